@@ -0,0 +1,285 @@
+// Copyright 2018 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+
+	"github.com/henrylee2cn/cfgo"
+	"github.com/henrylee2cn/erpc/v6"
+)
+
+// MetaCallerService the metadata key of the caller service name
+const MetaCallerService = "X-Caller-Service"
+
+type (
+	// ACLConfig service-to-service authorization policy config
+	// Note:
+	//  yaml tag is used for github.com/henrylee2cn/cfgo
+	//  json tag is used for github.com/xiaoenai/tp-micro/v6/configer
+	ACLConfig struct {
+		Enable          bool      `yaml:"enable"           json:"enable"`
+		DryRun          bool      `yaml:"dry_run"          json:"dry_run"`
+		RequireIdentity bool      `yaml:"require_identity" json:"require_identity"`
+		TrustedNetworks []string  `yaml:"trusted_networks" json:"trusted_networks"`
+		Public          []string  `yaml:"public"           json:"public"`
+		Rules           []ACLRule `yaml:"rules"            json:"rules"`
+		trustedNets     []*net.IPNet
+	}
+	// ACLRule allows the callers to call the URIs.
+	// Note:
+	//  A pattern ending with '*' matches by prefix, such as '/admin/*' or 'spiffe://example.org/ns/prod/*'.
+	ACLRule struct {
+		// Callers caller identity(SPIFFE ID or CN of the TLS certificate) or service name patterns
+		Callers []string `yaml:"callers" json:"callers"`
+		// Allow URI patterns
+		Allow []string `yaml:"allow"   json:"allow"`
+	}
+	// ACLPlugin a declarative service-to-service authorization plugin.
+	// Note:
+	//  If the peer identity is verified by mutual TLS, it is used as the caller;
+	//  otherwise, the service name in the metadata(MetaCallerService) is used only if RequireIdentity is false
+	//  and the peer comes from a trusted transport(unix socket or TrustedNetworks),
+	//  since it is declared by the caller itself.
+	ACLPlugin struct {
+		config atomic.Value // ACLConfig
+	}
+)
+
+var (
+	_ erpc.PostReadCallHeaderPlugin = new(ACLPlugin)
+	_ erpc.PostReadPushHeaderPlugin = new(ACLPlugin)
+)
+
+// Reload Bi-directionally synchronizes config between YAML file and memory.
+func (a *ACLConfig) Reload(bind cfgo.BindFunc) error {
+	err := bind()
+	if err != nil {
+		return err
+	}
+	return a.Check()
+}
+
+// Check check config.
+func (a *ACLConfig) Check() error {
+	a.trustedNets = nil
+	for _, cidr := range a.TrustedNetworks {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return fmt.Errorf("acl: invalid trusted network: %s", err.Error())
+		}
+		a.trustedNets = append(a.trustedNets, ipNet)
+	}
+	for _, pattern := range a.Public {
+		if len(pattern) == 0 {
+			return fmt.Errorf("acl: empty public URI pattern")
+		}
+	}
+	for i, rule := range a.Rules {
+		if len(rule.Callers) == 0 {
+			return fmt.Errorf("acl: rules[%d]: no callers", i)
+		}
+		for _, pattern := range rule.Callers {
+			if len(pattern) == 0 {
+				return fmt.Errorf("acl: rules[%d]: empty caller pattern", i)
+			}
+		}
+		for _, pattern := range rule.Allow {
+			if len(pattern) == 0 {
+				return fmt.Errorf("acl: rules[%d]: empty URI pattern", i)
+			}
+		}
+	}
+	return nil
+}
+
+// NewACLPlugin creates a service-to-service authorization plugin.
+func NewACLPlugin(cfg ACLConfig) (*ACLPlugin, error) {
+	a := new(ACLPlugin)
+	if err := a.Update(cfg); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+type aclYamlConfig struct {
+	ACLConfig `yaml:",inline"`
+	plugin    *ACLPlugin
+}
+
+func (a *aclYamlConfig) Reload(bind cfgo.BindFunc) error {
+	err := a.ACLConfig.Reload(bind)
+	if err != nil {
+		return err
+	}
+	return a.plugin.Update(a.ACLConfig)
+}
+
+// NewACLPluginFromYaml creates a service-to-service authorization plugin,
+// whose config is the section of the default cfgo YAML file, and is updated when cfgo reloads.
+// Note:
+//  The policy is enabled unless 'enable: false' is set explicitly, so that it denies by default.
+func NewACLPluginFromYaml(section string) *ACLPlugin {
+	a := new(ACLPlugin)
+	a.config.Store(ACLConfig{Enable: true})
+	cfgo.MustReg(section, &aclYamlConfig{
+		ACLConfig: ACLConfig{Enable: true},
+		plugin:    a,
+	})
+	return a
+}
+
+// Name returns name.
+func (a *ACLPlugin) Name() string {
+	return "acl"
+}
+
+// Config returns the current config.
+func (a *ACLPlugin) Config() ACLConfig {
+	return a.config.Load().(ACLConfig)
+}
+
+// Update checks and replaces the config.
+func (a *ACLPlugin) Update(cfg ACLConfig) error {
+	if err := cfg.Check(); err != nil {
+		return err
+	}
+	a.config.Store(cfg)
+	return nil
+}
+
+// MarshalJSON encodes the config, used for configer.
+func (a *ACLPlugin) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.Config())
+}
+
+// UnmarshalJSON decodes and updates the config, used for configer.
+// Note:
+//  The policy is enabled unless '"enable":false' is set explicitly.
+func (a *ACLPlugin) UnmarshalJSON(b []byte) error {
+	cfg := ACLConfig{Enable: true}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return err
+	}
+	return a.Update(cfg)
+}
+
+// Reload updates the config when it is changed in configer.
+// For example:
+//  configer.SyncNode(service, "acl", aclPlugin)
+func (a *ACLPlugin) Reload(b []byte) error {
+	return a.UnmarshalJSON(b)
+}
+
+// PostReadCallHeader authorizes the CALL.
+func (a *ACLPlugin) PostReadCallHeader(ctx erpc.ReadCtx) *erpc.Status {
+	return a.authorize(ctx)
+}
+
+// PostReadPushHeader authorizes the PUSH.
+func (a *ACLPlugin) PostReadPushHeader(ctx erpc.ReadCtx) *erpc.Status {
+	return a.authorize(ctx)
+}
+
+func (a *ACLPlugin) authorize(ctx erpc.ReadCtx) *erpc.Status {
+	cfg := a.Config()
+	if !cfg.Enable {
+		return nil
+	}
+	uri := ctx.ServiceMethod()
+	identity, verified := callerIdentity(ctx)
+	caller := identity
+	if !verified && !cfg.RequireIdentity && cfg.trusted(ctx.Session().RemoteAddr()) {
+		caller = string(ctx.PeekMeta(MetaCallerService))
+	}
+	if cfg.allowed(caller, uri) {
+		return nil
+	}
+	if cfg.DryRun {
+		erpc.Warnf("[%s] dry-run deny: caller(%q, verified:%v) -> %s", a.Name(), caller, verified, uri)
+		return nil
+	}
+	erpc.Debugf("[%s] deny: caller(%q, verified:%v) -> %s", a.Name(), caller, verified, uri)
+	return RerrForbidden.Copy(fmt.Sprintf("caller %q is not allowed to access %s", caller, uri))
+}
+
+// trusted returns whether the caller service name in the metadata from the address is trusted.
+func (a *ACLConfig) trusted(addr net.Addr) bool {
+	switch addr := addr.(type) {
+	case *net.UnixAddr:
+		return true
+	case *net.TCPAddr:
+		for _, ipNet := range a.trustedNets {
+			if ipNet.Contains(addr.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (a *ACLConfig) allowed(caller, uri string) bool {
+	if matchAnyPattern(a.Public, uri) {
+		return true
+	}
+	if len(caller) == 0 {
+		return false
+	}
+	for _, rule := range a.Rules {
+		if matchAnyPattern(rule.Callers, caller) && matchAnyPattern(rule.Allow, uri) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAnyPattern returns whether the name matches one of the patterns.
+// Note:
+//  A pattern ending with '*' matches by prefix.
+func matchAnyPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if pattern == name ||
+			strings.HasSuffix(pattern, "*") && strings.HasPrefix(name, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// callerServicePlugin sets the caller service name to the metadata of CALL and PUSH.
+type callerServicePlugin string
+
+var (
+	_ erpc.PreWriteCallPlugin = callerServicePlugin("")
+	_ erpc.PreWritePushPlugin = callerServicePlugin("")
+)
+
+func (c callerServicePlugin) Name() string {
+	return "caller-service"
+}
+
+func (c callerServicePlugin) PreWriteCall(ctx erpc.WriteCtx) *erpc.Status {
+	ctx.Output().Meta().Set(MetaCallerService, string(c))
+	return nil
+}
+
+func (c callerServicePlugin) PreWritePush(ctx erpc.WriteCtx) *erpc.Status {
+	ctx.Output().Meta().Set(MetaCallerService, string(c))
+	return nil
+}
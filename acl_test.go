@@ -0,0 +1,109 @@
+package micro
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+)
+
+type adminCall struct {
+	erpc.CallCtx
+}
+
+func (a *adminCall) Reset(arg *int) (int, *erpc.Status) {
+	return *arg, nil
+}
+
+func (a *adminCall) Ping(arg *int) (int, *erpc.Status) {
+	return *arg, nil
+}
+
+func TestACLPlugin(t *testing.T) {
+	acl, err := NewACLPlugin(ACLConfig{
+		Enable:          true,
+		TrustedNetworks: []string{"127.0.0.1/32"},
+		Public:          []string{"/admin_call/ping"},
+		Rules: []ACLRule{
+			{Callers: []string{"ops"}, Allow: []string{"/admin_call/*"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(SrvConfig{
+		ListenAddress:     "127.0.0.1:9102",
+		HttpListenAddress: "127.0.0.1:9104",
+	}, acl)
+	srv.RouteCall(new(adminCall))
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	ops := NewClient(CliConfig{ServiceName: "ops"}, NewStaticLinker("127.0.0.1:9102"))
+	defer ops.Close()
+	order := NewClient(CliConfig{ServiceName: "order"}, NewStaticLinker("127.0.0.1:9102"))
+	defer order.Close()
+
+	var reply int
+	if stat := ops.Call("/admin_call/reset", 1, &reply).Status(); !stat.OK() {
+		t.Fatalf("ops: %v", stat)
+	}
+	if stat := order.Call("/admin_call/ping", 1, &reply).Status(); !stat.OK() {
+		t.Fatalf("order public: %v", stat)
+	}
+	stat := order.Call("/admin_call/reset", 1, &reply).Status()
+	if stat.Code() != RerrForbidden.Code() {
+		t.Fatalf("order: expect forbidden, got %v", stat)
+	}
+
+	// the caller service name from the HTTP transcoding endpoint is dropped
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:9104/admin_call/reset?X-Caller-Service=ops", strings.NewReader("1"))
+	req.Header.Set(MetaCallerService, "ops")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 403 {
+		t.Fatalf("http: expect forbidden, got %d", resp.StatusCode)
+	}
+
+	// the caller service name from an untrusted network is ignored
+	cfg := acl.Config()
+	cfg.TrustedNetworks = []string{"10.0.0.0/8"}
+	if err = acl.Update(cfg); err != nil {
+		t.Fatal(err)
+	}
+	stat = ops.Call("/admin_call/reset", 1, &reply).Status()
+	if stat.Code() != RerrForbidden.Code() {
+		t.Fatalf("ops from untrusted network: expect forbidden, got %v", stat)
+	}
+
+	// enabled unless disabled explicitly
+	if err = acl.Reload([]byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if !acl.Config().Enable {
+		t.Fatal("expect enabled by default")
+	}
+	if err = acl.Reload([]byte(`{"enable":true,"trusted_networks":["bad"]}`)); err == nil {
+		t.Fatal("expect invalid trusted network error")
+	}
+
+	// dry-run only logs
+	if err = acl.Reload([]byte(`{"enable":true,"dry_run":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if stat := order.Call("/admin_call/reset", 1, &reply).Status(); !stat.OK() {
+		t.Fatalf("order dry-run: %v", stat)
+	}
+	if err = acl.Reload([]byte(`{"enable":true,"rules":[{"callers":[""]}]}`)); err == nil {
+		t.Fatal("expect invalid config error")
+	}
+	if !acl.Config().DryRun {
+		t.Fatal("invalid config should not be applied")
+	}
+}
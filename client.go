@@ -30,9 +30,13 @@ type (
 	//  ini tag is used for github.com/henrylee2cn/ini
 	CliConfig struct {
 		Network            string               `yaml:"network"                ini:"network"                comment:"Network; tcp, tcp4, tcp6, unix or unixpacket"`
+		ServiceName        string               `yaml:"service_name"           ini:"service_name"           comment:"Caller service name, sent in the metadata for the ACL of server; if empty, not sent"`
 		LocalIP            string               `yaml:"local_ip"               ini:"local_ip"               comment:"Local IP"`
 		TlsCertFile        string               `yaml:"tls_cert_file"          ini:"tls_cert_file"          comment:"TLS certificate file path"`
 		TlsKeyFile         string               `yaml:"tls_key_file"           ini:"tls_key_file"           comment:"TLS key file path"`
+		TlsCaFile          string               `yaml:"tls_ca_file"            ini:"tls_ca_file"            comment:"TLS CA bundle file path, used to verify server certificate; if empty, use the system roots"`
+		TlsAllowedPeers    []string             `yaml:"tls_allowed_peers"      ini:"-"                      comment:"Allowed server identities (URI SAN, DNS SAN or CN), a trailing '*' matches by prefix; if empty, allow all verified servers"`
+		TlsServerName      string               `yaml:"tls_server_name"        ini:"tls_server_name"        comment:"Server name used to verify server certificate; if empty, use the host of the dial address"`
 		DefaultSessionAge  time.Duration        `yaml:"default_session_age"    ini:"default_session_age"    comment:"Default session max age, if less than or equal to 0, no time limit; ns,µs,ms,s,m,h"`
 		DefaultContextAge  time.Duration        `yaml:"default_context_age"    ini:"default_context_age"    comment:"Default CALL or PUSH context max age, if less than or equal to 0, no time limit; ns,µs,ms,s,m,h"`
 		DefaultDialTimeout time.Duration        `yaml:"default_dial_timeout"   ini:"default_dial_timeout"   comment:"Default maximum duration for dialing; for client role; ns,µs,ms,s,m,h"`
@@ -86,6 +90,16 @@ func (c *CliConfig) Check() error {
 	return nil
 }
 
+func (c *CliConfig) tlsOptions() tlsOptions {
+	return tlsOptions{
+		certFile:     c.TlsCertFile,
+		keyFile:      c.TlsKeyFile,
+		caFile:       c.TlsCaFile,
+		allowedPeers: c.TlsAllowedPeers,
+		serverName:   c.TlsServerName,
+	}
+}
+
 func (c *CliConfig) peerConfig() erpc.PeerConfig {
 	return erpc.PeerConfig{
 		DefaultSessionAge: c.DefaultSessionAge,
@@ -124,11 +138,16 @@ func NewClient(cfg CliConfig, linker Linker, globalLeftPlugin ...erpc.Plugin) *C
 		globalLeftPlugin = append(globalLeftPlugin, heartbeatPing)
 	}
 	peer := erpc.NewPeer(cfg.peerConfig(), globalLeftPlugin...)
-	if len(cfg.TlsCertFile) > 0 && len(cfg.TlsKeyFile) > 0 {
-		err := peer.SetTLSConfigFromFile(cfg.TlsCertFile, cfg.TlsKeyFile)
+	if tlsOpts := cfg.tlsOptions(); tlsOpts.enabled() {
+		tlsConfig, err := newTLSConfig(tlsOpts)
 		if err != nil {
 			erpc.Fatalf("%v", err)
 		}
+		peer.SetTLSConfig(tlsConfig)
+		peer.PluginContainer().AppendRight(tlsIdentityPlugin{})
+	}
+	if len(cfg.ServiceName) > 0 {
+		peer.PluginContainer().AppendRight(callerServicePlugin(cfg.ServiceName))
 	}
 	cli := &Client{
 		peer:          peer,
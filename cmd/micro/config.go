@@ -0,0 +1,230 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/urfave/cli"
+	"github.com/xiaoenai/tp-micro/v6/micro/config"
+)
+
+// newConfigCommand creates the command that manages configs through the configer service.
+func newConfigCommand() cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "Manage the configs of the configer service",
+		Subcommands: []cli.Command{
+			{
+				Name:   "list",
+				Usage:  "List the config keys",
+				Flags:  configFlags(),
+				Before: initConfig,
+				Action: func(c *cli.Context) error {
+					config.List()
+					return nil
+				},
+			},
+			{
+				Name:      "get",
+				Usage:     "Print the config",
+				ArgsUsage: "{key}",
+				Flags:     configFlags(),
+				Before:    initConfig,
+				Action: func(c *cli.Context) error {
+					config.Get(configKey(c))
+					return nil
+				},
+			},
+			{
+				Name:      "edit",
+				Usage:     "Edit the config in $EDITOR, then validate and update it",
+				ArgsUsage: "{key}",
+				Flags:     configFlags(changeFlags...),
+				Before:    initConfig,
+				Action: func(c *cli.Context) error {
+					config.Edit(configKey(c), c.String("author"), c.String("comment"))
+					return nil
+				},
+			},
+			{
+				Name:      "update",
+				Usage:     "Update the config from the file",
+				ArgsUsage: "{key}",
+				Flags: configFlags(append(changeFlags, fileFlag, cli.Int64Flag{
+					Name:  "base, b",
+					Usage: "The revision that the file is based on, the update fails if the config has a newer one; 0 means no check",
+				})...),
+				Before: initConfig,
+				Action: func(c *cli.Context) error {
+					config.Update(configKey(c), configFile(c), c.String("author"), c.String("comment"), c.Int64("base"))
+					return nil
+				},
+			},
+			{
+				Name:      "validate",
+				Usage:     "Validate the config file against the JSON Schema",
+				ArgsUsage: "{key}",
+				Flags:     configFlags(fileFlag),
+				Before:    initConfig,
+				Action: func(c *cli.Context) error {
+					config.Validate(configKey(c), configFile(c))
+					return nil
+				},
+			},
+			{
+				Name:      "revisions",
+				Usage:     "List the revisions of the config, the newest first",
+				ArgsUsage: "{key}",
+				Flags: configFlags(cli.Int64Flag{
+					Name:  "limit, n",
+					Value: 20,
+					Usage: "The maximum number of the latest revisions, 0 means no limit",
+				}),
+				Before: initConfig,
+				Action: func(c *cli.Context) error {
+					config.Revisions(configKey(c), c.Int64("limit"))
+					return nil
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Print the changes between two revisions, the current config by default",
+				ArgsUsage: "{key} {from revision} [to revision]",
+				Flags:     configFlags(),
+				Before:    initConfig,
+				Action: func(c *cli.Context) error {
+					var to int64
+					if c.NArg() > 2 {
+						to = revisionArg(c, 2)
+					}
+					config.Diff(configKey(c), revisionArg(c, 1), to)
+					return nil
+				},
+			},
+			{
+				Name:      "rollback",
+				Usage:     "Roll back the config to the revision",
+				ArgsUsage: "{key} {revision}",
+				Flags:     configFlags(changeFlags...),
+				Before:    initConfig,
+				Action: func(c *cli.Context) error {
+					config.Rollback(configKey(c), revisionArg(c, 1), c.String("author"), c.String("comment"))
+					return nil
+				},
+			},
+			{
+				Name:      "events",
+				Usage:     "List the audit events of the config, the newest first",
+				ArgsUsage: "{key}",
+				Flags: configFlags(cli.Int64Flag{
+					Name:  "limit, n",
+					Value: 20,
+					Usage: "The maximum number of the latest events, 0 means no limit",
+				}),
+				Before: initConfig,
+				Action: func(c *cli.Context) error {
+					config.Events(configKey(c), c.Int64("limit"))
+					return nil
+				},
+			},
+			{
+				Name:      "watch",
+				Usage:     "Print the audit events of the configs, all configs by default",
+				ArgsUsage: "[key...]",
+				Flags:     configFlags(),
+				Before:    initConfig,
+				Action: func(c *cli.Context) error {
+					config.Watch(c.Args())
+					return nil
+				},
+			},
+			{
+				Name:  "console",
+				Usage: "Serve the web console of configs",
+				Flags: configFlags(cli.StringFlag{
+					Name:  "listen, l",
+					Value: "127.0.0.1:4041",
+					Usage: "The listen address of the web console",
+				}),
+				Before: initConfig,
+				Action: func(c *cli.Context) error {
+					config.Console(c.String("listen"))
+					return nil
+				},
+			},
+		},
+	}
+}
+
+var (
+	changeFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "author",
+			Usage: "Who changes the config, the caller identity or IP by default",
+		},
+		cli.StringFlag{
+			Name:  "comment, m",
+			Usage: "Why the config is changed",
+		},
+	}
+	fileFlag = cli.StringFlag{
+		Name:  "file, f",
+		Usage: "The JSON config file",
+	}
+)
+
+func configFlags(flags ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "addr, a",
+			Value: "127.0.0.1:4040",
+			Usage: "The address of the configer service",
+		},
+		cli.StringFlag{
+			Name:  "tls_cert",
+			Usage: "The TLS certificate file",
+		},
+		cli.StringFlag{
+			Name:  "tls_key",
+			Usage: "The TLS key file",
+		},
+		cli.StringFlag{
+			Name:  "tls_ca",
+			Usage: "The TLS CA file that verifies the configer service",
+		},
+	}, flags...)
+}
+
+func initConfig(c *cli.Context) error {
+	config.Init(config.Options{
+		Addr:        c.String("addr"),
+		TlsCertFile: c.String("tls_cert"),
+		TlsKeyFile:  c.String("tls_key"),
+		TlsCaFile:   c.String("tls_ca"),
+	})
+	return nil
+}
+
+func configKey(c *cli.Context) string {
+	key := c.Args().First()
+	if len(key) == 0 {
+		erpc.Fatalf("[micro] Missing config key")
+	}
+	return key
+}
+
+func configFile(c *cli.Context) string {
+	file := c.String("file")
+	if len(file) == 0 {
+		erpc.Fatalf("[micro] Missing config file, use -f")
+	}
+	return file
+}
+
+func revisionArg(c *cli.Context, i int) int64 {
+	rev, err := strconv.ParseInt(c.Args().Get(i), 10, 64)
+	if err != nil || rev <= 0 {
+		erpc.Fatalf("[micro] Invalid revision: %q", c.Args().Get(i))
+	}
+	return rev
+}
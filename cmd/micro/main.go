@@ -49,10 +49,18 @@ func main() {
 				Name:  "newdoc",
 				Usage: "Rebuild the README.md",
 			},
+			cli.StringFlag{
+				Name:  "dialect",
+				Usage: "The SQL dialect of the mysql models: mysql, postgres or sqlite (default: the last used, or mysql)",
+			},
+			cli.BoolFlag{
+				Name:  "drop",
+				Usage: "Drop the removed tables and columns in the migration, which are commented out by default",
+			},
 		},
 		Before: initProject,
 		Action: func(c *cli.Context) error {
-			create.CreateProject(c.Bool("force"), c.Bool("newdoc"))
+			create.CreateProject(c.Bool("force"), c.Bool("newdoc"), c.String("dialect"), c.Bool("drop"))
 			return nil
 		},
 	}
@@ -177,7 +185,7 @@ func main() {
 		},
 	}
 
-	app.Commands = []cli.Command{newCom, newdocCom, runCom, tplCom}
+	app.Commands = []cli.Command{newCom, newdocCom, runCom, tplCom, newConfigCommand(), newMigrateCommand()}
 	app.Run(os.Args)
 }
 
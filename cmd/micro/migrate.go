@@ -0,0 +1,146 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/henrylee2cn/erpc/v6"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/urfave/cli"
+	"github.com/xiaoenai/tp-micro/v6/micro/migrate"
+	"github.com/xiaoenai/tp-micro/v6/model/mysql"
+)
+
+// newMigrateCommand creates the command that manages the schema migrations of the SQL database.
+func newMigrateCommand() cli.Command {
+	return cli.Command{
+		Name:  "migrate",
+		Usage: "Manage the schema migrations of the SQL database",
+		Subcommands: []cli.Command{
+			{
+				Name:      "up",
+				Usage:     "Apply the pending migrations, all by default",
+				ArgsUsage: "[n]",
+				Flags:     migrateFlags(mysqlFlags...),
+				Before:    initMigrate(true),
+				Action: func(c *cli.Context) error {
+					migrate.Up(countArg(c, 0))
+					return nil
+				},
+			},
+			{
+				Name:      "down",
+				Usage:     "Revert the last applied migrations, one by default",
+				ArgsUsage: "[n]",
+				Flags:     migrateFlags(mysqlFlags...),
+				Before:    initMigrate(true),
+				Action: func(c *cli.Context) error {
+					migrate.Down(countArg(c, 1))
+					return nil
+				},
+			},
+			{
+				Name:   "status",
+				Usage:  "List the migrations and whether they are applied",
+				Flags:  migrateFlags(mysqlFlags...),
+				Before: initMigrate(true),
+				Action: func(c *cli.Context) error {
+					migrate.Status()
+					return nil
+				},
+			},
+			{
+				Name:      "create",
+				Usage:     "Create the empty up and down files of a new migration",
+				ArgsUsage: "{name}",
+				Flags:     migrateFlags(),
+				Before:    initMigrate(false),
+				Action: func(c *cli.Context) error {
+					name := c.Args().First()
+					if len(name) == 0 {
+						erpc.Fatalf("[micro] Missing migration name")
+					}
+					migrate.Create(name)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+var mysqlFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "dialect",
+		Value: "mysql",
+		Usage: "SQL dialect, [mysql, postgres, sqlite]",
+	},
+	cli.StringFlag{
+		Name:  "host",
+		Value: "localhost",
+		Usage: "database host ip",
+	},
+	cli.IntFlag{
+		Name:  "port",
+		Value: 0,
+		Usage: "database host port, the dialect's default if 0",
+	},
+	cli.StringFlag{
+		Name:  "username, user",
+		Value: "root",
+		Usage: "database username",
+	},
+	cli.StringFlag{
+		Name:  "password, pwd",
+		Value: "",
+		Usage: "database password",
+	},
+	cli.StringFlag{
+		Name:  "db",
+		Value: "test",
+		Usage: "database name, the file path for sqlite",
+	},
+	cli.StringFlag{
+		Name:  "ssl_mode",
+		Value: "",
+		Usage: "ssl mode of postgres, [disable, require, verify-ca, verify-full], require by default",
+	},
+}
+
+func migrateFlags(flags ...cli.Flag) []cli.Flag {
+	return append([]cli.Flag{
+		cli.StringFlag{
+			Name:  "dir, d",
+			Value: "migrations",
+			Usage: "The directory of the migration files",
+		},
+	}, flags...)
+}
+
+func initMigrate(connect bool) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		opts := migrate.Options{Dir: c.String("dir")}
+		if connect {
+			opts.Mysql = mysql.NewConfig()
+			opts.Mysql.Dialect = c.String("dialect")
+			opts.Mysql.Host = c.String("host")
+			opts.Mysql.Port = c.Int("port")
+			opts.Mysql.Username = c.String("username")
+			opts.Mysql.Password = c.String("password")
+			opts.Mysql.Database = c.String("db")
+			opts.Mysql.SSLMode = c.String("ssl_mode")
+		}
+		migrate.Init(opts)
+		return nil
+	}
+}
+
+func countArg(c *cli.Context, defaultCount int) int {
+	if c.NArg() == 0 {
+		return defaultCount
+	}
+	n, err := strconv.Atoi(c.Args().First())
+	if err != nil || n <= 0 {
+		erpc.Fatalf("[micro] Invalid count: %q", c.Args().First())
+	}
+	return n
+}
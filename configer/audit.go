@@ -0,0 +1,246 @@
+package configer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/xiaoenai/tp-micro/v6/model/etcd"
+)
+
+const (
+	// AUDIT_KEY_PREFIX the prifix of config audit event key in etcd
+	AUDIT_KEY_PREFIX = "MICRO-CONF-AUDIT"
+	// EventPushPath the PUSH path of the config events sent by Watch,
+	// which is handled by a PUSH function named 'CfgEvent' on the client.
+	EventPushPath = "/cfg_event"
+)
+
+// Event actions
+const (
+	ActionUpdate   = "update"
+	ActionRollback = "rollback"
+	ActionCanary   = "canary"
+	ActionPromote  = "promote"
+	ActionAbort    = "abort"
+	ActionOverlay  = "overlay"
+	ActionRestore  = "restore"
+)
+
+// NewAuditKey creates a config audit event key from the config data key.
+func NewAuditKey(key, id string) string {
+	return auditKeyPrefix(key) + id
+}
+
+func auditKeyPrefix(key string) string {
+	return AUDIT_KEY_PREFIX + strings.TrimPrefix(key, KEY_PREFIX) + "@"
+}
+
+// Event a config change event, which is recorded in the same transaction as the change
+type Event struct {
+	// ID the nanosecond timestamp, which is unique for the config key
+	ID     string `json:"id"`
+	Key    string `json:"key"`
+	Action string `json:"action"`
+	// Revision the new config revision of update, rollback and promote
+	Revision int64 `json:"revision,omitempty"`
+	// Layer the overlay layer
+	Layer string `json:"layer,omitempty"`
+	// Name the overlay name
+	Name string `json:"name,omitempty"`
+	// Actor the caller identity or IP, which can be customized by SetActorResolver
+	Actor string `json:"actor"`
+	// Author the author given by the caller
+	Author  string `json:"author,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	// Changes the changed fields, the encrypted values are masked
+	Changes []*Change `json:"changes,omitempty"`
+	// Text the readable summary, which can be posted to the chat webhooks directly
+	Text string    `json:"text"`
+	Time time.Time `json:"time"`
+}
+
+// String returns the encoding string
+func (e *Event) String() string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+// setChanges sets the masked changes between the two configs, and the summary text.
+func (e *Event) setChanges(oldConfig, newConfig string) {
+	changes, err := DiffConfig(oldConfig, newConfig)
+	if err != nil {
+		erpc.Warnf("Diff configuration failed: %s: %s", e.Key, err.Error())
+	}
+	for _, change := range changes {
+		change.Old = json.RawMessage(MaskConfig(string(change.Old)))
+		change.New = json.RawMessage(MaskConfig(string(change.New)))
+	}
+	e.Changes = changes
+	e.Text = e.summary()
+}
+
+func (e *Event) summary() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s %s", e.Actor, e.Action, e.Key)
+	if len(e.Layer) > 0 {
+		fmt.Fprintf(&buf, " (%s %s)", e.Layer, e.Name)
+	}
+	if e.Revision > 0 {
+		fmt.Fprintf(&buf, " to revision %d", e.Revision)
+	}
+	if len(e.Changes) > 0 {
+		paths := make([]string, 0, len(e.Changes))
+		for i, change := range e.Changes {
+			if i == 5 {
+				paths = append(paths, "...")
+				break
+			}
+			if change.Path == "" {
+				paths = append(paths, "(root)")
+			} else {
+				paths = append(paths, change.Path)
+			}
+		}
+		fmt.Fprintf(&buf, ", %d changes: %s", len(e.Changes), strings.Join(paths, ", "))
+	}
+	if len(e.Comment) > 0 {
+		fmt.Fprintf(&buf, ", comment: %s", e.Comment)
+	}
+	return buf.String()
+}
+
+// putOp returns the operation that records the event, and its comparison.
+func (e *Event) putOp() (etcd.Cmp, etcd.Op) {
+	e.Time = time.Now()
+	e.ID = fmt.Sprintf("%019d", e.Time.UnixNano())
+	auditKey := NewAuditKey(e.Key, e.ID)
+	return etcd.Compare(etcd.CreateRevision(auditKey), "=", 0), etcd.OpPut(auditKey, e.String())
+}
+
+// listEvents returns the latest events of the config, the newest first.
+// Note:
+//  If limit<=0, returns all events.
+func listEvents(etcdClient *etcd.Client, key string, limit int64) ([]*Event, error) {
+	opts := []etcd.OpOption{etcd.WithPrefix(), etcd.WithSort(etcd.SortByKey, etcd.SortDescend)}
+	if limit > 0 {
+		opts = append(opts, etcd.WithLimit(limit))
+	}
+	resp, err := etcdClient.Get(context.TODO(), auditKeyPrefix(key), opts...)
+	if err != nil {
+		return nil, err
+	}
+	var events = make([]*Event, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		e := new(Event)
+		if err = json.Unmarshal(kv.Value, e); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// watchEvents calls fn with the events of the configs until the context is done.
+// Note:
+//  If keys is empty, watches all configs.
+func watchEvents(ctx context.Context, etcdClient *etcd.Client, keys []string, fn func(*Event)) {
+	prefixes := []string{AUDIT_KEY_PREFIX + "@"}
+	if len(keys) > 0 {
+		prefixes = prefixes[:0]
+		for _, key := range keys {
+			prefixes = append(prefixes, auditKeyPrefix(key))
+		}
+	}
+	for _, prefix := range prefixes {
+		go func(prefix string) {
+			for resp := range etcdClient.Watch(ctx, prefix, etcd.WithPrefix()) {
+				for _, ev := range resp.Events {
+					if ev.Type != etcd.EventTypePut {
+						continue
+					}
+					e := new(Event)
+					if err := json.Unmarshal(ev.Kv.Value, e); err != nil {
+						erpc.Warnf("Decode configuration event failed: %s: %s", ev.Kv.Key, err.Error())
+						continue
+					}
+					fn(e)
+				}
+			}
+		}(prefix)
+	}
+}
+
+// Webhook a webhook that the config events are posted to as JSON
+type Webhook struct {
+	URL string
+	// Filter selects the events to post; if nil, posts all
+	Filter func(*Event) bool
+}
+
+var webhooks = struct {
+	list []*Webhook
+	mu   sync.RWMutex
+}{}
+
+// webhookClient the HTTP client that posts the events
+var webhookClient = &http.Client{Timeout: 5 * time.Second}
+
+// webhookRetryInterval the interval of retrying a failed webhook post, which is doubled after each failure
+var webhookRetryInterval = time.Second
+
+const maxWebhookTries = 3
+
+// AddWebhook adds a webhook that the config events are posted to.
+// For example, notify the chat when the production config changes:
+//  configer.AddWebhook(chatWebhookURL, func(e *configer.Event) bool {
+//  	return strings.HasSuffix(e.Key, "@prod") || e.Layer == configer.OverlayEnv && e.Name == "prod"
+//  })
+// Note:
+//  The events are posted asynchronously by the config manager that makes the change, and retried on failure;
+//  The body has a 'text' field, so it is compatible with most chat webhooks.
+func AddWebhook(url string, filter func(*Event) bool) {
+	webhooks.mu.Lock()
+	webhooks.list = append(webhooks.list, &Webhook{URL: url, Filter: filter})
+	webhooks.mu.Unlock()
+}
+
+// publish posts the event to the webhooks.
+func publish(e *Event) {
+	webhooks.mu.RLock()
+	list := webhooks.list
+	webhooks.mu.RUnlock()
+	for _, w := range list {
+		if w.Filter == nil || w.Filter(e) {
+			go w.post(e)
+		}
+	}
+}
+
+func (w *Webhook) post(e *Event) {
+	body := []byte(e.String())
+	interval := webhookRetryInterval
+	var err error
+	for i := 0; i < maxWebhookTries; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+			interval *= 2
+		}
+		var resp *http.Response
+		resp, err = webhookClient.Post(w.URL, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 300 {
+				return
+			}
+			err = fmt.Errorf("status code %d", resp.StatusCode)
+		}
+	}
+	erpc.Warnf("Post configuration event to webhook failed: %s: %s: %s", w.URL, e.Text, err.Error())
+}
@@ -0,0 +1,89 @@
+package configer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEventSummary(t *testing.T) {
+	e := &Event{
+		Key:      NewKey("svc", "prod"),
+		Action:   ActionUpdate,
+		Actor:    "spiffe://example.org/ops",
+		Revision: 3,
+		Comment:  "raise the pool",
+	}
+	e.setChanges(`{"pool":10,"password":"ENC[v1,k1,AAAA]"}`, `{"pool":20,"password":"ENC[v1,k1,BBBB]","debug":true}`)
+	if len(e.Changes) != 3 {
+		t.Fatalf("unexpected changes: %s", e.String())
+	}
+	for _, c := range e.Changes {
+		if strings.Contains(string(c.Old)+string(c.New), "ENC[") {
+			t.Fatalf("encrypted value is not masked: %s", e.String())
+		}
+	}
+	const text = "spiffe://example.org/ops update MICRO-CONF@svc@prod to revision 3, 3 changes: debug, password, pool, comment: raise the pool"
+	if e.Text != text {
+		t.Fatalf("unexpected text: %s", e.Text)
+	}
+
+	// the first config replaces the root
+	root := &Event{Key: NewKey("svc", "prod"), Action: ActionUpdate, Actor: "10.0.0.1"}
+	root.setChanges("", `{"pool":10}`)
+	if root.Text != "10.0.0.1 update MICRO-CONF@svc@prod, 1 changes: (root)" {
+		t.Fatalf("unexpected text: %s", root.Text)
+	}
+
+	_, op := e.putOp()
+	if !op.IsPut() || string(op.KeyBytes()) != "MICRO-CONF-AUDIT@svc@prod@"+e.ID || len(e.ID) != 19 {
+		t.Fatalf("unexpected audit key: %s", op.KeyBytes())
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	var tries int32
+	received := make(chan *Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&tries, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		e := new(Event)
+		if err := json.Unmarshal(b, e); err != nil {
+			t.Error(err)
+		}
+		received <- e
+	}))
+	defer srv.Close()
+
+	interval := webhookRetryInterval
+	webhookRetryInterval = 10 * time.Millisecond
+	defer func() {
+		webhookRetryInterval = interval
+		webhooks.list = nil
+	}()
+	AddWebhook(srv.URL, func(e *Event) bool {
+		return e.Layer == OverlayEnv && e.Name == "prod"
+	})
+
+	publish(&Event{Key: NewKey("svc", "v1"), Action: ActionOverlay, Layer: OverlayEnv, Name: "test"})
+	publish(&Event{Key: NewKey("svc", "v1"), Action: ActionOverlay, Layer: OverlayEnv, Name: "prod", Text: "prod changed"})
+	select {
+	case e := <-received:
+		if e.Name != "prod" || e.Text != "prod changed" {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook is not posted")
+	}
+	if n := atomic.LoadInt32(&tries); n != 2 {
+		t.Fatalf("expect 2 tries, got %d", n)
+	}
+}
@@ -0,0 +1,168 @@
+package configer
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// CANARY_KEY_PREFIX the prifix of config canary key in etcd
+	CANARY_KEY_PREFIX = "MICRO-CONF-CANARY"
+	// CANARY_STATUS_KEY_PREFIX the prifix of config canary status key of instance in etcd
+	CANARY_STATUS_KEY_PREFIX = "MICRO-CONF-CANARY-STATUS"
+	// OVERRIDE_KEY_PREFIX the prifix of config override key of instance in etcd
+	OVERRIDE_KEY_PREFIX = "MICRO-CONF-OVERRIDE"
+)
+
+// NewCanaryKey creates a config canary key from the config data key.
+func NewCanaryKey(key string) string {
+	return CANARY_KEY_PREFIX + strings.TrimPrefix(key, KEY_PREFIX)
+}
+
+// NewCanaryStatusKey creates a config canary status key of the instance from the config data key.
+func NewCanaryStatusKey(key, addr string) string {
+	return canaryStatusKeyPrefix(key) + addr
+}
+
+func canaryStatusKeyPrefix(key string) string {
+	return CANARY_STATUS_KEY_PREFIX + strings.TrimPrefix(key, KEY_PREFIX) + "@"
+}
+
+// NewOverrideKey creates a config override key of the instance from the config data key.
+func NewOverrideKey(key, addr string) string {
+	return OVERRIDE_KEY_PREFIX + strings.TrimPrefix(key, KEY_PREFIX) + "@" + addr
+}
+
+var instance = struct {
+	addr    string
+	labels  map[string]string
+	env     string
+	cluster string
+	mu      sync.RWMutex
+}{
+	addr:    defaultInstanceAddr(),
+	env:     os.Getenv("MICRO_ENV"),
+	cluster: os.Getenv("MICRO_CLUSTER"),
+}
+
+func defaultInstanceAddr() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// SetInstance sets the address and labels of the current instance,
+// which are used to select the canary config and the instance overlay.
+// Note:
+//  It should be called before SyncNode;
+//  The default address is 'hostname:pid'.
+func SetInstance(addr string, labels map[string]string) {
+	instance.mu.Lock()
+	defer instance.mu.Unlock()
+	if len(addr) > 0 {
+		instance.addr = addr
+	}
+	instance.labels = labels
+}
+
+func instanceInfo() (string, map[string]string) {
+	instance.mu.RLock()
+	defer instance.mu.RUnlock()
+	return instance.addr, instance.labels
+}
+
+// Canary a config change that is rolled out to the selected instances first
+type Canary struct {
+	ID     string `json:"id"`
+	Config string `json:"config"`
+	// Addrs the selected instance addresses
+	Addrs []string `json:"addrs,omitempty"`
+	// Labels the selected instances have all of the labels
+	Labels map[string]string `json:"labels,omitempty"`
+	// Percentage the percentage of the selected instances, which are chosen by the hash of address
+	Percentage int       `json:"percentage,omitempty"`
+	Author     string    `json:"author"`
+	Comment    string    `json:"comment"`
+	Time       time.Time `json:"time"`
+}
+
+// String returns the encoding string
+func (c *Canary) String() string {
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// Selected returns whether the instance of the config is selected.
+func (c *Canary) Selected(key, addr string, labels map[string]string) bool {
+	for _, a := range c.Addrs {
+		if a == addr {
+			return true
+		}
+	}
+	if len(c.Labels) > 0 {
+		matched := true
+		for k, v := range c.Labels {
+			if labels[k] != v {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return c.Percentage > 0 && int(crc32.ChecksumIEEE([]byte(key+"@"+addr))%100) < c.Percentage
+}
+
+// CanaryStatus the status of the instance that applies the canary config
+type CanaryStatus struct {
+	ID    string    `json:"id"`
+	Addr  string    `json:"addr"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// String returns the encoding string
+func (c *CanaryStatus) String() string {
+	b, _ := json.Marshal(c)
+	return string(b)
+}
+
+// MergeConfig deep-merges the JSON object configs in order, the later one takes precedence.
+// Note:
+//  Only the objects are merged, the other values are replaced.
+func MergeConfig(configs ...string) (string, error) {
+	var merged interface{}
+	for _, config := range configs {
+		if len(config) == 0 {
+			continue
+		}
+		v, err := decodeJSON(config)
+		if err != nil {
+			return "", err
+		}
+		merged = mergeValue(merged, v)
+	}
+	b, err := json.Marshal(merged)
+	return string(b), err
+}
+
+func mergeValue(dst, src interface{}) interface{} {
+	d, ok := dst.(map[string]interface{})
+	if !ok {
+		return src
+	}
+	s, ok := src.(map[string]interface{})
+	if !ok {
+		return src
+	}
+	for k, v := range s {
+		d[k] = mergeValue(d[k], v)
+	}
+	return d
+}
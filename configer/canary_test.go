@@ -0,0 +1,260 @@
+package configer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/xiaoenai/tp-micro/v6/model/etcd"
+)
+
+func TestCanarySelected(t *testing.T) {
+	key := NewKey("test", "1.0")
+	c := &Canary{
+		Addrs:  []string{"10.0.0.1:8080"},
+		Labels: map[string]string{"zone": "a", "role": "canary"},
+	}
+	if !c.Selected(key, "10.0.0.1:8080", nil) {
+		t.Fatal("expect selected by address")
+	}
+	if !c.Selected(key, "10.0.0.2:8080", map[string]string{"zone": "a", "role": "canary", "x": "y"}) {
+		t.Fatal("expect selected by labels")
+	}
+	if c.Selected(key, "10.0.0.2:8080", map[string]string{"zone": "a"}) {
+		t.Fatal("expect not selected")
+	}
+	var selected int
+	c = &Canary{Percentage: 30}
+	for i := 0; i < 1000; i++ {
+		if c.Selected(key, fmt.Sprintf("10.0.%d.%d:8080", i/256, i%256), nil) {
+			selected++
+		}
+	}
+	if selected < 200 || selected > 400 {
+		t.Fatalf("selected %d of 1000 instances, expect about 30%%", selected)
+	}
+}
+
+func TestMergeConfig(t *testing.T) {
+	merged, err := MergeConfig(
+		`{"mysql":{"host":"a","port":3306},"endpoints":["x"],"id":9007199254740993}`,
+		`{"mysql":{"host":"b"},"endpoints":["y"]}`,
+		``,
+		`{"debug":true}`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"debug":true,"endpoints":["y"],"id":9007199254740993,"mysql":{"host":"b","port":3306}}`
+	if merged != expect {
+		t.Fatalf("merged: %s, expect: %s", merged, expect)
+	}
+}
+
+func TestOverrideLayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	cfg := new(testConfig)
+	n := &Node{
+		key:      NewKey("test", "1.0"),
+		object:   cfg,
+		doInitCh: make(chan error, 1),
+		nodes:    &Nodes{nodeMap: map[string]*Node{}},
+	}
+	if err = n.bind([]byte(`{"config":"{\"name\":\"base\"}","initialized":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err = n.bindOverride([]byte(`{"config":"{\"name\":\"override\"}","initialized":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "override" {
+		t.Fatalf("name: %s, expect: override", cfg.Name)
+	}
+	if err = n.bind([]byte(`{"config":"{\"name\":\"base2\"}","initialized":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "override" {
+		t.Fatalf("name: %s, expect: override", cfg.Name)
+	}
+	if err = n.bindOverride(nil); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "base2" {
+		t.Fatalf("name: %s, expect: base2", cfg.Name)
+	}
+}
+
+func TestPromote(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e := startTestEtcd(t, dir)
+	defer e.Close()
+	etcdClient, err := etcd.NewClient(etcd.Config{Endpoints: []string{testEtcdEndpoint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcdClient.Close()
+	InitMgr(etcdClient)
+	// NOTE: The actor is resolved without a caller session.
+	SetActorResolver(func(erpc.CallCtx) string { return "tester" })
+	defer SetActorResolver(nil)
+
+	key := NewKey("test", "1.0")
+	c := new(cfg)
+	if _, stat := c.Update(&ConfigKV{Key: key, Value: `{"name":"base"}`, Author: "test"}); !stat.OK() {
+		t.Fatal(stat)
+	}
+	canary, stat := c.Canary(&CanaryArgs{Key: key, Value: `{"name":"canary"}`, Addrs: []string{"10.0.0.1:8080", "10.0.0.2:8080"}, Author: "test"})
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	putStatus := func(addr, id string, ok bool) {
+		status := &CanaryStatus{ID: id, Addr: addr, OK: ok, Time: time.Now()}
+		if _, err := etcdClient.Put(context.TODO(), NewCanaryStatusKey(key, addr), status.String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	promote := func() *erpc.Status {
+		_, stat := c.Promote(&PromoteArgs{Key: key, Author: "test"})
+		return stat
+	}
+
+	// no instance applied the canary
+	if stat = promote(); stat.Code() != statCanaryUnhealthy.Code() {
+		t.Fatalf("promote without instances: %v", stat)
+	}
+	// the status of the other canary is ignored
+	putStatus("10.0.0.1:8080", "other", true)
+	if stat = promote(); stat.Code() != statCanaryUnhealthy.Code() {
+		t.Fatalf("promote with the other canary: %v", stat)
+	}
+	// one of the instances failed to apply it
+	putStatus("10.0.0.1:8080", canary.ID, true)
+	putStatus("10.0.0.2:8080", canary.ID, false)
+	if stat = promote(); stat.Code() != statCanaryUnhealthy.Code() {
+		t.Fatalf("promote with an unhealthy instance: %v", stat)
+	}
+	if config, _ := getConfig(key); config != `{"name":"base"}` {
+		t.Fatalf("config: %s, expect: {\"name\":\"base\"}", config)
+	}
+
+	// all of the instances applied it
+	putStatus("10.0.0.2:8080", canary.ID, true)
+	rev, stat := c.Promote(&PromoteArgs{Key: key, Author: "test"})
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if rev.Revision != 2 {
+		t.Fatalf("revision: %d, expect: 2", rev.Revision)
+	}
+	if config, _ := getConfig(key); config != `{"name":"canary"}` {
+		t.Fatalf("config: %s, expect: {\"name\":\"canary\"}", config)
+	}
+	if _, _, stat = loadCanary(key); stat != statCanaryNotFound {
+		t.Fatalf("the canary is not ended: %v", stat)
+	}
+	events, err := listEvents(etcdClient, key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Action != ActionPromote || events[0].Revision != 2 {
+		t.Fatalf("events: %v", events)
+	}
+
+	// force promotes the unhealthy canary
+	if _, stat = c.Canary(&CanaryArgs{Key: key, Value: `{"name":"forced"}`, Percentage: 10, Author: "test"}); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if stat = promote(); stat.Code() != statCanaryUnhealthy.Code() {
+		t.Fatalf("promote without instances: %v", stat)
+	}
+	if _, stat = c.Promote(&PromoteArgs{Key: key, Force: true, Author: "test"}); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if config, _ := getConfig(key); config != `{"name":"forced"}` {
+		t.Fatalf("config: %s, expect: {\"name\":\"forced\"}", config)
+	}
+}
+
+func TestWatchOverride(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+	e := startTestEtcd(t, dir+"/etcd")
+	defer e.Close()
+	etcdClient, err := etcd.NewClient(etcd.Config{Endpoints: []string{testEtcdEndpoint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcdClient.Close()
+	InitMgr(etcdClient)
+	SetActorResolver(func(erpc.CallCtx) string { return "tester" })
+	defer SetActorResolver(nil)
+
+	addr, labels := instanceInfo()
+	defer SetInstance(addr, labels)
+	SetInstance("10.0.0.1:8080", nil)
+	key := NewKey("test", "1.0")
+	c := new(cfg)
+	if _, stat := c.Update(&ConfigKV{Key: key, Value: `{"name":"base"}`, Author: "test"}); !stat.OK() {
+		t.Fatal(stat)
+	}
+	InitNode(etcdClient)
+	defer CloseNode()
+	conf := new(testConfig)
+	SyncNode("test", "1.0", conf)
+	waitName := func(name string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		for conf.get() != name {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("name: %s, expect: %s", conf.get(), name)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	// the override of the other instance is not applied
+	if _, stat := c.Override(&OverrideArgs{Key: key, Addr: "10.0.0.2:8080", Value: `{"name":"other"}`}); !stat.OK() {
+		t.Fatal(stat)
+	}
+	if _, stat := c.Override(&OverrideArgs{Key: key, Addr: "10.0.0.1:8080", Value: `{"name":"override"}`}); !stat.OK() {
+		t.Fatal(stat)
+	}
+	waitName("override")
+
+	// the override takes precedence over the updated base
+	if _, stat := c.Update(&ConfigKV{Key: key, Value: `{"name":"updated"}`, Author: "test"}); !stat.OK() {
+		t.Fatal(stat)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if conf.get() != "override" {
+		t.Fatalf("name: %s, expect: override", conf.get())
+	}
+
+	// the base is applied after deleting the override
+	if _, stat := c.Override(&OverrideArgs{Key: key, Addr: "10.0.0.1:8080"}); !stat.OK() {
+		t.Fatal(stat)
+	}
+	waitName("updated")
+}
@@ -0,0 +1,242 @@
+package configer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xiaoenai/tp-micro/v6/model/etcd"
+)
+
+const (
+	// REVISION_KEY_PREFIX the prifix of config revision key in etcd
+	REVISION_KEY_PREFIX = "MICRO-CONF-REV"
+	// maxPutRetries the maximum times of retrying a conflicted revision write
+	maxPutRetries = 10
+)
+
+// NewRevisionKey creates a config revision key from the config data key.
+func NewRevisionKey(key string, revision int64) string {
+	return revisionKeyPrefix(key) + fmt.Sprintf("%010d", revision)
+}
+
+func revisionKeyPrefix(key string) string {
+	return REVISION_KEY_PREFIX + strings.TrimPrefix(key, KEY_PREFIX) + "@"
+}
+
+// Revision a versioned config revision
+type Revision struct {
+	Revision int64     `json:"revision"`
+	Config   string    `json:"config,omitempty"`
+	Author   string    `json:"author"`
+	Comment  string    `json:"comment"`
+	Time     time.Time `json:"time"`
+}
+
+// String returns the encoding string
+func (r *Revision) String() string {
+	b, _ := json.Marshal(r)
+	return string(b)
+}
+
+// errRevisionConflict the config has a newer revision than the expected base revision
+var errRevisionConflict = errors.New("config has a newer revision")
+
+// putRevision atomically writes the config and a new revision of it,
+// together with the audit event if not nil, and the extra comparisons and operations.
+// Note:
+//  If base>0, it fails with errRevisionConflict when the latest revision is not base.
+func putRevision(etcdClient *etcd.Client, key, config, author, comment string, base int64, event *Event, cmps []etcd.Cmp, ops ...etcd.Op) (*Revision, error) {
+	revPrefix := revisionKeyPrefix(key)
+	for i := 0; i < maxPutRetries; i++ {
+		resp, err := etcdClient.Get(context.TODO(), key)
+		if err != nil {
+			return nil, err
+		}
+		lastResp, err := etcdClient.Get(context.TODO(), revPrefix, append(etcd.WithLastKey(), etcd.WithKeysOnly())...)
+		if err != nil {
+			return nil, err
+		}
+		var rev = &Revision{
+			Revision: 1,
+			Config:   config,
+			Author:   author,
+			Comment:  comment,
+			Time:     time.Now(),
+		}
+		if len(lastResp.Kvs) > 0 {
+			fmt.Sscanf(strings.TrimPrefix(string(lastResp.Kvs[0].Key), revPrefix), "%d", &rev.Revision)
+			rev.Revision++
+		}
+		// NOTE: The comparison of the new revision key ensures that base is still the latest one.
+		if base > 0 && rev.Revision != base+1 {
+			return nil, errRevisionConflict
+		}
+		var cmp etcd.Cmp
+		if len(resp.Kvs) == 0 {
+			cmp = etcd.Compare(etcd.CreateRevision(key), "=", 0)
+		} else {
+			cmp = etcd.Compare(etcd.ModRevision(key), "=", resp.Kvs[0].ModRevision)
+		}
+		revKey := NewRevisionKey(key, rev.Revision)
+		txnCmps := append([]etcd.Cmp{cmp, etcd.Compare(etcd.CreateRevision(revKey), "=", 0)}, cmps...)
+		txnOps := append([]etcd.Op{
+			etcd.OpPut(key, (&Node{Initialized: true, Config: config}).String()),
+			etcd.OpPut(revKey, rev.String()),
+		}, ops...)
+		if event != nil {
+			var oldConfig string
+			if len(resp.Kvs) > 0 {
+				n := new(Node)
+				json.Unmarshal(resp.Kvs[0].Value, n)
+				oldConfig = n.Config
+			}
+			event.Revision = rev.Revision
+			event.setChanges(oldConfig, config)
+			eventCmp, eventOp := event.putOp()
+			txnCmps = append(txnCmps, eventCmp)
+			txnOps = append(txnOps, eventOp)
+		}
+		txnResp, err := etcdClient.Txn(context.TODO()).If(txnCmps...).Then(txnOps...).Commit()
+		if err != nil {
+			return nil, err
+		}
+		if txnResp.Succeeded {
+			return rev, nil
+		}
+	}
+	return nil, fmt.Errorf("config is modified concurrently: %s", key)
+}
+
+// getRevision returns the revision of the config, or nil if not exist.
+func getRevision(etcdClient *etcd.Client, key string, revision int64) (*Revision, error) {
+	resp, err := etcdClient.Get(context.TODO(), NewRevisionKey(key, revision))
+	if err != nil || len(resp.Kvs) == 0 {
+		return nil, err
+	}
+	rev := new(Revision)
+	err = json.Unmarshal(resp.Kvs[0].Value, rev)
+	return rev, err
+}
+
+// listRevisions returns the latest revisions of the config without config content, the newest first.
+// Note:
+//  If limit<=0, returns all revisions.
+func listRevisions(etcdClient *etcd.Client, key string, limit int64) ([]*Revision, error) {
+	opts := []etcd.OpOption{etcd.WithPrefix(), etcd.WithSort(etcd.SortByKey, etcd.SortDescend)}
+	if limit > 0 {
+		opts = append(opts, etcd.WithLimit(limit))
+	}
+	resp, err := etcdClient.Get(context.TODO(), revisionKeyPrefix(key), opts...)
+	if err != nil {
+		return nil, err
+	}
+	var revs = make([]*Revision, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		rev := new(Revision)
+		if err = json.Unmarshal(kv.Value, rev); err != nil {
+			return nil, err
+		}
+		rev.Config = ""
+		revs = append(revs, rev)
+	}
+	return revs, nil
+}
+
+// Change a changed field between two configs
+type Change struct {
+	// Path the JSON path of the field, such as 'mysql.host' or 'endpoints[0]'
+	Path string `json:"path"`
+	// Op add, remove or modify
+	Op  string          `json:"op"`
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// Change operations
+const (
+	ChangeAdd    = "add"
+	ChangeRemove = "remove"
+	ChangeModify = "modify"
+)
+
+// DiffConfig compares two JSON configs field by field.
+func DiffConfig(oldConfig, newConfig string) ([]*Change, error) {
+	var oldVal, newVal interface{}
+	if len(oldConfig) > 0 {
+		if err := json.Unmarshal([]byte(oldConfig), &oldVal); err != nil {
+			return nil, err
+		}
+	}
+	if len(newConfig) > 0 {
+		if err := json.Unmarshal([]byte(newConfig), &newVal); err != nil {
+			return nil, err
+		}
+	}
+	var changes []*Change
+	diffValue("", oldVal, newVal, &changes)
+	return changes, nil
+}
+
+func diffValue(path string, oldVal, newVal interface{}, changes *[]*Change) {
+	switch o := oldVal.(type) {
+	case map[string]interface{}:
+		if n, ok := newVal.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(o)+len(n))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			for k := range n {
+				if _, ok := o[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				p := k
+				if path != "" {
+					p = path + "." + k
+				}
+				ov, oldOk := o[k]
+				nv, newOk := n[k]
+				switch {
+				case !oldOk:
+					*changes = append(*changes, &Change{Path: p, Op: ChangeAdd, New: rawJSON(nv)})
+				case !newOk:
+					*changes = append(*changes, &Change{Path: p, Op: ChangeRemove, Old: rawJSON(ov)})
+				default:
+					diffValue(p, ov, nv, changes)
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if n, ok := newVal.([]interface{}); ok {
+			for i := 0; i < len(o) || i < len(n); i++ {
+				p := fmt.Sprintf("%s[%d]", path, i)
+				switch {
+				case i >= len(o):
+					*changes = append(*changes, &Change{Path: p, Op: ChangeAdd, New: rawJSON(n[i])})
+				case i >= len(n):
+					*changes = append(*changes, &Change{Path: p, Op: ChangeRemove, Old: rawJSON(o[i])})
+				default:
+					diffValue(p, o[i], n[i], changes)
+				}
+			}
+			return
+		}
+	}
+	oldRaw, newRaw := rawJSON(oldVal), rawJSON(newVal)
+	if string(oldRaw) != string(newRaw) {
+		*changes = append(*changes, &Change{Path: path, Op: ChangeModify, Old: oldRaw, New: newRaw})
+	}
+}
+
+func rawJSON(v interface{}) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
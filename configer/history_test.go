@@ -0,0 +1,226 @@
+package configer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/xiaoenai/tp-micro/v6/model/etcd"
+)
+
+func TestNewRevisionKey(t *testing.T) {
+	key := NewRevisionKey(NewKey("user", "1.0"), 12)
+	if key != "MICRO-CONF-REV@user@1.0@0000000012" {
+		t.Fatalf("revision key: %s", key)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	changes, err := DiffConfig(
+		`{"mysql":{"host":"a","port":3306},"endpoints":["x"],"debug":true}`,
+		`{"mysql":{"host":"b","port":3306},"endpoints":["x","y"],"level":"info"}`,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Change{
+		{Path: "debug", Op: ChangeRemove, Old: []byte(`true`)},
+		{Path: "endpoints[1]", Op: ChangeAdd, New: []byte(`"y"`)},
+		{Path: "level", Op: ChangeAdd, New: []byte(`"info"`)},
+		{Path: "mysql.host", Op: ChangeModify, Old: []byte(`"a"`), New: []byte(`"b"`)},
+	}
+	if len(changes) != len(expect) {
+		t.Fatalf("changes: %d, expect: %d", len(changes), len(expect))
+	}
+	for i, c := range changes {
+		e := expect[i]
+		if c.Path != e.Path || c.Op != e.Op || string(c.Old) != string(e.Old) || string(c.New) != string(e.New) {
+			t.Fatalf("changes[%d]: %+v, expect: %+v", i, *c, e)
+		}
+	}
+}
+
+func TestRevisions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e := startTestEtcd(t, dir)
+	defer e.Close()
+	etcdClient, err := etcd.NewClient(etcd.Config{Endpoints: []string{testEtcdEndpoint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcdClient.Close()
+	InitMgr(etcdClient)
+	// NOTE: The actor is resolved without a caller session.
+	SetActorResolver(func(erpc.CallCtx) string { return "tester" })
+	defer SetActorResolver(nil)
+
+	key := NewKey("test", "1.0")
+	c := new(cfg)
+	for i := 1; i <= 3; i++ {
+		rev, stat := c.Update(&ConfigKV{Key: key, Value: fmt.Sprintf(`{"name":"v%d"}`, i), Author: "test", BaseRevision: int64(i - 1)})
+		if !stat.OK() {
+			t.Fatal(stat)
+		}
+		if rev.Revision != int64(i) {
+			t.Fatalf("revision: %d, expect: %d", rev.Revision, i)
+		}
+	}
+
+	// the update based on a stale revision fails
+	if _, stat := c.Update(&ConfigKV{Key: key, Value: `{"name":"stale"}`, Author: "test", BaseRevision: 2}); stat.Msg() != statRevisionConflict.Msg() {
+		t.Fatalf("update based on a stale revision: %v", stat)
+	}
+	if config, _ := getConfig(key); config != `{"name":"v3"}` {
+		t.Fatalf("config: %s, expect: {\"name\":\"v3\"}", config)
+	}
+
+	// paging, the newest first
+	revs, stat := c.Revisions(&RevisionsArgs{Key: key, Limit: 2})
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if len(revs) != 2 || revs[0].Revision != 3 || revs[1].Revision != 2 || revs[0].Config != "" {
+		t.Fatalf("revisions: %v", revs)
+	}
+	if revs, _ = c.Revisions(&RevisionsArgs{Key: key}); len(revs) != 3 {
+		t.Fatalf("revisions: %d, expect: 3", len(revs))
+	}
+
+	// rollback writes a new revision with the old config
+	rev, stat := c.Rollback(&RollbackArgs{Key: key, Revision: 1, Author: "test"})
+	if !stat.OK() {
+		t.Fatal(stat)
+	}
+	if rev.Revision != 4 {
+		t.Fatalf("revision: %d, expect: 4", rev.Revision)
+	}
+	if config, _ := getConfig(key); config != `{"name":"v1"}` {
+		t.Fatalf("config: %s, expect: {\"name\":\"v1\"}", config)
+	}
+	if rev, _ := getRevision(etcdClient, key, 4); rev == nil || rev.Config != `{"name":"v1"}` {
+		t.Fatalf("revision 4: %v", rev)
+	}
+	if _, stat = c.Rollback(&RollbackArgs{Key: key, Revision: 5}); stat != statRevisionNotFound {
+		t.Fatalf("rollback to a missing revision: %v", stat)
+	}
+
+	// every revision has its event
+	events, err := listEvents(etcdClient, key, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("events: %d, expect: 4", len(events))
+	}
+	for i, e := range events {
+		action := ActionUpdate
+		if i == 0 {
+			action = ActionRollback
+		}
+		if e.Action != action || e.Revision != int64(4-i) || e.Actor != "tester" {
+			t.Fatalf("events[%d]: %v", i, e)
+		}
+	}
+}
+
+func TestPutRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	e := startTestEtcd(t, dir)
+	defer e.Close()
+	etcdClient, err := etcd.NewClient(etcd.Config{Endpoints: []string{testEtcdEndpoint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcdClient.Close()
+	InitMgr(etcdClient)
+
+	// the concurrent updates get the distinct revisions
+	key := NewKey("test", "1.0")
+	const n = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			event := &Event{Key: key, Action: ActionUpdate}
+			_, err := putRevision(etcdClient, key, fmt.Sprintf(`{"name":"v%d"}`, i), "test", "", 0, event, nil)
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	revs, err := listRevisions(etcdClient, key, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != n {
+		t.Fatalf("revisions: %d, expect: %d", len(revs), n)
+	}
+	for i, rev := range revs {
+		if rev.Revision != int64(n-i) {
+			t.Fatalf("revisions[%d]: %d, expect: %d", i, rev.Revision, n-i)
+		}
+	}
+	last, err := getRevision(etcdClient, key, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := etcdClient.Get(context.TODO(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := new(Node)
+	json.Unmarshal(resp.Kvs[0].Value, node)
+	if node.Config != last.Config {
+		t.Fatalf("config: %s, expect the latest revision: %s", node.Config, last.Config)
+	}
+	events, err := listEvents(etcdClient, key, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != n {
+		t.Fatalf("events: %d, expect: %d", len(events), n)
+	}
+	seen := make(map[int64]bool, n)
+	for _, e := range events {
+		seen[e.Revision] = true
+	}
+	if len(seen) != n {
+		t.Fatalf("the events of the revisions: %v", seen)
+	}
+
+	// a stale comparison fails, and neither the revision nor the event is written
+	stale := etcd.Compare(etcd.ModRevision(key), "=", resp.Kvs[0].ModRevision-1)
+	event := &Event{Key: key, Action: ActionUpdate}
+	if _, err = putRevision(etcdClient, key, `{"name":"stale"}`, "test", "", 0, event, []etcd.Cmp{stale}); err == nil {
+		t.Fatal("the stale comparison is passed")
+	}
+	if revs, _ = listRevisions(etcdClient, key, 0); len(revs) != n {
+		t.Fatalf("revisions: %d, expect: %d", len(revs), n)
+	}
+	if events, _ = listEvents(etcdClient, key, 0); len(events) != n {
+		t.Fatalf("events: %d, expect: %d", len(events), n)
+	}
+	if config, _ := getConfig(key); config == `{"name":"stale"}` {
+		t.Fatal("the stale config is written")
+	}
+}
@@ -3,14 +3,19 @@ package configer
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"time"
 
 	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/goutil"
 	micro "github.com/xiaoenai/tp-micro/v6"
 	"github.com/xiaoenai/tp-micro/v6/model/etcd"
 )
 
 var mgr = struct {
-	etcdClient *etcd.Client
+	etcdClient       *etcd.Client
+	secretAuthorizer func(erpc.CallCtx) bool
+	actorResolver    func(erpc.CallCtx) string
 }{}
 
 // InitMgr initializes a config manager.
@@ -18,6 +23,23 @@ func InitMgr(etcdClient *etcd.Client) {
 	mgr.etcdClient = etcdClient
 }
 
+// SetSecretAuthorizer sets the function that authorizes the caller to read the encrypted values,
+// otherwise they are masked in the responses.
+// For example:
+//  configer.SetSecretAuthorizer(func(ctx erpc.CallCtx) bool {
+//  	identity, _ := micro.PeerIdentity(ctx.Session())
+//  	return identity == "spiffe://example.org/ops"
+//  })
+func SetSecretAuthorizer(fn func(erpc.CallCtx) bool) {
+	mgr.secretAuthorizer = fn
+}
+
+// SetActorResolver sets the function that resolves the actor of the audit events from the caller session,
+// otherwise the caller identity or IP is used.
+func SetActorResolver(fn func(erpc.CallCtx) string) {
+	mgr.actorResolver = fn
+}
+
 // CallCtrl returns a new CALL controller.
 func CallCtrl() interface{} {
 	return new(cfg)
@@ -28,14 +50,20 @@ type cfg struct {
 }
 
 var (
-	statEtcdError = micro.RerrInternalServerError.Copy().SetMessage("Etcd Error")
-	statNotFound  = micro.RerrNotFound.Copy().SetReason("Config is not exist")
+	statEtcdError        = erpc.NewStatus(micro.RerrInternalServerError.Code(), "Etcd Error", "")
+	statNotFound         = micro.RerrNotFound.Copy("Config is not exist")
+	statRevisionNotFound = micro.RerrNotFound.Copy("Config revision is not exist")
+	statInvalidConfig    = erpc.NewStatus(micro.RerrInvalidParameter.Code(), "Invalid Config", "")
+	statCanaryNotFound   = micro.RerrNotFound.Copy("Canary is not exist")
+	statCanaryUnhealthy  = erpc.NewStatus(micro.RerrInvalidParameter.Code(), "Canary Is Unhealthy", "")
+	statEncryptError     = erpc.NewStatus(micro.RerrInternalServerError.Code(), "Encrypt Error", "")
+	statRevisionConflict = erpc.NewStatus(micro.RerrInvalidParameter.Code(), "Config Is Modified", "")
 )
 
 func (c *cfg) List(*struct{}) ([]string, *erpc.Status) {
-	resp, err := mgr.etcdClient.Get(context.TODO(), KEY_PREFIX, etcd.WithPrefix())
+	resp, err := mgr.etcdClient.Get(context.TODO(), KEY_PREFIX+"@", etcd.WithPrefix(), etcd.WithKeysOnly())
 	if err != nil {
-		return nil, statEtcdError.Copy().SetReason(err.Error())
+		return nil, statEtcdError.Copy(err)
 	}
 	var r = make([]string, len(resp.Kvs))
 	for i, kv := range resp.Kvs {
@@ -45,10 +73,14 @@ func (c *cfg) List(*struct{}) ([]string, *erpc.Status) {
 }
 
 func (c *cfg) Get(*struct{}) (string, *erpc.Status) {
-	key := c.Query().Get("config-key")
+	config, stat := getConfig(string(c.PeekMeta("config-key")))
+	return c.mask(config), stat
+}
+
+func getConfig(key string) (string, *erpc.Status) {
 	resp, err := mgr.etcdClient.Get(context.TODO(), key)
 	if err != nil {
-		return "", statEtcdError.Copy().SetReason(err.Error())
+		return "", statEtcdError.Copy(err)
 	}
 	if len(resp.Kvs) == 0 {
 		return "", statNotFound
@@ -65,15 +97,625 @@ func (c *cfg) Get(*struct{}) (string, *erpc.Status) {
 type ConfigKV struct {
 	Key   string
 	Value string
+	// Author who changes the config; if empty, use the caller identity or IP
+	Author string
+	// Comment why the config is changed
+	Comment string
+	// BaseRevision the revision that the change is based on;
+	// if >0, the update fails when the config has a newer revision
+	BaseRevision int64
+}
+
+// Update validates and updates the config, and records a new revision.
+func (c *cfg) Update(cfgKv *ConfigKV) (*Revision, *erpc.Status) {
+	value, stat := unmask(cfgKv.Key, cfgKv.Value)
+	if !stat.OK() {
+		return nil, stat
+	}
+	if stat = validate(cfgKv.Key, value); !stat.OK() {
+		return nil, stat
+	}
+	event := c.newEvent(cfgKv.Key, ActionUpdate, cfgKv.Author, cfgKv.Comment)
+	rev, err := putRevision(mgr.etcdClient, cfgKv.Key, value, c.author(cfgKv.Author), cfgKv.Comment, cfgKv.BaseRevision, event, nil)
+	if err == errRevisionConflict {
+		return nil, statRevisionConflict.Copy(fmt.Sprintf("the base revision %d is not the latest", cfgKv.BaseRevision))
+	}
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	publish(event)
+	rev.Config = ""
+	return rev, nil
+}
+
+// RevisionsArgs arguments of listing config revisions.
+type RevisionsArgs struct {
+	Key string
+	// Limit the maximum number of the latest revisions; if <=0, no limit
+	Limit int64
+}
+
+// Revisions lists the revisions of the config without the content, the newest first.
+func (c *cfg) Revisions(args *RevisionsArgs) ([]*Revision, *erpc.Status) {
+	revs, err := listRevisions(mgr.etcdClient, args.Key, args.Limit)
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	return revs, nil
+}
+
+// DiffArgs arguments of comparing two config revisions.
+type DiffArgs struct {
+	Key string
+	// From the old revision
+	From int64
+	// To the new revision; if 0, use the current config
+	To int64
+}
+
+// DiffResult the result of comparing two config revisions.
+type DiffResult struct {
+	From    *Revision `json:"from"`
+	To      *Revision `json:"to"`
+	Changes []*Change `json:"changes"`
+}
+
+// Diff compares two revisions of the config.
+func (c *cfg) Diff(args *DiffArgs) (*DiffResult, *erpc.Status) {
+	from, stat := loadRevision(args.Key, args.From)
+	if !stat.OK() {
+		return nil, stat
+	}
+	var to *Revision
+	if args.To == 0 {
+		config, stat := getConfig(args.Key)
+		if !stat.OK() {
+			return nil, stat
+		}
+		to = &Revision{Config: config}
+	} else if to, stat = loadRevision(args.Key, args.To); !stat.OK() {
+		return nil, stat
+	}
+	changes, err := DiffConfig(from.Config, to.Config)
+	if err != nil {
+		return nil, micro.RerrInvalidParameter.Copy(err)
+	}
+	from.Config = c.mask(from.Config)
+	to.Config = c.mask(to.Config)
+	for _, change := range changes {
+		change.Old = json.RawMessage(c.mask(string(change.Old)))
+		change.New = json.RawMessage(c.mask(string(change.New)))
+	}
+	return &DiffResult{
+		From:    from,
+		To:      to,
+		Changes: changes,
+	}, nil
+}
+
+// RollbackArgs arguments of rolling back the config.
+type RollbackArgs struct {
+	Key string
+	// Revision the revision to roll back to
+	Revision int64
+	// Author who rolls back the config; if empty, use the caller identity or IP
+	Author string
+	// Comment why the config is rolled back
+	Comment string
+}
+
+// Rollback atomically restores the config to the revision, and records it as a new revision.
+func (c *cfg) Rollback(args *RollbackArgs) (*Revision, *erpc.Status) {
+	target, stat := loadRevision(args.Key, args.Revision)
+	if !stat.OK() {
+		return nil, stat
+	}
+	if stat := validate(args.Key, target.Config); !stat.OK() {
+		return nil, stat
+	}
+	comment := fmt.Sprintf("rollback to revision %d", args.Revision)
+	if len(args.Comment) > 0 {
+		comment += ": " + args.Comment
+	}
+	event := c.newEvent(args.Key, ActionRollback, args.Author, comment)
+	rev, err := putRevision(mgr.etcdClient, args.Key, target.Config, c.author(args.Author), comment, 0, event, nil)
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	publish(event)
+	rev.Config = ""
+	return rev, nil
+}
+
+// CanaryArgs arguments of starting a canary rollout.
+type CanaryArgs struct {
+	Key   string
+	Value string
+	// Addrs the selected instance addresses
+	Addrs []string
+	// Labels the selected instances have all of the labels
+	Labels map[string]string
+	// Percentage the percentage of the selected instances
+	Percentage int
+	// Author who starts the canary; if empty, use the caller identity or IP
+	Author string
+	// Comment why the config is changed
+	Comment string
+}
+
+// Canary validates the config, and rolls it out to the selected instances first.
+// Note:
+//  If the config is the same as the current canary, only the selection is changed,
+//  and the reported instance statuses are kept.
+func (c *cfg) Canary(args *CanaryArgs) (*Canary, *erpc.Status) {
+	if args.Percentage < 0 || args.Percentage > 100 {
+		return nil, micro.RerrInvalidParameter.Copy("percentage must be in [0,100]")
+	}
+	if len(args.Addrs) == 0 && len(args.Labels) == 0 && args.Percentage == 0 {
+		return nil, micro.RerrInvalidParameter.Copy("no instance is selected")
+	}
+	value, stat := unmask(args.Key, args.Value)
+	if !stat.OK() {
+		return nil, stat
+	}
+	if stat = validate(args.Key, value); !stat.OK() {
+		return nil, stat
+	}
+	base, stat := getConfig(args.Key)
+	if !stat.OK() {
+		return nil, stat
+	}
+	canary := &Canary{
+		ID:         goutil.URLRandomString(8),
+		Config:     value,
+		Addrs:      args.Addrs,
+		Labels:     args.Labels,
+		Percentage: args.Percentage,
+		Author:     c.author(args.Author),
+		Comment:    args.Comment,
+		Time:       time.Now(),
+	}
+	if old, _, stat := loadCanary(args.Key); stat.OK() && old.Config == canary.Config {
+		canary.ID = old.ID
+	}
+	event := c.newEvent(args.Key, ActionCanary, args.Author, args.Comment)
+	event.setChanges(base, canary.Config)
+	if stat = writeEvent(event, etcd.OpPut(NewCanaryKey(args.Key), canary.String())); !stat.OK() {
+		return nil, stat
+	}
+	canary.Config = c.mask(canary.Config)
+	return canary, nil
+}
+
+// KeyArgs the config key argument.
+type KeyArgs struct {
+	Key string
+}
+
+// CanaryStatusResult the canary and the instance statuses.
+type CanaryStatusResult struct {
+	Canary    *Canary         `json:"canary"`
+	Instances []*CanaryStatus `json:"instances"`
+	// Healthy whether at least one instance applied the canary, and all of them are OK
+	Healthy bool `json:"healthy"`
+	// the modification revision of the canary key
+	modRevision int64
+}
+
+// CanaryStatus returns the current canary and the statuses of the instances applying it.
+func (c *cfg) CanaryStatus(args *KeyArgs) (*CanaryStatusResult, *erpc.Status) {
+	result, stat := canaryStatus(args.Key)
+	if !stat.OK() {
+		return nil, stat
+	}
+	result.Canary.Config = c.mask(result.Canary.Config)
+	return result, nil
+}
+
+// PromoteArgs arguments of promoting the canary.
+type PromoteArgs struct {
+	Key string
+	// Force promotes even if the health gate is not passed
+	Force bool
+	// Author who promotes the canary; if empty, use the caller identity or IP
+	Author string
+	// Comment why the canary is promoted
+	Comment string
+}
+
+// Promote atomically applies the canary config to all instances and ends the canary,
+// after at least one instance applied it and all of them are OK.
+func (c *cfg) Promote(args *PromoteArgs) (*Revision, *erpc.Status) {
+	result, stat := canaryStatus(args.Key)
+	if !stat.OK() {
+		return nil, stat
+	}
+	if !result.Healthy && !args.Force {
+		b, _ := json.Marshal(result.Instances)
+		return nil, statCanaryUnhealthy.Copy(string(b))
+	}
+	canaryKey := NewCanaryKey(args.Key)
+	comment := fmt.Sprintf("promote canary %s", result.Canary.ID)
+	if len(args.Comment) > 0 {
+		comment += ": " + args.Comment
+	}
+	event := c.newEvent(args.Key, ActionPromote, args.Author, comment)
+	rev, err := putRevision(mgr.etcdClient, args.Key, result.Canary.Config, c.author(args.Author), comment, 0, event,
+		[]etcd.Cmp{etcd.Compare(etcd.ModRevision(canaryKey), "=", result.modRevision)},
+		etcd.OpDelete(canaryKey),
+	)
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	publish(event)
+	rev.Config = ""
+	return rev, nil
+}
+
+// Abort ends the canary, and the selected instances go back to the current config.
+func (c *cfg) Abort(args *KeyArgs) (*struct{}, *erpc.Status) {
+	canaryKey := NewCanaryKey(args.Key)
+	event := c.newEvent(args.Key, ActionAbort, "", "")
+	event.Text = event.summary()
+	eventCmp, eventOp := event.putOp()
+	txnResp, err := mgr.etcdClient.Txn(context.TODO()).
+		If(etcd.Compare(etcd.CreateRevision(canaryKey), ">", 0), eventCmp).
+		Then(etcd.OpDelete(canaryKey), eventOp).
+		Commit()
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	if txnResp.Succeeded {
+		publish(event)
+	}
+	return nil, nil
+}
+
+// OverrideArgs arguments of overriding the config of an instance.
+type OverrideArgs struct {
+	Key string
+	// Addr the instance address
+	Addr string
+	// Value the JSON object that is deep-merged over the config of the instance; if empty, delete the override
+	Value string
+}
+
+// Override sets or deletes the override config of the instance.
+// Note:
+//  It is the overlay of the instance layer.
+func (c *cfg) Override(args *OverrideArgs) (*struct{}, *erpc.Status) {
+	if len(args.Addr) == 0 {
+		return nil, micro.RerrInvalidParameter.Copy("instance address is required")
+	}
+	return c.Overlay(&OverlayArgs{
+		Key:   args.Key,
+		Layer: OverlayInstance,
+		Name:  args.Addr,
+		Value: args.Value,
+	})
+}
+
+// OverlayArgs arguments of setting the overlay config.
+type OverlayArgs struct {
+	Key string
+	// Layer env, cluster or instance
+	Layer string
+	// Name the environment name, the cluster name or the instance address
+	Name string
+	// Value the JSON object that is deep-merged over the config; if empty, delete the overlay
+	Value string
+}
+
+// Overlay sets or deletes the overlay config of an environment, a cluster or an instance.
+// Note:
+//  The effective config of an instance is deep-merged as: base -> env -> cluster -> instance.
+func (c *cfg) Overlay(args *OverlayArgs) (*struct{}, *erpc.Status) {
+	if len(args.Name) == 0 {
+		return nil, micro.RerrInvalidParameter.Copy("overlay name is required")
+	}
+	overlayKey := NewOverlayKey(args.Key, args.Layer, args.Name)
+	if len(overlayKey) == 0 {
+		return nil, micro.RerrInvalidParameter.Copy(fmt.Sprintf("invalid overlay layer: %q", args.Layer))
+	}
+	resp, err := mgr.etcdClient.Get(context.TODO(), overlayKey)
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	var old string
+	if len(resp.Kvs) > 0 {
+		old = decodeOverlay(args.Key, resp.Kvs[0].Value)
+	}
+	var op etcd.Op
+	if len(args.Value) == 0 {
+		if len(resp.Kvs) == 0 {
+			return nil, nil
+		}
+		op = etcd.OpDelete(overlayKey)
+	} else {
+		config, stat := getConfig(args.Key)
+		if !stat.OK() {
+			return nil, stat
+		}
+		merged, mergeErr := MergeConfig(config, args.Value)
+		if mergeErr != nil {
+			return nil, statInvalidConfig.Copy(mergeErr)
+		}
+		if stat = validate(args.Key, merged); !stat.OK() {
+			return nil, stat
+		}
+		op = etcd.OpPut(overlayKey, (&Node{Initialized: true, Config: args.Value}).String())
+	}
+	event := c.newEvent(args.Key, ActionOverlay, "", "")
+	event.Layer = args.Layer
+	event.Name = args.Name
+	event.setChanges(old, args.Value)
+	return nil, writeEvent(event, op)
+}
+
+// EffectiveArgs arguments of getting the effective config.
+type EffectiveArgs struct {
+	Key     string
+	Env     string
+	Cluster string
+	// Addr the instance address
+	Addr string
+}
+
+// Effective returns the effective config deep-merged as: base -> env -> cluster -> instance.
+// Note:
+//  The canary is not included.
+func (c *cfg) Effective(args *EffectiveArgs) (string, *erpc.Status) {
+	config, stat := getConfig(args.Key)
+	if !stat.OK() {
+		return "", stat
+	}
+	configs := []string{config}
+	for i, name := range []string{args.Env, args.Cluster, args.Addr} {
+		if len(name) == 0 {
+			continue
+		}
+		resp, err := mgr.etcdClient.Get(context.TODO(), NewOverlayKey(args.Key, overlayLayers[i], name))
+		if err != nil {
+			return "", statEtcdError.Copy(err)
+		}
+		if len(resp.Kvs) > 0 {
+			configs = append(configs, decodeOverlay(args.Key, resp.Kvs[0].Value))
+		}
+	}
+	merged, err := MergeConfig(configs...)
+	if err != nil {
+		return "", statInvalidConfig.Copy(err)
+	}
+	return c.mask(merged), nil
+}
+
+// EventsArgs arguments of listing config events.
+type EventsArgs struct {
+	Key string
+	// Limit the maximum number of the latest events; if <=0, no limit
+	Limit int64
 }
 
-func (c *cfg) Update(cfgKv *ConfigKV) (*struct{}, *erpc.Status) {
-	_, err := mgr.etcdClient.Put(context.TODO(), cfgKv.Key, (&Node{
-		Initialized: true,
-		Config:      cfgKv.Value,
-	}).String())
+// Events lists the audit events of the config, the newest first.
+func (c *cfg) Events(args *EventsArgs) ([]*Event, *erpc.Status) {
+	events, err := listEvents(mgr.etcdClient, args.Key, args.Limit)
 	if err != nil {
-		return nil, statEtcdError.Copy().SetReason(err.Error())
+		return nil, statEtcdError.Copy(err)
 	}
+	return events, nil
+}
+
+// WatchArgs arguments of watching config events.
+type WatchArgs struct {
+	// Keys the config keys to watch; if empty, watch all configs
+	Keys []string
+}
+
+// Watch pushes the audit events of the configs to the caller by EventPushPath, until the session is closed.
+// For example, the client receives the events by:
+//  func CfgEvent(ctx erpc.PushCtx, e *configer.Event) *erpc.Status {...}
+//  cli.RoutePushFunc(CfgEvent)
+func (c *cfg) Watch(args *WatchArgs) (*struct{}, *erpc.Status) {
+	sess := c.Session()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-sess.CloseNotify()
+		cancel()
+	}()
+	watchEvents(ctx, mgr.etcdClient, args.Keys, func(e *Event) {
+		if stat := sess.Push(EventPushPath, e); !stat.OK() {
+			erpc.Debugf("Push configuration event failed: %s: %s", sess.ID(), stat.String())
+		}
+	})
 	return nil, nil
 }
+
+// loadCanary returns the canary and the modification revision of its key.
+func loadCanary(key string) (*Canary, int64, *erpc.Status) {
+	resp, err := mgr.etcdClient.Get(context.TODO(), NewCanaryKey(key))
+	if err != nil {
+		return nil, 0, statEtcdError.Copy(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, statCanaryNotFound
+	}
+	canary := new(Canary)
+	if err = json.Unmarshal(resp.Kvs[0].Value, canary); err != nil {
+		return nil, 0, statEtcdError.Copy(err)
+	}
+	return canary, resp.Kvs[0].ModRevision, nil
+}
+
+func canaryStatus(key string) (*CanaryStatusResult, *erpc.Status) {
+	canary, modRevision, stat := loadCanary(key)
+	if !stat.OK() {
+		return nil, stat
+	}
+	resp, err := mgr.etcdClient.Get(context.TODO(), canaryStatusKeyPrefix(key), etcd.WithPrefix())
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	result := &CanaryStatusResult{
+		Canary:      canary,
+		Instances:   make([]*CanaryStatus, 0, len(resp.Kvs)),
+		modRevision: modRevision,
+	}
+	healthy := true
+	for _, kv := range resp.Kvs {
+		status := new(CanaryStatus)
+		if err = json.Unmarshal(kv.Value, status); err != nil || status.ID != canary.ID {
+			continue
+		}
+		result.Instances = append(result.Instances, status)
+		healthy = healthy && status.OK
+	}
+	result.Healthy = healthy && len(result.Instances) > 0
+	return result, nil
+}
+
+// ValidateResult the result of validating the config.
+type ValidateResult struct {
+	Valid  bool               `json:"valid"`
+	Errors []*ValidationError `json:"errors,omitempty"`
+}
+
+// Validate validates the config against the JSON Schema published by the service, but does not write it.
+func (c *cfg) Validate(cfgKv *ConfigKV) (*ValidateResult, *erpc.Status) {
+	value, stat := unmask(cfgKv.Key, cfgKv.Value)
+	if !stat.OK() {
+		return nil, stat
+	}
+	errs, stat := validateConfig(cfgKv.Key, value)
+	if !stat.OK() {
+		return nil, stat
+	}
+	return &ValidateResult{
+		Valid:  len(errs) == 0,
+		Errors: errs,
+	}, nil
+}
+
+func validate(key, config string) *erpc.Status {
+	errs, stat := validateConfig(key, config)
+	if !stat.OK() {
+		return stat
+	}
+	if len(errs) > 0 {
+		b, _ := json.Marshal(errs)
+		return statInvalidConfig.Copy(string(b))
+	}
+	return nil
+}
+
+// validateConfig validates the config against the JSON Schema if it is published,
+// otherwise only checks whether it is a valid JSON.
+func validateConfig(key, config string) ([]*ValidationError, *erpc.Status) {
+	resp, err := mgr.etcdClient.Get(context.TODO(), NewSchemaKey(key))
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	if p := getKeyProvider(); p != nil {
+		plain, err := DecryptConfig(p, config)
+		if err != nil {
+			return []*ValidationError{{Message: err.Error()}}, nil
+		}
+		config = plain
+	}
+	if len(resp.Kvs) == 0 || len(resp.Kvs[0].Value) == 0 {
+		if !json.Valid([]byte(config)) {
+			return []*ValidationError{{Message: "invalid JSON"}}, nil
+		}
+		return nil, nil
+	}
+	errs, err := ValidateConfig(resp.Kvs[0].Value, config)
+	if err != nil {
+		return nil, statInvalidConfig.Copy(err)
+	}
+	return errs, nil
+}
+
+// Encrypt encrypts the plaintext with the current key, and returns the envelope,
+// which can be used as a string value of the config.
+func (c *cfg) Encrypt(plaintext *string) (string, *erpc.Status) {
+	envelope, err := EncryptValue(getKeyProvider(), *plaintext)
+	if err != nil {
+		return "", statEncryptError.Copy(err)
+	}
+	return envelope, nil
+}
+
+// mask masks the encrypted values unless the caller is authorized.
+func (c *cfg) mask(config string) string {
+	if mgr.secretAuthorizer != nil && mgr.secretAuthorizer(c) {
+		return config
+	}
+	return MaskConfig(config)
+}
+
+// unmask restores the masked values from the current config.
+func unmask(key, config string) (string, *erpc.Status) {
+	current, stat := getConfig(key)
+	if !stat.OK() && stat != statNotFound {
+		return "", stat
+	}
+	config, err := unmaskConfig(config, current)
+	if err != nil {
+		return "", statInvalidConfig.Copy(err)
+	}
+	return config, nil
+}
+
+func (c *cfg) author(author string) string {
+	if len(author) > 0 {
+		return author
+	}
+	if identity, ok := micro.PeerIdentity(c.Session()); ok {
+		return identity
+	}
+	return c.RealIP()
+}
+
+func loadRevision(key string, revision int64) (*Revision, *erpc.Status) {
+	rev, err := getRevision(mgr.etcdClient, key, revision)
+	if err != nil {
+		return nil, statEtcdError.Copy(err)
+	}
+	if rev == nil {
+		return nil, statRevisionNotFound
+	}
+	return rev, nil
+}
+
+// newEvent creates an audit event of the caller.
+func (c *cfg) newEvent(key, action, author, comment string) *Event {
+	return &Event{
+		Key:     key,
+		Action:  action,
+		Actor:   c.actor(),
+		Author:  author,
+		Comment: comment,
+	}
+}
+
+func (c *cfg) actor() string {
+	if mgr.actorResolver != nil {
+		if actor := mgr.actorResolver(c); len(actor) > 0 {
+			return actor
+		}
+	}
+	return c.author("")
+}
+
+// writeEvent atomically executes the operation and records the event, then publishes it.
+func writeEvent(event *Event, op etcd.Op) *erpc.Status {
+	eventCmp, eventOp := event.putOp()
+	txnResp, err := mgr.etcdClient.Txn(context.TODO()).If(eventCmp).Then(op, eventOp).Commit()
+	if err != nil {
+		return statEtcdError.Copy(err)
+	}
+	if !txnResp.Succeeded {
+		return statEtcdError.Copy("audit event conflicts")
+	}
+	publish(event)
+	return nil
+}
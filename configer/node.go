@@ -4,22 +4,42 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/henrylee2cn/erpc/v6"
 	"github.com/xiaoenai/tp-micro/v6/model/etcd"
 )
 
+const archiveFile = "./config/archive"
+
+// syncRetryInterval the interval of retrying to sync config from etcd after booting from the archive
+var syncRetryInterval = 5 * time.Second
+
 // InitNode initializes the config node.
-func InitNode(etcdClient *etcd.Client) {
+// Note:
+//  If fallbackTimeout>0, SyncNode boots from the archived config(./config/archive)
+//  when etcd is still unavailable after the timeout, and reconciles once etcd comes back;
+//  Otherwise, SyncNode waits for etcd.
+func InitNode(etcdClient *etcd.Client, fallbackTimeout ...time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
 	globalNodes = &Nodes{
-		nodeMap: make(map[string]*Node),
+		nodeMap:    make(map[string]*Node),
+		etcdClient: etcdClient,
+		archived:   make(map[string]*Node),
+		ctx:        ctx,
+		cancel:     cancel,
 	}
-
-	var err error
-	globalNodes.etcdSession, err = etcd.NewSession(etcdClient)
-	if err != nil {
+	if len(fallbackTimeout) > 0 && fallbackTimeout[0] > 0 {
+		globalNodes.fallbackTimeout = fallbackTimeout[0]
+		for key, node := range loadArchive() {
+			globalNodes.archived[key] = node
+		}
+		return
+	}
+	if _, err := globalNodes.session(); err != nil {
 		erpc.Fatalf("Initialization of the global node failed: %s", err.Error())
 	}
 }
@@ -30,121 +50,451 @@ func SyncNode(service, version string, cfg Config) {
 	globalNodes.mustAdd(service, version, cfg)
 }
 
+// CloseNode stops retrying and watching the configs in etcd.
+func CloseNode() {
+	globalNodes.cancel()
+}
+
 // Nodes config node handlers
 type Nodes struct {
-	nodeMap     map[string]*Node
-	etcdSession *etcd.Session
-	rwMutex     sync.RWMutex
+	nodeMap         map[string]*Node
+	etcdClient      *etcd.Client
+	etcdSession     *etcd.Session
+	sessionMutex    sync.Mutex
+	fallbackTimeout time.Duration
+	// archived the snapshots of the configs written to the archive file
+	archived map[string]*Node
+	rwMutex  sync.RWMutex
+	ctx      context.Context
+	cancel   context.CancelFunc
+	retrying sync.WaitGroup
 }
 
 var globalNodes *Nodes
 
+func (n *Nodes) session() (*etcd.Session, error) {
+	n.sessionMutex.Lock()
+	defer n.sessionMutex.Unlock()
+	if n.etcdSession != nil {
+		return n.etcdSession, nil
+	}
+	sess, err := etcd.NewSession(n.etcdClient)
+	if err != nil {
+		return nil, err
+	}
+	n.etcdSession = sess
+	return sess, nil
+}
+
 func (n *Nodes) mustAdd(service, version string, cfg Config) {
 	must(n.add(service, version, cfg))
 }
 
-func (n *Nodes) add(service, version string, cfg Config) (err error) {
-	n.rwMutex.Lock()
-	defer n.rwMutex.Unlock()
-
+func (n *Nodes) add(service, version string, cfg Config) error {
 	key := NewKey(service, version)
-	if _, ok := n.nodeMap[key]; ok {
-		return fmt.Errorf("Repeat the registration configuration: %s", key)
-	}
 	cfgBytes, _ := cfg.MarshalJSON()
+	schema, err := configSchema(cfg)
+	if err != nil {
+		return fmt.Errorf("Generate the configuration schema failed: %s: %s", key, err.Error())
+	}
 	node := &Node{
 		key:         key,
 		object:      cfg,
-		etcdMutex:   etcd.NewLocker(n.etcdSession, key),
+		schema:      string(schema),
 		Initialized: false,
 		Config:      string(cfgBytes),
+		base:        string(cfgBytes),
 		doInitCh:    make(chan error, 1),
 		nodes:       n,
 	}
+	n.rwMutex.Lock()
+	if _, ok := n.nodeMap[key]; ok {
+		n.rwMutex.Unlock()
+		return fmt.Errorf("Repeat the registration configuration: %s", key)
+	}
 	n.nodeMap[key] = node
+	n.rwMutex.Unlock()
 
-	defer func() {
-		if p := recover(); p != nil {
-			err = fmt.Errorf("etcd concurrency lock fail: %v", p)
+	if n.fallbackTimeout <= 0 {
+		return node.sync()
+	}
+	done := make(chan struct{})
+	n.retrying.Add(1)
+	go func() {
+		defer n.retrying.Done()
+		defer close(done)
+		for {
+			err := node.sync()
+			if err == nil {
+				return
+			}
+			erpc.Errorf("Sync configuration from etcd failed, retry after %s: %s: %s", syncRetryInterval, key, err.Error())
+			select {
+			case <-n.ctx.Done():
+				return
+			case <-time.After(syncRetryInterval):
+			}
 		}
 	}()
-
-	node.etcdMutex.Lock()
-	defer node.etcdMutex.Unlock()
-
-	resp, err := n.etcdSession.Client().Get(context.TODO(), key)
-	if err != nil {
-		return err
+	select {
+	case <-done:
+		return nil
+	case <-time.After(n.fallbackTimeout):
+	}
+	n.rwMutex.RLock()
+	archived, ok := n.archived[key]
+	n.rwMutex.RUnlock()
+	if !ok {
+		erpc.Errorf("Etcd is unavailable after %s, and there is no archived configuration, continue to wait: %s", n.fallbackTimeout, key)
+		<-done
+		return nil
 	}
+	erpc.Errorf("!!! Etcd is unavailable after %s, boot from the archived configuration, and reconcile once etcd comes back: %s", n.fallbackTimeout, key)
+	return node.bind([]byte(archived.String()))
+}
 
-	if len(resp.Kvs) > 0 {
-		err = node.bind(resp.Kvs[0].Value)
-		if node.Initialized {
-			go node.watch(n.etcdSession.Client())
-			return err
+// loadArchive loads the initialized configs from the archive file.
+func loadArchive() map[string]*Node {
+	b, err := ioutil.ReadFile(archiveFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			erpc.Warnf("Load archived config error: %v", err)
 		}
-
-	} else {
-		_, err = n.etcdSession.Client().Put(context.TODO(), key, node.String())
-		if err != nil {
-			return err
+		return nil
+	}
+	var nodeMap map[string]*Node
+	if err = json.Unmarshal(b, &nodeMap); err != nil {
+		erpc.Warnf("Load archived config error: %v", err)
+		return nil
+	}
+	for key, node := range nodeMap {
+		if node == nil || !node.Initialized {
+			delete(nodeMap, key)
 		}
 	}
-
-	erpc.Warnf("Wait for the configuration in the ETCD to be set: %s", key)
-	go node.watch(n.etcdSession.Client())
-	return node.waitInit()
+	return nodeMap
 }
 
 // Node config node handler
 type Node struct {
 	key    string
 	object Config
+	schema string
 	// Config string
 	Config string `json:"config"`
 	// Is it initialized?
 	Initialized bool `json:"initialized"`
-	doInitCh    chan error
-	etcdMutex   sync.Locker
-	nodes       *Nodes
+	// the layers of config: (base or canary) -> env -> cluster -> instance
+	base           string
+	canary         *Canary
+	overlays       [len(overlayLayers)]string
+	canaryReported bool
+	doInitCh       chan error
+	bindMutex      sync.Mutex
+	nodes          *Nodes
 }
 
-func (n *Nodes) archive() {
+// archive records the snapshot of the config, and writes all the snapshots to the archive file.
+// Note:
+//  The snapshot is copied by the caller with its bindMutex held,
+//  so that the other nodes are not read here.
+func (n *Nodes) archive(key string, snapshot *Node) {
+	n.rwMutex.Lock()
+	if n.archived == nil {
+		n.archived = make(map[string]*Node)
+	}
+	// NOTE: Do not overwrite the archived config with the uninitialized template.
+	if snapshot.Initialized || n.archived[key] == nil {
+		n.archived[key] = snapshot
+	}
+	b, _ := json.Marshal(n.archived)
+	n.rwMutex.Unlock()
+
 	os.Mkdir("./config", 0755)
-	r, err := os.OpenFile("./config/archive", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	r, err := os.OpenFile(archiveFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		erpc.Warnf("Archive config error: %v", err)
 		return
 	}
-	b, _ := json.Marshal(n.nodeMap)
 	r.Write(b)
 	r.Close()
 }
 
-func (n *Node) bind(data []byte) error {
-	inited := n.Initialized
-	err := json.Unmarshal(data, n)
+// sync binds the config from etcd, or registers the template to etcd if not exist,
+// then watches the changes.
+func (n *Node) sync() (err error) {
+	sess, err := n.nodes.session()
+	if err != nil {
+		return err
+	}
+	etcdMutex := etcd.NewLocker(sess, n.key)
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("etcd concurrency lock fail: %v", p)
+		}
+	}()
+
+	etcdMutex.Lock()
+	defer etcdMutex.Unlock()
+
+	etcdClient := n.nodes.etcdClient
+	_, err = etcdClient.Put(context.TODO(), NewSchemaKey(n.key), n.schema)
 	if err != nil {
 		return err
 	}
+	// NOTE: Read the base, canary and overlays at the same revision.
+	keys := append([]string{n.key, NewCanaryKey(n.key)}, overlayKeys(n.key)...)
+	ops := make([]etcd.Op, 0, len(keys))
+	for _, key := range keys {
+		if len(key) > 0 {
+			ops = append(ops, etcd.OpGet(key))
+		}
+	}
+	resp, err := etcdClient.Txn(context.TODO()).Then(ops...).Commit()
+	if err != nil {
+		return err
+	}
+	values := make(map[string][]byte, len(keys))
+	for _, r := range resp.Responses {
+		if kvs := r.GetResponseRange().Kvs; len(kvs) > 0 {
+			values[string(kvs[0].Key)] = kvs[0].Value
+		}
+	}
+	overlays := make([][]byte, len(keys)-2)
+	for i, key := range keys[2:] {
+		overlays[i] = values[key]
+	}
+	n.setLayers(values[keys[1]], overlays)
+
+	// NOTE: Watch the changes after the revision read, so that none is missed.
+	watchRev := resp.Header.Revision + 1
+	if base := values[n.key]; base != nil {
+		err = n.bind(base)
+		if n.isInitialized() {
+			go n.watch(etcdClient, watchRev)
+			return err
+		}
 
-	n.nodes.archive()
+	} else if n.isInitialized() {
+		if err = n.restore(etcdClient); err != nil {
+			return err
+		}
+		erpc.Warnf("Restore the archived configuration to etcd: %s", n.key)
+		go n.watch(etcdClient, watchRev)
+		return nil
 
-	if inited {
-		err = n.object.Reload([]byte(n.Config))
 	} else {
-		err = n.object.UnmarshalJSON([]byte(n.Config))
-		if n.Initialized {
-			select {
-			case n.doInitCh <- err:
-			default:
+		n.bindMutex.Lock()
+		base := (&Node{Initialized: n.Initialized, Config: n.base}).String()
+		n.bindMutex.Unlock()
+		putResp, err := etcdClient.Txn(context.TODO()).
+			If(etcd.Compare(etcd.CreateRevision(n.key), "=", 0)).
+			Then(etcd.OpPut(n.key, base)).
+			Commit()
+		if err != nil {
+			return err
+		}
+		if putResp.Succeeded {
+			// NOTE: Skip the template registered by itself.
+			watchRev = putResp.Header.Revision + 1
+		}
+	}
+
+	erpc.Warnf("Wait for the configuration in the ETCD to be set: %s", n.key)
+	go n.watch(etcdClient, watchRev)
+	return n.waitInit()
+}
+
+// restore writes the archived config to etcd as a new revision, and records the audit event,
+// the same as the config manager does.
+// Note:
+//  It fails if the config is set in etcd concurrently.
+func (n *Node) restore(etcdClient *etcd.Client) error {
+	n.bindMutex.Lock()
+	config := n.base
+	n.bindMutex.Unlock()
+	addr, _ := instanceInfo()
+	event := &Event{
+		Key:     n.key,
+		Action:  ActionRestore,
+		Actor:   addr,
+		Comment: "restore the archived configuration",
+	}
+	_, err := putRevision(etcdClient, n.key, config, addr, event.Comment, 0, event,
+		[]etcd.Cmp{etcd.Compare(etcd.CreateRevision(n.key), "=", 0)})
+	if err != nil {
+		return err
+	}
+	publish(event)
+	return nil
+}
+
+func (n *Node) isInitialized() bool {
+	n.bindMutex.Lock()
+	defer n.bindMutex.Unlock()
+	return n.Initialized
+}
+
+// setLayers sets the canary and overlay layers without applying.
+func (n *Node) setLayers(canary []byte, overlays [][]byte) {
+	n.bindMutex.Lock()
+	defer n.bindMutex.Unlock()
+	n.canary = decodeCanary(n.key, canary)
+	for i, overlay := range overlays {
+		n.overlays[i] = decodeOverlay(n.key, overlay)
+	}
+}
+
+func decodeCanary(key string, data []byte) *Canary {
+	if len(data) == 0 {
+		return nil
+	}
+	c := new(Canary)
+	if err := json.Unmarshal(data, c); err != nil {
+		erpc.Errorf("Decode canary configuration failed: %s: %s", key, err.Error())
+		return nil
+	}
+	return c
+}
+
+func decodeOverlay(key string, data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	var overlay Node
+	if err := json.Unmarshal(data, &overlay); err != nil {
+		erpc.Errorf("Decode overlay configuration failed: %s: %s", key, err.Error())
+		return ""
+	}
+	return overlay.Config
+}
+
+// bind binds the base config.
+func (n *Node) bind(data []byte) error {
+	n.bindMutex.Lock()
+	defer n.bindMutex.Unlock()
+	var newNode Node
+	err := json.Unmarshal(data, &newNode)
+	if err != nil {
+		return err
+	}
+	inited := n.Initialized
+	if inited && !newNode.Initialized {
+		// NOTE: Keep the archived config until it is set in etcd.
+		return nil
+	}
+	n.base = newNode.Config
+	n.Initialized = newNode.Initialized
+	return n.apply(inited)
+}
+
+// bindCanary binds the canary config, nil means no canary.
+func (n *Node) bindCanary(data []byte) error {
+	n.bindMutex.Lock()
+	defer n.bindMutex.Unlock()
+	n.canary = decodeCanary(n.key, data)
+	return n.apply(n.Initialized)
+}
+
+// bindOverlay returns the function that binds the overlay config of the layer index, nil means no overlay.
+func (n *Node) bindOverlay(layer int) func([]byte) error {
+	return func(data []byte) error {
+		n.bindMutex.Lock()
+		defer n.bindMutex.Unlock()
+		n.overlays[layer] = decodeOverlay(n.key, data)
+		return n.apply(n.Initialized)
+	}
+}
+
+// bindOverride binds the override config of the instance, nil means no override.
+// Note:
+//  The override is the instance overlay.
+func (n *Node) bindOverride(data []byte) error {
+	return n.bindOverlay(len(overlayLayers) - 1)(data)
+}
+
+// apply applies the effective config of the layers.
+// Note:
+//  It must be called with bindMutex held.
+func (n *Node) apply(inited bool) (err error) {
+	config := n.base
+	var canaryID string
+	if n.Initialized {
+		addr, labels := instanceInfo()
+		if n.canary != nil && n.canary.Selected(n.key, addr, labels) {
+			config = n.canary.Config
+			canaryID = n.canary.ID
+		}
+		if n.overlays != [len(overlayLayers)]string{} {
+			merged, err := MergeConfig(append([]string{config}, n.overlays[:]...)...)
+			if err != nil {
+				erpc.Errorf("Merge overlay configuration failed: %s: %s", n.key, err.Error())
+			} else {
+				config = merged
 			}
 		}
 	}
+	if inited && config == n.Config {
+		return nil
+	}
+	n.Config = config
+
+	n.nodes.archive(n.key, &Node{Initialized: n.Initialized, Config: n.Config})
+
+	// NOTE: Only the decrypted config is passed to the object, and the archived one is still encrypted.
+	plain, err := DecryptConfig(getKeyProvider(), n.Config)
+	if err == nil {
+		if inited {
+			err = n.object.Reload([]byte(plain))
+		} else {
+			err = n.object.UnmarshalJSON([]byte(plain))
+		}
+	}
+	if !inited && n.Initialized {
+		select {
+		case n.doInitCh <- err:
+		default:
+		}
+	}
 
+	if canaryID != "" || n.canaryReported {
+		n.canaryReported = canaryID != ""
+		go n.reportCanary(canaryID, err)
+	}
 	return err
 }
 
+// reportCanary reports the canary status of the instance, which is used as the health gate of promotion.
+// Note:
+//  If canaryID is empty, the status is deleted.
+func (n *Node) reportCanary(canaryID string, applyErr error) {
+	sess, err := n.nodes.session()
+	if err != nil {
+		erpc.Errorf("Report canary status failed: %s: %s", n.key, err.Error())
+		return
+	}
+	addr, _ := instanceInfo()
+	statusKey := NewCanaryStatusKey(n.key, addr)
+	if canaryID == "" {
+		_, err = n.nodes.etcdClient.Delete(context.TODO(), statusKey)
+	} else {
+		status := &CanaryStatus{
+			ID:   canaryID,
+			Addr: addr,
+			OK:   applyErr == nil,
+			Time: time.Now(),
+		}
+		if applyErr != nil {
+			status.Error = applyErr.Error()
+		}
+		_, err = n.nodes.etcdClient.Put(context.TODO(), statusKey, status.String(), etcd.WithLease(sess.Lease()))
+	}
+	if err != nil {
+		erpc.Errorf("Report canary status failed: %s: %s", n.key, err.Error())
+	}
+}
+
 func (n *Node) waitInit() error {
 	return <-n.doInitCh
 }
@@ -155,19 +505,38 @@ func (n *Node) String() string {
 	return string(b)
 }
 
-func (n *Node) watch(etcdClient *etcd.Client) {
+// watch watches the base, canary and overlays from the revision.
+func (n *Node) watch(etcdClient *etcd.Client, rev int64) {
+	go n.watchKey(etcdClient, NewCanaryKey(n.key), rev, n.bindCanary)
+	for i, overlayKey := range overlayKeys(n.key) {
+		if len(overlayKey) > 0 {
+			go n.watchKey(etcdClient, overlayKey, rev, n.bindOverlay(i))
+		}
+	}
+	n.watchKey(etcdClient, n.key, rev, func(data []byte) error {
+		if data == nil {
+			return nil
+		}
+		return n.bind(data)
+	})
+}
+
+// watchKey watches the key from the revision until CloseNode, and calls bind with nil value when it is deleted.
+func (n *Node) watchKey(etcdClient *etcd.Client, key string, rev int64, bind func([]byte) error) {
 	watcher := etcdClient.Watch(
-		context.TODO(),
-		n.key,
+		n.nodes.ctx,
+		key,
+		etcd.WithRev(rev),
 	)
 	for wresp := range watcher {
 		for _, event := range wresp.Events {
-			if event.Type != etcd.EventTypePut {
-				continue
+			var data []byte
+			if event.Type == etcd.EventTypePut {
+				data = event.Kv.Value
 			}
-			err := n.bind(event.Kv.Value)
+			err := bind(data)
 			if err != nil {
-				erpc.Errorf("Binding configuration from etcd failed: %s", err)
+				erpc.Errorf("Binding configuration from etcd failed: %s: %s", key, err)
 			}
 		}
 	}
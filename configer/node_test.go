@@ -0,0 +1,196 @@
+package configer
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+	"github.com/xiaoenai/tp-micro/v6/model/etcd"
+)
+
+// testEtcdEndpoint the client endpoint of the embedded etcd server
+const testEtcdEndpoint = "127.0.0.1:23790"
+
+// startTestEtcd starts an embedded etcd server in the directory.
+func startTestEtcd(t *testing.T, dir string) *embed.Etcd {
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LCUrls = []url.URL{{Scheme: "http", Host: testEtcdEndpoint}}
+	cfg.ACUrls = cfg.LCUrls
+	cfg.LPUrls = []url.URL{{Scheme: "http", Host: "127.0.0.1:23800"}}
+	cfg.APUrls = cfg.LPUrls
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		e.Close()
+		t.Fatal("embedded etcd is not ready")
+	}
+	return e
+}
+
+type testConfig struct {
+	Name string `json:"name"`
+	mu   sync.Mutex
+}
+
+func (t *testConfig) UnmarshalJSON(b []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var v struct {
+		Name string `json:"name"`
+	}
+	err := json.Unmarshal(b, &v)
+	t.Name = v.Name
+	return err
+}
+
+func (t *testConfig) MarshalJSON() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return json.Marshal(map[string]string{"name": t.Name})
+}
+
+func (t *testConfig) get() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Name
+}
+
+func (t *testConfig) Reload(b []byte) error {
+	return t.UnmarshalJSON(b)
+}
+
+func TestBootFromArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	key := NewKey("test", "1.0")
+	os.Mkdir("./config", 0755)
+	archived := map[string]*Node{
+		key: {Initialized: true, Config: `{"name":"archived"}`},
+	}
+	b, _ := json.Marshal(archived)
+	if err = ioutil.WriteFile(archiveFile, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: No etcd is listening on the endpoint.
+	etcdClient, err := etcd.NewClient(etcd.Config{Endpoints: []string{"127.0.0.1:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcdClient.Close()
+	InitNode(etcdClient, 200*time.Millisecond)
+
+	cfg := &testConfig{Name: "template"}
+	SyncNode("test", "1.0", cfg)
+	if cfg.Name != "archived" {
+		t.Fatalf("name: %s, expect: archived", cfg.Name)
+	}
+
+	// The archived config is kept when other nodes are archived.
+	globalNodes.archive(NewKey("other", "1.0"), &Node{Config: `{"name":"template"}`})
+	nodeMap := loadArchive()
+	if n := nodeMap[key]; n == nil || n.Config != `{"name":"archived"}` {
+		t.Fatalf("archive: %v", nodeMap)
+	}
+
+	// The retry goroutine is stopped by CloseNode.
+	CloseNode()
+	etcdClient.Close()
+	done := make(chan struct{})
+	go func() {
+		globalNodes.retrying.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the retry goroutine is not stopped")
+	}
+}
+
+func TestRestoreArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+	defer func(d time.Duration) { syncRetryInterval = d }(syncRetryInterval)
+	syncRetryInterval = 100 * time.Millisecond
+
+	key := NewKey("test", "1.0")
+	os.Mkdir("./config", 0755)
+	b, _ := json.Marshal(map[string]*Node{
+		key: {Initialized: true, Config: `{"name":"archived"}`},
+	})
+	if err = ioutil.WriteFile(archiveFile, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: The embedded etcd is started after booting from the archive.
+	etcdClient, err := etcd.NewClient(etcd.Config{Endpoints: []string{testEtcdEndpoint}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer etcdClient.Close()
+	InitNode(etcdClient, 200*time.Millisecond)
+	defer CloseNode()
+	cfg := &testConfig{Name: "template"}
+	SyncNode("test", "1.0", cfg)
+	if cfg.Name != "archived" {
+		t.Fatalf("name: %s, expect: archived", cfg.Name)
+	}
+	e := startTestEtcd(t, dir+"/etcd")
+	defer e.Close()
+
+	var revs []*Revision
+	for i := 0; i < 100 && len(revs) == 0; i++ {
+		time.Sleep(100 * time.Millisecond)
+		revs, _ = listRevisions(etcdClient, key, 0)
+	}
+	if len(revs) != 1 || revs[0].Revision != 1 {
+		t.Fatalf("revisions: %v", revs)
+	}
+	events, err := listEvents(etcdClient, key, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Action != ActionRestore || events[0].Revision != 1 {
+		t.Fatalf("events: %v", events)
+	}
+
+	// The changes after restoring are watched.
+	if _, err = putRevision(etcdClient, key, `{"name":"updated"}`, "test", "", 0, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for cfg.get() != "updated" {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("name: %s, expect: updated", cfg.get())
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package configer
+
+import "strings"
+
+const (
+	// ENV_KEY_PREFIX the prifix of config environment overlay key in etcd
+	ENV_KEY_PREFIX = "MICRO-CONF-ENV"
+	// CLUSTER_KEY_PREFIX the prifix of config cluster overlay key in etcd
+	CLUSTER_KEY_PREFIX = "MICRO-CONF-CLUSTER"
+)
+
+// Overlay layers, deep-merged over the base config in order
+const (
+	OverlayEnv      = "env"
+	OverlayCluster  = "cluster"
+	OverlayInstance = "instance"
+)
+
+var overlayLayers = [...]string{OverlayEnv, OverlayCluster, OverlayInstance}
+
+// NewEnvKey creates a config environment overlay key from the config data key.
+func NewEnvKey(key, env string) string {
+	return ENV_KEY_PREFIX + strings.TrimPrefix(key, KEY_PREFIX) + "@" + env
+}
+
+// NewClusterKey creates a config cluster overlay key from the config data key.
+func NewClusterKey(key, cluster string) string {
+	return CLUSTER_KEY_PREFIX + strings.TrimPrefix(key, KEY_PREFIX) + "@" + cluster
+}
+
+// NewOverlayKey creates a config overlay key of the layer from the config data key.
+// Note:
+//  The layer is OverlayEnv, OverlayCluster or OverlayInstance, otherwise returns empty.
+func NewOverlayKey(key, layer, name string) string {
+	switch layer {
+	case OverlayEnv:
+		return NewEnvKey(key, name)
+	case OverlayCluster:
+		return NewClusterKey(key, name)
+	case OverlayInstance:
+		return NewOverrideKey(key, name)
+	}
+	return ""
+}
+
+// SetEnv sets the environment and cluster of the current instance,
+// which are used to select the overlays.
+// Note:
+//  It should be called before SyncNode;
+//  The default values are from the environment variables MICRO_ENV and MICRO_CLUSTER.
+func SetEnv(env, cluster string) {
+	instance.mu.Lock()
+	defer instance.mu.Unlock()
+	instance.env = env
+	instance.cluster = cluster
+}
+
+// overlayKeys returns the overlay keys of the current instance in order,
+// the key of the unset layer is empty.
+func overlayKeys(key string) []string {
+	instance.mu.RLock()
+	defer instance.mu.RUnlock()
+	keys := make([]string, len(overlayLayers))
+	for i, name := range [...]string{instance.env, instance.cluster, instance.addr} {
+		if len(name) > 0 {
+			keys[i] = NewOverlayKey(key, overlayLayers[i], name)
+		}
+	}
+	return keys
+}
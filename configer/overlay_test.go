@@ -0,0 +1,61 @@
+package configer
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOverlayLayer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	os.Chdir(dir)
+
+	cfg := new(testConfig)
+	n := &Node{
+		key:      NewKey("test", "1.0"),
+		object:   cfg,
+		doInitCh: make(chan error, 1),
+		nodes:    &Nodes{nodeMap: map[string]*Node{}},
+	}
+	if err = n.bind([]byte(`{"config":"{\"name\":\"base\"}","initialized":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		layer  int
+		data   string
+		expect string
+	}{
+		{1, `{"config":"{\"name\":\"cluster\"}"}`, "cluster"},
+		{0, `{"config":"{\"name\":\"env\"}"}`, "cluster"},
+		{2, `{"config":"{\"name\":\"instance\"}"}`, "instance"},
+		{2, ``, "cluster"},
+		{1, ``, "env"},
+		{0, ``, "base"},
+	} {
+		var data []byte
+		if c.data != "" {
+			data = []byte(c.data)
+		}
+		if err = n.bindOverlay(c.layer)(data); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Name != c.expect {
+			t.Fatalf("layer %s: name: %s, expect: %s", overlayLayers[c.layer], cfg.Name, c.expect)
+		}
+	}
+	if err = n.bindOverlay(2)([]byte(`{"config":"{\"name\":\"instance\"}"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err = n.bind([]byte(`{"config":"{\"name\":\"base2\"}","initialized":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "instance" {
+		t.Fatalf("name: %s, expect: instance", cfg.Name)
+	}
+}
@@ -0,0 +1,374 @@
+package configer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// SCHEMA_KEY_PREFIX the prifix of config JSON Schema key in etcd
+	SCHEMA_KEY_PREFIX = "MICRO-CONF-SCHEMA"
+)
+
+// NewSchemaKey creates a config JSON Schema key from the config data key.
+func NewSchemaKey(key string) string {
+	return SCHEMA_KEY_PREFIX + strings.TrimPrefix(key, KEY_PREFIX)
+}
+
+// Schemer is implemented by the config that provides a custom JSON Schema,
+// otherwise the schema is generated from the config struct by GenerateSchema.
+type Schemer interface {
+	JSONSchema() ([]byte, error)
+}
+
+func configSchema(cfg Config) ([]byte, error) {
+	if s, ok := cfg.(Schemer); ok {
+		return s.JSONSchema()
+	}
+	return json.Marshal(GenerateSchema(cfg))
+}
+
+var (
+	typeOfTime          = reflect.TypeOf(time.Time{})
+	typeOfDuration      = reflect.TypeOf(time.Duration(0))
+	typeOfJSONMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	typeOfYAMLMarshaler = reflect.TypeOf((*yaml.Marshaler)(nil)).Elem()
+)
+
+// GenerateSchema generates the JSON Schema of the value type according to the json tags.
+// Note:
+//  Only the types of fields are constrained, and no field is required;
+//  The root value may implement json.Marshaler, but the nested ones are not constrained.
+func GenerateSchema(v interface{}) map[string]interface{} {
+	return generateSchema(reflect.TypeOf(v), "json")
+}
+
+// generateSchema generates the JSON Schema of the type according to the tags of the name, 'json' or 'yaml'.
+func generateSchema(t reflect.Type, tagName string) map[string]interface{} {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return map[string]interface{}{}
+	}
+	return typeSchema(t, true, tagName)
+}
+
+func typeSchema(t reflect.Type, root bool, tagName string) map[string]interface{} {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	if !root {
+		marshaler := typeOfJSONMarshaler
+		if tagName == "yaml" {
+			marshaler = typeOfYAMLMarshaler
+		}
+		if t.Implements(marshaler) || reflect.PtrTo(t).Implements(marshaler) {
+			return map[string]interface{}{}
+		}
+	}
+	var s map[string]interface{}
+	switch {
+	case t == typeOfTime:
+		s = map[string]interface{}{"type": "string"}
+	case t == typeOfDuration && tagName == "yaml":
+		// NOTE: YAML encodes the duration as a string, such as '1m30s'.
+		s = map[string]interface{}{"type": "string"}
+	case t == typeOfDuration:
+		s = map[string]interface{}{"type": "integer"}
+	default:
+		switch t.Kind() {
+		case reflect.Bool:
+			s = map[string]interface{}{"type": "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			s = map[string]interface{}{"type": "integer"}
+		case reflect.Float32, reflect.Float64:
+			s = map[string]interface{}{"type": "number"}
+		case reflect.String:
+			s = map[string]interface{}{"type": "string"}
+		case reflect.Slice:
+			nullable = true
+			if t.Elem().Kind() == reflect.Uint8 {
+				s = map[string]interface{}{"type": "string"}
+			} else {
+				s = map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), false, tagName)}
+			}
+		case reflect.Array:
+			s = map[string]interface{}{"type": "array", "items": typeSchema(t.Elem(), false, tagName)}
+		case reflect.Map:
+			nullable = true
+			s = map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem(), false, tagName)}
+		case reflect.Struct:
+			properties := make(map[string]interface{})
+			structProperties(t, properties, tagName)
+			s = map[string]interface{}{"type": "object", "properties": properties}
+		default:
+			return map[string]interface{}{}
+		}
+	}
+	if nullable {
+		s["type"] = []interface{}{s["type"], "null"}
+	}
+	return s
+}
+
+func structProperties(t reflect.Type, properties map[string]interface{}, tagName string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		// NOTE: encoding/json inlines the untagged anonymous struct, but YAML only inlines the one with the 'inline' flag.
+		var inline bool
+		if tagName == "yaml" {
+			for _, opt := range opts[1:] {
+				inline = inline || opt == "inline"
+			}
+		} else {
+			inline = field.Anonymous && name == ""
+		}
+		if inline {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				structProperties(ft, properties, tagName)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			if tagName == "yaml" {
+				name = strings.ToLower(field.Name)
+			} else {
+				name = field.Name
+			}
+		}
+		properties[name] = typeSchema(field.Type, false, tagName)
+	}
+}
+
+// ValidationError a config field that violates the JSON Schema
+type ValidationError struct {
+	// Path the JSON path of the field, such as 'mysql.port' or 'endpoints[0]'; empty for the root
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// Error implements error interface.
+func (v *ValidationError) Error() string {
+	if v.Path == "" {
+		return v.Message
+	}
+	return v.Path + ": " + v.Message
+}
+
+// ValidateConfig validates the JSON config against the JSON Schema.
+// Note:
+//  The supported keywords are type, enum, const, properties, required, additionalProperties,
+//  items, minItems, maxItems, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+//  minLength, maxLength and pattern; the others are ignored.
+func ValidateConfig(schema []byte, config string) ([]*ValidationError, error) {
+	var s interface{}
+	if err := json.Unmarshal(schema, &s); err != nil {
+		return nil, fmt.Errorf("invalid JSON Schema: %s", err.Error())
+	}
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(config))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return []*ValidationError{{Message: "invalid JSON: " + err.Error()}}, nil
+	}
+	var errs []*ValidationError
+	validateValue("", s, v, &errs)
+	return errs, nil
+}
+
+func validateValue(path string, schema, v interface{}, errs *[]*ValidationError) {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		if b, ok := schema.(bool); ok && !b {
+			addValidationError(errs, path, "not allowed")
+		}
+		return
+	}
+	if t, ok := s["type"]; ok && !matchType(t, v) {
+		addValidationError(errs, path, fmt.Sprintf("expect type %s, got %s", rawJSON(t), jsonType(v)))
+		return
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		var found bool
+		for _, e := range enum {
+			if jsonEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			addValidationError(errs, path, fmt.Sprintf("expect one of %s", rawJSON(enum)))
+		}
+	}
+	if c, ok := s["const"]; ok && !jsonEqual(c, v) {
+		addValidationError(errs, path, fmt.Sprintf("expect %s", rawJSON(c)))
+	}
+	switch val := v.(type) {
+	case map[string]interface{}:
+		validateObject(path, s, val, errs)
+	case []interface{}:
+		if n, ok := schemaNumber(s, "minItems"); ok && float64(len(val)) < n {
+			addValidationError(errs, path, fmt.Sprintf("expect at least %v items", n))
+		}
+		if n, ok := schemaNumber(s, "maxItems"); ok && float64(len(val)) > n {
+			addValidationError(errs, path, fmt.Sprintf("expect at most %v items", n))
+		}
+		if items, ok := s["items"]; ok {
+			for i, item := range val {
+				validateValue(fmt.Sprintf("%s[%d]", path, i), items, item, errs)
+			}
+		}
+	case json.Number:
+		f, _ := val.Float64()
+		if n, ok := schemaNumber(s, "minimum"); ok && f < n {
+			addValidationError(errs, path, fmt.Sprintf("expect >= %v", n))
+		}
+		if n, ok := schemaNumber(s, "maximum"); ok && f > n {
+			addValidationError(errs, path, fmt.Sprintf("expect <= %v", n))
+		}
+		if n, ok := schemaNumber(s, "exclusiveMinimum"); ok && f <= n {
+			addValidationError(errs, path, fmt.Sprintf("expect > %v", n))
+		}
+		if n, ok := schemaNumber(s, "exclusiveMaximum"); ok && f >= n {
+			addValidationError(errs, path, fmt.Sprintf("expect < %v", n))
+		}
+	case string:
+		length := float64(len([]rune(val)))
+		if n, ok := schemaNumber(s, "minLength"); ok && length < n {
+			addValidationError(errs, path, fmt.Sprintf("expect at least %v characters", n))
+		}
+		if n, ok := schemaNumber(s, "maxLength"); ok && length > n {
+			addValidationError(errs, path, fmt.Sprintf("expect at most %v characters", n))
+		}
+		if pattern, ok := s["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				addValidationError(errs, path, fmt.Sprintf("invalid pattern %q: %s", pattern, err.Error()))
+			} else if !re.MatchString(val) {
+				addValidationError(errs, path, fmt.Sprintf("expect to match %q", pattern))
+			}
+		}
+	}
+}
+
+func validateObject(path string, s map[string]interface{}, val map[string]interface{}, errs *[]*ValidationError) {
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, ok := val[name]; !ok {
+					addValidationError(errs, joinPath(path, name), "required")
+				}
+			}
+		}
+	}
+	properties, _ := s["properties"].(map[string]interface{})
+	additional, hasAdditional := s["additionalProperties"]
+	keys := make([]string, 0, len(val))
+	for k := range val {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if p, ok := properties[k]; ok {
+			validateValue(joinPath(path, k), p, val[k], errs)
+		} else if hasAdditional {
+			validateValue(joinPath(path, k), additional, val[k], errs)
+		}
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func addValidationError(errs *[]*ValidationError, path, msg string) {
+	*errs = append(*errs, &ValidationError{Path: path, Message: msg})
+}
+
+func schemaNumber(s map[string]interface{}, keyword string) (float64, bool) {
+	n, ok := s[keyword].(float64)
+	return n, ok
+}
+
+func matchType(t interface{}, v interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		return matchTypeName(t, v)
+	case []interface{}:
+		for _, name := range t {
+			if s, ok := name.(string); ok && matchTypeName(s, v) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchTypeName(name string, v interface{}) bool {
+	actual := jsonType(v)
+	if actual == name {
+		return true
+	}
+	return name == "number" && actual == "integer"
+}
+
+func jsonType(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := val.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := val.Float64(); err == nil && f == float64(int64(f)) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
+
+func jsonEqual(a, b interface{}) bool {
+	if n, ok := b.(json.Number); ok {
+		f, _ := n.Float64()
+		b = f
+	}
+	return bytes.Equal(rawJSON(a), rawJSON(b))
+}
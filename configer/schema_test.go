@@ -0,0 +1,78 @@
+package configer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+type schemaTestConfig struct {
+	Host      string            `json:"host"`
+	Port      int               `json:"port"`
+	Timeout   time.Duration     `json:"timeout"`
+	Endpoints []string          `json:"endpoints"`
+	Labels    map[string]string `json:"labels"`
+	Debug     *bool             `json:"debug,omitempty"`
+	Ignored   string            `json:"-"`
+}
+
+func TestGenerateSchema(t *testing.T) {
+	schema, err := json.Marshal(GenerateSchema(new(schemaTestConfig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs, err := ValidateConfig(schema, `{"host":"a","port":3306,"timeout":1000,"endpoints":null,"labels":{"a":"b"},"debug":true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	errs, err = ValidateConfig(schema, `{"host":1,"port":"3306","endpoints":["x",2],"labels":{"a":1},"Ignored":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"endpoints[1]", "host", "labels.a", "port"}
+	if len(errs) != len(expect) {
+		t.Fatalf("errors: %v, expect paths: %v", errs, expect)
+	}
+	for i, e := range errs {
+		if e.Path != expect[i] {
+			t.Fatalf("errors[%d]: %v, expect path: %s", i, e, expect[i])
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	schema := []byte(`{
+		"type": "object",
+		"required": ["level"],
+		"additionalProperties": false,
+		"properties": {
+			"level": {"enum": ["debug", "info"]},
+			"port": {"type": "integer", "minimum": 1, "maximum": 65535},
+			"name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 8}
+		}
+	}`)
+	errs, err := ValidateConfig(schema, `{"port":70000,"name":"Abc","extra":1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"level", "extra", "name", "port"}
+	if len(errs) != len(expect) {
+		t.Fatalf("errors: %v, expect paths: %v", errs, expect)
+	}
+	for i, e := range errs {
+		if e.Path != expect[i] {
+			t.Fatalf("errors[%d]: %v, expect path: %s", i, e, expect[i])
+		}
+	}
+	errs, _ = ValidateConfig(schema, `{"level":"info","port":80.0}`)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	errs, _ = ValidateConfig(schema, `{`)
+	if len(errs) != 1 {
+		t.Fatalf("expect invalid JSON error, got: %v", errs)
+	}
+}
@@ -0,0 +1,289 @@
+package configer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// SecretMask the masked value of the encrypted field
+	SecretMask = "******"
+	// secretEnvelopePrefix the prefix of the encrypted value: ENC[v1,<key id>,<base64(nonce+ciphertext)>]
+	secretEnvelopePrefix = "ENC[v1,"
+)
+
+var secretEnvelopeRegexp = regexp.MustCompile(`"ENC\[v1,[^"\]]*\]"`)
+
+// KeyProvider provides the AES-256 data keys of the encrypted config values.
+type KeyProvider interface {
+	// CurrentKey returns the key that is used to encrypt.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key of the ID, which is used to decrypt.
+	Key(id string) ([]byte, error)
+}
+
+var keyProvider = struct {
+	provider KeyProvider
+	mu       sync.RWMutex
+}{}
+
+// SetKeyProvider sets the key provider of the encrypted config values,
+// which is used by both SyncNode and the config manager.
+func SetKeyProvider(p KeyProvider) {
+	keyProvider.mu.Lock()
+	keyProvider.provider = p
+	keyProvider.mu.Unlock()
+}
+
+func getKeyProvider() KeyProvider {
+	keyProvider.mu.RLock()
+	defer keyProvider.mu.RUnlock()
+	return keyProvider.provider
+}
+
+// FileKeyProvider a key provider that loads keys from a local file.
+// Note:
+//  Each line of the file is '<key id>:<base64 encoded 32 bytes key>', and the line starting with '#' is ignored;
+//  The last key is used to encrypt, so the key can be rotated by appending a new line.
+type FileKeyProvider struct {
+	keys      map[string][]byte
+	currentID string
+}
+
+var _ KeyProvider = new(FileKeyProvider)
+
+// NewFileKeyProvider creates a key provider from a local key file.
+func NewFileKeyProvider(filename string) (*FileKeyProvider, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	p := &FileKeyProvider{keys: make(map[string][]byte)}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		idx := strings.Index(text, ":")
+		if idx <= 0 {
+			return nil, fmt.Errorf("key file %s:%d: expect '<key id>:<base64 key>'", filename, line)
+		}
+		id := text[:idx]
+		if strings.ContainsAny(id, ",]\"") {
+			return nil, fmt.Errorf("key file %s:%d: invalid key id %q", filename, line, id)
+		}
+		key, err := base64.StdEncoding.DecodeString(text[idx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("key file %s:%d: %s", filename, line, err.Error())
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key file %s:%d: expect 32 bytes key, got %d", filename, line, len(key))
+		}
+		p.keys[id] = key
+		p.currentID = id
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	if p.currentID == "" {
+		return nil, fmt.Errorf("key file %s: no key", filename)
+	}
+	return p, nil
+}
+
+// CurrentKey returns the last key of the file.
+func (p *FileKeyProvider) CurrentKey() (string, []byte, error) {
+	return p.currentID, p.keys[p.currentID], nil
+}
+
+// Key returns the key of the ID.
+func (p *FileKeyProvider) Key(id string) ([]byte, error) {
+	key, ok := p.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key is not found: %s", id)
+	}
+	return key, nil
+}
+
+// EncryptValue encrypts the plaintext with the current key, and returns the envelope.
+func EncryptValue(p KeyProvider, plaintext string) (string, error) {
+	if p == nil {
+		return "", errors.New("no key provider")
+	}
+	id, key, err := p.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(id))
+	return secretEnvelopePrefix + id + "," + base64.StdEncoding.EncodeToString(sealed) + "]", nil
+}
+
+// DecryptValue decrypts the envelope.
+func DecryptValue(p KeyProvider, envelope string) (string, error) {
+	if !IsEncrypted(envelope) {
+		return "", errors.New("invalid encrypted value")
+	}
+	if p == nil {
+		return "", errors.New("no key provider")
+	}
+	body := envelope[len(secretEnvelopePrefix) : len(envelope)-1]
+	idx := strings.Index(body, ",")
+	if idx < 0 {
+		return "", errors.New("invalid encrypted value")
+	}
+	id := body[:idx]
+	sealed, err := base64.StdEncoding.DecodeString(body[idx+1:])
+	if err != nil {
+		return "", err
+	}
+	key, err := p.Key(id)
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(id))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted returns whether the value is an encrypted envelope.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, secretEnvelopePrefix) && strings.HasSuffix(value, "]")
+}
+
+// DecryptConfig decrypts all the encrypted string values of the JSON config.
+func DecryptConfig(p KeyProvider, config string) (string, error) {
+	if !strings.Contains(config, secretEnvelopePrefix) {
+		return config, nil
+	}
+	v, err := decodeJSON(config)
+	if err != nil {
+		return "", err
+	}
+	v, err = walkStrings(v, "", func(path, s string) (interface{}, error) {
+		if !IsEncrypted(s) {
+			return s, nil
+		}
+		plaintext, err := DecryptValue(p, s)
+		if err != nil {
+			return nil, fmt.Errorf("decrypt %s: %s", path, err.Error())
+		}
+		return plaintext, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// MaskConfig replaces all the encrypted values of the JSON config with SecretMask.
+func MaskConfig(config string) string {
+	return secretEnvelopeRegexp.ReplaceAllString(config, `"`+SecretMask+`"`)
+}
+
+// unmaskConfig restores the masked values of the new config from the old config,
+// so that the masked config can be edited and written back.
+func unmaskConfig(newConfig, oldConfig string) (string, error) {
+	if !strings.Contains(newConfig, `"`+SecretMask+`"`) {
+		return newConfig, nil
+	}
+	newVal, err := decodeJSON(newConfig)
+	if err != nil {
+		return "", err
+	}
+	oldVal, _ := decodeJSON(oldConfig)
+	newVal, err = walkStrings(newVal, "", func(path, s string) (interface{}, error) {
+		if s != SecretMask {
+			return s, nil
+		}
+		if old, ok := lookupPath(oldVal, path).(string); ok && IsEncrypted(old) {
+			return old, nil
+		}
+		return nil, fmt.Errorf("%s: masked value has no encrypted value to restore", path)
+	})
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(newVal)
+	return string(b), err
+}
+
+func decodeJSON(config string) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader([]byte(config)))
+	dec.UseNumber()
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// walkStrings replaces every string value by fn, the path is the same as Change.Path.
+func walkStrings(v interface{}, path string, fn func(path, s string) (interface{}, error)) (interface{}, error) {
+	var err error
+	switch val := v.(type) {
+	case string:
+		return fn(path, val)
+	case map[string]interface{}:
+		for k, item := range val {
+			if val[k], err = walkStrings(item, joinPath(path, k), fn); err != nil {
+				return nil, err
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			if val[i], err = walkStrings(item, fmt.Sprintf("%s[%d]", path, i), fn); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+func lookupPath(v interface{}, path string) interface{} {
+	var found interface{}
+	walkStrings(v, "", func(p, s string) (interface{}, error) {
+		if p == path {
+			found = s
+		}
+		return s, nil
+	})
+	return found
+}
@@ -0,0 +1,73 @@
+package configer
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestKeyProvider(t *testing.T, dir string, ids ...string) *FileKeyProvider {
+	var lines []string
+	for i, id := range ids {
+		key := make([]byte, 32)
+		key[0] = byte(i + 1)
+		lines = append(lines, id+":"+base64.StdEncoding.EncodeToString(key))
+	}
+	filename := filepath.Join(dir, "keys")
+	if err := ioutil.WriteFile(filename, []byte("# test keys\n"+strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewFileKeyProvider(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSecret(t *testing.T) {
+	dir, err := ioutil.TempDir("", "configer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	oldProvider := newTestKeyProvider(t, dir, "k1")
+	envelope, err := EncryptValue(oldProvider, "p@ss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(envelope) || !strings.HasPrefix(envelope, "ENC[v1,k1,") {
+		t.Fatalf("envelope: %s", envelope)
+	}
+
+	// rotate key
+	p := newTestKeyProvider(t, dir, "k1", "k2")
+	config := `{"host":"a","password":"` + envelope + `","port":3306}`
+	plain, err := DecryptConfig(p, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain != `{"host":"a","password":"p@ss","port":3306}` {
+		t.Fatalf("decrypted: %s", plain)
+	}
+	if _, err = DecryptConfig(nil, config); err == nil {
+		t.Fatal("expect no key provider error")
+	}
+
+	masked := MaskConfig(config)
+	if masked != `{"host":"a","password":"******","port":3306}` {
+		t.Fatalf("masked: %s", masked)
+	}
+	unmasked, err := unmaskConfig(strings.Replace(masked, `"a"`, `"b"`, 1), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unmasked != `{"host":"b","password":"`+envelope+`","port":3306}` {
+		t.Fatalf("unmasked: %s", unmasked)
+	}
+	if _, err = unmaskConfig(`{"token":"******"}`, config); err == nil {
+		t.Fatal("expect no encrypted value to restore error")
+	}
+}
@@ -0,0 +1,244 @@
+package configer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Format the encoding format of the typed config struct
+type Format int
+
+const (
+	// FormatJSON encodes the struct according to the json tags
+	FormatJSON Format = iota
+	// FormatYAML encodes the struct according to the yaml tags
+	FormatYAML
+)
+
+// Typed a config that wraps any struct pointer, and implements Config and Schemer,
+// so no hand-written UnmarshalJSON, MarshalJSON and Reload is required.
+// Note:
+//  The config is always stored as JSON in etcd, and the YAML struct is converted by the yaml tags;
+//  Every change is decoded into a new struct that starts from the default values, then swapped atomically,
+//  so the readers see either the old or the new value, which must be treated as read-only.
+type Typed struct {
+	typ         reflect.Type
+	format      Format
+	defaults    []byte
+	current     []byte
+	value       atomic.Value
+	subscribers []*subscriber
+	subMutex    sync.RWMutex
+	mu          sync.Mutex
+}
+
+var (
+	_ Config  = new(Typed)
+	_ Schemer = new(Typed)
+)
+
+type subscriber struct {
+	paths []string
+	fn    func([]*Change)
+}
+
+// NewTyped creates a typed config from the struct pointer that holds the default values.
+// Note:
+//  The format is FormatJSON by default;
+//  The struct pointer is used as the initial value, and should not be modified after that.
+func NewTyped(ptr interface{}, format ...Format) (*Typed, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("typed config must be a non-nil struct pointer, got %T", ptr)
+	}
+	t := &Typed{typ: v.Elem().Type()}
+	if len(format) > 0 {
+		t.format = format[0]
+	}
+	if t.format != FormatJSON && t.format != FormatYAML {
+		return nil, fmt.Errorf("unknown typed config format: %d", t.format)
+	}
+	b, err := t.marshal(ptr)
+	if err != nil {
+		return nil, err
+	}
+	t.defaults = b
+	t.current = b
+	t.value.Store(ptr)
+	return t, nil
+}
+
+// MustNewTyped creates a typed config from the struct pointer, and exits if it fails.
+func MustNewTyped(ptr interface{}, format ...Format) *Typed {
+	t, err := NewTyped(ptr, format...)
+	must(err)
+	return t
+}
+
+// SyncTyped registers the struct pointer as a typed config, and syncs it from etcd.
+func SyncTyped(service, version string, ptr interface{}, format ...Format) *Typed {
+	t := MustNewTyped(ptr, format...)
+	SyncNode(service, version, t)
+	return t
+}
+
+// Load returns the current struct pointer, which must be treated as read-only.
+func (t *Typed) Load() interface{} {
+	return t.value.Load()
+}
+
+// Subscribe adds a subscriber that is notified of the changed fields after a new value is swapped.
+// Note:
+//  If paths are given, only the changes of the paths or their sub paths are notified, such as 'mysql' for 'mysql.host';
+//  The paths are the same as Change.Path, and use the names of the json or yaml tags;
+//  fn is called synchronously in the order of changes, so it should not block.
+func (t *Typed) Subscribe(fn func(changes []*Change), paths ...string) {
+	t.subMutex.Lock()
+	t.subscribers = append(t.subscribers, &subscriber{paths: paths, fn: fn})
+	t.subMutex.Unlock()
+}
+
+// UnmarshalJSON decodes the JSON config and swaps the value.
+func (t *Typed) UnmarshalJSON(b []byte) error {
+	return t.Reload(b)
+}
+
+// MarshalJSON encodes the current value to JSON.
+func (t *Typed) MarshalJSON() ([]byte, error) {
+	return t.marshal(t.Load())
+}
+
+// Reload decodes the JSON config into a new value that starts from the default values,
+// then swaps it and notifies the subscribers.
+// Note:
+//  The fields missing in the config keep the default values, and the maps are merged with the default entries.
+func (t *Typed) Reload(b []byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ptr := reflect.New(t.typ).Interface()
+	if err := t.unmarshal(t.defaults, ptr); err != nil {
+		return err
+	}
+	if err := t.unmarshal(b, ptr); err != nil {
+		return err
+	}
+	current, err := t.marshal(ptr)
+	if err != nil {
+		return err
+	}
+	changes, err := DiffConfig(string(t.current), string(current))
+	if err != nil {
+		return err
+	}
+	t.value.Store(ptr)
+	t.current = current
+	if len(changes) == 0 {
+		return nil
+	}
+	t.subMutex.RLock()
+	subscribers := t.subscribers
+	t.subMutex.RUnlock()
+	for _, s := range subscribers {
+		if matched := s.match(changes); len(matched) > 0 {
+			s.fn(matched)
+		}
+	}
+	return nil
+}
+
+// JSONSchema returns the JSON Schema generated from the struct according to the tags of the format.
+func (t *Typed) JSONSchema() ([]byte, error) {
+	tagName := "json"
+	if t.format == FormatYAML {
+		tagName = "yaml"
+	}
+	return json.Marshal(generateSchema(t.typ, tagName))
+}
+
+func (t *Typed) marshal(ptr interface{}) ([]byte, error) {
+	if t.format == FormatJSON {
+		return json.Marshal(ptr)
+	}
+	b, err := yaml.Marshal(ptr)
+	if err != nil {
+		return nil, err
+	}
+	return yamlToJSON(b)
+}
+
+func (t *Typed) unmarshal(b []byte, ptr interface{}) error {
+	if t.format == FormatJSON {
+		return json.Unmarshal(b, ptr)
+	}
+	// NOTE: JSON is a subset of YAML, but the indent tabs of JSON are not allowed by YAML.
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, b); err != nil {
+		return err
+	}
+	return yaml.Unmarshal(buf.Bytes(), ptr)
+}
+
+func (s *subscriber) match(changes []*Change) []*Change {
+	if len(s.paths) == 0 {
+		return changes
+	}
+	var matched []*Change
+	for _, c := range changes {
+		for _, p := range s.paths {
+			if c.Path == p || strings.HasPrefix(c.Path, p+".") || strings.HasPrefix(c.Path, p+"[") {
+				matched = append(matched, c)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+func yamlToJSON(b []byte) ([]byte, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, err
+	}
+	v, err := convertYAML(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// convertYAML converts the YAML maps to the JSON objects.
+func convertYAML(v interface{}) (interface{}, error) {
+	var err error
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			key, ok := k.(string)
+			if !ok {
+				if k == nil || reflect.TypeOf(k).Kind() == reflect.Map || reflect.TypeOf(k).Kind() == reflect.Slice {
+					return nil, errors.New("unsupported YAML map key for JSON")
+				}
+				key = fmt.Sprint(k)
+			}
+			if m[key], err = convertYAML(item); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		for i, item := range val {
+			if val[i], err = convertYAML(item); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,148 @@
+package configer
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+)
+
+type typedJSONConfig struct {
+	Host    string            `json:"host"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags"`
+	Extra   map[string]string `json:"extra"`
+	Timeout time.Duration     `json:"timeout"`
+}
+
+type typedYAMLConfig struct {
+	Mysql struct {
+		Host string `yaml:"host"`
+		Port int    `yaml:"port"`
+	} `yaml:"mysql"`
+	Debug   bool
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func TestTypedJSON(t *testing.T) {
+	cfg := MustNewTyped(&typedJSONConfig{Host: "localhost", Port: 3306})
+	var (
+		all, port []*Change
+		mu        sync.Mutex
+	)
+	cfg.Subscribe(func(changes []*Change) {
+		mu.Lock()
+		all = changes
+		mu.Unlock()
+	})
+	cfg.Subscribe(func(changes []*Change) {
+		mu.Lock()
+		port = changes
+		mu.Unlock()
+	}, "port")
+
+	old := cfg.Load().(*typedJSONConfig)
+	if err := cfg.Reload([]byte(`{"host":"db","tags":["a"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	cur := cfg.Load().(*typedJSONConfig)
+	if old.Host != "localhost" || cur == old {
+		t.Fatalf("the old value is modified: %+v", old)
+	}
+	if cur.Host != "db" || cur.Port != 3306 || len(cur.Tags) != 1 {
+		t.Fatalf("unexpected value: %+v", cur)
+	}
+	if len(all) != 2 || all[0].Path != "host" || string(all[0].Old) != `"localhost"` || string(all[0].New) != `"db"` ||
+		all[1].Path != "tags" {
+		b, _ := json.Marshal(all)
+		t.Fatalf("unexpected changes: %s", b)
+	}
+	if port != nil {
+		t.Fatalf("unexpected port changes: %v", port)
+	}
+
+	all = nil
+	if err := cfg.Reload([]byte(`{"host":"db","port":3307,"tags":["a"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || len(port) != 1 || port[0].Path != "port" {
+		t.Fatalf("unexpected changes: %v, %v", all, port)
+	}
+
+	if err := cfg.Reload([]byte(`{"port":"x"}`)); err == nil {
+		t.Fatal("expect decoding error")
+	}
+	if cfg.Load().(*typedJSONConfig).Port != 3307 {
+		t.Fatal("the value is swapped after the decoding error")
+	}
+
+	b, _ := cfg.MarshalJSON()
+	if string(b) != `{"host":"db","port":3307,"tags":["a"],"extra":null,"timeout":0}` {
+		t.Fatalf("unexpected JSON: %s", b)
+	}
+}
+
+func TestTypedYAML(t *testing.T) {
+	def := &typedYAMLConfig{Timeout: time.Second}
+	def.Mysql.Host = "localhost"
+	cfg := MustNewTyped(def, FormatYAML)
+	b, err := cfg.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"debug":false,"mysql":{"host":"localhost","port":0},"timeout":"1s"}` {
+		t.Fatalf("unexpected JSON: %s", b)
+	}
+	var changes []*Change
+	cfg.Subscribe(func(c []*Change) { changes = c }, "mysql")
+	if err = cfg.Reload([]byte("{\n\t\"mysql\": {\"port\": 3306},\n\t\"timeout\": \"2m\"\n}")); err != nil {
+		t.Fatal(err)
+	}
+	cur := cfg.Load().(*typedYAMLConfig)
+	if cur.Mysql.Host != "localhost" || cur.Mysql.Port != 3306 || cur.Timeout != 2*time.Minute {
+		t.Fatalf("unexpected value: %+v", cur)
+	}
+	if len(changes) != 1 || changes[0].Path != "mysql.port" {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	schema, _ := cfg.JSONSchema()
+	errs, err := ValidateConfig(schema, `{"debug":1,"mysql":{"host":"h"},"timeout":"1s"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Path != "debug" {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+}
+
+func TestTypedConcurrency(t *testing.T) {
+	cfg := MustNewTyped(&typedJSONConfig{Host: "a", Port: 1})
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			c := cfg.Load().(*typedJSONConfig)
+			if (c.Host == "a") != (c.Port == 1) {
+				t.Errorf("torn value: %+v", c)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			cfg.Reload([]byte(`{"host":"b","port":2}`))
+		} else {
+			cfg.Reload([]byte(`{"host":"a","port":1}`))
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -41,7 +41,9 @@ func SetServiceNamespace(prefix string) {
 // ServiceInfo serivce info
 type ServiceInfo struct {
 	UriPaths []string `json:"uri_paths"`
-	mu       sync.RWMutex
+	// Addrs the addresses of the extra listeners, the key is network or network/proto, such as 'unix' or 'tcp/http'
+	Addrs map[string]string `json:"addrs,omitempty"`
+	mu    sync.RWMutex
 }
 
 // String returns the JSON string.
@@ -59,6 +61,24 @@ func (s *ServiceInfo) Append(uriPath ...string) {
 	s.UriPaths = append(s.UriPaths, uriPath...)
 }
 
+// SetAddr sets the address of the extra listener.
+func (s *ServiceInfo) SetAddr(key, addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Addrs == nil {
+		s.Addrs = make(map[string]string)
+	}
+	s.Addrs[key] = addr
+}
+
+// Addr returns the address of the extra listener.
+func (s *ServiceInfo) Addr(key string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addr, ok := s.Addrs[key]
+	return addr, ok
+}
+
 func createServiceKey(addr string) string {
 	return serviceNamespace + addr
 }
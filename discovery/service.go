@@ -23,6 +23,7 @@ import (
 
 	"github.com/henrylee2cn/erpc/v6"
 	heartbeat "github.com/henrylee2cn/erpc/v6/plugin/heartbeat"
+	micro "github.com/xiaoenai/tp-micro/v6"
 	"github.com/xiaoenai/tp-micro/v6/model/etcd"
 )
 
@@ -43,8 +44,9 @@ type Service struct {
 }
 
 var (
-	_ erpc.PostRegPlugin    = new(Service)
-	_ erpc.PostListenPlugin = new(Service)
+	_ erpc.PostRegPlugin          = new(Service)
+	_ erpc.PostListenPlugin       = new(Service)
+	_ micro.PostListenExtraPlugin = new(Service)
 )
 
 // ServicePlugin creates a erpc plugin which automatically registered api info to etcd.
@@ -149,6 +151,32 @@ L:
 	return nil
 }
 
+// PostListenExtra adds the address of the extra listener to serviceInfo.
+// Note:
+//  For TCP networks, the host is the same as the main listener's.
+func (s *Service) PostListenExtra(addr net.Addr, proto string) error {
+	network := addr.Network()
+	key := network
+	if proto != "" {
+		key += "/" + proto
+	}
+	switch network {
+	case "unix", "unixpacket":
+		s.serviceInfo.SetAddr(key, addr.String())
+	default:
+		host, _, err := net.SplitHostPort(s.hostport)
+		if err != nil {
+			return err
+		}
+		_, port, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return err
+		}
+		s.serviceInfo.SetAddr(key, net.JoinHostPort(host, port))
+	}
+	return nil
+}
+
 func (s *Service) anywayKeepAlive() <-chan *etcd.LeaseKeepAliveResponse {
 	ch, err := s.keepAlive()
 	for err != nil {
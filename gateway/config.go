@@ -25,15 +25,16 @@ import (
 
 // Config app config
 type Config struct {
-	EnableHttp        bool                `yaml:"enable_http"`
-	EnableSocket      bool                `yaml:"enable_socket"`
-	EnableWebSocket   bool                `yaml:"enable_web_socket"`
-	OuterHttpServer   short.HttpSrvConfig `yaml:"outer_http_server"`
-	OuterSocketServer micro.SrvConfig     `yaml:"outer_socket_server"`
-	InnerSocketServer micro.SrvConfig     `yaml:"inner_socket_server"`
-	InnerSocketClient micro.CliConfig     `yaml:"inner_socket_client"`
-	WebSocketServer   micro.SrvConfig     `yaml:"web_socket_server"`
-	Etcd              etcd.EasyConfig     `yaml:"etcd"`
+	EnableHttp        bool                 `yaml:"enable_http"`
+	EnableSocket      bool                 `yaml:"enable_socket"`
+	EnableWebSocket   bool                 `yaml:"enable_web_socket"`
+	OuterHttpServer   short.HttpSrvConfig  `yaml:"outer_http_server"`
+	OuterSocketServer micro.SrvConfig      `yaml:"outer_socket_server"`
+	InnerSocketServer micro.SrvConfig      `yaml:"inner_socket_server"`
+	InnerSocketClient micro.CliConfig      `yaml:"inner_socket_client"`
+	WebSocketServer   micro.SrvConfig      `yaml:"web_socket_server"`
+	Etcd              etcd.EasyConfig      `yaml:"etcd"`
+	Recovery          micro.RecoveryConfig `yaml:"recovery"`
 }
 
 // NewConfig creates a default config.
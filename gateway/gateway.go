@@ -23,6 +23,7 @@ import (
 	// "github.com/henrylee2cn/erpc/v6/proto/httproto"
 	"github.com/henrylee2cn/erpc/v6/mixer/websocket/jsonSubProto"
 	"github.com/henrylee2cn/erpc/v6/proto/rawproto"
+	micro "github.com/xiaoenai/tp-micro/v6"
 	"github.com/xiaoenai/tp-micro/v6/clientele"
 	"github.com/xiaoenai/tp-micro/v6/gateway/logic"
 	"github.com/xiaoenai/tp-micro/v6/gateway/logic/hosts"
@@ -55,6 +56,9 @@ func Run(cfg Config, biz *types.Business, protoFunc, wsProtoFunc erpc.ProtoFunc)
 	if biz == nil {
 		biz = types.DefaultBusiness()
 	}
+	if biz.Recovery == nil {
+		biz.Recovery = micro.NewRecoveryPlugin(cfg.Recovery.Reporters()...)
+	}
 	logic.SetBusiness(biz)
 
 	// sdk version
@@ -17,6 +17,7 @@ package logic
 import (
 	"github.com/henrylee2cn/erpc/v6"
 	"github.com/henrylee2cn/erpc/v6/plugin/proxy"
+	micro "github.com/xiaoenai/tp-micro/v6"
 	"github.com/xiaoenai/tp-micro/v6/gateway/types"
 )
 
@@ -74,3 +75,8 @@ func ProxySelector(label *proxy.Label) proxy.Forwarder {
 func InnerServerPlugins() []erpc.Plugin {
 	return globalBusiness.InnerServerPlugins
 }
+
+// Recovery returns the panic recovery plugin.
+func Recovery() *micro.RecoveryPlugin {
+	return globalBusiness.Recovery
+}
@@ -17,14 +17,14 @@ package http
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"time"
 
-	"github.com/henrylee2cn/goutil"
 	"github.com/henrylee2cn/erpc/v6"
 	"github.com/henrylee2cn/erpc/v6/codec"
 	"github.com/henrylee2cn/erpc/v6/plugin/proxy"
+	"github.com/henrylee2cn/goutil"
 	"github.com/valyala/fasthttp"
+	micro "github.com/xiaoenai/tp-micro/v6"
 	"github.com/xiaoenai/tp-micro/v6/gateway/logic"
 	"github.com/xiaoenai/tp-micro/v6/gateway/logic/hosts"
 )
@@ -48,8 +48,6 @@ type requestHandler struct {
 	errMsg []byte
 }
 
-var statInternalServerError = erpc.NewStatus(erpc.CodeInternalServerError, erpc.CodeText(erpc.CodeInternalServerError), "")
-
 func (r *requestHandler) handle() {
 	var (
 		ctx             = r.ctx
@@ -78,7 +76,7 @@ func (r *requestHandler) handle() {
 	start := time.Now()
 	defer func() {
 		if p := recover(); p != nil {
-			r.replyError(statInternalServerError.SetCause(fmt.Sprint(p)))
+			r.replyError(logic.Recovery().Recover(p, label.ServiceMethod, label.SessionID, label.RealIP))
 		}
 		r.runlog(start, &label, goutil.BytesToString(query.Peek(SEQ)), bodyBytes, &reply)
 	}()
@@ -197,19 +195,8 @@ func (r *requestHandler) crossDomainFilter() bool {
 }
 
 func (r *requestHandler) replyError(stat *erpc.Status) {
-	var statusCode int
-	if stat.Code() < 200 {
-		// Internal communication error
-		statusCode = 500
-	} else if stat.Code() < 600 {
-		// Custom HTTP error
-		statusCode = int(stat.Code())
-	} else {
-		// Business error
-		statusCode = 299
-	}
 	r.errMsg, _ = stat.MarshalJSON()
-	r.ctx.SetStatusCode(statusCode)
+	r.ctx.SetStatusCode(micro.HttpStatusCode(stat))
 	r.ctx.SetContentType("application/json")
 	r.ctx.SetBody(r.errMsg)
 }
@@ -50,6 +50,7 @@ func Serve(outerSrvCfg, innerSrvCfg micro.SrvConfig, protoFunc erpc.ProtoFunc) {
 		socketConnTabPlugin,
 		proxy.NewPlugin(logic.ProxySelector),
 		preWritePushPlugin(),
+		logic.Recovery(),
 	)
 
 	outerPeer = outerServer.Peer()
@@ -59,7 +60,7 @@ func Serve(outerSrvCfg, innerSrvCfg micro.SrvConfig, protoFunc erpc.ProtoFunc) {
 		innerSrvCfg.InnerIpPort(),
 		clientele.GetEtcdClient(),
 	)
-	innerPlugins = append(innerPlugins, discoveryService)
+	innerPlugins = append(innerPlugins, discoveryService, logic.Recovery())
 	innerServer := micro.NewServer(
 		innerSrvCfg,
 		innerPlugins...,
@@ -25,6 +25,7 @@ func Serve(outerSrvCfg micro.SrvConfig, protoFunc erpc.ProtoFunc) {
 		webSocketConnTabPlugin,
 		proxy.NewPlugin(logic.ProxySelector),
 		preWritePushPlugin(),
+		logic.Recovery(),
 	}
 	if outerSrvCfg.EnableHeartbeat{
 		globalLeftPlugin = append(globalLeftPlugin,heartbeat.NewPong())
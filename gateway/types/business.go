@@ -17,6 +17,7 @@ package types
 import (
 	"github.com/henrylee2cn/erpc/v6"
 	"github.com/henrylee2cn/erpc/v6/plugin/proxy"
+	micro "github.com/xiaoenai/tp-micro/v6"
 	"github.com/xiaoenai/tp-micro/v6/clientele"
 )
 
@@ -34,6 +35,9 @@ type Business struct {
 	ProxySelector func(*proxy.Label) proxy.Forwarder
 	// InnerServerPlugins inner server plugins
 	InnerServerPlugins []erpc.Plugin
+	// Recovery recovers and reports the panic of request handling,
+	// if nil, created by the recovery config of the gateway
+	Recovery *micro.RecoveryPlugin
 }
 
 // DefaultBusiness creates a new default Business object.
@@ -0,0 +1,263 @@
+// Copyright 2018 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/erpc/v6/codec"
+	"github.com/henrylee2cn/goutil"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	httpBodyCodecMapping = map[string]byte{
+		"application/x-protobuf":            codec.ID_PROTOBUF,
+		"application/json":                  codec.ID_JSON,
+		"application/x-www-form-urlencoded": codec.ID_FORM,
+		"text/plain":                        codec.ID_PLAIN,
+	}
+	httpContentTypeMapping = map[byte]string{
+		codec.ID_PROTOBUF: "application/x-protobuf",
+		codec.ID_JSON:     "application/json",
+		codec.ID_FORM:     "application/x-www-form-urlencoded",
+		codec.ID_PLAIN:    "text/plain",
+	}
+	httpCodecMutex sync.RWMutex
+	// httpForwardHeaders the HTTP headers forwarded to the metadata by the HTTP transcoding endpoint.
+	// NOTE:
+	//  The others are dropped, especially the metadata reserved by the framework, such as X-Caller-Service.
+	httpForwardHeaders = []string{
+		"Authorization",
+		"Accept-Language",
+		"User-Agent",
+		"X-Request-Id",
+	}
+)
+
+// RegHttpBodyCodec registers a mapping of content type to body coder (for the HTTP transcoding endpoint).
+func RegHttpBodyCodec(contentType string, codecId byte) {
+	httpCodecMutex.Lock()
+	defer httpCodecMutex.Unlock()
+	httpBodyCodecMapping[contentType] = codecId
+	httpContentTypeMapping[codecId] = contentType
+}
+
+// GetHttpBodyCodec returns the codec id from content type.
+func GetHttpBodyCodec(contentType string, defCodecId byte) byte {
+	idx := strings.Index(contentType, ";")
+	if idx != -1 {
+		contentType = contentType[:idx]
+	}
+	httpCodecMutex.RLock()
+	codecId, ok := httpBodyCodecMapping[contentType]
+	httpCodecMutex.RUnlock()
+	if !ok {
+		return defCodecId
+	}
+	return codecId
+}
+
+// GetHttpContentType returns the content type from codec id.
+func GetHttpContentType(codecId byte, defContentType string) string {
+	httpCodecMutex.RLock()
+	contentType, ok := httpContentTypeMapping[codecId]
+	httpCodecMutex.RUnlock()
+	if !ok {
+		return defContentType
+	}
+	return contentType
+}
+
+// HttpStatusCode returns the HTTP status code corresponding to the status.
+// Note:
+//  code<200: internal communication error, returns 500;
+//  200<=code<600: custom HTTP error, returns the code;
+//  code>=600: business error, returns 299.
+func HttpStatusCode(stat *erpc.Status) int {
+	if stat.Code() < 200 {
+		// Internal communication error
+		return 500
+	} else if stat.Code() < 600 {
+		// Custom HTTP error
+		return int(stat.Code())
+	}
+	// Business error
+	return 299
+}
+
+const (
+	// metaPeerIdentity the metadata key of the client identity verified by the HTTP transcoding endpoint.
+	// NOTE: It is only trusted on the in-process session of the endpoint.
+	metaPeerIdentity = "X-Peer-Identity"
+	// httpFrontKey the session swap key marking the in-process session of the HTTP transcoding endpoint
+	httpFrontKey = "micro.http_front"
+)
+
+// callerIdentity returns the verified identity of the caller,
+// by mutual TLS of the session or of the HTTP transcoding endpoint.
+func callerIdentity(ctx interface {
+	Session() erpc.CtxSession
+	PeekMeta(key string) []byte
+}) (string, bool) {
+	sess := ctx.Session()
+	if identity, ok := PeerIdentity(sess); ok {
+		return identity, true
+	}
+	if _, ok := sess.Swap().Load(httpFrontKey); ok {
+		if identity := ctx.PeekMeta(metaPeerIdentity); len(identity) > 0 {
+			return string(identity), true
+		}
+	}
+	return "", false
+}
+
+// httpFront the lightweight HTTP/JSON transcoding endpoint,
+// which calls the local router in-process.
+type httpFront struct {
+	srv     *Server
+	cliPeer erpc.Peer
+	sess    erpc.Session
+	mu      sync.Mutex
+}
+
+func newHttpFront(srv *Server) *httpFront {
+	return &httpFront{
+		srv:     srv,
+		cliPeer: erpc.NewPeer(erpc.PeerConfig{}),
+	}
+}
+
+// session returns the in-process session connected to the server peer.
+func (h *httpFront) session() (erpc.Session, *erpc.Status) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.sess != nil && h.sess.Health() {
+		return h.sess, nil
+	}
+	srvConn, cliConn := net.Pipe()
+	srvSess, stat := h.srv.peer.ServeConn(srvConn)
+	if !stat.OK() {
+		cliConn.Close()
+		return nil, stat
+	}
+	srvSess.Swap().Store(httpFrontKey, true)
+	sess, stat := h.cliPeer.ServeConn(cliConn)
+	if !stat.OK() {
+		srvConn.Close()
+		return nil, stat
+	}
+	h.sess = sess
+	return sess, nil
+}
+
+func (h *httpFront) serve(lis net.Listener) error {
+	erpc.Printf("listen and serve (network:http, addr:%s)", lis.Addr())
+	return (&fasthttp.Server{
+		Name:    "micro-http",
+		Handler: h.handle,
+	}).Serve(lis)
+}
+
+// handle transcodes the HTTP request to a CALL.
+// NOTE:
+//  Only POST is allowed;
+//  Only httpForwardHeaders and the query arguments are forwarded to the metadata,
+//  the keys prefixed with 'X-' are reserved by the framework and dropped.
+func (h *httpFront) handle(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsPost() {
+		ctx.Response.Header.Set("Allow", "POST")
+		h.replyError(ctx, RerrMethodNotAllowed)
+		return
+	}
+	var (
+		serviceMethod   = goutil.BytesToString(ctx.Path())
+		header          = &ctx.Request.Header
+		contentType     = goutil.BytesToString(header.ContentType())
+		bodyCodec       = GetHttpBodyCodec(contentType, codec.ID_JSON)
+		acceptBodyCodec = GetHttpBodyCodec(goutil.BytesToString(header.Peek("Accept")), bodyCodec)
+		reply           []byte
+		settings        []erpc.MessageSetting
+	)
+	sess, stat := h.session()
+	if !stat.OK() {
+		h.replyError(ctx, stat)
+		return
+	}
+	for _, key := range httpForwardHeaders {
+		if value := header.Peek(key); len(value) > 0 {
+			settings = append(settings, erpc.WithAddMeta(key, string(value)))
+		}
+	}
+	if state := ctx.TLSConnectionState(); state != nil && len(state.PeerCertificates) > 0 {
+		settings = append(settings, erpc.WithAddMeta(metaPeerIdentity, certIdentity(state.PeerCertificates[0])))
+	}
+	ctx.QueryArgs().VisitAll(func(key, value []byte) {
+		if isReservedMeta(key) {
+			return
+		}
+		settings = append(settings, erpc.WithAddMeta(string(key), string(value)))
+	})
+	settings = append(settings,
+		erpc.WithBodyCodec(bodyCodec),
+		erpc.WithAddMeta(erpc.MetaRealIP, ctx.RemoteAddr().String()),
+	)
+	if acceptBodyCodec != bodyCodec {
+		settings = append(settings, erpc.WithAcceptBodyCodec(acceptBodyCodec))
+	}
+
+	callcmd := sess.Call(serviceMethod, ctx.Request.Body(), &reply, settings...)
+	if stat := callcmd.Status(); !stat.OK() {
+		h.replyError(ctx, stat)
+		return
+	}
+	var hasRespContentType bool
+	callcmd.InputMeta().VisitAll(func(key, value []byte) {
+		k := goutil.BytesToString(key)
+		v := goutil.BytesToString(value)
+		if k == "Content-Type" {
+			hasRespContentType = true
+			ctx.Response.Header.Set(k, v)
+		} else {
+			ctx.Response.Header.Add(k, v)
+		}
+	})
+	if !hasRespContentType {
+		ctx.Response.Header.Set(
+			"Content-Type",
+			GetHttpContentType(callcmd.InputBodyCodec(), contentType),
+		)
+	}
+	ctx.SetBody(reply)
+}
+
+// isReservedMeta returns whether the key is prefixed with 'X-' (case-insensitive).
+func isReservedMeta(key []byte) bool {
+	return len(key) >= 2 && (key[0] == 'X' || key[0] == 'x') && key[1] == '-'
+}
+
+func (h *httpFront) replyError(ctx *fasthttp.RequestCtx, stat *erpc.Status) {
+	errMsg, _ := stat.MarshalJSON()
+	ctx.SetStatusCode(HttpStatusCode(stat))
+	ctx.SetContentType("application/json")
+	ctx.SetBody(errMsg)
+}
+
+func (h *httpFront) close() {
+	h.cliPeer.Close()
+}
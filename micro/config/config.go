@@ -0,0 +1,252 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+	micro "github.com/xiaoenai/tp-micro/v6"
+	"github.com/xiaoenai/tp-micro/v6/configer"
+)
+
+// Options the options of connecting to the configer server
+type Options struct {
+	Addr        string
+	TlsCertFile string
+	TlsKeyFile  string
+	TlsCaFile   string
+}
+
+var client *micro.Client
+
+// Init connects to the configer server.
+func Init(opts Options) {
+	erpc.SetLoggerLevel("WARNING")
+	client = micro.NewClient(micro.CliConfig{
+		TlsCertFile:        opts.TlsCertFile,
+		TlsKeyFile:         opts.TlsKeyFile,
+		TlsCaFile:          opts.TlsCaFile,
+		DefaultDialTimeout: 5 * time.Second,
+	}, micro.NewStaticLinker(opts.Addr))
+}
+
+func call(serviceMethod string, arg, result interface{}, setting ...erpc.MessageSetting) {
+	if stat := client.Call(serviceMethod, arg, result, setting...).Status(); !stat.OK() {
+		erpc.Fatalf("[micro] %s: %s", serviceMethod, stat.String())
+	}
+}
+
+// List prints the config keys.
+func List() {
+	var keys []string
+	call("/cfg/list", struct{}{}, &keys)
+	for _, key := range keys {
+		fmt.Println(key)
+	}
+}
+
+func getConfig(key string) string {
+	var config string
+	call("/cfg/get", struct{}{}, &config, erpc.WithAddMeta("config-key", key))
+	return config
+}
+
+// Get prints the config.
+func Get(key string) {
+	fmt.Println(indent(getConfig(key)))
+}
+
+// Revisions prints the latest revisions of the config.
+// Note:
+//  If limit<=0, prints all revisions.
+func Revisions(key string, limit int64) {
+	var revs []*configer.Revision
+	call("/cfg/revisions", &configer.RevisionsArgs{Key: key, Limit: limit}, &revs)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REVISION\tTIME\tAUTHOR\tCOMMENT")
+	for _, rev := range revs {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", rev.Revision, rev.Time.Local().Format("2006-01-02 15:04:05"), rev.Author, rev.Comment)
+	}
+	w.Flush()
+}
+
+// Diff prints the changes between two revisions of the config.
+// Note:
+//  If to is 0, compares with the current config.
+func Diff(key string, from, to int64) {
+	var result configer.DiffResult
+	call("/cfg/diff", &configer.DiffArgs{Key: key, From: from, To: to}, &result)
+	printChanges(result.Changes)
+}
+
+func printChanges(changes []*configer.Change) {
+	if len(changes) == 0 {
+		fmt.Println("no change")
+		return
+	}
+	for _, c := range changes {
+		switch c.Op {
+		case configer.ChangeAdd:
+			fmt.Printf("+ %s: %s\n", c.Path, c.New)
+		case configer.ChangeRemove:
+			fmt.Printf("- %s: %s\n", c.Path, c.Old)
+		default:
+			fmt.Printf("~ %s: %s -> %s\n", c.Path, c.Old, c.New)
+		}
+	}
+}
+
+// Validate validates the config file against the JSON Schema, but does not write it.
+func Validate(key, filename string) {
+	if !validate(key, readFile(filename)) {
+		os.Exit(1)
+	}
+}
+
+func validate(key, config string) bool {
+	var result configer.ValidateResult
+	call("/cfg/validate", &configer.ConfigKV{Key: key, Value: config}, &result)
+	if result.Valid {
+		fmt.Println("valid")
+		return true
+	}
+	for _, e := range result.Errors {
+		fmt.Println("invalid:", e.Error())
+	}
+	return false
+}
+
+// Update updates the config from the file.
+// Note:
+//  If base>0, the update fails when the config has a newer revision than base.
+func Update(key, filename, author, comment string, base int64) {
+	update(key, readFile(filename), author, comment, base)
+}
+
+func update(key, config, author, comment string, base int64) {
+	var rev configer.Revision
+	call("/cfg/update", &configer.ConfigKV{
+		Key:          key,
+		Value:        config,
+		Author:       author,
+		Comment:      comment,
+		BaseRevision: base,
+	}, &rev)
+	fmt.Printf("updated to revision %d\n", rev.Revision)
+}
+
+// latestRevision returns the latest revision of the config, or 0 if none.
+func latestRevision(key string) int64 {
+	var revs []*configer.Revision
+	call("/cfg/revisions", &configer.RevisionsArgs{Key: key, Limit: 1}, &revs)
+	if len(revs) == 0 {
+		return 0
+	}
+	return revs[0].Revision
+}
+
+// Edit edits the config in $EDITOR, then validates and updates it.
+// Note:
+//  The update fails if the config is changed by others during editing.
+func Edit(key, author, comment string) {
+	// NOTE: Read the revision before the config, so that a change in between is not overwritten.
+	base := latestRevision(key)
+	old := getConfig(key)
+	f, err := ioutil.TempFile("", "micro-config-*.json")
+	if err != nil {
+		erpc.Fatalf("[micro] Create temporary file failed: %v", err)
+	}
+	filename := f.Name()
+	f.WriteString(indent(old) + "\n")
+	f.Close()
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command(editor, filename)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err = cmd.Run(); err != nil {
+		erpc.Fatalf("[micro] Run editor failed: %v", err)
+	}
+	config := readFile(filename)
+	changes, err := configer.DiffConfig(old, config)
+	if err != nil {
+		erpc.Fatalf("[micro] Invalid JSON, the edited config is kept in %s: %v", filename, err)
+	}
+	printChanges(changes)
+	if len(changes) == 0 {
+		os.Remove(filename)
+		return
+	}
+	if !validate(key, config) {
+		erpc.Fatalf("[micro] The edited config is kept in %s", filename)
+	}
+	update(key, config, author, comment, base)
+	os.Remove(filename)
+}
+
+// Rollback rolls back the config to the revision.
+func Rollback(key string, revision int64, author, comment string) {
+	var rev configer.Revision
+	call("/cfg/rollback", &configer.RollbackArgs{
+		Key:      key,
+		Revision: revision,
+		Author:   author,
+		Comment:  comment,
+	}, &rev)
+	fmt.Printf("rolled back to revision %d, as revision %d\n", revision, rev.Revision)
+}
+
+// Events prints the latest audit events of the config.
+// Note:
+//  If limit<=0, prints all events.
+func Events(key string, limit int64) {
+	var events []*configer.Event
+	call("/cfg/events", &configer.EventsArgs{Key: key, Limit: limit}, &events)
+	for _, e := range events {
+		printEvent(e)
+	}
+}
+
+// Watch prints the audit events of the configs until interrupted.
+// Note:
+//  If keys is empty, watches all configs.
+func Watch(keys []string) {
+	client.RoutePushFunc(CfgEvent)
+	call("/cfg/watch", &configer.WatchArgs{Keys: keys}, nil)
+	select {}
+}
+
+// CfgEvent handles the config event pushed by the configer server.
+func CfgEvent(ctx erpc.PushCtx, e *configer.Event) *erpc.Status {
+	printEvent(e)
+	return nil
+}
+
+func printEvent(e *configer.Event) {
+	fmt.Printf("[%s] %s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.Text)
+}
+
+func readFile(filename string) string {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		erpc.Fatalf("[micro] Read file failed: %v", err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func indent(config string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(config), "", "  "); err != nil {
+		return config
+	}
+	return buf.String()
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/erpc/v6/codec"
+	micro "github.com/xiaoenai/tp-micro/v6"
+)
+
+// consoleMethods the RPC methods of the config manager that the console can call
+var consoleMethods = map[string]bool{
+	"list":      true,
+	"get":       true,
+	"update":    true,
+	"revisions": true,
+	"diff":      true,
+	"validate":  true,
+	"rollback":  true,
+}
+
+// Console serves the web console of configs.
+// Note:
+//  The console calls the config manager with the identity of the CLI, so it should listen on a local address;
+//  The API only accepts 'application/json' POST requests, which can not be sent by cross-site forms;
+//  The API rejects the requests whose Host or Origin is neither the listen address nor localhost,
+//  which are sent by the DNS rebinding pages.
+func Console(listen string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", serveConsolePage)
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		serveConsoleAPI(listen, w, r)
+	})
+	erpc.Printf("[micro] config console is listening on http://%s", listen)
+	if err := http.ListenAndServe(listen, mux); err != nil {
+		erpc.Fatalf("[micro] %v", err)
+	}
+}
+
+func serveConsolePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(consolePage))
+}
+
+// isConsoleHost returns whether the host is the listen address or a loopback host with the same port.
+func isConsoleHost(listen, host string) bool {
+	if host == listen {
+		return true
+	}
+	_, port, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	h, p, err := net.SplitHostPort(host)
+	if err != nil || p != port {
+		return false
+	}
+	if h == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(h)
+	return ip != nil && ip.IsLoopback()
+}
+
+func serveConsoleAPI(listen string, w http.ResponseWriter, r *http.Request) {
+	if !isConsoleHost(listen, r.Host) {
+		http.Error(w, "invalid host", http.StatusForbidden)
+		return
+	}
+	if origin := r.Header.Get("Origin"); len(origin) > 0 {
+		u, err := url.Parse(origin)
+		if err != nil || !isConsoleHost(listen, u.Host) {
+			http.Error(w, "invalid origin", http.StatusForbidden)
+			return
+		}
+	}
+	method := strings.TrimPrefix(r.URL.Path, "/api/")
+	if !consoleMethods[method] {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "expect Content-Type application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 4<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(body) == 0 {
+		body = []byte("{}")
+	}
+	settings := []erpc.MessageSetting{erpc.WithBodyCodec(codec.ID_JSON)}
+	if method == "get" {
+		settings = append(settings, erpc.WithAddMeta("config-key", r.URL.Query().Get("key")))
+	}
+	var reply []byte
+	stat := client.Call("/cfg/"+method, body, &reply, settings...).Status()
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if !stat.OK() {
+		w.WriteHeader(micro.HttpStatusCode(stat))
+		json.NewEncoder(w).Encode(stat)
+		return
+	}
+	if method == "get" {
+		var config string
+		if json.Unmarshal(reply, &config) == nil {
+			reply, _ = json.Marshal(indent(config))
+		}
+	}
+	w.Write(reply)
+}
+
+const consolePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Micro Config Console</title>
+<style>
+body{margin:0;font:14px sans-serif;display:flex;height:100vh}
+#keys{width:280px;overflow:auto;border-right:1px solid #ddd;padding:8px}
+#keys div{padding:4px;cursor:pointer;word-break:break-all}
+#keys div.active,#keys div:hover{background:#eef}
+#main{flex:1;display:flex;flex-direction:column;padding:8px;overflow:auto}
+textarea{flex:1;min-height:300px;font:13px monospace}
+input{margin-right:8px}
+pre{background:#f6f6f6;padding:8px;white-space:pre-wrap}
+table{border-collapse:collapse}td,th{border:1px solid #ddd;padding:2px 6px}
+</style>
+</head>
+<body>
+<div id="keys"></div>
+<div id="main">
+<h3 id="title">Select a config</h3>
+<textarea id="config"></textarea>
+<p>
+<input id="author" placeholder="author">
+<input id="comment" placeholder="comment" size="40">
+<button onclick="validate()">Validate</button>
+<button onclick="save()">Save</button>
+<button onclick="load(key)">Reload</button>
+</p>
+<pre id="result"></pre>
+<h4>Revisions</h4>
+<table><thead><tr><th>Revision</th><th>Time</th><th>Author</th><th>Comment</th><th></th></tr></thead><tbody id="revisions"></tbody></table>
+</div>
+<script>
+var key = "", base = 0;
+function $(id) { return document.getElementById(id); }
+function api(method, args, query) {
+  return fetch("/api/" + method + (query || ""), {
+    method: "POST",
+    headers: {"Content-Type": "application/json"},
+    body: JSON.stringify(args || {})
+  }).then(function (r) {
+    return r.json().then(function (v) {
+      if (!r.ok) throw v;
+      return v;
+    });
+  });
+}
+function show(v) { $("result").textContent = typeof v === "string" ? v : JSON.stringify(v, null, 2); }
+function fail(e) { show(e.msg ? e.msg + (e.cause ? ": " + e.cause : "") : String(e)); }
+function text(s) { return document.createTextNode(s == null ? "" : String(s)); }
+function listKeys() {
+  api("list").then(function (keys) {
+    $("keys").innerHTML = "";
+    (keys || []).forEach(function (k) {
+      var d = document.createElement("div");
+      d.appendChild(text(k));
+      d.onclick = function () { load(k); };
+      if (k === key) d.className = "active";
+      $("keys").appendChild(d);
+    });
+  }, fail);
+}
+function load(k) {
+  if (!k) return;
+  key = k;
+  $("title").textContent = k;
+  listKeys();
+  // NOTE: Read the revision before the config, so that a change in between is not overwritten.
+  return revisions().then(function () {
+    return api("get", {}, "?key=" + encodeURIComponent(k));
+  }).then(function (cfg) {
+    $("config").value = cfg;
+    show("");
+  }, fail);
+}
+function revisions() {
+  return api("revisions", {key: key, limit: 20}).then(function (revs) {
+    base = revs && revs.length ? revs[0].revision : 0;
+    $("revisions").innerHTML = "";
+    (revs || []).forEach(function (r) {
+      var tr = document.createElement("tr");
+      [r.revision, r.time, r.author, r.comment].forEach(function (v) {
+        var td = document.createElement("td");
+        td.appendChild(text(v));
+        tr.appendChild(td);
+      });
+      var td = document.createElement("td");
+      var diff = document.createElement("button");
+      diff.appendChild(text("Diff"));
+      diff.onclick = function () { api("diff", {key: key, from: r.revision}).then(show, fail); };
+      var rollback = document.createElement("button");
+      rollback.appendChild(text("Rollback"));
+      rollback.onclick = function () {
+        if (!confirm("Roll back to revision " + r.revision + "?")) return;
+        api("rollback", {key: key, revision: r.revision, author: $("author").value, comment: $("comment").value})
+          .then(function () { load(key); }, fail);
+      };
+      td.appendChild(diff);
+      td.appendChild(rollback);
+      tr.appendChild(td);
+      $("revisions").appendChild(tr);
+    });
+  }, fail);
+}
+function validate() {
+  api("validate", {key: key, value: $("config").value}).then(show, fail);
+}
+function save() {
+  api("update", {key: key, value: $("config").value, author: $("author").value, comment: $("comment").value, baseRevision: base})
+    .then(function (rev) {
+      load(key).then(function () { show("saved as revision " + rev.revision); });
+    }, fail);
+}
+listKeys();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConsoleAPIReject(t *testing.T) {
+	const listen = "127.0.0.1:4041"
+	cases := []struct {
+		method, path, contentType, host, origin string
+		code                                    int
+	}{
+		{"POST", "/api/encrypt", "application/json", listen, "", http.StatusNotFound},
+		{"GET", "/api/list", "application/json", "localhost:4041", "", http.StatusMethodNotAllowed},
+		{"POST", "/api/update", "text/plain", listen, "http://" + listen, http.StatusUnsupportedMediaType},
+		// DNS rebinding
+		{"POST", "/api/list", "application/json", "evil.example.com:4041", "", http.StatusForbidden},
+		{"POST", "/api/list", "application/json", "127.0.0.1:80", "", http.StatusForbidden},
+		{"POST", "/api/list", "application/json", listen, "http://evil.example.com:4041", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(`{}`))
+		r.Host = c.host
+		r.Header.Set("Content-Type", c.contentType)
+		if len(c.origin) > 0 {
+			r.Header.Set("Origin", c.origin)
+		}
+		w := httptest.NewRecorder()
+		serveConsoleAPI(listen, w, r)
+		if w.Code != c.code {
+			t.Fatalf("%s %s (host %s, origin %s): expect %d, got %d", c.method, c.path, c.host, c.origin, c.code, w.Code)
+		}
+	}
+}
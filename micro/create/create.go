@@ -9,6 +9,7 @@ import (
 	"github.com/henrylee2cn/goutil"
 	"github.com/xiaoenai/tp-micro/v6/micro/create/tpl"
 	"github.com/xiaoenai/tp-micro/v6/micro/info"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
 )
 
 // MicroTpl template file name
@@ -18,7 +19,11 @@ const MicroTpl = "__tp-micro__tpl__.go"
 const MicroGenLock = "__tp-micro__gen__.lock"
 
 // CreateProject creates a project.
-func CreateProject(force, newdoc bool) {
+// NOTE:
+//  dialectName is the SQL dialect of the mysql models,
+//  the one of the last generation or mysql is used if empty;
+//  If dropRemoved is false, the migration leaves the removed tables and columns as the comments.
+func CreateProject(force, newdoc bool, dialectName string, dropRemoved bool) {
 	erpc.Infof("Generating project: %s", info.ProjPath())
 
 	os.MkdirAll(info.AbsPath(), os.FileMode(0755))
@@ -29,6 +34,17 @@ func CreateProject(force, newdoc bool) {
 
 	force = force || !goutil.FileExists(MicroGenLock)
 
+	if len(dialectName) == 0 {
+		snapshot, _ := readSnapshot()
+		if snapshot != nil {
+			dialectName = snapshot.Dialect
+		}
+	}
+	d, err := dialect.Get(dialectName)
+	if err != nil {
+		erpc.Fatalf("[micro] %v", err)
+	}
+
 	// creates base files
 	if force {
 		tpl.Create()
@@ -42,6 +58,8 @@ func CreateProject(force, newdoc bool) {
 
 	// new project code
 	proj := NewProject(b)
+	proj.dialect = d
+	proj.dropRemoved = dropRemoved
 	proj.Generator(force, force || newdoc)
 
 	// write template file
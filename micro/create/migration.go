@@ -0,0 +1,539 @@
+package create
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/goutil"
+	"github.com/xiaoenai/tp-micro/v6/micro/info"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
+	"github.com/xiaoenai/tp-micro/v6/model/migrate"
+	"github.com/xiaoenai/tp-micro/v6/model/mysql"
+)
+
+const (
+	// migrationDir the directory of the migration files
+	migrationDir = "migrations"
+	// schemaFile the schema snapshot of the mysql models, which is compared to emit the next migration
+	schemaFile = migrationDir + "/schema.gen.json"
+)
+
+type (
+	// tableSchema the schema of a mysql model
+	tableSchema struct {
+		Name string `json:"name"`
+		// Tables the physical tables, more than one if sharded
+		Tables  []string        `json:"tables"`
+		Columns []*columnSchema `json:"columns"`
+		Primary []string        `json:"primary"`
+		Unique  []string        `json:"unique"`
+	}
+	columnSchema struct {
+		Name string `json:"name"`
+		// Def the column definition, e.g. bigint(20) NOT NULL DEFAULT '0'
+		Def string `json:"def"`
+	}
+)
+
+// schemaSnapshot the snapshot of the mysql model schemas
+type schemaSnapshot struct {
+	Dialect string         `json:"dialect"`
+	Tables  []*tableSchema `json:"tables"`
+}
+
+// readSnapshot reads the schema snapshot, nil if not exist.
+func readSnapshot() (*schemaSnapshot, error) {
+	b, err := ioutil.ReadFile(schemaFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var snapshot schemaSnapshot
+	if len(bytes.TrimSpace(b)) > 0 && bytes.TrimSpace(b)[0] == '[' {
+		// NOTE: the snapshot of the old version is the tables of mysql
+		snapshot.Dialect = dialect.MySQL.Name()
+		err = json.Unmarshal(b, &snapshot.Tables)
+	} else {
+		err = json.Unmarshal(b, &snapshot)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// genMigration emits the migration of the changed mysql models, and updates the schema snapshot.
+// NOTE:
+//  If the dialect is changed, the migration creates all the tables;
+//  The removed tables and columns are dropped only if p.dropRemoved is true.
+func (p *Project) genMigration() {
+	snapshot, err := readSnapshot()
+	if err != nil {
+		erpc.Fatalf("[micro] read %s error: %v", schemaFile, err)
+	}
+	var old []*tableSchema
+	if snapshot != nil {
+		if snapshot.Dialect == p.dialect.Name() {
+			old = snapshot.Tables
+		} else {
+			erpc.Warnf("[micro] the SQL dialect is changed from %s to %s, creating all the tables", snapshot.Dialect, p.dialect.Name())
+		}
+	}
+	schemas := p.mysqlSchemas()
+	up, down := diffSchemas(p.dialect, old, schemas, p.dropRemoved)
+	if len(up) == 0 {
+		return
+	}
+	m, err := migrate.Create(migrationDir, "gen_models", up, down)
+	if err != nil {
+		erpc.Fatalf("[micro] create migration error: %v", err)
+	}
+	fmt.Printf("generate %s/%s/%s\n", info.ProjPath(), migrationDir, m.FileName("up"))
+	fmt.Printf("generate %s/%s/%s\n", info.ProjPath(), migrationDir, m.FileName("down"))
+	b, _ := json.MarshalIndent(&schemaSnapshot{Dialect: p.dialect.Name(), Tables: schemas}, "", "  ")
+	if err = ioutil.WriteFile(schemaFile, b, 0644); err != nil {
+		erpc.Fatalf("[micro] write %s error: %v", schemaFile, err)
+	}
+}
+
+func (p *Project) mysqlSchemas() []*tableSchema {
+	schemas := make([]*tableSchema, 0, len(p.tplInfo.models.mysql))
+	for _, s := range p.tplInfo.models.mysql {
+		schemas = append(schemas, newTableSchema(p.dialect, s))
+	}
+	return schemas
+}
+
+func newTableSchema(d dialect.Dialect, s *structType) *tableSchema {
+	t := &tableSchema{Name: goutil.SnakeString(s.name)}
+	if s.shardField != nil {
+		// NOTE: Every DB of the shards creates all the physical tables,
+		// since which ones it owns depends on the number of shard_addrs at runtime.
+		cfg := mysql.ShardConfig{Tables: s.shardTables}
+		for i := 0; i < s.shardTables; i++ {
+			t.Tables = append(t.Tables, cfg.ShardTableName(t.Name, i))
+		}
+	} else {
+		t.Tables = []string{t.Name}
+	}
+	var keys = make(map[*field]bool)
+	for _, f := range s.primaryFields {
+		t.Primary = append(t.Primary, f.ModelName)
+		keys[f] = true
+	}
+	for _, f := range s.uniqueFields {
+		t.Unique = append(t.Unique, f.ModelName)
+		keys[f] = true
+	}
+	for _, f := range s.fields {
+		if f.ModelName == "" || f.ModelName == "-" {
+			continue
+		}
+		def := columnDef(d, f.Typ, keys[f])
+		// NOTE: the sharded rows are always inserted with the primary keys
+		if s.isDefaultPrimary && s.shardField == nil && f == s.primaryFields[0] {
+			def = autoIncrementDef(d)
+		}
+		t.Columns = append(t.Columns, &columnSchema{Name: f.ModelName, Def: def})
+	}
+	return t
+}
+
+// autoIncrementDef returns the column definition of the auto-increment primary key.
+func autoIncrementDef(d dialect.Dialect) string {
+	switch d.Name() {
+	case "mysql":
+		return "bigint(20) NOT NULL AUTO_INCREMENT"
+	case "sqlite":
+		// NOTE: the INTEGER primary key is the alias of the ROWID
+		return "INTEGER NOT NULL"
+	default:
+		return "bigserial NOT NULL"
+	}
+}
+
+// columnDef returns the column definition of the go type.
+func columnDef(d dialect.Dialect, typ string, isKey bool) string {
+	switch d.Name() {
+	case "mysql":
+		return mysqlColumnDef(typ, isKey)
+	case "sqlite":
+		return sqliteColumnDef(typ)
+	default:
+		return postgresColumnDef(typ, isKey)
+	}
+}
+
+func mysqlColumnDef(typ string, isKey bool) string {
+	var unsigned string
+	if strings.HasPrefix(typ, "uint") || typ == "byte" {
+		unsigned = " unsigned"
+		typ = strings.TrimPrefix(typ, "u")
+	}
+	switch typ {
+	case "int64", "int":
+		return "bigint(20)" + unsigned + " NOT NULL DEFAULT '0'"
+	case "int32", "rune":
+		return "int(11)" + unsigned + " NOT NULL DEFAULT '0'"
+	case "int16":
+		return "smallint(6)" + unsigned + " NOT NULL DEFAULT '0'"
+	case "int8", "byte":
+		return "tinyint(4)" + unsigned + " NOT NULL DEFAULT '0'"
+	case "bool":
+		return "tinyint(1) NOT NULL DEFAULT '0'"
+	case "float32":
+		return "float NOT NULL DEFAULT '0'"
+	case "float64":
+		return "double NOT NULL DEFAULT '0'"
+	case "string":
+		if isKey {
+			return "varchar(255) NOT NULL DEFAULT ''"
+		}
+		return "text NOT NULL"
+	case "[]byte":
+		if isKey {
+			return "varbinary(255) NOT NULL DEFAULT ''"
+		}
+		return "blob NOT NULL"
+	case "time.Time":
+		return "datetime NOT NULL DEFAULT CURRENT_TIMESTAMP"
+	default:
+		return "text NOT NULL"
+	}
+}
+
+// postgresColumnDef returns the PostgreSQL column definition of the go type.
+// NOTE:
+//  PostgreSQL has no unsigned integer, the unsigned types use the next larger type.
+func postgresColumnDef(typ string, isKey bool) string {
+	switch typ {
+	case "int64", "int", "uint32":
+		return "bigint NOT NULL DEFAULT 0"
+	case "uint64", "uint":
+		return "numeric(20) NOT NULL DEFAULT 0"
+	case "int32", "rune", "uint16":
+		return "integer NOT NULL DEFAULT 0"
+	case "int16", "int8", "uint8", "byte":
+		return "smallint NOT NULL DEFAULT 0"
+	case "bool":
+		return "boolean NOT NULL DEFAULT false"
+	case "float32":
+		return "real NOT NULL DEFAULT 0"
+	case "float64":
+		return "double precision NOT NULL DEFAULT 0"
+	case "string":
+		if isKey {
+			return "varchar(255) NOT NULL DEFAULT ''"
+		}
+		return "text NOT NULL DEFAULT ''"
+	case "[]byte":
+		return "bytea NOT NULL DEFAULT ''"
+	case "time.Time":
+		return "timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP"
+	default:
+		return "text NOT NULL DEFAULT ''"
+	}
+}
+
+// sqliteColumnDef returns the SQLite column definition of the go type.
+func sqliteColumnDef(typ string) string {
+	switch typ {
+	case "int64", "int", "int32", "rune", "int16", "int8",
+		"uint64", "uint", "uint32", "uint16", "uint8", "byte", "bool":
+		return "INTEGER NOT NULL DEFAULT 0"
+	case "float32", "float64":
+		return "REAL NOT NULL DEFAULT 0"
+	case "[]byte":
+		return "BLOB NOT NULL DEFAULT ''"
+	case "time.Time":
+		return "DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP"
+	default:
+		return "TEXT NOT NULL DEFAULT ''"
+	}
+}
+
+// diffSchemas returns the up and down statements that migrate the old schemas to the new ones.
+// NOTE:
+//  The unique keys include the 'deleted_ts' column, so that the soft-deleted rows do not conflict;
+//  Unless drop is true, the removed tables and columns are not dropped, but left as the comments in up.
+func diffSchemas(d dialect.Dialect, old, new []*tableSchema, drop bool) (up, down string) {
+	var oldByName = make(map[string]*tableSchema, len(old))
+	for _, t := range old {
+		oldByName[t.Name] = t
+	}
+	var ups, downs []string
+	for _, t := range new {
+		o := oldByName[t.Name]
+		delete(oldByName, t.Name)
+		if o == nil {
+			o = &tableSchema{Name: t.Name}
+		}
+		for _, table := range t.Tables {
+			if !containsString(o.Tables, table) {
+				ups = append(ups, t.createTable(d, table))
+				downs = append(downs, dropTableSQL(d, table))
+				continue
+			}
+			if u, dn := alterTable(d, table, o, t, drop); len(u) > 0 {
+				ups = append(ups, u)
+				if len(dn) > 0 {
+					downs = append(downs, dn)
+				}
+			}
+		}
+		for _, table := range o.Tables {
+			if !containsString(t.Tables, table) {
+				ups, downs = dropTable(d, table, o, drop, ups, downs)
+			}
+		}
+	}
+	for _, o := range old {
+		if _, ok := oldByName[o.Name]; !ok {
+			continue
+		}
+		for _, table := range o.Tables {
+			ups, downs = dropTable(d, table, o, drop, ups, downs)
+		}
+	}
+	if len(ups) == 0 {
+		return "", ""
+	}
+	// revert in the reverse order
+	reverseStrings(downs)
+	return strings.Join(ups, "\n\n") + "\n", strings.Join(downs, "\n\n") + "\n"
+}
+
+func (t *tableSchema) createTable(d dialect.Dialect, table string) string {
+	var lines []string
+	for _, c := range t.Columns {
+		lines = append(lines, fmt.Sprintf("  %s %s", d.Quote(c.Name), c.Def))
+	}
+	lines = append(lines, fmt.Sprintf("  PRIMARY KEY (%s)", dialect.QuoteAll(d, t.Primary)))
+	switch d.Name() {
+	case "mysql":
+		for _, u := range t.Unique {
+			lines = append(lines, "  "+uniqueKey(d, table, u))
+		}
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;",
+			d.Quote(table), strings.Join(lines, ",\n"))
+	case "sqlite":
+		stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n);", d.Quote(table), strings.Join(lines, ",\n"))}
+		for _, u := range t.Unique {
+			stmts = append(stmts, uniqueKey(d, table, u)+";")
+		}
+		return strings.Join(stmts, "\n")
+	default:
+		for _, u := range t.Unique {
+			lines = append(lines, "  "+uniqueKey(d, table, u))
+		}
+		return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n%s\n);", d.Quote(table), strings.Join(lines, ",\n"))
+	}
+}
+
+// dropTable appends the statements of dropping the removed table, which are the comments in up unless drop is true.
+func dropTable(d dialect.Dialect, table string, old *tableSchema, drop bool, ups, downs []string) ([]string, []string) {
+	if !drop {
+		return append(ups, fmt.Sprintf("-- the table %s is removed from the models, drop it by hand if it is unused:\n-- %s",
+			d.Quote(table), dropTableSQL(d, table))), downs
+	}
+	return append(ups, dropTableSQL(d, table)), append(downs, old.createTable(d, table))
+}
+
+func dropTableSQL(d dialect.Dialect, table string) string {
+	return fmt.Sprintf("DROP TABLE IF EXISTS %s;", d.Quote(table))
+}
+
+// alterTable returns the up and down ALTER TABLE statements, or empty if not changed.
+// NOTE:
+//  SQLite can not modify the columns and the primary key in place,
+//  which are emitted as the comments to rebuild the table manually;
+//  Unless drop is true, the removed columns are emitted as the comments to drop them manually.
+func alterTable(d dialect.Dialect, table string, old, new *tableSchema, drop bool) (up, down string) {
+	var ups, downs, kept []string
+	var oldCols = make(map[string]*columnSchema, len(old.Columns))
+	for _, c := range old.Columns {
+		oldCols[c.Name] = c
+	}
+	var prev string
+	for _, c := range new.Columns {
+		pos := columnPosition(d, prev)
+		prev = c.Name
+		o, ok := oldCols[c.Name]
+		delete(oldCols, c.Name)
+		if !ok {
+			ups = append(ups, fmt.Sprintf("ADD COLUMN %s %s%s", d.Quote(c.Name), c.Def, pos))
+			downs = append(downs, fmt.Sprintf("DROP COLUMN %s", d.Quote(c.Name)))
+		} else if o.Def != c.Def {
+			ups = append(ups, modifyColumn(d, table, c.Name, o.Def, c.Def))
+			downs = append(downs, modifyColumn(d, table, c.Name, c.Def, o.Def))
+		}
+	}
+	prev = ""
+	for _, c := range old.Columns {
+		if _, ok := oldCols[c.Name]; ok {
+			if drop {
+				ups = append(ups, fmt.Sprintf("DROP COLUMN %s", d.Quote(c.Name)))
+				downs = append(downs, fmt.Sprintf("ADD COLUMN %s %s%s", d.Quote(c.Name), c.Def, columnPosition(d, prev)))
+			} else {
+				kept = append(kept, fmt.Sprintf("-- the column %s of %s is removed from the models, drop it by hand if it is unused:\n-- ALTER TABLE %s DROP COLUMN %s;",
+					d.Quote(c.Name), d.Quote(table), d.Quote(table), d.Quote(c.Name)))
+			}
+		}
+		prev = c.Name
+	}
+	if strings.Join(old.Primary, ",") != strings.Join(new.Primary, ",") {
+		ups = append(ups, changePrimaryKey(d, table, new.Primary)...)
+		downs = append(downs, changePrimaryKey(d, table, old.Primary)...)
+	}
+	for _, u := range new.Unique {
+		if !containsString(old.Unique, u) {
+			ups = append(ups, addUniqueKey(d, table, u))
+			downs = append(downs, dropUniqueKey(d, table, u))
+		}
+	}
+	for _, u := range old.Unique {
+		if !containsString(new.Unique, u) {
+			ups = append(ups, dropUniqueKey(d, table, u))
+			downs = append(downs, addUniqueKey(d, table, u))
+		}
+	}
+	if len(ups) == 0 {
+		return strings.Join(kept, "\n"), ""
+	}
+	if d.Name() != "mysql" {
+		// NOTE: drop the keys before the columns of them
+		reverseStrings(downs)
+	}
+	if d.Name() == "sqlite" {
+		// NOTE: SQLite alters one thing at a time
+		up, down = sqliteAlterTable(d, table, ups), sqliteAlterTable(d, table, downs)
+	} else {
+		up = fmt.Sprintf("ALTER TABLE %s\n  %s;", d.Quote(table), strings.Join(ups, ",\n  "))
+		down = fmt.Sprintf("ALTER TABLE %s\n  %s;", d.Quote(table), strings.Join(downs, ",\n  "))
+	}
+	return strings.Join(append([]string{up}, kept...), "\n"), down
+}
+
+func sqliteAlterTable(d dialect.Dialect, table string, clauses []string) string {
+	stmts := make([]string, len(clauses))
+	for i, clause := range clauses {
+		if strings.HasPrefix(clause, "--") || strings.HasPrefix(clause, "CREATE ") || strings.HasPrefix(clause, "DROP INDEX ") {
+			stmts[i] = clause
+		} else {
+			stmts[i] = fmt.Sprintf("ALTER TABLE %s %s;", d.Quote(table), clause)
+		}
+	}
+	return strings.Join(stmts, "\n")
+}
+
+// columnPosition returns the position of the added column, only MySQL supports it.
+func columnPosition(d dialect.Dialect, prev string) string {
+	if d.Name() != "mysql" {
+		return ""
+	}
+	if len(prev) == 0 {
+		return " FIRST"
+	}
+	return " AFTER " + d.Quote(prev)
+}
+
+func modifyColumn(d dialect.Dialect, table, column, oldDef, newDef string) string {
+	switch d.Name() {
+	case "mysql":
+		return fmt.Sprintf("MODIFY COLUMN %s %s", d.Quote(column), newDef)
+	case "sqlite":
+		return fmt.Sprintf("-- rebuild the table %s to modify the column %s: %s", d.Quote(table), d.Quote(column), newDef)
+	}
+	typ, dflt := splitColumnDef(newDef)
+	_, oldDflt := splitColumnDef(oldDef)
+	clauses := []string{fmt.Sprintf("ALTER COLUMN %s TYPE %s USING %s::%s", d.Quote(column), typ, d.Quote(column), typ)}
+	if dflt != oldDflt {
+		if len(dflt) == 0 {
+			clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s DROP DEFAULT", d.Quote(column)))
+		} else {
+			clauses = append(clauses, fmt.Sprintf("ALTER COLUMN %s SET DEFAULT %s", d.Quote(column), dflt))
+		}
+	}
+	return strings.Join(clauses, ",\n  ")
+}
+
+// splitColumnDef splits the column definition into the type and the default value.
+func splitColumnDef(def string) (typ, dflt string) {
+	typ = def
+	if i := strings.Index(typ, " DEFAULT "); i != -1 {
+		typ, dflt = typ[:i], typ[i+len(" DEFAULT "):]
+	}
+	return strings.TrimSuffix(typ, " NOT NULL"), dflt
+}
+
+func changePrimaryKey(d dialect.Dialect, table string, primary []string) []string {
+	switch d.Name() {
+	case "mysql":
+		return []string{"DROP PRIMARY KEY", fmt.Sprintf("ADD PRIMARY KEY (%s)", dialect.QuoteAll(d, primary))}
+	case "sqlite":
+		return []string{fmt.Sprintf("-- rebuild the table %s to change the primary key: (%s)", d.Quote(table), dialect.QuoteAll(d, primary))}
+	default:
+		return []string{
+			fmt.Sprintf("DROP CONSTRAINT %s", d.Quote(table+"_pkey")),
+			fmt.Sprintf("ADD PRIMARY KEY (%s)", dialect.QuoteAll(d, primary)),
+		}
+	}
+}
+
+func uniqueKey(d dialect.Dialect, table, column string) string {
+	columns := dialect.QuoteAll(d, []string{column, "deleted_ts"})
+	switch d.Name() {
+	case "mysql":
+		return fmt.Sprintf("UNIQUE KEY %s (%s)", d.Quote(column), columns)
+	case "sqlite":
+		return fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)", d.Quote(uniqueKeyName(table, column)), d.Quote(table), columns)
+	default:
+		return fmt.Sprintf("CONSTRAINT %s UNIQUE (%s)", d.Quote(uniqueKeyName(table, column)), columns)
+	}
+}
+
+// uniqueKeyName returns the name of the unique key,
+// which is prefixed with the table name since it is unique in the schema except MySQL.
+func uniqueKeyName(table, column string) string {
+	return table + "_" + column + "_key"
+}
+
+func addUniqueKey(d dialect.Dialect, table, column string) string {
+	if d.Name() == "sqlite" {
+		return uniqueKey(d, table, column) + ";"
+	}
+	return "ADD " + uniqueKey(d, table, column)
+}
+
+func dropUniqueKey(d dialect.Dialect, table, column string) string {
+	switch d.Name() {
+	case "mysql":
+		return fmt.Sprintf("DROP INDEX %s", d.Quote(column))
+	case "sqlite":
+		return fmt.Sprintf("DROP INDEX IF EXISTS %s;", d.Quote(uniqueKeyName(table, column)))
+	default:
+		return fmt.Sprintf("DROP CONSTRAINT %s", d.Quote(uniqueKeyName(table, column)))
+	}
+}
+
+func reverseStrings(a []string) {
+	for i, j := 0, len(a)-1; i < j; i, j = i+1, j-1 {
+		a[i], a[j] = a[j], a[i]
+	}
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
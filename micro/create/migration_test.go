@@ -0,0 +1,117 @@
+package create
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xiaoenai/tp-micro/v6/micro/info"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
+	"github.com/xiaoenai/tp-micro/v6/model/migrate"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	info.Init("test")
+	old := NewProject([]byte(__tpl__)).mysqlSchemas()
+	up, down := diffSchemas(dialect.MySQL, nil, old, false)
+	t.Logf("create up:\n%s\ncreate down:\n%s", up, down)
+	for _, s := range []string{
+		"CREATE TABLE IF NOT EXISTS `user` (",
+		"`id` bigint(20) NOT NULL AUTO_INCREMENT,",
+		"UNIQUE KEY `name` (`name`,`deleted_ts`)",
+		"PRIMARY KEY (`uuid`)",
+	} {
+		if !strings.Contains(up, s) {
+			t.Fatalf("expect %q in up", s)
+		}
+	}
+	if !strings.Contains(down, "DROP TABLE IF EXISTS `device`;") {
+		t.Fatal("expect dropping the tables in down")
+	}
+	if up, _ = diffSchemas(dialect.MySQL, old, old, false); up != "" {
+		t.Fatalf("expect no change, got:\n%s", up)
+	}
+
+	src := strings.Replace(__tpl__, "type Log struct {\n\tText string\n}", "type Log struct {\n\tLevel int8\n\tText string\n}", 1)
+	src = strings.Replace(src, "\tLog\n\tDevice\n", "\tLog\n", 1)
+	up, down = diffSchemas(dialect.MySQL, old, NewProject([]byte(src)).mysqlSchemas(), true)
+	t.Logf("alter up:\n%s\nalter down:\n%s", up, down)
+	if !strings.Contains(up, "ADD COLUMN `level` tinyint(4) NOT NULL DEFAULT '0' AFTER `id`") ||
+		!strings.Contains(up, "\nDROP TABLE IF EXISTS `device`;") {
+		t.Fatal("expect adding the column and dropping the table in up")
+	}
+	if !strings.Contains(down, "DROP COLUMN `level`") ||
+		!strings.Contains(down, "CREATE TABLE IF NOT EXISTS `device` (") {
+		t.Fatal("expect reverting in down")
+	}
+
+	// the removed tables and columns are commented out by default
+	src = strings.Replace(__tpl__, "type User struct {\n\tId   int64  `key:\"pri\"`\n\tName string `key:\"uni\"`\n\tAge  int32\n}", "type User struct {\n\tId   int64  `key:\"pri\"`\n\tName string `key:\"uni\"`\n}", 1)
+	src = strings.Replace(src, "\tLog\n\tDevice\n", "\tLog\n", 1)
+	up, down = diffSchemas(dialect.MySQL, old, NewProject([]byte(src)).mysqlSchemas(), false)
+	t.Logf("keep up:\n%s\nkeep down:\n%s", up, down)
+	for _, stmt := range migrate.SplitStatements(up) {
+		if strings.Contains(stmt, "DROP") {
+			t.Fatalf("expect no drop, got: %s", stmt)
+		}
+	}
+	if !strings.Contains(up, "-- DROP TABLE IF EXISTS `device`;") ||
+		!strings.Contains(up, "-- ALTER TABLE `user` DROP COLUMN `age`;") {
+		t.Fatalf("expect the drops commented out in up:\n%s", up)
+	}
+	if strings.Contains(down, "CREATE TABLE IF NOT EXISTS `device` (") || strings.Contains(down, "ADD COLUMN `age`") {
+		t.Fatalf("expect nothing to revert in down:\n%s", down)
+	}
+}
+
+func TestDialectSchemas(t *testing.T) {
+	info.Init("test")
+	src := strings.Replace(__tpl__, "type Log struct {\n\tText string\n}", "type Log struct {\n\tLevel int8\n\tText string\n}", 1)
+	for _, c := range []struct {
+		d             dialect.Dialect
+		create, alter []string
+		down          string
+	}{
+		{
+			d: dialect.Postgres,
+			create: []string{
+				`CREATE TABLE IF NOT EXISTS "user" (`,
+				`"id" bigserial NOT NULL,`,
+				`CONSTRAINT "user_name_key" UNIQUE ("name","deleted_ts")`,
+			},
+			alter: []string{`ALTER TABLE "log"
+  ADD COLUMN "level" smallint NOT NULL DEFAULT 0;`},
+			down: `DROP COLUMN "level"`,
+		},
+		{
+			d: dialect.SQLite,
+			create: []string{
+				`CREATE TABLE IF NOT EXISTS "user" (`,
+				`"id" INTEGER NOT NULL,`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS "user_name_key" ON "user" ("name","deleted_ts");`,
+			},
+			alter: []string{`ALTER TABLE "log" ADD COLUMN "level" INTEGER NOT NULL DEFAULT 0;`},
+			down:  `ALTER TABLE "log" DROP COLUMN "level";`,
+		},
+	} {
+		proj := NewProject([]byte(__tpl__))
+		proj.dialect = c.d
+		old := proj.mysqlSchemas()
+		up, _ := diffSchemas(c.d, nil, old, false)
+		for _, s := range c.create {
+			if !strings.Contains(up, s) {
+				t.Fatalf("%s: expect %q in up:\n%s", c.d.Name(), s, up)
+			}
+		}
+		proj = NewProject([]byte(src))
+		proj.dialect = c.d
+		up, down := diffSchemas(c.d, old, proj.mysqlSchemas(), false)
+		for _, s := range c.alter {
+			if !strings.Contains(up, s) {
+				t.Fatalf("%s: expect %q in up:\n%s", c.d.Name(), s, up)
+			}
+		}
+		if !strings.Contains(down, c.down) {
+			t.Fatalf("%s: expect %q in down:\n%s", c.d.Name(), c.down, down)
+		}
+	}
+}
@@ -10,10 +10,11 @@ import (
 	"go/token"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 
-	"github.com/henrylee2cn/goutil"
 	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/goutil"
 	"github.com/xiaoenai/tp-micro/v6/micro/create/structtag"
 )
 
@@ -75,6 +76,8 @@ type (
 		primaryFields    []*field
 		uniqueFields     []*field
 		isDefaultPrimary bool
+		shardField       *field
+		shardTables      int
 		modelStyle       string // mysql, mongo
 		node             *ast.StructType
 	}
@@ -425,6 +428,14 @@ func (s *structType) initModel() {
 					s.uniqueFields = append(s.uniqueFields, f)
 				}
 			}
+			if tag, err = tags.Get("shard"); err == nil {
+				n, err := strconv.Atoi(tag.Name)
+				if err != nil || n <= 0 {
+					erpc.Fatalf("[micro] %s.%s: the shard tag should be the number of tables, got %q", s.name, f.Name, tag.Name)
+				}
+				s.shardField = f
+				s.shardTables = n
+			}
 			return true
 		})
 		if !hasPrimary {
@@ -439,6 +450,17 @@ func (s *structType) initModel() {
 		if len(s.primaryFields) == 1 && s.primaryFields[0].Typ == "int64" {
 			s.isDefaultPrimary = true
 		}
+		if s.shardField != nil {
+			var isPrimary bool
+			for _, f := range s.primaryFields {
+				if f == s.shardField {
+					isPrimary = true
+				}
+			}
+			if !isPrimary {
+				erpc.Fatalf("[micro] %s.%s: the sharding field should be a primary key", s.name, s.shardField.Name)
+			}
+		}
 
 	case "mongo":
 		var hasObjectId bool
@@ -858,9 +880,9 @@ func (r *router) handlerString(ctnFn func(*handler) string) string {
 		var secondParam, resultParam string
 		for _, h := range r.handlers {
 			secondParam = fmt.Sprintf("arg *args.%s", h.arg)
-			resultParam = "*erpc.Status"
+			resultParam = "(_stat *erpc.Status)"
 			if len(h.result) > 0 {
-				resultParam = fmt.Sprintf("(*args.%s,%s)", h.result, resultParam)
+				resultParam = fmt.Sprintf("(_result *args.%s,_stat *erpc.Status)", h.result)
 			}
 			if len(r.name) > 0 {
 				text += fmt.Sprintf(
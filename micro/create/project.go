@@ -16,6 +16,7 @@ import (
 	"github.com/henrylee2cn/erpc/v6"
 	"github.com/henrylee2cn/goutil"
 	"github.com/xiaoenai/tp-micro/v6/micro/info"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
 )
 
 type (
@@ -23,8 +24,11 @@ type (
 	Project struct {
 		*tplInfo
 		codeFiles    map[string]string
+		dialect      dialect.Dialect
 		Name         string
 		ImprotPrefix string
+		// dropRemoved whether the migration drops the removed tables and columns
+		dropRemoved bool
 	}
 	Model struct {
 		*structType
@@ -33,24 +37,35 @@ type (
 		UniqueFields     []*field
 		Fields           []*field
 		IsDefaultPrimary bool
+		ShardField       *field
+		ShardTables      int
 		Doc              string
 		Name             string
 		SnakeName        string
 		LowerFirstName   string
 		LowerFirstLetter string
-		NameSql          string
-		QuerySql         [2]string
-		UpdateSql        string
+		NameSql          template.HTML
+		QuerySql         [2]template.HTML
+		UpdateSql        template.HTML
 		UpsertSqlSuffix  string
+		UpsertFields     []string
+		dialect          dialect.Dialect
 	}
 )
 
+// dialectDrivers the SQL drivers imported by the generated project, the mysql one is imported by model/mysql
+var dialectDrivers = map[string][2]string{
+	"postgres": {"github.com/lib/pq", "v1.10.9"},
+	"sqlite":   {"github.com/mattn/go-sqlite3", "v1.14.16"},
+}
+
 // NewProject new project.
 func NewProject(src []byte) *Project {
 	p := new(Project)
 	p.tplInfo = newTplInfo(src).Parse()
 	p.Name = info.ProjName()
 	p.ImprotPrefix = info.ProjPath()
+	p.dialect = dialect.MySQL
 	p.codeFiles = make(map[string]string)
 	for k, v := range tplFiles {
 		p.codeFiles[k] = v
@@ -119,6 +134,8 @@ func (p *Project) Generator(force, newdoc bool) {
 		f.Close()
 		fmt.Printf("generate %s\n", realName)
 	}
+	// emit the migration of the changed mysql models
+	p.genMigration()
 
 	// gen and write README.md
 	if newdoc {
@@ -304,21 +321,19 @@ func baseTypeToJsonValue(t string) (string, bool) {
 func (p *Project) genMainFile() {
 	p.replace("main.go", "${PROJ_NAME}", p.Name)
 	p.replace("config.go", "${service_api_prefix}", goutil.SnakeString(p.Name))
+	p.replace("config.go", "${dialect}", p.dialect.Name())
+	p.replace("logic/model/init.go", "${deleted_ts}", string((&Model{dialect: p.dialect}).Q("deleted_ts")))
+	var driverImport string
+	if driver, ok := dialectDrivers[p.dialect.Name()]; ok {
+		driverImport = fmt.Sprintf("\n\t_ %q", driver[0])
+	}
+	p.replace("logic/model/init.go", "${driver_import}", driverImport)
 }
 
 func (p *Project) genConstFile() {
 	var text string
 	text = "import \"time\"\n"
 	text += fmt.Sprintf("// SQL CacheExpire \n const CacheExpire = time.Duration(24*time.Hour)\n")
-	for _, s := range p.tplInfo.models.mysql {
-		name := s.name + "Sql"
-		text += fmt.Sprintf(
-			"// %s the statement to create '%s' mysql table\n"+
-				"const %s string = ``\n",
-			name, goutil.SnakeString(s.name),
-			name,
-		)
-	}
 	p.replaceWithLine("args/const.gen.go", "${const_list}", text)
 }
 
@@ -342,7 +357,7 @@ func (p *Project) genHandlerFile() {
 			if len(h.group.name) > 0 {
 				ctx = firstLowerLetter(h.group.name) + ".PushCtx"
 			}
-			return fmt.Sprintf("return logic.%s(%s, arg)", h.fullName, ctx)
+			return fmt.Sprintf("defer micro.GuardPush(%s, &_stat)\nreturn logic.%s(%s, arg)", ctx, h.fullName, ctx)
 		})
 		p.replaceWithLine("api/push_handler.gen.go", "${handler_api_define}", s)
 	} else {
@@ -355,7 +370,7 @@ func (p *Project) genHandlerFile() {
 			if len(h.group.name) > 0 {
 				ctx = firstLowerLetter(h.group.name) + ".CallCtx"
 			}
-			return fmt.Sprintf("return logic.%s(%s, arg)", h.fullName, ctx)
+			return fmt.Sprintf("defer micro.GuardCall(%s, &_stat)\nreturn logic.%s(%s, arg)", ctx, h.fullName, ctx)
 		})
 		p.replaceWithLine("api/pull_handler.gen.go", "${handler_api_define}", s)
 	} else {
@@ -449,22 +464,25 @@ func (p *Project) genSdkFile() {
 func (p *Project) genModelFile() {
 	for _, m := range p.tplInfo.models.mysql {
 		fileName := "logic/model/mysql_" + goutil.SnakeString(m.name) + ".gen.go"
-		p.codeFiles[fileName] = newModelString(m)
+		p.codeFiles[fileName] = newModelString(m, p.dialect)
 		p.fillFile(fileName)
 	}
 	for _, m := range p.tplInfo.models.mongo {
 		fileName := "logic/model/mongo_" + goutil.SnakeString(m.name) + ".gen.go"
-		p.codeFiles[fileName] = newModelString(m)
+		p.codeFiles[fileName] = newModelString(m, p.dialect)
 		p.fillFile(fileName)
 	}
 }
 
-func newModelString(s *structType) string {
+func newModelString(s *structType, d dialect.Dialect) string {
 	model := &Model{
+		dialect:          d,
 		structType:       s,
 		PrimaryFields:    s.primaryFields,
 		UniqueFields:     s.uniqueFields,
 		IsDefaultPrimary: s.isDefaultPrimary,
+		ShardField:       s.shardField,
+		ShardTables:      s.shardTables,
 		Fields:           s.fields,
 		Doc:              s.doc,
 		Name:             s.name,
@@ -482,15 +500,22 @@ func newModelString(s *structType) string {
 	return ""
 }
 
+// Q returns the identifier quoted by the dialect, which is escaped in the string literal of the go source.
+func (mod *Model) Q(ident string) template.HTML {
+	q := strconv.Quote(mod.dialect.Quote(ident))
+	return template.HTML(q[1 : len(q)-1])
+}
+
 func (mod *Model) mongoString() string {
-	mod.NameSql = fmt.Sprintf("`%s`", mod.SnakeName)
-	mod.QuerySql = [2]string{}
+	mod.NameSql = template.HTML(fmt.Sprintf("`%s`", mod.SnakeName))
+	mod.QuerySql = [2]template.HTML{}
 	mod.UpdateSql = ""
 	mod.UpsertSqlSuffix = ""
 
 	var (
 		fields               []string
 		querySql1, querySql2 string
+		updateSql            string
 	)
 	for _, field := range mod.fields {
 		fields = append(fields, field.ModelName)
@@ -510,11 +535,11 @@ func (mod *Model) mongoString() string {
 		if field == "created_at" {
 			continue
 		}
-		mod.UpdateSql += fmt.Sprintf("`%s`=:%s,", field, field)
+		updateSql += fmt.Sprintf("`%s`=:%s,", field, field)
 		mod.UpsertSqlSuffix += fmt.Sprintf("`%s`=VALUES(`%s`),", field, field)
 	}
-	mod.QuerySql = [2]string{querySql1[:len(querySql1)-1], querySql2[:len(querySql2)-1]}
-	mod.UpdateSql = mod.UpdateSql[:len(mod.UpdateSql)-1]
+	mod.QuerySql = [2]template.HTML{template.HTML(querySql1[:len(querySql1)-1]), template.HTML(querySql2[:len(querySql2)-1])}
+	mod.UpdateSql = template.HTML(updateSql[:len(updateSql)-1])
 	mod.UpsertSqlSuffix = mod.UpsertSqlSuffix[:len(mod.UpsertSqlSuffix)-1] + ";"
 
 	m, err := template.New("").Parse(mongoModelTpl)
@@ -531,14 +556,15 @@ func (mod *Model) mongoString() string {
 }
 
 func (mod *Model) mysqlString() string {
-	mod.NameSql = fmt.Sprintf("`%s`", mod.SnakeName)
-	mod.QuerySql = [2]string{}
+	mod.NameSql = mod.Q(mod.SnakeName)
+	mod.QuerySql = [2]template.HTML{}
 	mod.UpdateSql = ""
-	mod.UpsertSqlSuffix = ""
+	mod.UpsertFields = nil
 
 	var (
 		fields               []string
-		querySql1, querySql2 string
+		querySql1, querySql2 template.HTML
+		updateSql            template.HTML
 	)
 	for _, field := range mod.fields {
 		fields = append(fields, field.ModelName)
@@ -553,19 +579,22 @@ func (mod *Model) mysqlString() string {
 		if field == "deleted_ts" || primaryFieldMap[field] {
 			continue
 		}
-		querySql1 += fmt.Sprintf("`%s`,", field)
-		querySql2 += fmt.Sprintf(":%s,", field)
+		querySql1 += mod.Q(field) + ","
+		querySql2 += template.HTML(":" + field + ",")
 		if field == "created_at" {
 			continue
 		}
-		mod.UpdateSql += fmt.Sprintf("`%s`=:%s,", field, field)
-		mod.UpsertSqlSuffix += fmt.Sprintf("`%s`=VALUES(`%s`),", field, field)
+		updateSql += mod.Q(field) + template.HTML("=:"+field+",")
+		mod.UpsertFields = append(mod.UpsertFields, field)
 	}
-	mod.QuerySql = [2]string{querySql1[:len(querySql1)-1], querySql2[:len(querySql2)-1]}
-	mod.UpdateSql = mod.UpdateSql[:len(mod.UpdateSql)-1]
-	mod.UpsertSqlSuffix = mod.UpsertSqlSuffix[:len(mod.UpsertSqlSuffix)-1] + ";"
+	mod.QuerySql = [2]template.HTML{querySql1[:len(querySql1)-1], querySql2[:len(querySql2)-1]}
+	mod.UpdateSql = updateSql[:len(updateSql)-1]
 
-	m, err := template.New("").Parse(mysqlModelTpl)
+	tpl := mysqlModelTpl
+	if mod.ShardField != nil {
+		tpl = mysqlShardModelTpl
+	}
+	m, err := template.New("").Parse(tpl)
 	if err != nil {
 		erpc.Fatalf("[micro] model string: %v", err)
 	}
@@ -598,5 +627,10 @@ func formatSource(src []byte) []byte {
 
 func (p *Project) genGoMod() string {
 	r := strings.Replace(__gomod__, "${import_prefix}", p.ImprotPrefix, -1)
+	var driverRequire string
+	if driver, ok := dialectDrivers[p.dialect.Name()]; ok {
+		driverRequire = fmt.Sprintf("\n\t%s %s", driver[0], driver[1])
+	}
+	r = strings.Replace(r, "${driver_require}", driverRequire, 1)
 	return r
 }
@@ -1,10 +1,12 @@
 package create
 
 import (
+	"go/format"
 	"strings"
 	"testing"
 
 	"github.com/xiaoenai/tp-micro/v6/micro/info"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
 )
 
 func TestGenerator(t *testing.T) {
@@ -29,3 +31,83 @@ func TestGenerator(t *testing.T) {
 	}
 	t.Logf("README.md:\n%s", proj.genReadme())
 }
+
+func TestHandlerGuard(t *testing.T) {
+	info.Init("test")
+	proj := NewProject([]byte(__tpl__))
+	proj.gen()
+	pull := proj.codeFiles["api/pull_handler.gen.go"]
+	for _, want := range []string{
+		"(_result *args.DivideResult,_stat *erpc.Status)",
+		"defer micro.GuardCall(m.CallCtx, &_stat)",
+		"defer micro.GuardCall(ctx, &_stat)",
+	} {
+		if !strings.Contains(pull, want) {
+			t.Fatalf("api/pull_handler.gen.go: missing %q:\n%s", want, pull)
+		}
+	}
+	if push := proj.codeFiles["api/push_handler.gen.go"]; !strings.Contains(push, "defer micro.GuardPush(") {
+		t.Fatalf("api/push_handler.gen.go: missing the guard:\n%s", push)
+	}
+}
+
+func TestShardModel(t *testing.T) {
+	info.Init("test")
+	src := strings.Replace(__tpl__, "type Log struct {\n\tText string\n}", "type Log struct {\n\tUserId int64 `key:\"pri\" shard:\"64\"`\n\tSeq int64 `key:\"pri\"`\n\tText string `key:\"uni\"`\n}", 1)
+	proj := NewProject([]byte(src))
+	proj.gen()
+	code := proj.codeFiles["logic/model/mysql_log.gen.go"]
+	if !strings.Contains(code, "mysqlHandler.RegShardedDB(") {
+		t.Fatalf("expect sharded model:\n%s", code)
+	}
+	// the unique key can not be routed, so all the tables are queried without the cache layer
+	if !strings.Contains(code, "err := logDB.Get(_l, \"SELECT ") {
+		t.Fatalf("expect the unique key queried by Get:\n%s", code)
+	}
+	if _, err := format.Source([]byte(code)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialectModel(t *testing.T) {
+	info.Init("test")
+	proj := NewProject([]byte(__tpl__))
+	proj.dialect = dialect.Postgres
+	proj.gen()
+	code := proj.codeFiles["logic/model/mysql_user.gen.go"]
+	if !strings.Contains(code, `"DELETE FROM \"user\" WHERE \"id\"=? AND \"deleted_ts\"=0;"`) {
+		t.Fatalf("expect the SQL quoted by the dialect:\n%s", code)
+	}
+	if !strings.Contains(proj.codeFiles["logic/model/init.go"], `" AND \"deleted_ts\"=0"`) {
+		t.Fatalf("expect the SQL quoted by the dialect in init.go:\n%s", proj.codeFiles["logic/model/init.go"])
+	}
+	if !strings.Contains(proj.codeFiles["config.go"], `Dialect:    "postgres",`) {
+		t.Fatalf("expect postgres dialect in config.go:\n%s", proj.codeFiles["config.go"])
+	}
+	if !strings.Contains(proj.codeFiles["logic/model/init.go"], `_ "github.com/lib/pq"`) {
+		t.Fatalf("expect the postgres driver imported in init.go:\n%s", proj.codeFiles["logic/model/init.go"])
+	}
+	if !strings.Contains(proj.genGoMod(), "github.com/lib/pq v") {
+		t.Fatalf("expect the postgres driver required in go.mod:\n%s", proj.genGoMod())
+	}
+	if _, err := format.Source([]byte(code)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := format.Source([]byte(proj.codeFiles["logic/model/init.go"])); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMongoModel(t *testing.T) {
+	info.Init("test")
+	src := strings.Replace(__tpl__, "type Meta struct {\n\tHobby []string\n\tTags  []string\n}", "type Meta struct {\n\tHobby []string\n\tTags  []string\n\tEmail string `key:\"uni\"`\n}", 1)
+	proj := NewProject([]byte(src))
+	proj.gen()
+	code := proj.codeFiles["logic/model/mongo_meta.gen.go"]
+	if !strings.Contains(code, `metaDB.CacheMultiGet(_ms, "email", "deleted_ts")`) {
+		t.Fatalf("expect MultiGetMetaByEmail:\n%s", code)
+	}
+	if _, err := format.Source([]byte(code)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -177,6 +177,10 @@ var cfg = &config{
 	Etcd: etcd.EasyConfig{
 		Endpoints: []string{"http://127.0.0.1:2379"},
 	},
+	Mysql: mysql.Config{
+		Dialect:    "${dialect}",
+		Migrations: "migrations",
+	},
 	Redis:    *redis.NewConfig(),
 	LogLevel: "TRACE",
 }
@@ -194,7 +198,7 @@ import (
 
 	"github.com/xiaoenai/tp-micro/v6/model/mongo"
 	"github.com/xiaoenai/tp-micro/v6/model/mysql"
-	"github.com/xiaoenai/tp-micro/v6/model/redis"
+	"github.com/xiaoenai/tp-micro/v6/model/redis"${driver_import}
 )
 
 // mysqlHandler preset mysql DB handler
@@ -261,7 +265,7 @@ func insertZeroDeletedTsField(whereCond string) string {
 	whereCond = strings.TrimRight(whereCond, ";")
 	i := index(
 		whereCond,
-		"` + "`" + `deleted_ts` + "`" + `",
+		"${deleted_ts}",
 		" deleted_ts",
 	)
 	if i != -1 {
@@ -275,9 +279,9 @@ func insertZeroDeletedTsField(whereCond string) string {
 		"LIMIT", "limit",
 	)
 	if i == -1 {
-		return whereCond + " AND ` + "`" + `deleted_ts` + "`" + `=0"
+		return whereCond + " AND ${deleted_ts}=0"
 	}
-	return whereCond[:i] + " AND ` + "`" + `deleted_ts` + "`" + `=0 " + whereCond[i:]
+	return whereCond[:i] + " AND ${deleted_ts}=0 " + whereCond[i:]
 }
 `,
 
@@ -305,6 +309,7 @@ ${logic_api_define}
 	"api/pull_handler.gen.go": `package api
 import (
     "github.com/henrylee2cn/erpc/v6"
+    micro "github.com/xiaoenai/tp-micro/v6"
 
     "${import_prefix}/logic"
     "${import_prefix}/args"
@@ -315,6 +320,7 @@ ${handler_api_define}
 	"api/push_handler.gen.go": `package api
 import (
     "github.com/henrylee2cn/erpc/v6"
+    micro "github.com/xiaoenai/tp-micro/v6"
 
     "${import_prefix}/logic"
     "${import_prefix}/args"
@@ -450,7 +456,7 @@ func (_{{.LowerFirstLetter}} *{{.Name}}) isZeroPrimaryKey() bool {
 	{{end}}return true
 }
 
-var {{.LowerFirstName}}DB, _ = mysqlHandler.RegCacheableDB(new({{.Name}}), args.CacheExpire, ` + "args.{{.Name}}Sql" + `)
+var {{.LowerFirstName}}DB, _ = mysqlHandler.RegCacheableDB(new({{.Name}}), args.CacheExpire, "")
 
 // Get{{.Name}}DB returns the {{.Name}} DB handler.
 func Get{{.Name}}DB() *mysql.CacheableDB {
@@ -460,13 +466,14 @@ func Get{{.Name}}DB() *mysql.CacheableDB {
 // Insert{{.Name}} insert a {{.Name}} data into database.
 // NOTE:
 //  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
-//  Without cache layer.
+//  With cache layer;
+//  Clear the cached misses of the primary key and unique keys after inserting.
 func Insert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, tx ...*sqlx.Tx) ({{if .IsDefaultPrimary}}int64,{{end}}error) {
 	_{{.LowerFirstLetter}}.UpdatedAt = coarsetime.FloorTimeNow().Unix()
 	if _{{.LowerFirstLetter}}.CreatedAt == 0 {
 		_{{.LowerFirstLetter}}.CreatedAt = _{{.LowerFirstLetter}}.UpdatedAt
 	}
-	return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}{{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
+	err := {{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
 		var (
 			query string
 			isZeroPrimaryKey=_{{.LowerFirstLetter}}.isZeroPrimaryKey()
@@ -474,15 +481,30 @@ func Insert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, tx ...*sqlx.Tx) ({{if .I
 		if isZeroPrimaryKey {
 			query = "INSERT INTO {{.NameSql}} ({{index .QuerySql 0}})VALUES({{index .QuerySql 1}});"
 		} else {
-			query = "INSERT INTO {{.NameSql}} ({{range .PrimaryFields}}` + "`{{.ModelName}}`," + `{{end}}{{index .QuerySql 0}})VALUES({{range .PrimaryFields}}:{{.ModelName}},{{end}}{{index .QuerySql 1}});"
+			query = "INSERT INTO {{.NameSql}} ({{range .PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index .QuerySql 0}})VALUES({{range .PrimaryFields}}:{{.ModelName}},{{end}}{{index .QuerySql 1}});"
 		}
-		{{if .IsDefaultPrimary}}r, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		if isZeroPrimaryKey && err==nil {
-			_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}}, err = r.LastInsertId()
+		{{if .IsDefaultPrimary}}if isZeroPrimaryKey {
+			_id, err := {{.LowerFirstName}}DB.NamedInsert(tx, query, _{{.LowerFirstLetter}}, "{{range .PrimaryFields}}{{.ModelName}}{{end}}")
+			if _id > 0 {
+				_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}} = _id
+			}
+			return err
 		}
-		{{else}}_, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		{{end}}return err
+		{{end}}_, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
+		return err
 	}, tx...)
+	if err != nil {
+		return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}err
+	}
+	err = {{.LowerFirstName}}DB.DeleteCache(_{{.LowerFirstLetter}})
+	if err != nil {
+		erpc.Errorf("%s", err.Error())
+	}
+	{{range .UniqueFields}}err = {{$.LowerFirstName}}DB.DeleteCache(_{{$.LowerFirstLetter}},"{{.ModelName}}")
+	if err != nil {
+		erpc.Errorf("%s", err.Error())
+	}
+	{{end}}return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}nil
 }
 
 // Upsert{{.Name}} insert or update the {{.Name}} data by primary key.
@@ -506,37 +528,29 @@ func Upsert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields []string,
 		var (
 			query string
 			isZeroPrimaryKey=_{{.LowerFirstLetter}}.isZeroPrimaryKey()
+			_conflict = []string{ {{range .PrimaryFields}}"{{.ModelName}}",{{end}} }
 		)
 		if isZeroPrimaryKey {
 			query = "INSERT INTO {{.NameSql}} ({{index .QuerySql 0}})VALUES({{index .QuerySql 1}})"
+			// NOTE: the unique keys include the 'deleted_ts' column
+			_conflict = {{if .UniqueFields}}[]string{"{{(index .UniqueFields 0).ModelName}}", "deleted_ts"}{{else}}nil{{end}}
 		} else {
-			query = "INSERT INTO {{.NameSql}} ({{range .PrimaryFields}}` + "`{{.ModelName}}`," + `{{end}}{{index .QuerySql 0}})VALUES({{range .PrimaryFields}}:{{.ModelName}},{{end}}{{index .QuerySql 1}})"
+			query = "INSERT INTO {{.NameSql}} ({{range .PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index .QuerySql 0}})VALUES({{range .PrimaryFields}}:{{.ModelName}},{{end}}{{index .QuerySql 1}})"
 		}
-		query +=" ON DUPLICATE KEY UPDATE "
-		if len(_updateFields) == 0 {
-			query += "{{.UpsertSqlSuffix}}"
-		} else {
-			for _, s := range _updateFields {
-				if s == "updated_at" || s == "created_at" || s == "deleted_ts"{{range .PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
-					continue
-				}
-				query += ` + "\"`\" + s + \"`=VALUES(`\" + s + \"`),\"" + `
-			}
-			if query[len(query)-1] != ',' {
-				return nil
-			}
-			query += ` + "\"`updated_at`=VALUES(`updated_at`),`deleted_ts`=0;\"" + `
+		_fields, ok := upsert{{.Name}}Fields(_updateFields)
+		if !ok {
+			return nil
 		}
-		{{if .IsDefaultPrimary}}r, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		if isZeroPrimaryKey && err==nil {
-			var rowsAffected int64
-			rowsAffected, err = r.RowsAffected()
-			if rowsAffected == 1 {
-				_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}}, err = r.LastInsertId()
+		query += {{.LowerFirstName}}DB.Dialect().Upsert(_conflict, _fields)
+		{{if .IsDefaultPrimary}}if isZeroPrimaryKey {
+			_id, err := {{.LowerFirstName}}DB.NamedInsert(tx, query, _{{.LowerFirstLetter}}, "{{range .PrimaryFields}}{{.ModelName}}{{end}}")
+			if _id > 0 {
+				_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}} = _id
 			}
+			return err
 		}
-		{{else}}_, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
-		{{end}}return err
+		{{end}}_, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
+		return err
 	}, tx...)
 	if err != nil {
 		return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}err
@@ -548,6 +562,24 @@ func Upsert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields []string,
 	return {{if .IsDefaultPrimary}}_{{.LowerFirstLetter}}{{range .PrimaryFields}}.{{.Name}}{{end}},{{end}}nil
 }
 
+// upsert{{.Name}}Fields returns the fields updated by Upsert{{.Name}}, false if there is nothing to update.
+func upsert{{.Name}}Fields(_updateFields []string) ([]string, bool) {
+	if len(_updateFields) == 0 {
+		return []string{ {{range .UpsertFields}}"{{.}}",{{end}} }, true
+	}
+	var _fields []string
+	for _, s := range _updateFields {
+		if s == "updated_at" || s == "created_at" || s == "deleted_ts"{{range .PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
+			continue
+		}
+		_fields = append(_fields, s)
+	}
+	if len(_fields) == 0 {
+		return nil, false
+	}
+	return append(_fields, "updated_at", "deleted_ts"), true
+}
+
 // Update{{.Name}}ByPrimary update the {{.Name}} data in database by primary key.
 // NOTE:
 //  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
@@ -561,18 +593,18 @@ func Update{{.Name}}ByPrimary(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields [
 	err := {{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
 		query := "UPDATE {{.NameSql}} SET "
 		if len(_updateFields) == 0 {
-			query += "{{.UpdateSql}} WHERE ` + "{{range $.PrimaryFields}}`{{.ModelName}}`=:{{.ModelName}} AND {{end}}`deleted_ts`=0" + ` LIMIT 1;"
+			query += "{{.UpdateSql}} WHERE {{range $.PrimaryFields}}{{$.Q .ModelName}}=:{{.ModelName}} AND {{end}}{{$.Q "deleted_ts"}}=0;"
 		} else {
 			for _, s := range _updateFields {
 				if s == "updated_at" || s == "created_at" || s == "deleted_ts"{{range .PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
 					continue
 				}
-				query += ` + "\"`\" + s + \"`=:\" + s + \",\"" + `
+				query += {{$.LowerFirstName}}DB.Dialect().Quote(s) + "=:" + s + ","
 			}
 			if query[len(query)-1] != ',' {
 				return nil
 			}
-			query += ` + "\"`updated_at`=:updated_at WHERE {{range .PrimaryFields}}`{{.ModelName}}`=:{{.ModelName}} AND {{end}}`deleted_ts`=0 LIMIT 1;\"" + `
+			query += "{{$.Q "updated_at"}}=:updated_at WHERE {{range .PrimaryFields}}{{$.Q .ModelName}}=:{{.ModelName}} AND {{end}}{{$.Q "deleted_ts"}}=0;"
 		}
 		_, err := tx.NamedExec(query, _{{.LowerFirstLetter}})
 		return err
@@ -600,18 +632,18 @@ func Update{{$.Name}}By{{.Name}}(_{{$.LowerFirstLetter}} *{{$.Name}}, _updateFie
 	err := {{$.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
 		query := "UPDATE {{$.NameSql}} SET "
 		if len(_updateFields) == 0 {
-			query += "{{$.UpdateSql}} WHERE ` + "`{{.ModelName}}`=:{{.ModelName}} AND `deleted_ts`=0" + ` LIMIT 1;"
+			query += "{{$.UpdateSql}} WHERE {{$.Q .ModelName}}=:{{.ModelName}} AND {{$.Q "deleted_ts"}}=0;"
 		} else {
 			for _, s := range _updateFields {
 				if s == "updated_at" || s == "created_at" || s == "deleted_ts" || s == "{{.ModelName}}"{{range $.PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
 					continue
 				}
-				query += ` + "\"`\" + s + \"`=:\" + s + \",\"" + `
+				query += {{$.LowerFirstName}}DB.Dialect().Quote(s) + "=:" + s + ","
 			}
 			if query[len(query)-1] != ',' {
 				return nil
 			}
-			query += ` + "\"`updated_at`=:updated_at WHERE `{{.ModelName}}`=:{{.ModelName}} AND `deleted_ts`=0 LIMIT 1;\"" + `
+			query += "{{$.Q "updated_at"}}=:updated_at WHERE {{$.Q .ModelName}}=:{{.ModelName}} AND {{$.Q "deleted_ts"}}=0;"
 		}
 		_, err := tx.NamedExec(query, _{{$.LowerFirstLetter}})
 		return err
@@ -636,7 +668,7 @@ func Delete{{.Name}}ByPrimary({{range .PrimaryFields}}_{{.ModelName}} {{.Typ}},
 	if deleteHard {
 		// Immediately delete from the hard disk.
 		err = {{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-				_, err := tx.Exec("DELETE FROM {{.NameSql}} WHERE {{range .PrimaryFields}}` + "`{{.ModelName}}`=? AND {{end}}`deleted_ts`=0;" + `", {{range .PrimaryFields}}_{{.ModelName}}, {{end}})
+				_, err := tx.Exec(tx.Rebind("DELETE FROM {{.NameSql}} WHERE {{range .PrimaryFields}}{{$.Q .ModelName}}=? AND {{end}}{{$.Q "deleted_ts"}}=0;"), {{range .PrimaryFields}}_{{.ModelName}}, {{end}})
 				return err
 			}, tx...)
 
@@ -644,7 +676,7 @@ func Delete{{.Name}}ByPrimary({{range .PrimaryFields}}_{{.ModelName}} {{.Typ}},
 		// Delay delete from the hard disk.
 		ts := coarsetime.FloorTimeNow().Unix()
 		err = {{.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-			_, err := tx.Exec("UPDATE {{.NameSql}} SET ` + "`updated_at`=?, `deleted_ts`=?" + ` WHERE {{range .PrimaryFields}}` + "`{{.ModelName}}`=? AND {{end}}`deleted_ts`=0;" + `", ts, ts, {{range .PrimaryFields}}_{{.ModelName}}, {{end}})
+			_, err := tx.Exec(tx.Rebind("UPDATE {{.NameSql}} SET {{$.Q "updated_at"}}=?, {{$.Q "deleted_ts"}}=? WHERE {{range .PrimaryFields}}{{$.Q .ModelName}}=? AND {{end}}{{$.Q "deleted_ts"}}=0;"), ts, ts, {{range .PrimaryFields}}_{{.ModelName}}, {{end}})
 			return err
 		}, tx...)
 	}
@@ -670,7 +702,7 @@ func Delete{{$.Name}}By{{.Name}}(_{{.ModelName}} {{.Typ}}, deleteHard bool, tx .
 	if deleteHard {
 		// Immediately delete from the hard disk.
 		err = {{$.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-				_, err := tx.Exec("DELETE FROM {{$.NameSql}} WHERE ` + "`{{.ModelName}}`=? AND `deleted_ts`=0;" + `", _{{.ModelName}})
+				_, err := tx.Exec(tx.Rebind("DELETE FROM {{$.NameSql}} WHERE {{$.Q .ModelName}}=? AND {{$.Q "deleted_ts"}}=0;"), _{{.ModelName}})
 				return err
 			}, tx...)
 
@@ -678,7 +710,7 @@ func Delete{{$.Name}}By{{.Name}}(_{{.ModelName}} {{.Typ}}, deleteHard bool, tx .
 		// Delay delete from the hard disk.
 		ts := coarsetime.FloorTimeNow().Unix()
 		err = {{$.LowerFirstName}}DB.Callback(func(tx sqlx.DbOrTx) error {
-			_, err := tx.Exec("UPDATE {{$.NameSql}} SET ` + "`updated_at`=?, `deleted_ts`=?" + ` WHERE ` + "`{{.ModelName}}`=? AND `deleted_ts`=0;" + `", ts, ts, _{{.ModelName}})
+			_, err := tx.Exec(tx.Rebind("UPDATE {{$.NameSql}} SET {{$.Q "updated_at"}}=?, {{$.Q "deleted_ts"}}=? WHERE {{$.Q .ModelName}}=? AND {{$.Q "deleted_ts"}}=0;"), ts, ts, _{{.ModelName}})
 			return err
 		}, tx...)
 	}
@@ -743,13 +775,64 @@ func Get{{$.Name}}By{{.Name}}(_{{.ModelName}} {{.Typ}}) (*{{$.Name}}, bool, erro
 }
 {{end}}
 
+// MultiGet{{.Name}}ByPrimary query the {{.Name}} data from database by primary keys in batch.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  With cache layer;
+//  Returns the data in the order of the keys, and nil means the data is not exist.
+{{if eq (len .PrimaryFields) 1}}{{with index .PrimaryFields 0}}func MultiGet{{$.Name}}ByPrimary(_{{.ModelName}}s []{{.Typ}}) ([]*{{$.Name}}, error) {
+	var _{{$.LowerFirstLetter}}s = make([]*{{$.Name}}, len(_{{.ModelName}}s))
+	for i, _{{.ModelName}} := range _{{.ModelName}}s {
+		_{{$.LowerFirstLetter}}s[i] = &{{$.Name}}{ {{.Name}}: _{{.ModelName}} }
+	}{{end}}{{else}}func MultiGet{{.Name}}ByPrimary(_keys []*{{.Name}}) ([]*{{.Name}}, error) {
+	var _{{.LowerFirstLetter}}s = make([]*{{.Name}}, len(_keys))
+	for i, _key := range _keys {
+		_{{.LowerFirstLetter}}s[i] = &{{.Name}}{
+			{{range .PrimaryFields}}{{.Name}}:_key.{{.Name}},
+			{{end}} }
+	}{{end}}
+	exists, err := {{.LowerFirstName}}DB.CacheMultiGet(_{{.LowerFirstLetter}}s)
+	if err != nil {
+		return nil, err
+	}
+	for i, _{{.LowerFirstLetter}} := range _{{.LowerFirstLetter}}s {
+		if !exists[i] || _{{.LowerFirstLetter}}.CreatedAt == 0 || _{{.LowerFirstLetter}}.DeletedTs != 0 {
+			_{{.LowerFirstLetter}}s[i] = nil
+		}
+	}
+	return _{{.LowerFirstLetter}}s, nil
+}
+
+{{range .UniqueFields}}
+// MultiGet{{$.Name}}By{{.Name}} query the {{$.Name}} data from database by '{{.ModelName}}' unique keys in batch.
+// NOTE:
+//  With cache layer;
+//  Returns the data in the order of the keys, and nil means the data is not exist.
+func MultiGet{{$.Name}}By{{.Name}}(_{{.ModelName}}s []{{.Typ}}) ([]*{{$.Name}}, error) {
+	var _{{$.LowerFirstLetter}}s = make([]*{{$.Name}}, len(_{{.ModelName}}s))
+	for i, _{{.ModelName}} := range _{{.ModelName}}s {
+		_{{$.LowerFirstLetter}}s[i] = &{{$.Name}}{ {{.Name}}: _{{.ModelName}} }
+	}
+	exists, err := {{$.LowerFirstName}}DB.CacheMultiGet(_{{$.LowerFirstLetter}}s, "{{.ModelName}}")
+	if err != nil {
+		return nil, err
+	}
+	for i, _{{$.LowerFirstLetter}} := range _{{$.LowerFirstLetter}}s {
+		if !exists[i] || _{{$.LowerFirstLetter}}.CreatedAt == 0 || _{{$.LowerFirstLetter}}.DeletedTs != 0 {
+			_{{$.LowerFirstLetter}}s[i] = nil
+		}
+	}
+	return _{{$.LowerFirstLetter}}s, nil
+}
+{{end}}
+
 // Get{{.Name}}ByWhere query a {{.Name}} data from database by WHERE condition.
 // NOTE:
 //  Without cache layer;
 //  If @return bool=false error=nil, means the data is not exist.
 func Get{{.Name}}ByWhere(whereCond string, arg ...interface{}) (*{{.Name}}, bool, error) {
 	var _{{.LowerFirstLetter}} = new({{.Name}})
-	err := {{.LowerFirstName}}DB.Get(_{{.LowerFirstLetter}}, "SELECT {{range .PrimaryFields}}` + "`{{.ModelName}}`," + `{{end}}{{index .QuerySql 0}} FROM {{.NameSql}} WHERE "+insertZeroDeletedTsField(whereCond)+ " LIMIT 1;", arg...)
+	err := {{.LowerFirstName}}DB.Get(_{{.LowerFirstLetter}}, "SELECT {{range .PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index .QuerySql 0}} FROM {{.NameSql}} WHERE "+insertZeroDeletedTsField(whereCond)+ " LIMIT 1;", arg...)
 	switch err {
 	case nil:
 		return _{{.LowerFirstLetter}}, true, nil
@@ -765,7 +848,7 @@ func Get{{.Name}}ByWhere(whereCond string, arg ...interface{}) (*{{.Name}}, bool
 //  Without cache layer.
 func Select{{.Name}}ByWhere(whereCond string, arg ...interface{}) ([]*{{.Name}}, error) {
 	var objs = new([]*{{.Name}})
-	err := {{.LowerFirstName}}DB.Select(objs, "SELECT {{range .PrimaryFields}}` + "`{{.ModelName}}`," + `{{end}}{{index .QuerySql 0}} FROM {{.NameSql}} WHERE "+insertZeroDeletedTsField(whereCond), arg...)
+	err := {{.LowerFirstName}}DB.Select(objs, "SELECT {{range .PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index .QuerySql 0}} FROM {{.NameSql}} WHERE "+insertZeroDeletedTsField(whereCond), arg...)
 	return *objs, err
 }
 
@@ -779,6 +862,328 @@ func Count{{.Name}}ByWhere(whereCond string, arg ...interface{}) (int64, error)
 }
 `
 
+const mysqlShardModelTpl = `package model
+
+import (
+	"database/sql"
+	"unsafe"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/goutil/coarsetime"
+	"github.com/xiaoenai/tp-micro/v6/model/mysql"
+	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
+
+	"${import_prefix}/args"
+)
+
+{{.Doc}}type {{.Name}} args.{{.Name}}
+
+// To{{.Name}} converts to *{{.Name}} type.
+func To{{.Name}}(_{{.LowerFirstLetter}} *args.{{.Name}}) *{{.Name}} {
+	return (*{{.Name}})(unsafe.Pointer(_{{.LowerFirstLetter}}))
+}
+
+// ToArgs{{.Name}} converts to *args.{{.Name}} type.
+func ToArgs{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}) *args.{{.Name}} {
+	return (*args.{{.Name}})(unsafe.Pointer(_{{.LowerFirstLetter}}))
+}
+
+// To{{.Name}}Slice converts to []*{{.Name}} type.
+func To{{.Name}}Slice(a []*args.{{.Name}}) []*{{.Name}} {
+	return *(*[]*{{.Name}})(unsafe.Pointer(&a))
+}
+
+// ToArgs{{.Name}}Slice converts to []*args.{{.Name}} type.
+func ToArgs{{.Name}}Slice(a []*{{.Name}}) []*args.{{.Name}} {
+	return *(*[]*args.{{.Name}})(unsafe.Pointer(&a))
+}
+
+// TableName implements 'github.com/xiaoenai/tp-micro/model'.Cacheable
+func (*{{.Name}}) TableName() string {
+	return "{{.SnakeName}}"
+}
+
+// {{.LowerFirstName}}DB the tables are spread evenly over the mysql DB and the DBs of its shard_addrs config.
+var {{.LowerFirstName}}DB, _ = mysqlHandler.RegShardedDB(new({{.Name}}), args.CacheExpire, mysql.ShardConfig{
+	Column: "{{.ShardField.ModelName}}",
+	Tables: {{.ShardTables}},
+}, "")
+
+// Get{{.Name}}DB returns the {{.Name}} sharded DB handler.
+func Get{{.Name}}DB() *mysql.ShardedDB {
+	return {{.LowerFirstName}}DB
+}
+
+// Insert{{.Name}} insert a {{.Name}} data into database.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  Sharded by '{{.ShardField.ModelName}}' into {{.ShardTables}} tables, which must be set;
+//  The tx must be of the DB of the table;
+//  With cache layer;
+//  Clear the cached miss of the primary key after inserting.
+func Insert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, tx ...*sqlx.Tx) error {
+	_{{.LowerFirstLetter}}.UpdatedAt = coarsetime.FloorTimeNow().Unix()
+	if _{{.LowerFirstLetter}}.CreatedAt == 0 {
+		_{{.LowerFirstLetter}}.CreatedAt = _{{.LowerFirstLetter}}.UpdatedAt
+	}
+	_shard := {{.LowerFirstName}}DB.Shard(_{{.LowerFirstLetter}}.{{.ShardField.Name}})
+	err := _shard.Callback(func(tx sqlx.DbOrTx) error {
+		_, err := tx.NamedExec(mysql.ShardQuery(_shard, "INSERT INTO {table} ({{range .PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index .QuerySql 0}})VALUES({{range .PrimaryFields}}:{{.ModelName}},{{end}}{{index .QuerySql 1}});"), _{{.LowerFirstLetter}})
+		return err
+	}, tx...)
+	if err != nil {
+		return err
+	}
+	err = _shard.DeleteCache(_{{.LowerFirstLetter}})
+	if err != nil {
+		erpc.Errorf("%s", err.Error())
+	}
+	return nil
+}
+
+// Upsert{{.Name}} insert or update the {{.Name}} data by primary key.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  Sharded by '{{.ShardField.ModelName}}' into {{.ShardTables}} tables, which must be set;
+//  The tx must be of the DB of the table;
+//  With cache layer;
+//  _updateFields' members must be db field style (snake format);
+//  Automatic update 'updated_at' field;
+//  Don't update the primary keys, 'created_at' key and 'deleted_ts' key;
+//  Update all fields except the primary keys, 'created_at' key and 'deleted_ts' key, if _updateFields is empty.
+func Upsert{{.Name}}(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields []string, tx ...*sqlx.Tx) error {
+	if _{{.LowerFirstLetter}}.UpdatedAt == 0 {
+		_{{.LowerFirstLetter}}.UpdatedAt = coarsetime.FloorTimeNow().Unix()
+	}
+	if _{{.LowerFirstLetter}}.CreatedAt == 0 {
+		_{{.LowerFirstLetter}}.CreatedAt = _{{.LowerFirstLetter}}.UpdatedAt
+	}
+	_shard := {{.LowerFirstName}}DB.Shard(_{{.LowerFirstLetter}}.{{.ShardField.Name}})
+	err := _shard.Callback(func(tx sqlx.DbOrTx) error {
+		_fields, ok := upsert{{.Name}}Fields(_updateFields)
+		if !ok {
+			return nil
+		}
+		query := "INSERT INTO {table} ({{range .PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index .QuerySql 0}})VALUES({{range .PrimaryFields}}:{{.ModelName}},{{end}}{{index .QuerySql 1}})" +
+			_shard.Dialect().Upsert([]string{ {{range .PrimaryFields}}"{{.ModelName}}",{{end}} }, _fields)
+		_, err := tx.NamedExec(mysql.ShardQuery(_shard, query), _{{.LowerFirstLetter}})
+		return err
+	}, tx...)
+	if err != nil {
+		return err
+	}
+	err = _shard.DeleteCache(_{{.LowerFirstLetter}})
+	if err != nil {
+		erpc.Errorf("%s", err.Error())
+	}
+	return nil
+}
+
+// upsert{{.Name}}Fields returns the fields updated by Upsert{{.Name}}, false if there is nothing to update.
+func upsert{{.Name}}Fields(_updateFields []string) ([]string, bool) {
+	if len(_updateFields) == 0 {
+		return []string{ {{range .UpsertFields}}"{{.}}",{{end}} }, true
+	}
+	var _fields []string
+	for _, s := range _updateFields {
+		if s == "updated_at" || s == "created_at" || s == "deleted_ts"{{range .PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
+			continue
+		}
+		_fields = append(_fields, s)
+	}
+	if len(_fields) == 0 {
+		return nil, false
+	}
+	return append(_fields, "updated_at", "deleted_ts"), true
+}
+
+// Update{{.Name}}ByPrimary update the {{.Name}} data in database by primary key.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  Sharded by '{{.ShardField.ModelName}}' into {{.ShardTables}} tables;
+//  The tx must be of the DB of the table;
+//  With cache layer;
+//  _updateFields' members must be db field style (snake format);
+//  Automatic update 'updated_at' field;
+//  Don't update the primary keys, 'created_at' key and 'deleted_ts' key;
+//  Update all fields except the primary keys, 'created_at' key and 'deleted_ts' key, if _updateFields is empty.
+func Update{{.Name}}ByPrimary(_{{.LowerFirstLetter}} *{{.Name}}, _updateFields []string, tx ...*sqlx.Tx) error {
+	_{{.LowerFirstLetter}}.UpdatedAt = coarsetime.FloorTimeNow().Unix()
+	_shard := {{.LowerFirstName}}DB.Shard(_{{.LowerFirstLetter}}.{{.ShardField.Name}})
+	err := _shard.Callback(func(tx sqlx.DbOrTx) error {
+		query := "UPDATE {table} SET "
+		if len(_updateFields) == 0 {
+			query += "{{.UpdateSql}} WHERE {{range $.PrimaryFields}}{{$.Q .ModelName}}=:{{.ModelName}} AND {{end}}{{$.Q "deleted_ts"}}=0;"
+		} else {
+			for _, s := range _updateFields {
+				if s == "updated_at" || s == "created_at" || s == "deleted_ts"{{range .PrimaryFields}} || s == "{{.ModelName}}"{{end}} {
+					continue
+				}
+				query += _shard.Dialect().Quote(s) + "=:" + s + ","
+			}
+			if query[len(query)-1] != ',' {
+				return nil
+			}
+			query += "{{$.Q "updated_at"}}=:updated_at WHERE {{range .PrimaryFields}}{{$.Q .ModelName}}=:{{.ModelName}} AND {{end}}{{$.Q "deleted_ts"}}=0;"
+		}
+		_, err := tx.NamedExec(mysql.ShardQuery(_shard, query), _{{.LowerFirstLetter}})
+		return err
+	}, tx...)
+	if err != nil {
+		return err
+	}
+	err = _shard.DeleteCache(_{{.LowerFirstLetter}})
+	if err != nil {
+		erpc.Errorf("%s", err.Error())
+	}
+	return nil
+}
+
+// Delete{{.Name}}ByPrimary delete a {{.Name}} data in database by primary key.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  Sharded by '{{.ShardField.ModelName}}' into {{.ShardTables}} tables;
+//  The tx must be of the DB of the table;
+//  With cache layer.
+func Delete{{.Name}}ByPrimary({{range .PrimaryFields}}_{{.ModelName}} {{.Typ}}, {{end}}deleteHard bool, tx ...*sqlx.Tx) error {
+	var err error
+	_shard := {{.LowerFirstName}}DB.Shard(_{{.ShardField.ModelName}})
+	if deleteHard {
+		// Immediately delete from the hard disk.
+		err = _shard.Callback(func(tx sqlx.DbOrTx) error {
+				_, err := tx.Exec(tx.Rebind(mysql.ShardQuery(_shard, "DELETE FROM {table} WHERE {{range .PrimaryFields}}{{$.Q .ModelName}}=? AND {{end}}{{$.Q "deleted_ts"}}=0;")), {{range .PrimaryFields}}_{{.ModelName}}, {{end}})
+				return err
+			}, tx...)
+
+	}else {
+		// Delay delete from the hard disk.
+		ts := coarsetime.FloorTimeNow().Unix()
+		err = _shard.Callback(func(tx sqlx.DbOrTx) error {
+			_, err := tx.Exec(tx.Rebind(mysql.ShardQuery(_shard, "UPDATE {table} SET {{$.Q "updated_at"}}=?, {{$.Q "deleted_ts"}}=? WHERE {{range .PrimaryFields}}{{$.Q .ModelName}}=? AND {{end}}{{$.Q "deleted_ts"}}=0;")), ts, ts, {{range .PrimaryFields}}_{{.ModelName}}, {{end}})
+			return err
+		}, tx...)
+	}
+	
+	if err != nil {
+		return err
+	}
+	err = _shard.DeleteCache(&{{.Name}}{
+		{{range .PrimaryFields}}{{.Name}}:_{{.ModelName}},
+		{{end}} })
+	if err != nil {
+		erpc.Errorf("%s", err.Error())
+	}
+	return nil
+}
+
+// Get{{.Name}}ByPrimary query a {{.Name}} data from database by primary key.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  With cache layer;
+//  If @return bool=false error=nil, means the data is not exist.
+func Get{{.Name}}ByPrimary({{range .PrimaryFields}}_{{.ModelName}} {{.Typ}}, {{end}}) (*{{.Name}}, bool, error) {
+	var _{{.LowerFirstLetter}} = &{{.Name}}{
+		{{range .PrimaryFields}}{{.Name}}:_{{.ModelName}},
+		{{end}} }
+	err := {{.LowerFirstName}}DB.CacheGet(_{{.LowerFirstLetter}})
+	switch err {
+	case nil:
+		if _{{.LowerFirstLetter}}.CreatedAt == 0 || _{{.LowerFirstLetter}}.DeletedTs != 0{
+			return nil, false, nil
+		}
+		return _{{.LowerFirstLetter}}, true, nil
+	case sql.ErrNoRows:
+		return nil, false, nil
+	default:
+		return nil, false, err
+	}
+}
+
+{{range .UniqueFields}}
+// Get{{$.Name}}By{{.Name}} query a {{$.Name}} data from database by '{{.ModelName}}' unique key.
+// NOTE:
+//  Without cache layer;
+//  All the {{$.ShardTables}} tables are queried, since it is not sharded by '{{.ModelName}}';
+//  If @return bool=false error=nil, means the data is not exist.
+func Get{{$.Name}}By{{.Name}}(_{{.ModelName}} {{.Typ}}) (*{{$.Name}}, bool, error) {
+	var _{{$.LowerFirstLetter}} = new({{$.Name}})
+	err := {{$.LowerFirstName}}DB.Get(_{{$.LowerFirstLetter}}, "SELECT {{range $.PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index $.QuerySql 0}} FROM {table} WHERE {{$.Q .ModelName}}=? AND {{$.Q "deleted_ts"}}=0 LIMIT 1;", _{{.ModelName}})
+	switch err {
+	case nil:
+		return _{{$.LowerFirstLetter}}, true, nil
+	case sql.ErrNoRows:
+		return nil, false, nil
+	default:
+		return nil, false, err
+	}
+}
+{{end}}
+
+// MultiGet{{.Name}}ByPrimary query the {{.Name}} data from database by primary keys in batch.
+// NOTE:
+//  Primary key:{{range .PrimaryFields}} '{{.ModelName}}'{{end}};
+//  With cache layer;
+//  Returns the data in the order of the keys, and nil means the data is not exist.
+{{if eq (len .PrimaryFields) 1}}{{with index .PrimaryFields 0}}func MultiGet{{$.Name}}ByPrimary(_{{.ModelName}}s []{{.Typ}}) ([]*{{$.Name}}, error) {
+	var _{{$.LowerFirstLetter}}s = make([]*{{$.Name}}, len(_{{.ModelName}}s))
+	for i, _{{.ModelName}} := range _{{.ModelName}}s {
+		_{{$.LowerFirstLetter}}s[i] = &{{$.Name}}{ {{.Name}}: _{{.ModelName}} }
+	}{{end}}{{else}}func MultiGet{{.Name}}ByPrimary(_keys []*{{.Name}}) ([]*{{.Name}}, error) {
+	var _{{.LowerFirstLetter}}s = make([]*{{.Name}}, len(_keys))
+	for i, _key := range _keys {
+		_{{.LowerFirstLetter}}s[i] = &{{.Name}}{
+			{{range .PrimaryFields}}{{.Name}}:_key.{{.Name}},
+			{{end}} }
+	}{{end}}
+	exists, err := {{.LowerFirstName}}DB.CacheMultiGet(_{{.LowerFirstLetter}}s)
+	if err != nil {
+		return nil, err
+	}
+	for i, _{{.LowerFirstLetter}} := range _{{.LowerFirstLetter}}s {
+		if !exists[i] || _{{.LowerFirstLetter}}.CreatedAt == 0 || _{{.LowerFirstLetter}}.DeletedTs != 0 {
+			_{{.LowerFirstLetter}}s[i] = nil
+		}
+	}
+	return _{{.LowerFirstLetter}}s, nil
+}
+
+// Get{{.Name}}ByWhere query a {{.Name}} data from database by WHERE condition.
+// NOTE:
+//  Without cache layer;
+//  All the {{.ShardTables}} tables are queried, and the first found in the order of the tables is returned;
+//  If @return bool=false error=nil, means the data is not exist.
+func Get{{.Name}}ByWhere(whereCond string, arg ...interface{}) (*{{.Name}}, bool, error) {
+	var _{{.LowerFirstLetter}} = new({{.Name}})
+	err := {{.LowerFirstName}}DB.Get(_{{.LowerFirstLetter}}, "SELECT {{range .PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index .QuerySql 0}} FROM {table} WHERE "+insertZeroDeletedTsField(whereCond)+ " LIMIT 1;", arg...)
+	switch err {
+	case nil:
+		return _{{.LowerFirstLetter}}, true, nil
+	case sql.ErrNoRows:
+		return nil, false, nil
+	default:
+		return nil, false, err
+	}
+}
+
+// Select{{.Name}}ByWhere query some {{.Name}} data from database by WHERE condition.
+// NOTE:
+//  Without cache layer;
+//  All the {{.ShardTables}} tables are queried, and the data are merged by _opts, which may be nil.
+func Select{{.Name}}ByWhere(_opts *mysql.MergeOptions, whereCond string, arg ...interface{}) ([]*{{.Name}}, error) {
+	var objs = new([]*{{.Name}})
+	err := {{.LowerFirstName}}DB.SelectMerge(objs, _opts, "SELECT {{range .PrimaryFields}}{{$.Q .ModelName}},{{end}}{{index .QuerySql 0}} FROM {table} WHERE "+insertZeroDeletedTsField(whereCond), arg...)
+	return *objs, err
+}
+
+// Count{{.Name}}ByWhere count {{.Name}} data number from database by WHERE condition.
+// NOTE:
+//  Without cache layer;
+//  The counts of all the {{.ShardTables}} tables are summed.
+func Count{{.Name}}ByWhere(whereCond string, arg ...interface{}) (int64, error) {
+	return {{.LowerFirstName}}DB.Count("SELECT count(*) FROM {table} WHERE "+insertZeroDeletedTsField(whereCond), arg...)
+}
+`
+
 const mongoModelTpl = `package model
 
 import (
@@ -884,6 +1289,32 @@ func Get{{$.Name}}By{{.Name}}({{.ModelName}} {{.Typ}}) (*{{$.Name}}, bool, error
 }
 {{end}}
 
+{{range .UniqueFields}}
+// MultiGet{{$.Name}}By{{.Name}} query the {{$.Name}} data from database by '{{.ModelName}}' unique keys in batch.
+// NOTE:
+//  With cache layer;
+//  Returns the data in the order of the keys, and nil means the data is not exist.
+func MultiGet{{$.Name}}By{{.Name}}({{.ModelName}}s []{{.Typ}}) ([]*{{$.Name}}, error) {
+	var _{{$.LowerFirstLetter}}s = make([]*{{$.Name}}, len({{.ModelName}}s))
+	for i, {{.ModelName}} := range {{.ModelName}}s {
+		_{{$.LowerFirstLetter}}s[i] = &{{$.Name}}{
+			{{.Name}}: {{.ModelName}},
+			DeletedTs: 0,
+		}
+	}
+	exists, err := {{$.LowerFirstName}}DB.CacheMultiGet(_{{$.LowerFirstLetter}}s, "{{.ModelName}}", "deleted_ts")
+	if err != nil {
+		return nil, err
+	}
+	for i := range _{{$.LowerFirstLetter}}s {
+		if !exists[i] {
+			_{{$.LowerFirstLetter}}s[i] = nil
+		}
+	}
+	return _{{$.LowerFirstLetter}}s, nil
+}
+{{end}}
+
 // Get{{.Name}}ByFields query a {{.Name}} data from database by WHERE field.
 // NOTE:
 //  With cache layer;
@@ -972,6 +1403,6 @@ require (
 	github.com/henrylee2cn/cfgo v0.0.0-20180417024816-e6c3cc325b21
 	github.com/henrylee2cn/erpc/v6 v6.3.1
 	github.com/henrylee2cn/goutil v0.0.0-20191202093501-834eaf50f6fe
-	github.com/xiaoenai/tp-micro/v6 v6.1.2
+	github.com/xiaoenai/tp-micro/v6 v6.1.2${driver_require}
 )
 `
@@ -0,0 +1,108 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/xiaoenai/tp-micro/v6/model/migrate"
+	"github.com/xiaoenai/tp-micro/v6/model/mysql"
+)
+
+// Options the options of migrating
+type Options struct {
+	// Dir the directory of the migration files
+	Dir string
+	// Mysql the database to migrate, which is not connected if nil
+	Mysql *mysql.Config
+}
+
+var (
+	dir      string
+	migrator *migrate.Migrator
+)
+
+// Init loads the migrations, and connects to the database if configured.
+func Init(opts Options) {
+	dir = opts.Dir
+	if opts.Mysql == nil {
+		return
+	}
+	opts.Mysql.NoCache = true
+	db, err := mysql.Connect(opts.Mysql, nil)
+	if err != nil {
+		erpc.Fatalf("[micro] connect mysql error: %v", err)
+	}
+	migrator, err = db.Migrator(dir)
+	if err != nil {
+		erpc.Fatalf("[micro] load migrations error: %v", err)
+	}
+}
+
+// Up applies the first n pending migrations.
+// Note:
+//  If n<=0, applies all the pending migrations.
+func Up(n int) {
+	done, err := migrator.Up(n)
+	for _, m := range done {
+		fmt.Printf("applied %s\n", m.FileName("up"))
+	}
+	if err != nil {
+		erpc.Fatalf("[micro] %v", err)
+	}
+	if len(done) == 0 {
+		fmt.Println("no pending migration")
+	}
+}
+
+// Down reverts the last n applied migrations.
+func Down(n int) {
+	done, err := migrator.Down(n)
+	for _, m := range done {
+		fmt.Printf("reverted %s\n", m.FileName("down"))
+	}
+	if err != nil {
+		erpc.Fatalf("[micro] %v", err)
+	}
+	if len(done) == 0 {
+		fmt.Println("no applied migration")
+	}
+}
+
+// Status prints the status of the migrations.
+func Status() {
+	status, err := migrator.Status()
+	if err != nil {
+		erpc.Fatalf("[micro] %v", err)
+	}
+	var files = make(map[int64]bool)
+	for _, m := range migrator.Migrations() {
+		files[m.Version] = true
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range status {
+		state, at := "pending", ""
+		if s.Applied {
+			state, at = "applied", s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			if !files[s.Version] {
+				state = "applied (missing files)"
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+	}
+	w.Flush()
+}
+
+// Create creates the empty files of a new migration.
+func Create(name string) {
+	m, err := migrate.Create(dir, name, "-- the statements of applying\n", "-- the statements of reverting\n")
+	if err != nil {
+		erpc.Fatalf("[micro] %v", err)
+	}
+	for _, direction := range []string{"up", "down"} {
+		fmt.Printf("create %s\n", filepath.Join(dir, m.FileName(direction)))
+	}
+}
@@ -114,7 +114,7 @@ func rewatch() {
 				erpc.Printf("%s", e.String())
 				watcher.Close()
 				if strings.HasSuffix(e.Name, create.MicroTpl) {
-					create.CreateProject(false, false)
+					create.CreateProject(false, false, "", false)
 				}
 				go rewatch()
 				return
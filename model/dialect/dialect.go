@@ -0,0 +1,136 @@
+// Package dialect abstracts the SQL differences of the databases used by the model layer.
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Dialect the SQL dialect of a database
+type Dialect interface {
+	// Name returns the dialect name, e.g. mysql
+	Name() string
+	// DriverName returns the database/sql driver name.
+	// NOTE:
+	//  Except mysql, the driver should be imported by the user.
+	DriverName() string
+	// DataSource returns the connection string, the default port is used if port is 0.
+	DataSource(host string, port int, username, password, database string) string
+	// Quote quotes the identifier, e.g. the table or column name.
+	Quote(ident string) string
+	// Placeholder returns the i-th bind variable, i starts from 1.
+	Placeholder(i int) string
+	// Columns returns the columns of the table in the current database, in the order of definition.
+	Columns(ctx context.Context, q Queryer, table string) ([]*Column, error)
+	// Upsert returns the clause appended to INSERT, which updates the update columns
+	// to the inserted values on conflict of the conflict columns.
+	// NOTE:
+	//  MySQL ignores conflict, and updates on the conflict of any unique key;
+	//  The others return empty if conflict is empty, and do nothing on conflict if update is empty.
+	Upsert(conflict, update []string) string
+	// Returning returns the clause appended to INSERT that returns the column,
+	// or empty if the driver supports sql.Result.LastInsertId.
+	Returning(column string) string
+	// Lock acquires the named lock of the session, waiting at most timeout.
+	Lock(ctx context.Context, q Queryer, name string, timeout time.Duration) error
+	// Unlock releases the named lock of the session.
+	Unlock(ctx context.Context, q Queryer, name string) error
+}
+
+// ReplicaLagger is implemented by the dialects that can check the lag of a replica.
+type ReplicaLagger interface {
+	// ReplicaLag returns how far the replica is behind the primary.
+	ReplicaLag(ctx context.Context, q Queryer) (time.Duration, error)
+}
+
+// SSLDataSourcer is implemented by the dialects whose connection string has the ssl mode.
+type SSLDataSourcer interface {
+	// SSLDataSource returns the connection string with the ssl mode, the dialect's default if empty.
+	SSLDataSource(host string, port int, username, password, database, sslMode string) string
+}
+
+// Queryer runs the queries, e.g. *sql.DB, *sql.Conn or *sql.Tx.
+type Queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Column the column of a table
+type Column struct {
+	Name    string
+	Primary bool
+}
+
+// The builtin dialects
+var (
+	MySQL    Dialect = mysqlDialect{}
+	Postgres Dialect = postgresDialect{}
+	SQLite   Dialect = sqliteDialect{}
+)
+
+var (
+	dialects = make(map[string]Dialect)
+	rwMutex  sync.RWMutex
+)
+
+func init() {
+	Register(MySQL)
+	Register(Postgres)
+	Register(SQLite)
+}
+
+// Register registers the dialect by its name and driver name.
+func Register(d Dialect) {
+	rwMutex.Lock()
+	defer rwMutex.Unlock()
+	dialects[d.Name()] = d
+	dialects[d.DriverName()] = d
+}
+
+// Get returns the dialect by the name or the driver name, MySQL if name is empty.
+func Get(name string) (Dialect, error) {
+	if len(name) == 0 {
+		return MySQL, nil
+	}
+	rwMutex.RLock()
+	d, ok := dialects[name]
+	rwMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown SQL dialect: %s", name)
+	}
+	return d, nil
+}
+
+// QuoteAll quotes the identifiers, and joins them with ','.
+func QuoteAll(d Dialect, idents []string) string {
+	quoted := make([]string, len(idents))
+	for i, ident := range idents {
+		quoted[i] = d.Quote(ident)
+	}
+	return strings.Join(quoted, ",")
+}
+
+// quoteIdent quotes the identifier with q, doubling the q in it.
+func quoteIdent(ident string, q string) string {
+	return q + strings.Replace(ident, q, q+q, -1) + q
+}
+
+// ansiUpsert returns the ON CONFLICT clause of PostgreSQL and SQLite.
+func ansiUpsert(d Dialect, conflict, update []string) string {
+	if len(conflict) == 0 {
+		return ""
+	}
+	if len(update) == 0 {
+		return " ON CONFLICT (" + QuoteAll(d, conflict) + ") DO NOTHING"
+	}
+	sets := make([]string, len(update))
+	for i, col := range update {
+		sets[i] = d.Quote(col) + "=EXCLUDED." + d.Quote(col)
+	}
+	return " ON CONFLICT (" + QuoteAll(d, conflict) + ") DO UPDATE SET " + strings.Join(sets, ",")
+}
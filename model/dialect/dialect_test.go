@@ -0,0 +1,81 @@
+package dialect
+
+import (
+	"testing"
+)
+
+func TestDialect(t *testing.T) {
+	for _, name := range []string{"", "mysql", "postgres", "sqlite", "sqlite3"} {
+		if _, err := Get(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := Get("oracle"); err == nil {
+		t.Fatal("expect error for unknown dialect")
+	}
+
+	cases := []struct {
+		d                        Dialect
+		quote, placeholder       string
+		upsert, nothing, dataSrc string
+	}{
+		{
+			d:           MySQL,
+			quote:       "`a``b`",
+			placeholder: "?",
+			upsert:      " ON DUPLICATE KEY UPDATE `name`=VALUES(`name`),`age`=VALUES(`age`)",
+			dataSrc:     "root:pwd@tcp(127.0.0.1:3306)/test?charset=utf8mb4&parseTime=true&loc=Local&interpolateParams=true",
+		},
+		{
+			d:           Postgres,
+			quote:       `"a` + "`" + `b"`,
+			placeholder: "$2",
+			upsert:      ` ON CONFLICT ("id") DO UPDATE SET "name"=EXCLUDED."name","age"=EXCLUDED."age"`,
+			nothing:     ` ON CONFLICT ("id") DO NOTHING`,
+			dataSrc:     `host='127.0.0.1' port=5432 user='root' dbname='test' sslmode='require' password='pwd'`,
+		},
+		{
+			d:           SQLite,
+			quote:       `"a` + "`" + `b"`,
+			placeholder: "?",
+			upsert:      ` ON CONFLICT ("id") DO UPDATE SET "name"=EXCLUDED."name","age"=EXCLUDED."age"`,
+			nothing:     ` ON CONFLICT ("id") DO NOTHING`,
+			dataSrc:     "test",
+		},
+	}
+	for _, c := range cases {
+		name := c.d.Name()
+		if got := c.d.Quote("a`b"); got != c.quote {
+			t.Fatalf("%s: Quote: expect %s, got %s", name, c.quote, got)
+		}
+		if got := c.d.Placeholder(2); got != c.placeholder {
+			t.Fatalf("%s: Placeholder: expect %s, got %s", name, c.placeholder, got)
+		}
+		if got := c.d.Upsert([]string{"id"}, []string{"name", "age"}); got != c.upsert {
+			t.Fatalf("%s: Upsert: expect %s, got %s", name, c.upsert, got)
+		}
+		if c.d != MySQL {
+			if got := c.d.Upsert([]string{"id"}, nil); got != c.nothing {
+				t.Fatalf("%s: Upsert: expect %s, got %s", name, c.nothing, got)
+			}
+			if got := c.d.Upsert(nil, []string{"name"}); got != "" {
+				t.Fatalf("%s: Upsert: expect empty without conflict, got %s", name, got)
+			}
+		}
+		if got := c.d.DataSource("127.0.0.1", 0, "root", "pwd", "test"); got != c.dataSrc {
+			t.Fatalf("%s: DataSource: expect %s, got %s", name, c.dataSrc, got)
+		}
+	}
+	if got := Postgres.(SSLDataSourcer).SSLDataSource("127.0.0.1", 5433, "root", "", "test", "disable"); got != `host='127.0.0.1' port=5433 user='root' dbname='test' sslmode='disable'` {
+		t.Fatalf("postgres: SSLDataSource: got %s", got)
+	}
+	if _, ok := MySQL.(SSLDataSourcer); ok {
+		t.Fatalf("mysql: unexpected SSLDataSourcer")
+	}
+	if got := Postgres.Returning("id"); got != ` RETURNING "id"` {
+		t.Fatalf("postgres: Returning: got %s", got)
+	}
+	if got := QuoteAll(Postgres, []string{"a", "b"}); got != `"a","b"` {
+		t.Fatalf("QuoteAll: got %s", got)
+	}
+}
@@ -0,0 +1,121 @@
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Name() string {
+	return "mysql"
+}
+
+func (mysqlDialect) DriverName() string {
+	return "mysql"
+}
+
+func (mysqlDialect) DataSource(host string, port int, username, password, database string) string {
+	if port == 0 {
+		port = 3306
+	}
+	if password != "" {
+		password = ":" + password
+	}
+	return fmt.Sprintf("%s%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=true&loc=Local&interpolateParams=true", username, password, host, port, database)
+}
+
+func (mysqlDialect) Quote(ident string) string {
+	return quoteIdent(ident, "`")
+}
+
+func (mysqlDialect) Placeholder(int) string {
+	return "?"
+}
+
+func (mysqlDialect) Columns(ctx context.Context, q Queryer, table string) ([]*Column, error) {
+	rows, err := q.QueryContext(ctx, "SELECT COLUMN_NAME, COLUMN_KEY FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ORDINAL_POSITION;", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []*Column
+	for rows.Next() {
+		var name, key string
+		if err = rows.Scan(&name, &key); err != nil {
+			return nil, err
+		}
+		cols = append(cols, &Column{Name: name, Primary: key == "PRI"})
+	}
+	return cols, rows.Err()
+}
+
+func (d mysqlDialect) Upsert(_, update []string) string {
+	sets := make([]string, len(update))
+	for i, col := range update {
+		sets[i] = d.Quote(col) + "=VALUES(" + d.Quote(col) + ")"
+	}
+	return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+}
+
+func (mysqlDialect) Returning(string) string {
+	return ""
+}
+
+func (mysqlDialect) Lock(ctx context.Context, q Queryer, name string, timeout time.Duration) error {
+	var got sql.NullInt64
+	err := q.QueryRowContext(ctx, "SELECT GET_LOCK(CONCAT(DATABASE(),'.',?),?);", name, int64(math.Ceil(timeout.Seconds()))).Scan(&got)
+	if err != nil {
+		return err
+	}
+	if !got.Valid || got.Int64 != 1 {
+		return fmt.Errorf("timeout waiting for the lock %s held by another session", name)
+	}
+	return nil
+}
+
+func (mysqlDialect) Unlock(ctx context.Context, q Queryer, name string) error {
+	_, err := q.ExecContext(ctx, "SELECT RELEASE_LOCK(CONCAT(DATABASE(),'.',?));", name)
+	return err
+}
+
+// ReplicaLag returns the Seconds_Behind_Master of the replica.
+func (mysqlDialect) ReplicaLag(ctx context.Context, q Queryer) (time.Duration, error) {
+	rows, err := q.QueryContext(ctx, "SHOW SLAVE STATUS;")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("not a replica")
+	}
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]interface{}, len(cols))
+	var seconds sql.NullInt64
+	for i, col := range cols {
+		if col == "Seconds_Behind_Master" {
+			values[i] = &seconds
+		} else {
+			values[i] = new(sql.RawBytes)
+		}
+	}
+	if err = rows.Scan(values...); err != nil {
+		return 0, err
+	}
+	if !seconds.Valid {
+		// NOTE: NULL means the replication is stopped
+		return 0, errors.New("replication is stopped")
+	}
+	return time.Duration(seconds.Int64) * time.Second, nil
+}
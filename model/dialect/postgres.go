@@ -0,0 +1,141 @@
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// postgresSSLMode the default ssl mode of the connection
+const postgresSSLMode = "require"
+
+// postgresLockInterval the interval of retrying to acquire the advisory lock
+const postgresLockInterval = 200 * time.Millisecond
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string {
+	return "postgres"
+}
+
+func (postgresDialect) DriverName() string {
+	return "postgres"
+}
+
+func (d postgresDialect) DataSource(host string, port int, username, password, database string) string {
+	return d.SSLDataSource(host, port, username, password, database, "")
+}
+
+// SSLDataSource returns the connection string with the ssl mode, require by default.
+// NOTE:
+//  The mode is one of [disable, require, verify-ca, verify-full].
+func (postgresDialect) SSLDataSource(host string, port int, username, password, database, sslMode string) string {
+	if sslMode == "" {
+		sslMode = postgresSSLMode
+	}
+	if port == 0 {
+		port = 5432
+	}
+	var params = []string{
+		"host=" + postgresValue(host),
+		"port=" + strconv.Itoa(port),
+		"user=" + postgresValue(username),
+		"dbname=" + postgresValue(database),
+		"sslmode=" + postgresValue(sslMode),
+	}
+	if password != "" {
+		params = append(params, "password="+postgresValue(password))
+	}
+	return strings.Join(params, " ")
+}
+
+// postgresValue quotes the value of the connection string.
+func postgresValue(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	return "'" + strings.Replace(value, `'`, `\'`, -1) + "'"
+}
+
+func (postgresDialect) Quote(ident string) string {
+	return quoteIdent(ident, `"`)
+}
+
+func (postgresDialect) Placeholder(i int) string {
+	return "$" + strconv.Itoa(i)
+}
+
+func (postgresDialect) Columns(ctx context.Context, q Queryer, table string) ([]*Column, error) {
+	rows, err := q.QueryContext(ctx, `SELECT c.column_name, k.column_name IS NOT NULL
+FROM information_schema.columns c
+LEFT JOIN information_schema.table_constraints t
+	ON t.table_schema = c.table_schema AND t.table_name = c.table_name AND t.constraint_type = 'PRIMARY KEY'
+LEFT JOIN information_schema.key_column_usage k
+	ON k.constraint_schema = t.constraint_schema AND k.constraint_name = t.constraint_name AND k.column_name = c.column_name
+WHERE c.table_schema = current_schema() AND c.table_name = $1
+ORDER BY c.ordinal_position;`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []*Column
+	for rows.Next() {
+		var col Column
+		if err = rows.Scan(&col.Name, &col.Primary); err != nil {
+			return nil, err
+		}
+		cols = append(cols, &col)
+	}
+	return cols, rows.Err()
+}
+
+func (d postgresDialect) Upsert(conflict, update []string) string {
+	return ansiUpsert(d, conflict, update)
+}
+
+func (d postgresDialect) Returning(column string) string {
+	return " RETURNING " + d.Quote(column)
+}
+
+// Lock acquires the advisory lock of the session.
+func (postgresDialect) Lock(ctx context.Context, q Queryer, name string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		var got bool
+		err := q.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext(current_database()||'.'||$1));", name).Scan(&got)
+		if err != nil {
+			return err
+		}
+		if got {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout waiting for the lock %s held by another session", name)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(postgresLockInterval):
+		}
+	}
+}
+
+func (postgresDialect) Unlock(ctx context.Context, q Queryer, name string) error {
+	_, err := q.ExecContext(ctx, "SELECT pg_advisory_unlock(hashtext(current_database()||'.'||$1));", name)
+	return err
+}
+
+// ReplicaLag returns the time since the last transaction replayed by the standby.
+func (postgresDialect) ReplicaLag(ctx context.Context, q Queryer) (time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := q.QueryRowContext(ctx, "SELECT CASE WHEN pg_is_in_recovery() THEN COALESCE(EXTRACT(EPOCH FROM now()-pg_last_xact_replay_timestamp()),0) END;").Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	if !seconds.Valid {
+		return 0, errors.New("not a replica")
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
@@ -0,0 +1,69 @@
+package dialect
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string {
+	return "sqlite"
+}
+
+func (sqliteDialect) DriverName() string {
+	return "sqlite3"
+}
+
+// DataSource returns the database file, e.g. ./test.db or :memory:
+func (sqliteDialect) DataSource(_ string, _ int, _, _, database string) string {
+	return database
+}
+
+func (sqliteDialect) Quote(ident string) string {
+	return quoteIdent(ident, `"`)
+}
+
+func (sqliteDialect) Placeholder(int) string {
+	return "?"
+}
+
+func (d sqliteDialect) Columns(ctx context.Context, q Queryer, table string) ([]*Column, error) {
+	rows, err := q.QueryContext(ctx, "PRAGMA table_info("+d.Quote(table)+");")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var cols []*Column
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err = rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+		cols = append(cols, &Column{Name: name, Primary: pk > 0})
+	}
+	return cols, rows.Err()
+}
+
+// Upsert requires SQLite 3.24.0 or later.
+func (d sqliteDialect) Upsert(conflict, update []string) string {
+	return ansiUpsert(d, conflict, update)
+}
+
+func (sqliteDialect) Returning(string) string {
+	return ""
+}
+
+// Lock does nothing, since the writes of SQLite are serialized by the database file.
+func (sqliteDialect) Lock(context.Context, Queryer, string, time.Duration) error {
+	return nil
+}
+
+func (sqliteDialect) Unlock(context.Context, Queryer, string) error {
+	return nil
+}
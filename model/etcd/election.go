@@ -0,0 +1,170 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+)
+
+const (
+	// ELECTION_KEY_PREFIX the prefix of leader election key
+	ELECTION_KEY_PREFIX = "MICRO-ELECTION"
+	// defaultCoordTTL the default session TTL of the coordination helpers, in seconds
+	defaultCoordTTL = 10
+)
+
+// retryInterval the interval of retrying after the etcd error
+var retryInterval = time.Second
+
+// LeaderCallbacks the callbacks of the leader election
+type LeaderCallbacks struct {
+	// OnElected is called in a new goroutine when the instance becomes the leader,
+	// and ctx is canceled when it loses the leadership.
+	// NOTE: The leadership is not resigned until it returns, so it should return soon after ctx is done.
+	OnElected func(ctx context.Context)
+	// OnDemoted is called after OnElected returns, when the instance loses the leadership,
+	// including being stopped and the session lease being expired.
+	OnDemoted func()
+}
+
+// LeaderElection campaigns for the leadership of the name among the instances,
+// and campaigns again after losing it, until it is stopped.
+type LeaderElection struct {
+	client    *Client
+	prefix    string
+	value     string
+	ttl       int
+	callbacks LeaderCallbacks
+	leader    int32
+	cancel    context.CancelFunc
+	done      chan struct{}
+	mu        sync.Mutex
+}
+
+// NewLeaderElection creates a leader election of the name.
+// Note:
+//  value is the identity of the instance, such as its address; if empty, use 'hostname:pid';
+//  ttl is the session TTL in seconds, the leadership is lost after the instance is down for ttl; if <=0, use 10s.
+func NewLeaderElection(client *Client, name, value string, ttl int, callbacks LeaderCallbacks) *LeaderElection {
+	if len(value) == 0 {
+		hostname, _ := os.Hostname()
+		value = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	}
+	if ttl <= 0 {
+		ttl = defaultCoordTTL
+	}
+	return &LeaderElection{
+		client:    client,
+		prefix:    ELECTION_KEY_PREFIX + "@" + name,
+		value:     value,
+		ttl:       ttl,
+		callbacks: callbacks,
+	}
+}
+
+// Start starts campaigning in the background.
+// Note:
+//  It does nothing if the election is already started.
+func (e *LeaderElection) Start() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go e.run(ctx, e.done)
+}
+
+// Stop resigns the leadership and stops campaigning, and waits for OnElected and OnDemoted to return.
+func (e *LeaderElection) Stop() {
+	e.mu.Lock()
+	cancel, done := e.cancel, e.done
+	e.cancel = nil
+	e.mu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// IsLeader returns whether the instance is the leader now.
+func (e *LeaderElection) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Leader returns the value of the current leader, or empty if there is no leader.
+func (e *LeaderElection) Leader(ctx context.Context) (string, error) {
+	resp, err := e.client.Get(ctx, e.prefix+"/", WithFirstCreate()...)
+	if err != nil || len(resp.Kvs) == 0 {
+		return "", err
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+func (e *LeaderElection) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	for ctx.Err() == nil {
+		if err := e.campaign(ctx); err != nil && ctx.Err() == nil {
+			erpc.Warnf("[etcd] campaign %s failed: %s", e.prefix, err.Error())
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryInterval):
+			}
+		}
+	}
+}
+
+func (e *LeaderElection) campaign(ctx context.Context) error {
+	sess, err := NewSession(e.client, WithSessionTTL(e.ttl))
+	if err != nil {
+		return err
+	}
+	defer sess.Close()
+	// NOTE: Stop campaigning when the session lease is expired.
+	sessCtx, sessCancel := context.WithCancel(ctx)
+	defer sessCancel()
+	go func() {
+		select {
+		case <-sess.Done():
+			sessCancel()
+		case <-sessCtx.Done():
+		}
+	}()
+	election := NewElection(sess, e.prefix)
+	if err = election.Campaign(sessCtx, e.value); err != nil {
+		return err
+	}
+
+	erpc.Infof("[etcd] elected as the leader of %s: %s", e.prefix, e.value)
+	atomic.StoreInt32(&e.leader, 1)
+	elected := make(chan struct{})
+	go func() {
+		defer close(elected)
+		if e.callbacks.OnElected != nil {
+			e.callbacks.OnElected(sessCtx)
+		}
+	}()
+	<-sessCtx.Done()
+	atomic.StoreInt32(&e.leader, 0)
+	<-elected
+	erpc.Infof("[etcd] demoted from the leader of %s: %s", e.prefix, e.value)
+	if e.callbacks.OnDemoted != nil {
+		e.callbacks.OnDemoted()
+	}
+
+	select {
+	case <-sess.Done():
+		return fmt.Errorf("session of %s is expired", e.prefix)
+	default:
+		resignCtx, cancel := context.WithTimeout(context.Background(), time.Duration(e.ttl)*time.Second)
+		defer cancel()
+		return election.Resign(resignCtx)
+	}
+}
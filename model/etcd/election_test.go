@@ -0,0 +1,63 @@
+package etcd
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLeaderElection(t *testing.T) {
+	var elected, demoted [2]int32
+	elections := make([]*LeaderElection, 2)
+	for i, value := range []string{"a", "b"} {
+		i := i
+		elections[i] = NewLeaderElection(testClient, "test-election", value, 0, LeaderCallbacks{
+			OnElected: func(ctx context.Context) {
+				atomic.AddInt32(&elected[i], 1)
+				<-ctx.Done()
+			},
+			OnDemoted: func() {
+				atomic.AddInt32(&demoted[i], 1)
+			},
+		})
+	}
+	a, b := elections[0], elections[1]
+	a.Start()
+	defer a.Stop()
+	waitFor(t, "a is elected", a.IsLeader)
+	b.Start()
+	defer b.Stop()
+	if leader, err := a.Leader(context.TODO()); err != nil || leader != "a" {
+		t.Fatalf("leader: %q, %v", leader, err)
+	}
+	if b.IsLeader() {
+		t.Fatal("b: expect not the leader")
+	}
+
+	// a loses the leadership when its session lease is revoked
+	resp, err := testClient.Get(context.TODO(), a.prefix+"/", WithFirstCreate()...)
+	if err != nil || len(resp.Kvs) == 0 {
+		t.Fatalf("leader key: %v", err)
+	}
+	if _, err = testClient.Revoke(context.TODO(), LeaseID(resp.Kvs[0].Lease)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "b is elected", b.IsLeader)
+	waitFor(t, "a is demoted", func() bool { return atomic.LoadInt32(&demoted[0]) == 1 })
+	if a.IsLeader() {
+		t.Fatal("a: expect not the leader")
+	}
+	if leader, _ := b.Leader(context.TODO()); leader != "b" {
+		t.Fatalf("leader: %q, expect: b", leader)
+	}
+
+	// b resigns when stopped, and a campaigns again
+	b.Stop()
+	if atomic.LoadInt32(&demoted[1]) != 1 {
+		t.Fatal("b: expect demoted after stopped")
+	}
+	waitFor(t, "a is elected again", a.IsLeader)
+	if atomic.LoadInt32(&elected[0]) != 2 || atomic.LoadInt32(&elected[1]) != 1 {
+		t.Fatalf("elected: %v", elected)
+	}
+}
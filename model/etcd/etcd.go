@@ -329,3 +329,50 @@ var NewMutex = concurrency.NewMutex
 // NewLocker creates a sync.Locker backed by an etcd mutex.
 //  func NewLocker(s *concurrency.Session, pfx string) sync.Locker
 var NewLocker = concurrency.NewLocker
+
+// Cmp represents a comparison of a key in the transaction.
+type Cmp = clientv3.Cmp
+
+// Op represents an operation in the transaction.
+type Op = clientv3.Op
+
+// Compare creates a comparison for the transaction.
+// The result is one of "=", "!=", ">" and "<".
+//  func Compare(cmp clientv3.Cmp, result string, v interface{}) clientv3.Cmp
+var Compare = clientv3.Compare
+
+// Value compares the value of the key.
+//  func Value(key string) clientv3.Cmp
+var Value = clientv3.Value
+
+// Version compares the version of the key.
+//  func Version(key string) clientv3.Cmp
+var Version = clientv3.Version
+
+// CreateRevision compares the creation revision of the key.
+// If the key does not exist, the creation revision is 0.
+//  func CreateRevision(key string) clientv3.Cmp
+var CreateRevision = clientv3.CreateRevision
+
+// ModRevision compares the modification revision of the key.
+//  func ModRevision(key string) clientv3.Cmp
+var ModRevision = clientv3.ModRevision
+
+// OpGet returns "get" operation based on given key and operation options.
+//  func OpGet(key string, opts ...clientv3.OpOption) clientv3.Op
+var OpGet = clientv3.OpGet
+
+// OpPut returns "put" operation based on given key-value and operation options.
+//  func OpPut(key, val string, opts ...clientv3.OpOption) clientv3.Op
+var OpPut = clientv3.OpPut
+
+// OpDelete returns "delete" operation based on given key and operation options.
+//  func OpDelete(key string, opts ...clientv3.OpOption) clientv3.Op
+var OpDelete = clientv3.OpDelete
+
+// Election implements the leader election with etcd.
+type Election = concurrency.Election
+
+// NewElection creates a new election of the prefix.
+//  func NewElection(s *concurrency.Session, pfx string) *Election
+var NewElection = concurrency.NewElection
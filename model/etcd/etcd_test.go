@@ -0,0 +1,59 @@
+package etcd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/coreos/etcd/embed"
+)
+
+// testClient the client of the embedded etcd server
+var testClient *Client
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "etcd")
+	if err != nil {
+		panic(err)
+	}
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LCUrls = []url.URL{{Scheme: "http", Host: "127.0.0.1:23791"}}
+	cfg.ACUrls = cfg.LCUrls
+	cfg.LPUrls = []url.URL{{Scheme: "http", Host: "127.0.0.1:23801"}}
+	cfg.APUrls = cfg.LPUrls
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		os.RemoveAll(dir)
+		panic(err)
+	}
+	<-e.Server.ReadyNotify()
+	testClient, err = NewClient(Config{Endpoints: []string{"127.0.0.1:23791"}})
+	if err != nil {
+		panic(err)
+	}
+	retryInterval = 100 * time.Millisecond
+
+	code := m.Run()
+	testClient.Close()
+	e.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// waitFor waits until cond returns true.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for !cond() {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("timeout: %s", what)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
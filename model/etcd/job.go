@@ -0,0 +1,79 @@
+package etcd
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// SingletonJob runs the job in exactly one of the instances with the same name,
+// which is elected as the leader.
+// It is also a server plugin that starts after listening and stops before closing, for example:
+//  job := etcd.NewSingletonJob(etcdClient, "daily-report", etcd.Periodic(time.Hour, report))
+//  srv := micro.NewServer(srvCfg, job)
+type SingletonJob struct {
+	name     string
+	election *LeaderElection
+}
+
+// NewSingletonJob creates a singleton job of the name.
+// Note:
+//  run is called when the instance is elected, and ctx is canceled when it loses the leadership,
+//  so run should return soon after ctx is done, and then the leadership is resigned;
+//  If run returns before ctx is done, it is not called again until the instance is elected again.
+func NewSingletonJob(client *Client, name string, run func(ctx context.Context)) *SingletonJob {
+	return &SingletonJob{
+		name: name,
+		election: NewLeaderElection(client, "job@"+name, "", 0, LeaderCallbacks{
+			OnElected: run,
+		}),
+	}
+}
+
+// Name returns the plugin name.
+func (j *SingletonJob) Name() string {
+	return "singleton_job(" + j.name + ")"
+}
+
+// PostListen starts the job election.
+func (j *SingletonJob) PostListen(net.Addr) error {
+	j.Start()
+	return nil
+}
+
+// PreClose stops the job and resigns the leadership, so that another instance takes over.
+func (j *SingletonJob) PreClose() error {
+	j.Stop()
+	return nil
+}
+
+// Start starts the job election in the background.
+func (j *SingletonJob) Start() {
+	j.election.Start()
+}
+
+// Stop stops the job and resigns the leadership, and waits for the running job to return.
+func (j *SingletonJob) Stop() {
+	j.election.Stop()
+}
+
+// IsRunning returns whether the job is running in the instance.
+func (j *SingletonJob) IsRunning() bool {
+	return j.election.IsLeader()
+}
+
+// Periodic returns a job that calls fn immediately and then every interval, until ctx is done.
+func Periodic(interval time.Duration, fn func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			fn(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
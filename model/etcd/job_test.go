@@ -0,0 +1,39 @@
+package etcd
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSingletonJob(t *testing.T) {
+	var running, runs int32
+	run := func(ctx context.Context) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			t.Error("the job is running in more than one instance")
+		}
+		atomic.AddInt32(&runs, 1)
+		<-ctx.Done()
+		atomic.AddInt32(&running, -1)
+	}
+	a := NewSingletonJob(testClient, "test-job", run)
+	b := NewSingletonJob(testClient, "test-job", run)
+	a.Start()
+	defer a.Stop()
+	waitFor(t, "a is running", a.IsRunning)
+	b.Start()
+	defer b.Stop()
+	if b.IsRunning() {
+		t.Fatal("b: expect not running")
+	}
+
+	// b takes over after a is stopped
+	a.Stop()
+	if a.IsRunning() {
+		t.Fatal("a: expect not running after stopped")
+	}
+	waitFor(t, "b takes over", b.IsRunning)
+	if n := atomic.LoadInt32(&runs); n != 2 {
+		t.Fatalf("runs: %d, expect: 2", n)
+	}
+}
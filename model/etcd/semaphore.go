@@ -0,0 +1,128 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	// SEMAPHORE_KEY_PREFIX the prefix of distributed semaphore key
+	SEMAPHORE_KEY_PREFIX = "MICRO-SEMAPHORE"
+)
+
+// ErrSemaphoreFull the error that all permits of the semaphore are held
+var ErrSemaphoreFull = errors.New("etcd: semaphore is full")
+
+// Semaphore a distributed semaphore that allows at most limit holders at the same time.
+// Note:
+//  Each permit is bound to a session lease, so it is released automatically after the holder is down for ttl;
+//  The waiters acquire the permits in the order of arrival.
+type Semaphore struct {
+	client *Client
+	prefix string
+	limit  int
+	ttl    int
+}
+
+// NewSemaphore creates a distributed semaphore of the name.
+// Note:
+//  ttl is the session TTL in seconds; if <=0, use 10s.
+func NewSemaphore(client *Client, name string, limit, ttl int) *Semaphore {
+	if limit <= 0 {
+		limit = 1
+	}
+	if ttl <= 0 {
+		ttl = defaultCoordTTL
+	}
+	return &Semaphore{
+		client: client,
+		prefix: SEMAPHORE_KEY_PREFIX + "@" + name + "/",
+		limit:  limit,
+		ttl:    ttl,
+	}
+}
+
+// Permit a held permit of the semaphore
+type Permit struct {
+	sess *Session
+	key  string
+}
+
+// Done returns a channel that is closed when the permit is lost,
+// because the session lease is expired or the permit is released.
+func (p *Permit) Done() <-chan struct{} {
+	return p.sess.Done()
+}
+
+// Release releases the permit.
+func (p *Permit) Release() error {
+	_, err := p.sess.Client().Delete(context.TODO(), p.key)
+	return mergeErr(err, p.sess.Close())
+}
+
+// Acquire waits for a permit until ctx is done.
+func (s *Semaphore) Acquire(ctx context.Context) (*Permit, error) {
+	return s.acquire(ctx, true)
+}
+
+// TryAcquire acquires a permit without waiting,
+// and returns ErrSemaphoreFull if all permits are held.
+func (s *Semaphore) TryAcquire(ctx context.Context) (*Permit, error) {
+	return s.acquire(ctx, false)
+}
+
+func (s *Semaphore) acquire(ctx context.Context, wait bool) (*Permit, error) {
+	sess, err := NewSession(s.client, WithSessionTTL(s.ttl))
+	if err != nil {
+		return nil, err
+	}
+	p := &Permit{
+		sess: sess,
+		key:  fmt.Sprintf("%s%016x", s.prefix, sess.Lease()),
+	}
+	if _, err = s.client.Put(ctx, p.key, "", WithLease(sess.Lease())); err != nil {
+		p.Release()
+		return nil, err
+	}
+	for {
+		// NOTE: The permits are ranked by the creation revision, and the first limit ones are held.
+		resp, err := s.client.Get(ctx, s.prefix, WithPrefix(), WithKeysOnly(),
+			WithSort(SortByCreateRevision, SortAscend), WithLimit(int64(s.limit)))
+		if err != nil {
+			p.Release()
+			return nil, err
+		}
+		for _, kv := range resp.Kvs {
+			if string(kv.Key) == p.key {
+				return p, nil
+			}
+		}
+		if !wait {
+			p.Release()
+			return nil, ErrSemaphoreFull
+		}
+		wctx, cancel := context.WithCancel(ctx)
+		wch := s.client.Watch(wctx, s.prefix, WithPrefix(), WithRev(resp.Header.Revision+1), WithFilterPut())
+		select {
+		case <-wch:
+			cancel()
+		case <-sess.Done():
+			cancel()
+			return nil, fmt.Errorf("etcd: session of %s is expired", p.key)
+		case <-ctx.Done():
+			cancel()
+			p.Release()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func mergeErr(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package etcd
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	s := NewSemaphore(testClient, "test-semaphore", 2, 0)
+	p1, err := s.TryAcquire(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := s.TryAcquire(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p2.Release()
+	if _, err = s.TryAcquire(context.TODO()); err != ErrSemaphoreFull {
+		t.Fatalf("expect ErrSemaphoreFull, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	_, err = s.Acquire(ctx)
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+
+	// the waiter acquires the released permit
+	acquired := make(chan *Permit)
+	go func() {
+		p, err := s.Acquire(context.TODO())
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- p
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("expect waiting for a permit")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err = p1.Release(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p3 := <-acquired:
+		if p3 == nil {
+			t.FailNow()
+		}
+		p3.Release()
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout: the waiter does not acquire the released permit")
+	}
+}
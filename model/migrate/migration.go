@@ -0,0 +1,167 @@
+package migrate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/henrylee2cn/goutil"
+)
+
+// Migration a versioned schema change, which is stored in two files of the directory:
+//  <version>_<name>.up.sql
+//  <version>_<name>.down.sql
+type Migration struct {
+	// Version the version, the UTC time of creating, e.g. 20181019150405
+	Version int64
+	// Name the snake name
+	Name string
+	// Up the statements of applying
+	Up string
+	// Down the statements of reverting
+	Down string
+}
+
+var (
+	fileRegexp = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+	nameRegexp = regexp.MustCompile(`^\w+$`)
+)
+
+// Load reads the migrations of the directory, in ascending order of the versions.
+// NOTE:
+//  Returns an empty list if the directory does not exist.
+func Load(dir string) ([]*Migration, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var byVersion = make(map[int64]*Migration)
+	for _, info := range infos {
+		sub := fileRegexp.FindStringSubmatch(info.Name())
+		if info.IsDir() || sub == nil {
+			continue
+		}
+		version, _ := strconv.ParseInt(sub[1], 10, 64)
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: sub[2]}
+			byVersion[version] = m
+		} else if m.Name != sub[2] {
+			return nil, fmt.Errorf("migrate: duplicate version %d: %s, %s", version, m.Name, sub[2])
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if sub[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// NewVersion returns a version of the current time.
+func NewVersion() int64 {
+	version, _ := strconv.ParseInt(time.Now().UTC().Format("20060102150405"), 10, 64)
+	return version
+}
+
+// Create writes a new migration into the directory, and returns it.
+// NOTE:
+//  The version is the current time, or the next of the latest version if it is not newer.
+func Create(dir, name, up, down string) (*Migration, error) {
+	name = goutil.SnakeString(strings.Replace(strings.TrimSpace(name), " ", "_", -1))
+	if !nameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("migrate: invalid name: %q", name)
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	m := &Migration{Version: NewVersion(), Name: name, Up: up, Down: down}
+	if n := len(migrations); n > 0 && migrations[n-1].Version >= m.Version {
+		m.Version = migrations[n-1].Version + 1
+	}
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, m.FileName("up")), []byte(up), 0644); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, m.FileName("down")), []byte(down), 0644); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// FileName returns the file name of the direction, 'up' or 'down'.
+func (m *Migration) FileName(direction string) string {
+	return fmt.Sprintf("%d_%s.%s.sql", m.Version, m.Name, direction)
+}
+
+// SplitStatements splits the SQL script into the statements by ';',
+// skipping the ones in the quotes and the comments.
+func SplitStatements(script string) []string {
+	var (
+		stmts []string
+		buf   []rune
+		quote rune
+		runes = []rune(script)
+	)
+	flush := func() {
+		if stmt := strings.TrimSpace(string(buf)); len(stmt) > 0 {
+			stmts = append(stmts, stmt)
+		}
+		buf = buf[:0]
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if quote != 0 {
+			buf = append(buf, r)
+			if r == '\\' && quote != '`' && i+1 < len(runes) {
+				i++
+				buf = append(buf, runes[i])
+			} else if r == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch {
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '#' || (r == '-' && i+1 < len(runes) && runes[i+1] == '-'):
+			for i+1 < len(runes) && runes[i+1] != '\n' {
+				i++
+			}
+			continue
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			for i += 3; i < len(runes) && !(runes[i-1] == '*' && runes[i] == '/'); i++ {
+			}
+			continue
+		case r == ';':
+			flush()
+			continue
+		}
+		buf = append(buf, r)
+	}
+	flush()
+	return stmts
+}
@@ -0,0 +1,53 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	script := "-- create the table\n" +
+		"CREATE TABLE `a;b` (`id` bigint(20) NOT NULL, `s` varchar(10) DEFAULT 'x;\\'y');\n" +
+		"/* add; the column */ ALTER TABLE `a;b` ADD COLUMN `n` int(11) NOT NULL DEFAULT '0'; # comment;\n" +
+		"INSERT INTO `a;b` (`s`) VALUES (\"1;2\")"
+	stmts := SplitStatements(script)
+	want := []string{
+		"CREATE TABLE `a;b` (`id` bigint(20) NOT NULL, `s` varchar(10) DEFAULT 'x;\\'y')",
+		"ALTER TABLE `a;b` ADD COLUMN `n` int(11) NOT NULL DEFAULT '0'",
+		"INSERT INTO `a;b` (`s`) VALUES (\"1;2\")",
+	}
+	if !reflect.DeepEqual(stmts, want) {
+		t.Fatalf("SplitStatements:\nexpect %q\ngot %q", want, stmts)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, err := Create(dir, "create user", "CREATE TABLE `user` (`id` bigint(20));", "DROP TABLE `user`;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Create(dir, "AddUserAge", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "create_user" || b.Name != "add_user_age" || b.Version <= a.Version {
+		t.Fatalf("Create: got %+v, %+v", a, b)
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(migrations, []*Migration{a, b}) {
+		t.Fatalf("Load: got %+v", migrations)
+	}
+	if _, err = Create(dir, "bad-name", "", ""); err == nil {
+		t.Fatal("Create: expect error for invalid name")
+	}
+}
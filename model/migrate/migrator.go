@@ -0,0 +1,241 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
+	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
+)
+
+// Table the table that records the applied migrations
+const Table = "schema_migrations"
+
+// lockTimeout the time waiting for the migration lock held by another instance
+const lockTimeout = time.Minute
+
+// Migrator applies and reverts the migrations of a directory to a database.
+// NOTE:
+//  Only one instance migrates at a time, by the named lock of the database, except SQLite;
+//  Most DDL statements commit implicitly, so a failed migration is not rolled back,
+//  fix the schema by hand, then migrate again.
+type Migrator struct {
+	db         *sqlx.DB
+	dialect    dialect.Dialect
+	migrations []*Migration
+}
+
+// Status the status of a migration
+type Status struct {
+	*Migration
+	// Applied whether it is applied
+	Applied bool
+	// AppliedAt the time of applying
+	AppliedAt time.Time
+}
+
+// New creates a migrator of the migrations in the directory, in the dialect of the db driver.
+func New(db *sqlx.DB, dir string) (*Migrator, error) {
+	d, err := dialect.Get(db.DriverName())
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: d, migrations: migrations}, nil
+}
+
+// Migrations returns the migrations, in ascending order of the versions.
+func (m *Migrator) Migrations() []*Migration {
+	return m.migrations
+}
+
+// Up applies the first n pending migrations in ascending order, and returns them.
+// NOTE:
+//  If n<=0, applies all the pending migrations.
+func (m *Migrator) Up(n int) ([]*Migration, error) {
+	var done []*Migration
+	err := m.locked(func(ctx context.Context, conn *sqlx.Conn, applied map[int64]int64) error {
+		for _, mig := range m.migrations {
+			if n > 0 && len(done) >= n {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := execScript(ctx, conn, mig.Up); err != nil {
+				return fmt.Errorf("migrate: up %s: %s", mig.FileName("up"), err.Error())
+			}
+			_, err := conn.ExecContext(ctx, conn.Rebind("INSERT INTO "+m.dialect.Quote(Table)+
+				" ("+dialect.QuoteAll(m.dialect, []string{"version", "name", "applied_at"})+") VALUES (?,?,?);"),
+				mig.Version, mig.Name, time.Now().Unix())
+			if err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the last n applied migrations in descending order, and returns them.
+// NOTE:
+//  If n<=0, reverts all the applied migrations.
+func (m *Migrator) Down(n int) ([]*Migration, error) {
+	var done []*Migration
+	err := m.locked(func(ctx context.Context, conn *sqlx.Conn, applied map[int64]int64) error {
+		versions := make([]int64, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Slice(versions, func(i, j int) bool {
+			return versions[i] > versions[j]
+		})
+		for _, version := range versions {
+			if n > 0 && len(done) >= n {
+				break
+			}
+			mig := m.lookup(version)
+			if mig == nil {
+				return fmt.Errorf("migrate: down: the files of the applied version %d are missing", version)
+			}
+			if err := execScript(ctx, conn, mig.Down); err != nil {
+				return fmt.Errorf("migrate: down %s: %s", mig.FileName("down"), err.Error())
+			}
+			_, err := conn.ExecContext(ctx, conn.Rebind("DELETE FROM "+m.dialect.Quote(Table)+" WHERE "+m.dialect.Quote("version")+"=?;"), version)
+			if err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Status returns the status of the migrations in ascending order,
+// including the applied ones whose files are missing.
+// NOTE:
+//  It neither locks nor writes, and all the migrations are pending if the migration table does not exist.
+func (m *Migrator) Status() ([]*Status, error) {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	applied, names, err := m.loadApplied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	status := make([]*Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := &Status{Migration: mig}
+		if at, ok := applied[mig.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = time.Unix(at, 0)
+		}
+		status = append(status, s)
+	}
+	for version, at := range applied {
+		if m.lookup(version) == nil {
+			status = append(status, &Status{
+				Migration: &Migration{Version: version, Name: names[version]},
+				Applied:   true,
+				AppliedAt: time.Unix(at, 0),
+			})
+		}
+	}
+	sort.Slice(status, func(i, j int) bool {
+		return status[i].Version < status[j].Version
+	})
+	return status, nil
+}
+
+func (m *Migrator) lookup(version int64) *Migration {
+	i := sort.Search(len(m.migrations), func(i int) bool {
+		return m.migrations[i].Version >= version
+	})
+	if i < len(m.migrations) && m.migrations[i].Version == version {
+		return m.migrations[i]
+	}
+	return nil
+}
+
+// locked calls fn with the versions and times of the applied migrations, holding the migration lock.
+func (m *Migrator) locked(fn func(ctx context.Context, conn *sqlx.Conn, applied map[int64]int64) error) error {
+	ctx := context.Background()
+	// NOTE: the named lock belongs to the connection
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err = m.dialect.Lock(ctx, conn, Table, lockTimeout); err != nil {
+		return fmt.Errorf("migrate: %s", err.Error())
+	}
+	defer m.dialect.Unlock(ctx, conn, Table)
+	if err = m.createTable(ctx, conn); err != nil {
+		return err
+	}
+	applied, _, err := m.loadApplied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, conn, applied)
+}
+
+// createTable creates the migration table if not exists.
+func (m *Migrator) createTable(ctx context.Context, conn *sqlx.Conn) error {
+	q := m.dialect.Quote
+	_, err := conn.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+q(Table)+" ("+
+		q("version")+" BIGINT NOT NULL,"+
+		q("name")+" VARCHAR(255) NOT NULL DEFAULT '',"+
+		q("applied_at")+" BIGINT NOT NULL DEFAULT 0,"+
+		"PRIMARY KEY ("+q("version")+"));")
+	return err
+}
+
+// loadApplied returns the applied times and names by version.
+// NOTE:
+//  It is read-only, and returns none if the migration table does not exist.
+func (m *Migrator) loadApplied(ctx context.Context, conn *sqlx.Conn) (map[int64]int64, map[int64]string, error) {
+	applied := make(map[int64]int64)
+	names := make(map[int64]string)
+	cols, err := m.dialect.Columns(ctx, conn, Table)
+	if err != nil || len(cols) == 0 {
+		return applied, names, err
+	}
+	q := m.dialect.Quote
+	rows, err := conn.QueryContext(ctx, "SELECT "+dialect.QuoteAll(m.dialect, []string{"version", "name", "applied_at"})+" FROM "+q(Table)+";")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			version, at int64
+			name        string
+		)
+		if err = rows.Scan(&version, &name, &at); err != nil {
+			return nil, nil, err
+		}
+		applied[version] = at
+		names[version] = name
+	}
+	return applied, names, rows.Err()
+}
+
+func execScript(ctx context.Context, conn *sqlx.Conn, script string) error {
+	for _, stmt := range SplitStatements(script) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package migrate
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
+)
+
+func TestMigrator(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, err := Create(dir, "create user", `CREATE TABLE "user" ("id" INTEGER PRIMARY KEY, "name" TEXT NOT NULL DEFAULT '');`, `DROP TABLE "user";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Create(dir, "add user age", `ALTER TABLE "user" ADD COLUMN "age" INTEGER NOT NULL DEFAULT 0;`, `ALTER TABLE "user" DROP COLUMN "age";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlx.Connect("sqlite3", "file:migrator?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the status is read-only before migrating
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || status[0].Applied || status[1].Applied {
+		t.Fatalf("Status: expect all pending, got %+v, %+v", status[0], status[1])
+	}
+	if _, err = db.Exec(`SELECT 1 FROM "` + Table + `";`); err == nil {
+		t.Fatal("Status: the migration table is created")
+	}
+
+	done, err := m.Up(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Version != a.Version {
+		t.Fatalf("Up(1): expect %s, got %v", a.Name, done)
+	}
+	if status, err = m.Status(); err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 2 || !status[0].Applied || status[1].Applied {
+		t.Fatalf("Status: expect the first applied only, got %+v, %+v", status[0], status[1])
+	}
+
+	if done, err = m.Up(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 1 || done[0].Version != b.Version {
+		t.Fatalf("Up(0): expect %s, got %v", b.Name, done)
+	}
+	if _, err = db.Exec(`INSERT INTO "user" ("id","name","age") VALUES (1,'a',2);`); err != nil {
+		t.Fatal(err)
+	}
+
+	if done, err = m.Down(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(done) != 2 || done[0].Version != b.Version || done[1].Version != a.Version {
+		t.Fatalf("Down(0): expect in descending order, got %v", done)
+	}
+	if _, err = db.Exec(`SELECT 1 FROM "user";`); err == nil {
+		t.Fatal("Down(0): the table is not dropped")
+	}
+	if status, err = m.Status(); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.Applied {
+			t.Fatalf("Status: expect all pending, got %+v", s)
+		}
+	}
+}
@@ -21,6 +21,11 @@ type Config struct {
 	PoolLimit int `yaml:"pool_limit"`
 	// NoCache whether to disable cache
 	NoCache bool `yaml:"no_cache"`
+	// CacheCodec the codec of the cached rows, [json, gob, msgpack, protobuf] or a registered one, default is json;
+	// protobuf only supports the proto.Message models.
+	CacheCodec string `yaml:"cache_codec"`
+	// CacheVersion the version of the cached rows, changing it treats the rows cached before as misses.
+	CacheVersion string `yaml:"cache_version"`
 
 	init bool
 }
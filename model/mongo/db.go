@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -62,6 +63,17 @@ type CacheableDB struct {
 	cacheExpiration   time.Duration
 	typeName          string
 	module            *redis.Module
+	local             *redis.LocalCache
+	localConfig       *redis.LocalCacheConfig
+	cacheOptions      redis.CacheOptions
+	loader            *redis.CacheLoader
+	ormType           reflect.Type
+	format            *redis.CacheFormat
+	codecConfig       *codecConfig
+}
+
+type codecConfig struct {
+	name, version string
 }
 
 // ErrCacheNil error: *DB.Cache (redis) is nil
@@ -77,6 +89,11 @@ func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duratio
 		return nil, ErrCacheNil
 	}
 
+	format, err := redis.NewCacheFormat(d.dbConfig.CacheCodec, d.dbConfig.CacheVersion, ormStructPtr)
+	if err != nil {
+		return nil, fmt.Errorf("RegCacheableDB(): %s", err.Error())
+	}
+
 	module := redis.NewModule(d.dbConfig.Database + ":" + tableName)
 	t := reflect.TypeOf(ormStructPtr)
 	c := &CacheableDB{
@@ -87,6 +104,9 @@ func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duratio
 		cacheExpiration:   cacheExpiration,
 		typeName:          t.String(),
 		module:            module,
+		loader:            new(redis.CacheLoader),
+		ormType:           t.Elem(),
+		format:            format,
 	}
 	d.cacheableDBs[tableName] = c
 	return c, nil
@@ -177,94 +197,188 @@ func (c *CacheableDB) CacheGet(destStructPtr Cacheable, fields ...string) error
 		})
 	}
 
-	var (
-		key                 = cacheKey.Key
-		gettedFirstCacheKey = cacheKey.isPriKey
-	)
+	return c.readThrough(&cacheRead{
+		cacheKey: cacheKey,
+		dest:     destStructPtr,
+		check: func() bool {
+			return cacheKey.isPriKey || c.checkSecondCache(destStructPtr, fields, cacheKey.FieldValues)
+		},
+		query: func() error {
+			return c.WitchCollection(func(collect *Collection) error {
+				return collect.Find(c.CreateGetQuery(cacheKey.FieldValues, fields...)).One(destStructPtr)
+			})
+		},
+	})
+}
+
+// cacheRead a read through the cache
+type cacheRead struct {
+	cacheKey CacheKey
+	dest     Cacheable
+	// check returns whether the cached row matches the secondary key
+	check func() bool
+	// query reads the row from db into dest
+	query func() error
+	// firstKey the key of the first cache read, and ttl its PTTL then, if it should be refreshed early
+	firstKey string
+	ttl      time.Duration
+}
 
+// readThrough reads the row from the cache, or loads it from db and writes the cache.
+func (c *CacheableDB) readThrough(r *cacheRead) error {
+	exist, refresh, err := c.readCache(r)
+	if exist || err != nil {
+		return err
+	}
+	if refresh {
+		return c.refreshCache(r)
+	}
+	if !c.cacheOptions.Singleflight {
+		_, err = c.loadCache(r)
+		return err
+	}
+	var leader bool
+	data, err := c.loader.Do(r.cacheKey.Key, func() ([]byte, error) {
+		leader = true
+		return c.loadCache(r)
+	})
+	if leader || err != nil {
+		return err
+	}
+	// shared by the leader
+	return c.format.Unmarshal(data, r.dest)
+}
+
+// readCache reads the row from the cache into dest.
+// Note:
+//  If the row is cached as non-existent, returns true and ErrNotFound;
+//  If the cache should be refreshed early, returns false and true.
+func (c *CacheableDB) readCache(r *cacheRead) (exist, refresh bool, err error) {
+	key := r.cacheKey.Key
 	// read secondary cache
-	if !gettedFirstCacheKey {
+	if !r.cacheKey.isPriKey {
 		var b []byte
-		b, err = c.Cache.Get(key).Bytes()
-		if err == nil {
-			key = goutil.BytesToString(b)
-			gettedFirstCacheKey = true
-		} else if !redis.IsRedisNil(err) {
-			return err
+		b, err = c.cacheGet(key)
+		if err != nil {
+			if redis.IsRedisNil(err) {
+				err = nil
+			}
+			return
 		}
+		if redis.IsNegativeCache(b) {
+			return true, false, ErrNotFound
+		}
+		key = goutil.BytesToString(b)
 	}
-
-	var exist bool
-
 	// get first cache
-	if gettedFirstCacheKey {
-		exist, err = c.getFirstCache(key, destStructPtr)
-		if err != nil {
-			return err
+	data, ttl, err := c.getFirstCache(key)
+	if err != nil {
+		if redis.IsRedisNil(err) {
+			err = nil
 		}
-		if exist {
-			// check
-			if !cacheKey.isPriKey && !c.checkSecondCache(destStructPtr, fields, cacheKey.FieldValues) {
-				c.Cache.Del(cacheKey.Key)
-			} else {
-				return nil
-			}
+		return
+	}
+	if redis.IsNegativeCache(data) {
+		if r.cacheKey.isPriKey {
+			return true, false, ErrNotFound
 		}
+		return
 	}
-
-	// to lock or get first cache
-	c.Cache.LockCallback("lock_"+key, func() {
-		var b []byte
-		if !exist {
-		FIRST:
-			if gettedFirstCacheKey {
-				exist, err = c.getFirstCache(key, destStructPtr)
-				if exist {
-					err = nil
-					return
-				}
-				if err != nil {
-					return
-				}
-			} else {
-				b, err = c.Cache.Get(key).Bytes()
-				if err == nil {
-					key = goutil.BytesToString(b)
-					gettedFirstCacheKey = true
-					goto FIRST
-				} else if !redis.IsRedisNil(err) {
-					return
-				}
-			}
+	if err = c.format.Unmarshal(data, r.dest); err != nil {
+		if err != redis.ErrCacheVersion {
+			erpc.Errorf("CacheGet(): %s", err.Error())
 		}
+		return false, false, nil
+	}
+	// check secondary cache
+	if !r.check() {
+		c.Cache.Del(r.cacheKey.Key)
+		c.local.Invalidate(r.cacheKey.Key)
+		return false, false, nil
+	}
+	if refresh = c.cacheOptions.ShouldRefresh(ttl, c.loader.Delta()); refresh {
+		r.firstKey, r.ttl = key, ttl
+	}
+	return !refresh, refresh, nil
+}
 
-		err = c.WitchCollection(func(collect *Collection) error {
-			return collect.Find(c.CreateGetQuery(cacheKey.FieldValues, fields...)).One(destStructPtr)
-		})
-		if err != nil {
+// loadCache loads the row from db into dest with the distributed lock, writes the cache, and returns the encoded row.
+func (c *CacheableDB) loadCache(r *cacheRead) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	lockErr := c.Cache.LockCallback("lock_"+r.cacheKey.Key, func() {
+		// the cache may be written while waiting for the lock
+		var exist bool
+		if exist, _, err = c.readCache(r); exist || err != nil {
+			if err == nil {
+				data, err = c.format.Marshal(r.dest)
+			}
 			return
 		}
+		data, err = c.loadDB(r)
+	})
+	if lockErr != nil {
+		return nil, lockErr
+	}
+	return data, err
+}
 
-		key, err = c.createPrikey(destStructPtr)
-		if err != nil {
-			erpc.Errorf("CacheGet(): createPrikey: %s", err.Error())
-			err = nil
-			return
+// refreshCache reloads the cached row in dest from db before the cache expires.
+// Note:
+//  Returns the cached row without waiting if another caller is refreshing it,
+//  or without querying if the cache has been refreshed by another caller.
+func (c *CacheableDB) refreshCache(r *cacheRead) error {
+	lock, err := c.Cache.TryObtain("lock_"+r.cacheKey.Key, nil)
+	if err != nil {
+		if err != redis.ErrLockNotObtained {
+			erpc.Errorf("CacheGet(): %s", err.Error())
 		}
+		return nil
+	}
+	defer lock.Release()
+	if ttl, err := c.Cache.PTTL(r.firstKey).Result(); err == nil && ttl > r.ttl {
+		return nil
+	}
+	_, err = c.loadDB(r)
+	return err
+}
 
-		// write cache
-		data, _ := json.Marshal(destStructPtr)
-		err = c.Cache.Set(key, data, c.cacheExpiration).Err()
-		if err == nil && !cacheKey.isPriKey {
-			err = c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
-		}
-		if err != nil {
-			erpc.Errorf("CacheGet(): %s", err.Error())
-			err = nil
+func (c *CacheableDB) loadDB(r *cacheRead) ([]byte, error) {
+	// read db
+	start := time.Now()
+	err := r.query()
+	c.loader.Observe(time.Since(start))
+	if err != nil {
+		if err == ErrNotFound && c.cacheOptions.NegativeExpiration > 0 {
+			if err2 := c.Cache.Set(r.cacheKey.Key, redis.NegativeCacheValue, c.cacheOptions.NegativeExpiration).Err(); err2 != nil {
+				erpc.Errorf("CacheGet(): %s", err2.Error())
+			}
+			c.local.Delete(r.cacheKey.Key)
 		}
-	})
+		return nil, err
+	}
+	data, err := c.format.Marshal(r.dest)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.createPrikey(r.dest)
+	if err != nil {
+		erpc.Errorf("CacheGet(): createPrikey: %s", err.Error())
+		return data, nil
+	}
 
-	return err
+	// write cache
+	err = c.Cache.Set(key, data, c.cacheExpiration).Err()
+	if err == nil && !r.cacheKey.isPriKey {
+		err = c.Cache.Set(r.cacheKey.Key, key, c.cacheExpiration).Err()
+	}
+	if err != nil {
+		erpc.Errorf("CacheGet(): %s", err.Error())
+	}
+	c.local.Delete(key, r.cacheKey.Key)
+	return data, nil
 }
 
 func (c *CacheableDB) checkSecondCache(destStructPtr Cacheable, fields []string, values []interface{}) bool {
@@ -281,20 +395,26 @@ func (c *CacheableDB) checkSecondCache(destStructPtr Cacheable, fields []string,
 	return true
 }
 
-// get first cache
-func (c *CacheableDB) getFirstCache(key string, destStructPtr Cacheable) (bool, error) {
-	data, err := c.Cache.Get(key).Bytes()
-	if err == nil {
-		err = json.Unmarshal(data, destStructPtr)
-		if err == nil {
-			return true, nil
-		}
-		erpc.Errorf("CacheGet(): %s", err.Error())
-
-	} else if !redis.IsRedisNil(err) {
-		return false, err
+// getFirstCache gets the first cache, and its PTTL if it may be refreshed early.
+func (c *CacheableDB) getFirstCache(key string) ([]byte, time.Duration, error) {
+	if c.cacheOptions.EarlyRefreshBeta <= 0 {
+		data, err := c.cacheGet(key)
+		return data, 0, err
 	}
-	return false, nil
+	var pttl *redis.DurationCmd
+	data, err := c.local.Fetch(key, func() ([]byte, error) {
+		var get *redis.StringCmd
+		c.Cache.Pipelined(func(pipe redis.Pipeliner) error {
+			get = pipe.Get(key)
+			pttl = pipe.PTTL(key)
+			return nil
+		})
+		return get.Bytes()
+	})
+	if err != nil || pttl == nil {
+		return data, 0, err
+	}
+	return data, pttl.Val(), nil
 }
 
 // PutCache caches one row by primary key.
@@ -309,7 +429,7 @@ func (c *CacheableDB) PutCache(srcStructPtr Cacheable, fields ...string) error {
 	if err != nil {
 		return err
 	}
-	data, err := json.Marshal(srcStructPtr)
+	data, err := c.format.Marshal(srcStructPtr)
 	if err != nil {
 		return err
 	}
@@ -317,7 +437,9 @@ func (c *CacheableDB) PutCache(srcStructPtr Cacheable, fields ...string) error {
 	key := cacheKey.Key
 
 	if cacheKey.isPriKey {
-		return c.Cache.Set(key, data, c.cacheExpiration).Err()
+		err = c.Cache.Set(key, data, c.cacheExpiration).Err()
+		c.local.Invalidate(key)
+		return err
 	}
 
 	// secondary cache
@@ -326,10 +448,11 @@ func (c *CacheableDB) PutCache(srcStructPtr Cacheable, fields ...string) error {
 		return err
 	}
 	err = c.Cache.Set(key, data, c.cacheExpiration).Err()
-	if err != nil {
-		return err
+	if err == nil {
+		err = c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
 	}
-	return c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
+	c.local.Invalidate(key, cacheKey.Key)
+	return err
 }
 
 // DeleteCache deletes one row form cache by primary key.
@@ -353,7 +476,9 @@ func (c *CacheableDB) DeleteCache(srcStructPtr Cacheable, fields ...string) erro
 			keys = append(keys, firstKey)
 		}
 	}
-	return c.Cache.Del(keys...).Err()
+	err = c.Cache.Del(keys...).Err()
+	c.local.Invalidate(keys...)
+	return err
 }
 
 func (c *CacheableDB) createPrikey(structPtr Cacheable) (string, error) {
@@ -396,3 +521,357 @@ func (c *CacheableDB) WitchCollection(s func(*Collection) error) error {
 	collection := c.DB.DB(c.DB.dbConfig.Database).C(c.tableName)
 	return s(collection)
 }
+
+// EnableLocalCache enables the bounded in-process cache in front of redis,
+// which is invalidated across the instances when PutCache and DeleteCache are called.
+// Note:
+//  If the DB is not initialized, it is enabled after initialization;
+//  The rows changed without PutCache or DeleteCache may be stale until the entries expire.
+func (c *CacheableDB) EnableLocalCache(cfg redis.LocalCacheConfig) error {
+	if c.DB == nil || c.DB.dbConfig == nil {
+		c.localConfig = &cfg
+		return nil
+	}
+	if c.DB.dbConfig.NoCache {
+		return nil
+	}
+	local, err := redis.NewLocalCache(c.Cache, c.module.Key("local_cache_invalidation"), cfg)
+	if err != nil {
+		return err
+	}
+	if c.local != nil {
+		c.local.Close()
+	}
+	c.local = local
+	return nil
+}
+
+// SetCacheOptions sets the options of reading through the cache.
+// Note:
+//  With NegativeExpiration, the row inserted later is invisible until the negative cache expires,
+//  unless PutCache or DeleteCache is called after inserting.
+func (c *CacheableDB) SetCacheOptions(opts redis.CacheOptions) {
+	c.cacheOptions = opts
+}
+
+// SetCacheCodec sets the codec and the version of the cached rows,
+// which override the cache_codec and cache_version of the config.
+// Note:
+//  If the DB is not initialized, it is set after initialization;
+//  Changing them treats the rows cached before as misses.
+func (c *CacheableDB) SetCacheCodec(codecName, version string) error {
+	if c.DB == nil || c.DB.dbConfig == nil {
+		c.codecConfig = &codecConfig{name: codecName, version: version}
+		return nil
+	}
+	format, err := redis.NewCacheFormat(codecName, version, reflect.New(c.ormType).Interface())
+	if err != nil {
+		return err
+	}
+	c.format = format
+	return nil
+}
+
+// cacheGet gets the cache from the local cache or redis.
+func (c *CacheableDB) cacheGet(key string) ([]byte, error) {
+	return c.local.Fetch(key, func() ([]byte, error) {
+		return c.Cache.Get(key).Bytes()
+	})
+}
+
+// CacheMultiGet selects the rows by the fields in batch.
+// Priority from the read cache.
+// Note:
+//  destStructPtrs must be a []*struct type, whose key fields are set;
+//  fields must not be empty;
+//  The misses of cache are selected by one query with '$in' or '$or', then written to the cache by one pipeline;
+//  The rows cached as non-existent by NegativeExpiration are not selected again;
+//  Returns whether the rows exist in the order of destStructPtrs.
+func (c *CacheableDB) CacheMultiGet(destStructPtrs interface{}, fields ...string) ([]bool, error) {
+	dests := reflect.ValueOf(destStructPtrs)
+	if dests.Kind() != reflect.Slice || dests.Type().Elem().String() != c.typeName {
+		return nil, fmt.Errorf("CacheMultiGet(): unmatch destStructPtrs: want []%s, have %T", c.typeName, destStructPtrs)
+	}
+	var (
+		n         = dests.Len()
+		exists    = make([]bool, n)
+		cacheKeys = make([]CacheKey, n)
+		elems     = make([]Cacheable, n)
+		err       error
+	)
+	if n == 0 {
+		return exists, nil
+	}
+	for i := 0; i < n; i++ {
+		elems[i] = dests.Index(i).Interface().(Cacheable)
+		cacheKeys[i], err = c.CreateCacheKey(elems[i], fields...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var misses []int
+	if c.DB.dbConfig.NoCache {
+		for i := range cacheKeys {
+			misses = append(misses, i)
+		}
+	} else {
+		misses, err = c.multiGetCache(cacheKeys, elems, fields, exists)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(misses) == 0 {
+		return exists, nil
+	}
+
+	// read db
+	var (
+		missIndexes = make(map[string][]int, len(misses))
+		values      = make([][]interface{}, 0, len(misses))
+	)
+	for _, i := range misses {
+		key := cacheKeys[i].Key
+		if _, ok := missIndexes[key]; !ok {
+			values = append(values, cacheKeys[i].FieldValues)
+		}
+		missIndexes[key] = append(missIndexes[key], i)
+	}
+	rows := reflect.New(reflect.SliceOf(c.ormType))
+	err = c.WitchCollection(func(collect *Collection) error {
+		return collect.Find(c.createMultiGetQuery(fields, values)).All(rows.Interface())
+	})
+	if err != nil {
+		return nil, err
+	}
+	type backfill struct {
+		key, priKey string
+		data        []byte
+	}
+	var backfills []backfill
+	rows = rows.Elem()
+	for j := 0; j < rows.Len(); j++ {
+		row := rows.Index(j).Addr().Interface().(Cacheable)
+		rowKey, err := c.CreateCacheKey(row, fields...)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range missIndexes[rowKey.Key] {
+			reflect.ValueOf(elems[i]).Elem().Set(reflect.ValueOf(row).Elem())
+			exists[i] = true
+		}
+		if c.DB.dbConfig.NoCache {
+			continue
+		}
+		priKey, err := c.createPrikey(row)
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.format.Marshal(row)
+		if err != nil {
+			return nil, err
+		}
+		backfills = append(backfills, backfill{key: rowKey.Key, priKey: priKey, data: data})
+	}
+
+	var notFound []string
+	if !c.DB.dbConfig.NoCache && c.cacheOptions.NegativeExpiration > 0 {
+		for key, indexes := range missIndexes {
+			if !exists[indexes[0]] {
+				notFound = append(notFound, key)
+			}
+		}
+	}
+
+	// write cache
+	if len(backfills) > 0 || len(notFound) > 0 {
+		_, err = c.Cache.Pipelined(func(pipe redis.Pipeliner) error {
+			for _, b := range backfills {
+				pipe.Set(b.priKey, b.data, c.cacheExpiration)
+				if b.key != b.priKey {
+					pipe.Set(b.key, b.priKey, c.cacheExpiration)
+				}
+			}
+			for _, key := range notFound {
+				pipe.Set(key, redis.NegativeCacheValue, c.cacheOptions.NegativeExpiration)
+			}
+			return nil
+		})
+		c.local.Delete(notFound...)
+		if err != nil {
+			erpc.Errorf("CacheMultiGet(): %s", err.Error())
+		}
+	}
+	return exists, nil
+}
+
+// multiGetCache reads the cache into the elements, and returns the indexes of the misses.
+func (c *CacheableDB) multiGetCache(cacheKeys []CacheKey, elems []Cacheable, fields []string, exists []bool) ([]int, error) {
+	var (
+		priKeys = make([]string, len(cacheKeys))
+		misses  []int
+		second  []int
+	)
+	for i, cacheKey := range cacheKeys {
+		if cacheKey.isPriKey {
+			priKeys[i] = cacheKey.Key
+		} else {
+			second = append(second, i)
+		}
+	}
+
+	// read secondary cache
+	if len(second) > 0 {
+		keys := make([]string, len(second))
+		for j, i := range second {
+			keys[j] = cacheKeys[i].Key
+		}
+		values, err := c.multiCacheGet(keys)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range second {
+			if values[j] == nil {
+				misses = append(misses, i)
+			} else if redis.IsNegativeCache(values[j]) {
+				// cached as non-existent
+				continue
+			} else {
+				priKeys[i] = goutil.BytesToString(values[j])
+			}
+		}
+	}
+
+	// get first cache
+	var (
+		keys    = make([]string, 0, len(cacheKeys))
+		indexes = make([]int, 0, len(cacheKeys))
+	)
+	for i, priKey := range priKeys {
+		if priKey != "" {
+			keys = append(keys, priKey)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(keys) == 0 {
+		return misses, nil
+	}
+	values, err := c.multiCacheGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	var staleKeys []string
+	for j, i := range indexes {
+		if values[j] == nil {
+			misses = append(misses, i)
+			continue
+		}
+		if redis.IsNegativeCache(values[j]) {
+			if !cacheKeys[i].isPriKey {
+				misses = append(misses, i)
+			}
+			continue
+		}
+		if err = c.format.Unmarshal(values[j], elems[i]); err != nil {
+			if err != redis.ErrCacheVersion {
+				erpc.Errorf("CacheMultiGet(): %s", err.Error())
+			}
+			misses = append(misses, i)
+			continue
+		}
+		// check secondary cache
+		if !cacheKeys[i].isPriKey && !c.checkSecondCache(elems[i], fields, cacheKeys[i].FieldValues) {
+			staleKeys = append(staleKeys, cacheKeys[i].Key)
+			misses = append(misses, i)
+			continue
+		}
+		exists[i] = true
+	}
+	if len(staleKeys) > 0 {
+		c.Cache.Del(staleKeys...)
+		c.local.Invalidate(staleKeys...)
+	}
+	sort.Ints(misses)
+	return misses, nil
+}
+
+// multiCacheGet gets the caches from the local cache or redis, the value of the miss is nil.
+// Note:
+//  For redis cluster, the keys are got by a pipeline instead of MGET, since they may be in different slots.
+func (c *CacheableDB) multiCacheGet(keys []string) ([][]byte, error) {
+	var (
+		values  = make([][]byte, len(keys))
+		remote  = make([]string, 0, len(keys))
+		indexes = make([]int, 0, len(keys))
+		version uint64
+	)
+	if c.local != nil {
+		version = c.local.Version()
+	}
+	for i, key := range keys {
+		if c.local != nil {
+			if value, ok := c.local.Get(key); ok {
+				values[i] = value
+				continue
+			}
+		}
+		remote = append(remote, key)
+		indexes = append(indexes, i)
+	}
+	if len(remote) == 0 {
+		return values, nil
+	}
+	var results []interface{}
+	if c.Cache.IsCluster() {
+		cmds, err := c.Cache.Pipelined(func(pipe redis.Pipeliner) error {
+			for _, key := range remote {
+				pipe.Get(key)
+			}
+			return nil
+		})
+		if err != nil && !redis.IsRedisNil(err) {
+			return nil, err
+		}
+		results = make([]interface{}, len(cmds))
+		for j, cmd := range cmds {
+			if s, err := cmd.(*redis.StringCmd).Result(); err == nil {
+				results[j] = s
+			}
+		}
+	} else {
+		var err error
+		results, err = c.Cache.MGet(remote...).Result()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for j, result := range results {
+		s, ok := result.(string)
+		if !ok {
+			continue
+		}
+		i := indexes[j]
+		values[i] = []byte(s)
+		if c.local != nil {
+			c.local.Set(keys[i], values[i], version)
+		}
+	}
+	return values, nil
+}
+
+// createMultiGetQuery creates the query of selecting the rows by the fields' values,
+// '$in' for one field, otherwise '$or'.
+func (c *CacheableDB) createMultiGetQuery(whereFields []string, values [][]interface{}) M {
+	if len(whereFields) == 1 {
+		in := make([]interface{}, len(values))
+		for i, v := range values {
+			in[i] = v[0]
+		}
+		return M{whereFields[0]: M{"$in": in}}
+	}
+	or := make([]M, len(values))
+	for i, v := range values {
+		or[i] = c.CreateGetQuery(v, whereFields...)
+	}
+	return M{"$or": or}
+}
@@ -74,7 +74,14 @@ func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Dura
 
 	var preFunc = func() error {
 		_cacheableDB, err := p.DB.RegCacheableDB(ormStructPtr, cacheExpiration)
+		if err == nil && cacheableDB.localConfig != nil {
+			err = _cacheableDB.EnableLocalCache(*cacheableDB.localConfig)
+		}
+		if err == nil && cacheableDB.codecConfig != nil {
+			err = _cacheableDB.SetCacheCodec(cacheableDB.codecConfig.name, cacheableDB.codecConfig.version)
+		}
 		if err == nil {
+			_cacheableDB.cacheOptions = cacheableDB.cacheOptions
 			*cacheableDB = *_cacheableDB
 			p.DB.cacheableDBs[tableName] = cacheableDB
 		}
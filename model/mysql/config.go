@@ -1,19 +1,31 @@
 package mysql
 
 import (
-	"fmt"
+	"net"
+	"strconv"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/henrylee2cn/cfgo"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
+	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
 )
 
 // Config db config
 type Config struct {
+	// Dialect the SQL dialect, [mysql, postgres, sqlite] or a registered one, default is mysql.
+	// NOTE:
+	//  The driver of postgres or sqlite should be imported, e.g. github.com/lib/pq, github.com/mattn/go-sqlite3;
+	//  The database of sqlite is the file path.
+	Dialect  string `yaml:"dialect"`
 	Database string
 	Username string
 	Password string
 	Host     string
 	Port     int
+	// SSLMode the ssl mode of the dialects supporting it, e.g. postgres [disable, require, verify-ca, verify-full];
+	// The dialect's default if empty, e.g. require for postgres.
+	SSLMode string `yaml:"ssl_mode"`
 	// the maximum number of connections in the idle connection pool.
 	//
 	// If MaxOpenConns is greater than 0 but less than the new MaxIdleConns
@@ -33,8 +45,31 @@ type Config struct {
 	// If d <= 0, connections are reused forever.
 	ConnMaxLifetime int64 `yaml:"conn_max_lifetime"`
 
+	// ReplicaAddrs the addresses of the read replicas, e.g. 10.0.0.2:3306,
+	// which share the database, username and password of the primary.
+	ReplicaAddrs []string `yaml:"replica_addrs"`
+	// MaxReplicaLag the maximum seconds a replica may be behind the primary, otherwise it is not read.
+	// If n <= 0, the lag is not checked.
+	MaxReplicaLag int64 `yaml:"max_replica_lag"`
+	// ShardAddrs the addresses of the other DBs over which the sharded tables of PreDB are spread, e.g. 10.0.0.4:3306,
+	// which share the database, username and password of the primary.
+	ShardAddrs []string `yaml:"shard_addrs"`
+
+	// Migrations the directory of the migration files, whose pending ones are warned at connecting.
+	// If empty, no migration is checked.
+	Migrations string `yaml:"migrations"`
+	// AutoMigrate whether to apply the pending migrations at connecting, instead of warning them.
+	// NOTE:
+	//  Apply them by 'micro migrate up' or DB.Migrate by default, after reviewing.
+	AutoMigrate bool `yaml:"auto_migrate"`
+
 	// NoCache whether to disable cache
 	NoCache bool `yaml:"no_cache"`
+	// CacheCodec the codec of the cached rows, [json, gob, msgpack, protobuf] or a registered one, default is json;
+	// protobuf only supports the proto.Message models.
+	CacheCodec string `yaml:"cache_codec"`
+	// CacheVersion the version of the cached rows, changing it treats the rows cached before as misses.
+	CacheVersion string `yaml:"cache_version"`
 
 	init bool
 }
@@ -67,17 +102,46 @@ func NewConfig() *Config {
 	}
 }
 
-// Source returns the mysql connection string.
+// Source returns the connection string of the dialect.
 func (cfg *Config) Source() string {
-	pwd := cfg.Password
-	if pwd != "" {
-		pwd = ":" + pwd
+	return cfg.dataSource(cfg.Host, cfg.Port)
+}
+
+// source returns the connection string of the address, e.g. 10.0.0.2:3306.
+func (cfg *Config) source(addr string) string {
+	host, port := addr, 0
+	if h, p, err := net.SplitHostPort(addr); err == nil {
+		host = h
+		port, _ = strconv.Atoi(p)
+	}
+	return cfg.dataSource(host, port)
+}
+
+// dataSource returns the connection string of the host and port, with the ssl mode if supported.
+func (cfg *Config) dataSource(host string, port int) string {
+	d := cfg.getDialect()
+	if s, ok := d.(dialect.SSLDataSourcer); ok {
+		return s.SSLDataSource(host, port, cfg.Username, cfg.Password, cfg.Database, cfg.SSLMode)
 	}
-	port := cfg.Port
-	if port == 0 {
-		port = 3306
+	return d.DataSource(host, port, cfg.Username, cfg.Password, cfg.Database)
+}
+
+// getDialect returns the SQL dialect, MySQL if unknown.
+// NOTE:
+//  The unknown dialect is rejected at connecting.
+func (cfg *Config) getDialect() dialect.Dialect {
+	d, err := dialect.Get(cfg.Dialect)
+	if err != nil {
+		return dialect.MySQL
 	}
-	return fmt.Sprintf("%s%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=true&loc=Local&interpolateParams=true", cfg.Username, pwd, cfg.Host, port, cfg.Database)
+	return d
+}
+
+// setPool sets the connection pool of db.
+func (cfg *Config) setPool(db *sqlx.DB) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetime) * time.Second)
 }
 
 // Reload sync automatically config from config file.
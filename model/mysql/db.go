@@ -10,9 +10,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/henrylee2cn/erpc/v6"
 	"github.com/henrylee2cn/goutil"
 	"github.com/henrylee2cn/goutil/errors"
-	"github.com/henrylee2cn/erpc/v6"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
 	"github.com/xiaoenai/tp-micro/v6/model/redis"
 	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
 	"github.com/xiaoenai/tp-micro/v6/model/sqlx/reflectx"
@@ -25,13 +26,18 @@ type DB struct {
 	dbConfig     *Config
 	redisConfig  *redis.Config
 	cacheableDBs map[string]*CacheableDB
+	replicas     *replicaSet
+	dialect      dialect.Dialect
 }
 
 // Connect to a database and verify with a ping.
 func Connect(dbConfig *Config, redisConfig *redis.Config) (*DB, error) {
+	d, err := dialect.Get(dbConfig.Dialect)
+	if err != nil {
+		return nil, err
+	}
 	var cache *redis.Client
 	if !dbConfig.NoCache && redisConfig != nil {
-		var err error
 		cache, err = redis.NewClient(redisConfig)
 		if err != nil {
 			return nil, err
@@ -40,25 +46,74 @@ func Connect(dbConfig *Config, redisConfig *redis.Config) (*DB, error) {
 
 	// this Pings the database trying to connect, panics on error
 	// use sqlx.Open() for sql.Open() semantics
-	db, err := sqlx.Connect("mysql", dbConfig.Source())
+	db, err := sqlx.Connect(d.DriverName(), dbConfig.Source())
 	if err != nil {
 		return nil, err
 	}
-	db.SetMaxOpenConns(dbConfig.MaxOpenConns)
-	db.SetMaxIdleConns(dbConfig.MaxIdleConns)
-	db.SetConnMaxLifetime(time.Duration(dbConfig.ConnMaxLifetime) * time.Second)
+	dbConfig.setPool(db)
 	// db.MapperFunc(goutil.SnakeString)
 	db.Mapper = reflectx.NewMapperFunc("json", goutil.SnakeString)
 
+	if err = (&DB{DB: db, dialect: d}).migrateAtConnecting(dbConfig); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	replicas, err := newReplicaSet(dbConfig)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	return &DB{
 		DB:           db,
 		dbConfig:     dbConfig,
 		Cache:        cache,
 		redisConfig:  redisConfig,
 		cacheableDBs: make(map[string]*CacheableDB),
+		replicas:     replicas,
+		dialect:      d,
 	}, nil
 }
 
+// Dialect returns the SQL dialect, MySQL if not connected by the config.
+func (d *DB) Dialect() dialect.Dialect {
+	if d.dialect == nil {
+		return dialect.MySQL
+	}
+	return d.dialect
+}
+
+// NamedInsert executes the named INSERT query, and returns the auto-increment value of idColumn.
+// NOTE:
+//  Returns 0 if no row is inserted, e.g. the row is updated on conflict in MySQL.
+func (d *DB) NamedInsert(tx sqlx.DbOrTx, query string, arg interface{}, idColumn string) (int64, error) {
+	if returning := d.Dialect().Returning(idColumn); len(returning) > 0 {
+		query = strings.TrimRight(strings.TrimSpace(query), ";") + returning
+		rows, err := tx.NamedQuery(query, arg)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		var id int64
+		if rows.Next() {
+			err = rows.Scan(&id)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		return id, err
+	}
+	r, err := tx.NamedExec(query, arg)
+	if err != nil {
+		return 0, err
+	}
+	if n, err := r.RowsAffected(); err != nil || n != 1 {
+		return 0, err
+	}
+	return r.LastInsertId()
+}
+
 // Cacheable the interface that can use cache.
 // It must be orm-struct.
 type Cacheable interface {
@@ -77,6 +132,17 @@ type CacheableDB struct {
 	priFieldsIndex    []int          // primary column index in struct
 	fieldsIndexMap    map[string]int // key:colName, value:field index in struct
 	module            *redis.Module
+	local             *redis.LocalCache
+	localConfig       *redis.LocalCacheConfig
+	cacheOptions      redis.CacheOptions
+	loader            *redis.CacheLoader
+	ormType           reflect.Type
+	format            *redis.CacheFormat
+	codecConfig       *codecConfig
+}
+
+type codecConfig struct {
+	name, version string
 }
 
 // ErrCacheNil error: *DB.Cache (redis) is nil
@@ -84,7 +150,11 @@ var ErrCacheNil = errors.New("*DB.Cache (redis) is nil")
 
 // RegCacheableDB registers a cacheable table.
 func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duration) (*CacheableDB, error) {
-	tableName := ormStructPtr.TableName()
+	return d.regCacheableDB(ormStructPtr, ormStructPtr.TableName(), cacheExpiration)
+}
+
+// regCacheableDB registers a cacheable table, whose name may differ from ormStructPtr.TableName().
+func (d *DB) regCacheableDB(ormStructPtr Cacheable, tableName string, cacheExpiration time.Duration) (*CacheableDB, error) {
 	if _, ok := d.cacheableDBs[tableName]; ok {
 		return nil, fmt.Errorf("re-register cacheable table: %s", tableName)
 	}
@@ -93,23 +163,21 @@ func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duratio
 		return nil, ErrCacheNil
 	}
 
-	type Col struct {
-		ColumnName string `json:"COLUMN_NAME" db:"COLUMN_NAME"`
-		ColumnKey  string `json:"COLUMN_KEY" db:"COLUMN_KEY"`
-	}
-
-	var colsResult []*Col
-	err := d.DB.Select(&colsResult, `SELECT COLUMN_NAME, COLUMN_KEY FROM information_schema.columns WHERE table_schema = ? AND table_name = ?;`, d.dbConfig.Database, tableName)
+	colsResult, err := d.Dialect().Columns(context.Background(), d.DB, tableName)
 	if err != nil {
 		return nil, fmt.Errorf("RegCacheableDB(): %s", err.Error())
 	}
 
+	if len(colsResult) == 0 {
+		return nil, fmt.Errorf("RegCacheableDB(): table '%s.%s' does not exist%s", d.dbConfig.Database, tableName, d.pendingMigrations())
+	}
+
 	priCols := make([]string, 0, 1)
 	cols := make([]string, 0, len(colsResult))
 	for _, col := range colsResult {
-		cols = append(cols, col.ColumnName)
-		if col.ColumnKey == "PRI" {
-			priCols = append(priCols, col.ColumnName)
+		cols = append(cols, col.Name)
+		if col.Primary {
+			priCols = append(priCols, col.Name)
 		}
 	}
 
@@ -144,6 +212,11 @@ func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duratio
 		priFieldsIndex[i] = fieldsIndexMap[col]
 	}
 
+	format, err := redis.NewCacheFormat(d.dbConfig.CacheCodec, d.dbConfig.CacheVersion, ormStructPtr)
+	if err != nil {
+		return nil, fmt.Errorf("RegCacheableDB(): %s", err.Error())
+	}
+
 	module := redis.NewModule(d.dbConfig.Database + ":" + tableName)
 	c := &CacheableDB{
 		DB:                d,
@@ -156,6 +229,9 @@ func (d *DB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duratio
 		priFieldsIndex:    priFieldsIndex,
 		fieldsIndexMap:    fieldsIndexMap,
 		module:            module,
+		loader:            new(redis.CacheLoader),
+		ormType:           t,
+		format:            format,
 	}
 	d.cacheableDBs[tableName] = c
 	return c, nil
@@ -171,6 +247,11 @@ func (d *DB) GetCacheableDB(tableName string) (*CacheableDB, error) {
 	return c, nil
 }
 
+// TableName returns the table name.
+func (c *CacheableDB) TableName() string {
+	return c.tableName
+}
+
 // CacheKey cache key and values corresponding to primary keys
 type CacheKey struct {
 	Key         string
@@ -264,13 +345,10 @@ func (c *CacheableDB) CreateGetQuery(whereFields ...string) string {
 	if len(whereFields) == 0 {
 		whereFields = c.priCols
 	}
-	var queryAll = "SELECT"
-	for _, col := range c.cols {
-		queryAll += " `" + col + "`,"
-	}
-	queryAll = queryAll[:len(queryAll)-1] + " FROM `" + c.tableName + "` WHERE"
-	for _, col := range whereFields {
-		queryAll += " `" + col + "`=? AND"
+	var q = c.DB.Dialect()
+	var queryAll = "SELECT " + dialect.QuoteAll(q, c.cols) + " FROM " + q.Quote(c.tableName) + " WHERE"
+	for i, col := range whereFields {
+		queryAll += " " + q.Quote(col) + "=" + q.Placeholder(i+1) + " AND"
 	}
 	queryAll = queryAll[:len(queryAll)-4] + " LIMIT 1;"
 	return queryAll
@@ -293,95 +371,17 @@ func (c *CacheableDB) CacheGet(destStructPtr Cacheable, fields ...string) error
 		return c.DB.Get(destStructPtr, c.CreateGetQuery(fields...), cacheKey.FieldValues...)
 	}
 
-	var (
-		key                 = cacheKey.Key
-		gettedFirstCacheKey = cacheKey.isPriKey
-	)
-
-	// read secondary cache
-	if !gettedFirstCacheKey {
-		var b []byte
-		b, err = c.Cache.Get(key).Bytes()
-		if err == nil {
-			key = goutil.BytesToString(b)
-			gettedFirstCacheKey = true
-		} else if !redis.IsRedisNil(err) {
-			return err
-		}
-	}
-
-	var exist bool
-
-	// get first cache
-	if gettedFirstCacheKey {
-		// clean
-		c.cleanDestCacheable(structElemValue)
-
-		exist, err = c.getFirstCache(key, destStructPtr)
-		if err != nil {
-			return err
-		}
-		if exist {
-			// check secondary cache
-			if !cacheKey.isPriKey && !c.checkSecondCache(structElemValue, fields, cacheKey.FieldValues) {
-				c.Cache.Del(cacheKey.Key)
-			} else {
-				return nil
-			}
-		}
-	}
-
-	// to lock or get first cache
-	c.Cache.LockCallback("lock_"+key, func() {
-		var b []byte
-		if !exist {
-		FIRST:
-			if gettedFirstCacheKey {
-				exist, err = c.getFirstCache(key, destStructPtr)
-				if exist {
-					err = nil
-					return
-				}
-				if err != nil {
-					return
-				}
-			} else {
-				b, err = c.Cache.Get(key).Bytes()
-				if err == nil {
-					key = goutil.BytesToString(b)
-					gettedFirstCacheKey = true
-					goto FIRST
-				} else if !redis.IsRedisNil(err) {
-					return
-				}
-			}
-		}
-
-		// read db
-		err = c.DB.Get(destStructPtr, c.CreateGetQuery(fields...), cacheKey.FieldValues...)
-		if err != nil {
-			return
-		}
-		key, err = c.createPrikey(structElemValue)
-		if err != nil {
-			erpc.Errorf("CacheGet(): createPrikey: %s", err.Error())
-			err = nil
-			return
-		}
-
-		// write cache
-		data, _ := json.Marshal(destStructPtr)
-		err = c.Cache.Set(key, data, c.cacheExpiration).Err()
-		if err == nil && !cacheKey.isPriKey {
-			err = c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
-		}
-		if err != nil {
-			erpc.Errorf("CacheGet(): %s", err.Error())
-			err = nil
-		}
+	return c.readThrough(&cacheRead{
+		cacheKey: cacheKey,
+		dest:     destStructPtr,
+		elem:     structElemValue,
+		check: func() bool {
+			return cacheKey.isPriKey || c.checkSecondCache(structElemValue, fields, cacheKey.FieldValues)
+		},
+		query: func() error {
+			return c.DB.GetContext(cacheFillContext, destStructPtr, c.CreateGetQuery(fields...), cacheKey.FieldValues...)
+		},
 	})
-
-	return err
 }
 
 func (c *CacheableDB) createCacheKeyByWhere(structPtr Cacheable, whereNamedCond string) (CacheKey, string, error) {
@@ -401,11 +401,8 @@ func (c *CacheableDB) createCacheKeyByWhere(structPtr Cacheable, whereNamedCond
 }
 
 func (c *CacheableDB) createGetQueryByWhere(whereCond string) string {
-	var queryAll = "SELECT"
-	for _, col := range c.cols {
-		queryAll += " `" + col + "`,"
-	}
-	return queryAll[:len(queryAll)-1] + " FROM `" + c.tableName + "` WHERE " + whereCond + " LIMIT 1;"
+	var q = c.DB.Dialect()
+	return "SELECT " + dialect.QuoteAll(q, c.cols) + " FROM " + q.Quote(c.tableName) + " WHERE " + whereCond + " LIMIT 1;"
 }
 
 // CacheGetByWhere selects one row by the whereNamedCond.
@@ -426,90 +423,191 @@ func (c *CacheableDB) CacheGetByWhere(destStructPtr Cacheable, whereNamedCond st
 		return c.DB.Get(destStructPtr, c.createGetQueryByWhere(whereCond), cacheKey.FieldValues...)
 	}
 
-	var (
-		key                 = cacheKey.Key
-		gettedFirstCacheKey bool
-		b                   []byte
-		exist               bool
-	)
+	return c.readThrough(&cacheRead{
+		cacheKey: cacheKey,
+		dest:     destStructPtr,
+		elem:     structElemValue,
+		check: func() bool {
+			cacheKey2, _, _ := c.createCacheKeyByWhere(destStructPtr, whereNamedCond)
+			return cacheKey2.Key == cacheKey.Key
+		},
+		query: func() error {
+			return c.DB.GetContext(cacheFillContext, destStructPtr, c.createGetQueryByWhere(whereCond), cacheKey.FieldValues...)
+		},
+	})
+}
 
-	// read secondary cache
-	b, err = c.Cache.Get(key).Bytes()
-	if err == nil {
-		key = goutil.BytesToString(b)
-		gettedFirstCacheKey = true
-	} else if !redis.IsRedisNil(err) {
+// cacheRead a read through the cache
+type cacheRead struct {
+	cacheKey CacheKey
+	dest     Cacheable
+	elem     reflect.Value
+	// check returns whether the cached row matches the secondary key
+	check func() bool
+	// query reads the row from db into dest
+	query func() error
+	// firstKey the key of the first cache read, and ttl its PTTL then, if it should be refreshed early
+	firstKey string
+	ttl      time.Duration
+}
+
+// readThrough reads the row from the cache, or loads it from db and writes the cache.
+func (c *CacheableDB) readThrough(r *cacheRead) error {
+	exist, refresh, err := c.readCache(r)
+	if exist || err != nil {
 		return err
 	}
+	if refresh {
+		return c.refreshCache(r)
+	}
+	if !c.cacheOptions.Singleflight {
+		_, err = c.loadCache(r)
+		return err
+	}
+	var leader bool
+	data, err := c.loader.Do(r.cacheKey.Key, func() ([]byte, error) {
+		leader = true
+		return c.loadCache(r)
+	})
+	if leader || err != nil {
+		return err
+	}
+	// shared by the leader
+	c.cleanDestCacheable(r.elem)
+	return c.format.Unmarshal(data, r.dest)
+}
 
-	// get first cache
-	if gettedFirstCacheKey {
-		// clean
-		c.cleanDestCacheable(structElemValue)
-
-		exist, err = c.getFirstCache(key, destStructPtr)
+// readCache reads the row from the cache into dest.
+// NOTE:
+//  If the row is cached as non-existent, returns true and ErrNoRows;
+//  If the cache should be refreshed early, returns false and true.
+func (c *CacheableDB) readCache(r *cacheRead) (exist, refresh bool, err error) {
+	key := r.cacheKey.Key
+	// read secondary cache
+	if !r.cacheKey.isPriKey {
+		var b []byte
+		b, err = c.cacheGet(key)
 		if err != nil {
-			return err
-		}
-		if exist {
-			// check secondary cache
-			cacheKey2, _, _ := c.createCacheKeyByWhere(destStructPtr, whereNamedCond)
-			if cacheKey2.Key != cacheKey.Key {
-				c.Cache.Del(cacheKey.Key)
-			} else {
-				return nil
+			if redis.IsRedisNil(err) {
+				err = nil
 			}
+			return
+		}
+		if redis.IsNegativeCache(b) {
+			return true, false, ErrNoRows
 		}
+		key = goutil.BytesToString(b)
+	}
+	// get first cache
+	data, ttl, err := c.getFirstCache(key)
+	if err != nil {
+		if redis.IsRedisNil(err) {
+			err = nil
+		}
+		return
+	}
+	if redis.IsNegativeCache(data) {
+		if r.cacheKey.isPriKey {
+			return true, false, ErrNoRows
+		}
+		return
 	}
+	c.cleanDestCacheable(r.elem)
+	if err = c.format.Unmarshal(data, r.dest); err != nil {
+		if err != redis.ErrCacheVersion {
+			erpc.Errorf("CacheGet(): %s", err.Error())
+		}
+		return false, false, nil
+	}
+	// check secondary cache
+	if !r.check() {
+		c.Cache.Del(r.cacheKey.Key)
+		c.local.Invalidate(r.cacheKey.Key)
+		return false, false, nil
+	}
+	if refresh = c.cacheOptions.ShouldRefresh(ttl, c.loader.Delta()); refresh {
+		r.firstKey, r.ttl = key, ttl
+	}
+	return !refresh, refresh, nil
+}
 
-	// to lock or get first cache
-	c.Cache.LockCallback("lock_"+key, func() {
-	FIRST:
-		if gettedFirstCacheKey {
-			exist, err = c.getFirstCache(key, destStructPtr)
-			if exist {
-				err = nil
-				return
-			}
-			if err != nil {
-				return
-			}
-		} else {
-			b, err = c.Cache.Get(key).Bytes()
+// loadCache loads the row from db into dest with the distributed lock, writes the cache, and returns the encoded row.
+func (c *CacheableDB) loadCache(r *cacheRead) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	lockErr := c.Cache.LockCallback("lock_"+r.cacheKey.Key, func() {
+		// the cache may be written while waiting for the lock
+		var exist bool
+		if exist, _, err = c.readCache(r); exist || err != nil {
 			if err == nil {
-				key = goutil.BytesToString(b)
-				gettedFirstCacheKey = true
-				goto FIRST
-			} else if !redis.IsRedisNil(err) {
-				return
+				data, err = c.format.Marshal(r.dest)
 			}
-		}
-
-		// read db
-		err = c.DB.Get(destStructPtr, c.createGetQueryByWhere(whereCond), cacheKey.FieldValues...)
-		if err != nil {
-			return
-		}
-		key, err = c.createPrikey(structElemValue)
-		if err != nil {
-			erpc.Errorf("CacheGetByWhere(): createPrikey: %s", err.Error())
-			err = nil
 			return
 		}
+		data, err = c.loadDB(r)
+	})
+	if lockErr != nil {
+		return nil, lockErr
+	}
+	return data, err
+}
 
-		// write cache
-		data, _ := json.Marshal(destStructPtr)
-		err = c.Cache.Set(key, data, c.cacheExpiration).Err()
-		if err == nil && !cacheKey.isPriKey {
-			err = c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
+// refreshCache reloads the cached row in dest from db before the cache expires.
+// NOTE:
+//  Returns the cached row without waiting if another caller is refreshing it,
+//  or without querying if the cache has been refreshed by another caller.
+func (c *CacheableDB) refreshCache(r *cacheRead) error {
+	lock, err := c.Cache.TryObtain("lock_"+r.cacheKey.Key, nil)
+	if err != nil {
+		if err != redis.ErrLockNotObtained {
+			erpc.Errorf("CacheGet(): %s", err.Error())
 		}
-		if err != nil {
-			erpc.Errorf("CacheGetByWhere(): %s", err.Error())
-			err = nil
+		return nil
+	}
+	defer lock.Release()
+	if ttl, err := c.Cache.PTTL(r.firstKey).Result(); err == nil && ttl > r.ttl {
+		return nil
+	}
+	_, err = c.loadDB(r)
+	return err
+}
+
+func (c *CacheableDB) loadDB(r *cacheRead) ([]byte, error) {
+	// read db
+	start := time.Now()
+	err := r.query()
+	c.loader.Observe(time.Since(start))
+	if err != nil {
+		if IsNoRows(err) && c.cacheOptions.NegativeExpiration > 0 {
+			if err2 := c.Cache.Set(r.cacheKey.Key, redis.NegativeCacheValue, c.cacheOptions.NegativeExpiration).Err(); err2 != nil {
+				erpc.Errorf("CacheGet(): %s", err2.Error())
+			}
+			c.local.Delete(r.cacheKey.Key)
 		}
-	})
+		return nil, err
+	}
+	data, err := c.format.Marshal(r.dest)
+	if err != nil {
+		return nil, err
+	}
+	key, err := c.createPrikey(r.elem)
+	if err != nil {
+		erpc.Errorf("CacheGet(): createPrikey: %s", err.Error())
+		return data, nil
+	}
 
-	return err
+	// write cache
+	err = c.Cache.Set(key, data, c.cacheExpiration).Err()
+	if err == nil && !r.cacheKey.isPriKey {
+		err = c.Cache.Set(r.cacheKey.Key, key, c.cacheExpiration).Err()
+	}
+	if err != nil {
+		erpc.Errorf("CacheGet(): %s", err.Error())
+	}
+	c.local.Delete(key, r.cacheKey.Key)
+	return data, nil
 }
 
 func (c *CacheableDB) cleanDestCacheable(destStructElemValue reflect.Value) {
@@ -538,20 +636,26 @@ func (c *CacheableDB) checkSecondCache(destStructElemValue reflect.Value, fields
 	return true
 }
 
-// get first cache
-func (c *CacheableDB) getFirstCache(key string, destStructPtr Cacheable) (bool, error) {
-	data, err := c.Cache.Get(key).Bytes()
-	if err == nil {
-		err = json.Unmarshal(data, destStructPtr)
-		if err == nil {
-			return true, nil
-		}
-		erpc.Errorf("CacheGet(): %s", err.Error())
-
-	} else if !redis.IsRedisNil(err) {
-		return false, err
+// getFirstCache gets the first cache, and its PTTL if it may be refreshed early.
+func (c *CacheableDB) getFirstCache(key string) ([]byte, time.Duration, error) {
+	if c.cacheOptions.EarlyRefreshBeta <= 0 {
+		data, err := c.cacheGet(key)
+		return data, 0, err
 	}
-	return false, nil
+	var pttl *redis.DurationCmd
+	data, err := c.local.Fetch(key, func() ([]byte, error) {
+		var get *redis.StringCmd
+		c.Cache.Pipelined(func(pipe redis.Pipeliner) error {
+			get = pipe.Get(key)
+			pttl = pipe.PTTL(key)
+			return nil
+		})
+		return get.Bytes()
+	})
+	if err != nil || pttl == nil {
+		return data, 0, err
+	}
+	return data, pttl.Val(), nil
 }
 
 // PutCache caches one row by primary key.
@@ -566,7 +670,7 @@ func (c *CacheableDB) PutCache(srcStructPtr Cacheable, fields ...string) error {
 	if err != nil {
 		return err
 	}
-	data, err := json.Marshal(srcStructPtr)
+	data, err := c.format.Marshal(srcStructPtr)
 	if err != nil {
 		return err
 	}
@@ -574,7 +678,9 @@ func (c *CacheableDB) PutCache(srcStructPtr Cacheable, fields ...string) error {
 	key := cacheKey.Key
 
 	if cacheKey.isPriKey {
-		return c.Cache.Set(key, data, c.cacheExpiration).Err()
+		err = c.Cache.Set(key, data, c.cacheExpiration).Err()
+		c.local.Invalidate(key)
+		return err
 	}
 
 	// secondary cache
@@ -583,10 +689,11 @@ func (c *CacheableDB) PutCache(srcStructPtr Cacheable, fields ...string) error {
 		return err
 	}
 	err = c.Cache.Set(key, data, c.cacheExpiration).Err()
-	if err != nil {
-		return err
+	if err == nil {
+		err = c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
 	}
-	return c.Cache.Set(cacheKey.Key, key, c.cacheExpiration).Err()
+	c.local.Invalidate(key, cacheKey.Key)
+	return err
 }
 
 // DeleteCache deletes one row form cache by primary key.
@@ -610,7 +717,9 @@ func (c *CacheableDB) DeleteCache(srcStructPtr Cacheable, fields ...string) erro
 			keys = append(keys, firstKey)
 		}
 	}
-	return c.Cache.Del(keys...).Err()
+	err = c.Cache.Del(keys...).Err()
+	c.local.Invalidate(keys...)
+	return err
 }
 
 // Callback non-transactional operations.
@@ -707,3 +816,367 @@ var ErrNoRows = sql.ErrNoRows
 func IsNoRows(err error) bool {
 	return ErrNoRows == err
 }
+
+// EnableLocalCache enables the bounded in-process cache in front of redis,
+// which is invalidated across the instances when PutCache and DeleteCache are called.
+// Note:
+//  If the DB is not initialized, it is enabled after initialization;
+//  The rows changed without PutCache or DeleteCache may be stale until the entries expire.
+func (c *CacheableDB) EnableLocalCache(cfg redis.LocalCacheConfig) error {
+	if c.DB == nil || c.DB.dbConfig == nil {
+		c.localConfig = &cfg
+		return nil
+	}
+	if c.DB.dbConfig.NoCache {
+		return nil
+	}
+	local, err := redis.NewLocalCache(c.Cache, c.module.Key("local_cache_invalidation"), cfg)
+	if err != nil {
+		return err
+	}
+	if c.local != nil {
+		c.local.Close()
+	}
+	c.local = local
+	return nil
+}
+
+// SetCacheOptions sets the options of reading through the cache.
+// Note:
+//  With NegativeExpiration, the row inserted later is invisible until the negative cache expires,
+//  unless PutCache or DeleteCache is called after inserting.
+func (c *CacheableDB) SetCacheOptions(opts redis.CacheOptions) {
+	c.cacheOptions = opts
+}
+
+// SetCacheCodec sets the codec and the version of the cached rows,
+// which override the cache_codec and cache_version of the config.
+// Note:
+//  If the DB is not initialized, it is set after initialization;
+//  Changing them treats the rows cached before as misses.
+func (c *CacheableDB) SetCacheCodec(codecName, version string) error {
+	if c.DB == nil || c.DB.dbConfig == nil {
+		c.codecConfig = &codecConfig{name: codecName, version: version}
+		return nil
+	}
+	format, err := redis.NewCacheFormat(codecName, version, reflect.New(c.ormType).Interface())
+	if err != nil {
+		return err
+	}
+	c.format = format
+	return nil
+}
+
+// cacheGet gets the cache from the local cache or redis.
+func (c *CacheableDB) cacheGet(key string) ([]byte, error) {
+	return c.local.Fetch(key, func() ([]byte, error) {
+		return c.Cache.Get(key).Bytes()
+	})
+}
+
+// CacheMultiGet selects the rows by primary key or the fields in batch.
+// Priority from the read cache.
+// NOTE:
+//  destStructPtrs must be a []*struct type, whose key fields are set;
+//  If fields is empty, auto-use primary fields;
+//  The misses of cache are selected by one query, then written to the cache by one pipeline;
+//  The rows cached as non-existent by NegativeExpiration are not selected again;
+//  Returns whether the rows exist in the order of destStructPtrs.
+func (c *CacheableDB) CacheMultiGet(destStructPtrs interface{}, fields ...string) ([]bool, error) {
+	dests := reflect.ValueOf(destStructPtrs)
+	if dests.Kind() != reflect.Slice || dests.Type().Elem().String() != c.typeName {
+		return nil, fmt.Errorf("CacheMultiGet(): unmatch destStructPtrs: want []%s, have %T", c.typeName, destStructPtrs)
+	}
+	var (
+		n         = dests.Len()
+		exists    = make([]bool, n)
+		cacheKeys = make([]CacheKey, n)
+		elems     = make([]reflect.Value, n)
+		err       error
+	)
+	if n == 0 {
+		return exists, nil
+	}
+	for i := 0; i < n; i++ {
+		cacheKeys[i], elems[i], err = c.CreateCacheKey(dests.Index(i).Interface().(Cacheable), fields...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var whereFields = fields
+	if len(whereFields) == 0 {
+		whereFields = c.priCols
+	}
+
+	var misses []int
+	if c.DB.dbConfig.NoCache {
+		for i := range cacheKeys {
+			misses = append(misses, i)
+		}
+	} else {
+		misses, err = c.multiGetCache(cacheKeys, elems, whereFields, exists)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(misses) == 0 {
+		return exists, nil
+	}
+
+	// read db
+	var (
+		missIndexes = make(map[string][]int, len(misses))
+		args        = make([]interface{}, 0, len(misses)*len(whereFields))
+	)
+	for _, i := range misses {
+		key := cacheKeys[i].Key
+		if _, ok := missIndexes[key]; !ok {
+			args = append(args, cacheKeys[i].FieldValues...)
+		}
+		missIndexes[key] = append(missIndexes[key], i)
+	}
+	rows := reflect.New(reflect.SliceOf(dests.Type().Elem()))
+	if err = c.DB.SelectContext(cacheFillContext, rows.Interface(), c.createMultiGetQuery(whereFields, len(missIndexes)), args...); err != nil {
+		return nil, err
+	}
+	type backfill struct {
+		key, priKey string
+		data        []byte
+	}
+	var backfills []backfill
+	rows = rows.Elem()
+	for j := 0; j < rows.Len(); j++ {
+		row := rows.Index(j)
+		rowKey, _, err := c.CreateCacheKey(row.Interface().(Cacheable), fields...)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range missIndexes[rowKey.Key] {
+			elems[i].Set(row.Elem())
+			exists[i] = true
+		}
+		if c.DB.dbConfig.NoCache {
+			continue
+		}
+		priKey, err := c.createPrikey(row.Elem())
+		if err != nil {
+			return nil, err
+		}
+		data, err := c.format.Marshal(row.Interface())
+		if err != nil {
+			return nil, err
+		}
+		backfills = append(backfills, backfill{key: rowKey.Key, priKey: priKey, data: data})
+	}
+
+	var notFound []string
+	if !c.DB.dbConfig.NoCache && c.cacheOptions.NegativeExpiration > 0 {
+		for key, indexes := range missIndexes {
+			if !exists[indexes[0]] {
+				notFound = append(notFound, key)
+			}
+		}
+	}
+
+	// write cache
+	if len(backfills) > 0 || len(notFound) > 0 {
+		_, err = c.Cache.Pipelined(func(pipe redis.Pipeliner) error {
+			for _, b := range backfills {
+				pipe.Set(b.priKey, b.data, c.cacheExpiration)
+				if b.key != b.priKey {
+					pipe.Set(b.key, b.priKey, c.cacheExpiration)
+				}
+			}
+			for _, key := range notFound {
+				pipe.Set(key, redis.NegativeCacheValue, c.cacheOptions.NegativeExpiration)
+			}
+			return nil
+		})
+		c.local.Delete(notFound...)
+		if err != nil {
+			erpc.Errorf("CacheMultiGet(): %s", err.Error())
+		}
+	}
+	return exists, nil
+}
+
+// multiGetCache reads the cache into the elements, and returns the indexes of the misses.
+func (c *CacheableDB) multiGetCache(cacheKeys []CacheKey, elems []reflect.Value, fields []string, exists []bool) ([]int, error) {
+	var (
+		priKeys = make([]string, len(cacheKeys))
+		misses  []int
+		second  []int
+	)
+	for i, cacheKey := range cacheKeys {
+		if cacheKey.isPriKey {
+			priKeys[i] = cacheKey.Key
+		} else {
+			second = append(second, i)
+		}
+	}
+
+	// read secondary cache
+	if len(second) > 0 {
+		keys := make([]string, len(second))
+		for j, i := range second {
+			keys[j] = cacheKeys[i].Key
+		}
+		values, err := c.multiCacheGet(keys)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range second {
+			if values[j] == nil {
+				misses = append(misses, i)
+			} else if redis.IsNegativeCache(values[j]) {
+				// cached as non-existent
+				continue
+			} else {
+				priKeys[i] = goutil.BytesToString(values[j])
+			}
+		}
+	}
+
+	// get first cache
+	var (
+		keys    = make([]string, 0, len(cacheKeys))
+		indexes = make([]int, 0, len(cacheKeys))
+	)
+	for i, priKey := range priKeys {
+		if priKey != "" {
+			keys = append(keys, priKey)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(keys) == 0 {
+		return misses, nil
+	}
+	values, err := c.multiCacheGet(keys)
+	if err != nil {
+		return nil, err
+	}
+	var staleKeys []string
+	for j, i := range indexes {
+		if values[j] == nil {
+			misses = append(misses, i)
+			continue
+		}
+		if redis.IsNegativeCache(values[j]) {
+			if !cacheKeys[i].isPriKey {
+				misses = append(misses, i)
+			}
+			continue
+		}
+		c.cleanDestCacheable(elems[i])
+		dest := elems[i].Addr().Interface()
+		if err = c.format.Unmarshal(values[j], dest); err != nil {
+			if err != redis.ErrCacheVersion {
+				erpc.Errorf("CacheMultiGet(): %s", err.Error())
+			}
+			misses = append(misses, i)
+			continue
+		}
+		// check secondary cache
+		if !cacheKeys[i].isPriKey && !c.checkSecondCache(elems[i], fields, cacheKeys[i].FieldValues) {
+			staleKeys = append(staleKeys, cacheKeys[i].Key)
+			misses = append(misses, i)
+			continue
+		}
+		exists[i] = true
+	}
+	if len(staleKeys) > 0 {
+		c.Cache.Del(staleKeys...)
+		c.local.Invalidate(staleKeys...)
+	}
+	sort.Ints(misses)
+	return misses, nil
+}
+
+// multiCacheGet gets the caches from the local cache or redis, the value of the miss is nil.
+// NOTE:
+//  For redis cluster, the keys are got by a pipeline instead of MGET, since they may be in different slots.
+func (c *CacheableDB) multiCacheGet(keys []string) ([][]byte, error) {
+	var (
+		values  = make([][]byte, len(keys))
+		remote  = make([]string, 0, len(keys))
+		indexes = make([]int, 0, len(keys))
+		version uint64
+	)
+	if c.local != nil {
+		version = c.local.Version()
+	}
+	for i, key := range keys {
+		if c.local != nil {
+			if value, ok := c.local.Get(key); ok {
+				values[i] = value
+				continue
+			}
+		}
+		remote = append(remote, key)
+		indexes = append(indexes, i)
+	}
+	if len(remote) == 0 {
+		return values, nil
+	}
+	var results []interface{}
+	if c.Cache.IsCluster() {
+		cmds, err := c.Cache.Pipelined(func(pipe redis.Pipeliner) error {
+			for _, key := range remote {
+				pipe.Get(key)
+			}
+			return nil
+		})
+		if err != nil && !redis.IsRedisNil(err) {
+			return nil, err
+		}
+		results = make([]interface{}, len(cmds))
+		for j, cmd := range cmds {
+			if s, err := cmd.(*redis.StringCmd).Result(); err == nil {
+				results[j] = s
+			}
+		}
+	} else {
+		var err error
+		results, err = c.Cache.MGet(remote...).Result()
+		if err != nil {
+			return nil, err
+		}
+	}
+	for j, result := range results {
+		s, ok := result.(string)
+		if !ok {
+			continue
+		}
+		i := indexes[j]
+		values[i] = []byte(s)
+		if c.local != nil {
+			c.local.Set(keys[i], values[i], version)
+		}
+	}
+	return values, nil
+}
+
+// createMultiGetQuery creates query string of selecting the rows by the fields' values.
+func (c *CacheableDB) createMultiGetQuery(whereFields []string, n int) string {
+	var q = c.DB.Dialect()
+	var queryAll = "SELECT " + dialect.QuoteAll(q, c.cols) + " FROM " + q.Quote(c.tableName) + " WHERE "
+	if len(whereFields) == 1 {
+		queryAll += q.Quote(whereFields[0]) + " IN ("
+	} else {
+		queryAll += "(" + dialect.QuoteAll(q, whereFields) + ") IN ("
+	}
+	var i int
+	for row := 0; row < n; row++ {
+		if len(whereFields) > 1 {
+			queryAll += "("
+		}
+		for range whereFields {
+			i++
+			queryAll += q.Placeholder(i) + ","
+		}
+		if len(whereFields) > 1 {
+			queryAll = queryAll[:len(queryAll)-1] + "),"
+		}
+	}
+	return queryAll[:len(queryAll)-1] + ");"
+}
@@ -1,11 +1,13 @@
 package mysql_test
 
 import (
-	"encoding/json"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/henrylee2cn/goutil"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/xiaoenai/tp-micro/v6/model/mysql"
 	"github.com/xiaoenai/tp-micro/v6/model/redis"
 	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
@@ -41,24 +43,38 @@ func TestNamed(t *testing.T) {
 	// values:[123 ctn]
 }
 
-func TestCacheDb(t *testing.T) {
-	dbConf, err := mysql.ReadConfig("test_db")
-	if err != nil {
-		t.Fatal(err)
-	}
-	dbConf.Database = "test"
-	redisConf, err := redis.ReadConfig("test_redis")
+// newTestDB connects an in-memory SQLite database with a miniredis cache, and creates the dbtest table.
+func newTestDB(t *testing.T) (*mysql.DB, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
 	if err != nil {
 		t.Fatal(err)
 	}
+	redisConf := redis.NewConfig()
+	redisConf.ForSingle.Addr = mr.Addr()
+	dbConf := mysql.NewConfig()
+	dbConf.Dialect = "sqlite"
+	dbConf.Database = ":memory:"
+	// NOTE: every connection has its own in-memory database
+	dbConf.MaxOpenConns = 1
+	dbConf.MaxIdleConns = 1
 	db, err := mysql.Connect(dbConf, redisConf)
 	if err != nil {
+		mr.Close()
 		t.Fatal(err)
 	}
-	_, err = db.Exec("CREATE TABLE IF NOT EXISTS `dbtest` (`test_id` INT(10) AUTO_INCREMENT, `test_content` VARCHAR(20), `test_deleted` TINYINT(2),  PRIMARY KEY(`test_id`)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT='测试表'")
+	_, err = db.Exec(`CREATE TABLE "dbtest" ("test_id" INTEGER PRIMARY KEY, "test_content" VARCHAR(20), "test_deleted" TINYINT(2));`)
 	if err != nil {
+		db.Close()
+		mr.Close()
 		t.Fatal(err)
 	}
+	return db, mr
+}
+
+func TestCacheDb(t *testing.T) {
+	db, mr := newTestDB(t)
+	defer db.Close()
+	defer mr.Close()
 	c, err := db.RegCacheableDB(new(testTable), time.Second)
 	if err != nil {
 		t.Fatal(err)
@@ -68,7 +84,7 @@ func TestCacheDb(t *testing.T) {
 		TestContent: "abc",
 		Deleted:     false,
 	}
-	_, err = c.NamedExec("INSERT INTO dbtest (test_id,test_content,test_deleted)VALUES(:test_id,:test_content,:test_deleted) ON DUPLICATE KEY UPDATE test_id=:test_id", obj)
+	_, err = c.NamedExec("INSERT INTO dbtest (test_id,test_content,test_deleted)VALUES(:test_id,:test_content,:test_deleted)"+db.Dialect().Upsert([]string{"test_id"}, []string{"test_content"}), obj)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -92,19 +108,23 @@ func TestCacheDb(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	format, err := redis.NewCacheFormat(redis.CodecJSON, "", new(testTable))
+	if err != nil {
+		t.Fatal(err)
+	}
 	var v1 = new(testTable)
-	err = json.Unmarshal(b, v1)
+	err = format.Unmarshal(b, v1)
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Logf("cache of before expiring: %+v", v1)
 
-	time.Sleep(2 * time.Second)
+	mr.FastForward(2 * time.Second)
 
 	b, err = c.Cache.Get(key).Bytes()
 	if err == nil {
 		var v2 = new(testTable)
-		err = json.Unmarshal(b, v2)
+		err = format.Unmarshal(b, v2)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -112,3 +132,140 @@ func TestCacheDb(t *testing.T) {
 	}
 	t.Logf("expired cache error: %v", err)
 }
+
+func TestCacheMultiGet(t *testing.T) {
+	db, mr := newTestDB(t)
+	defer db.Close()
+	defer mr.Close()
+	c, err := db.RegCacheableDB(new(testTable), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, obj := range []*testTable{{TestId: 1, TestContent: "abc"}, {TestId: 2, TestContent: "def"}} {
+		_, err = c.NamedExec("INSERT INTO dbtest (test_id,test_content,test_deleted)VALUES(:test_id,:test_content,:test_deleted)"+db.Dialect().Upsert([]string{"test_id"}, []string{"test_content"}), obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.DeleteCache(&testTable{TestId: 2})
+	// 1 is cached, 2 is selected from db, and -1 does not exist
+	if err = c.CacheGet(&testTable{TestId: 1}); err != nil {
+		t.Fatal(err)
+	}
+	dests := []*testTable{{TestId: 2}, {TestId: -1}, {TestId: 1}}
+	exists, err := c.CacheMultiGet(dests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists[0] || exists[1] || !exists[2] {
+		t.Fatalf("exists: %v", exists)
+	}
+	if dests[0].TestContent != "def" || dests[2].TestContent != "abc" {
+		t.Fatalf("dests: %+v, %+v", dests[0], dests[2])
+	}
+	// 2 is cached
+	cacheKey, _, _ := c.CreateCacheKey(&testTable{TestId: 2})
+	if err = c.Cache.Get(cacheKey.Key).Err(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCacheOptions(t *testing.T) {
+	db, mr := newTestDB(t)
+	defer db.Close()
+	defer mr.Close()
+	c, err := db.RegCacheableDB(new(testTable), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetCacheOptions(redis.CacheOptions{
+		NegativeExpiration: time.Second,
+		Singleflight:       true,
+		EarlyRefreshBeta:   1,
+	})
+	_, err = c.Exec("DELETE FROM dbtest WHERE test_id=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.DeleteCache(&testTable{TestId: 3})
+
+	// the non-existent row is cached
+	if err = c.CacheGet(&testTable{TestId: 3}); !mysql.IsNoRows(err) {
+		t.Fatalf("CacheGet: expect ErrNoRows, got %v", err)
+	}
+	cacheKey, _, _ := c.CreateCacheKey(&testTable{TestId: 3})
+	if v := c.Cache.Get(cacheKey.Key).Val(); v != redis.NegativeCacheValue {
+		t.Fatalf("negative cache: expect %q, got %q", redis.NegativeCacheValue, v)
+	}
+	// invisible until the cache is deleted
+	obj := &testTable{TestId: 3, TestContent: "ghi"}
+	_, err = c.NamedExec("INSERT INTO dbtest (test_id,test_content,test_deleted)VALUES(:test_id,:test_content,:test_deleted)", obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CacheGet(&testTable{TestId: 3}); !mysql.IsNoRows(err) {
+		t.Fatalf("CacheGet: expect ErrNoRows, got %v", err)
+	}
+	c.DeleteCache(obj)
+
+	// the concurrent loads share the result
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dest := &testTable{TestId: 3}
+			if err := c.CacheGet(dest); err != nil {
+				t.Error(err)
+			} else if dest.TestContent != "ghi" {
+				t.Errorf("CacheGet: expect ghi, got %q", dest.TestContent)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCacheEarlyRefresh(t *testing.T) {
+	db, mr := newTestDB(t)
+	defer db.Close()
+	defer mr.Close()
+	c, err := db.RegCacheableDB(new(testTable), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Exec(`INSERT INTO dbtest (test_id,test_content,test_deleted) VALUES (4,'old',0);`); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.CacheGet(&testTable{TestId: 4}); err != nil {
+		t.Fatal(err)
+	}
+	// always refresh early
+	c.SetCacheOptions(redis.CacheOptions{EarlyRefreshBeta: 1e15})
+	if _, err = c.Exec(`UPDATE dbtest SET test_content='new' WHERE test_id=4;`); err != nil {
+		t.Fatal(err)
+	}
+
+	// another caller is refreshing the key, the cached row is returned without waiting
+	cacheKey, _, _ := c.CreateCacheKey(&testTable{TestId: 4})
+	lock, err := c.Cache.TryObtain("lock_"+cacheKey.Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	dest := &testTable{TestId: 4}
+	if err = c.CacheGet(dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest.TestContent != "old" || time.Since(start) > time.Second {
+		t.Fatalf("CacheGet: expect the cached row without waiting, got %q in %s", dest.TestContent, time.Since(start))
+	}
+	lock.Release()
+
+	// the lock is obtained, the row is reloaded
+	if err = c.CacheGet(dest); err != nil {
+		t.Fatal(err)
+	}
+	if dest.TestContent != "new" {
+		t.Fatalf("CacheGet: expect the refreshed row, got %q", dest.TestContent)
+	}
+}
@@ -0,0 +1,79 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/xiaoenai/tp-micro/v6/model/migrate"
+)
+
+// Migrator returns the migrator of the migration files in the directory.
+func (d *DB) Migrator(dir string) (*migrate.Migrator, error) {
+	return migrate.New(d.DB, dir)
+}
+
+// Migrate applies the pending migrations in the directory.
+// NOTE:
+//  Only one instance migrates at a time, the others wait for it.
+func (d *DB) Migrate(dir string) error {
+	m, err := d.Migrator(dir)
+	if err != nil {
+		return err
+	}
+	done, err := m.Up(0)
+	for _, mig := range done {
+		erpc.Infof("mysql: applied migration %s", mig.FileName("up"))
+	}
+	return err
+}
+
+// migrateAtConnecting applies the pending migrations of the config if AutoMigrate is true, otherwise warns them.
+func (d *DB) migrateAtConnecting(cfg *Config) error {
+	if len(cfg.Migrations) == 0 {
+		return nil
+	}
+	if cfg.AutoMigrate {
+		return d.Migrate(cfg.Migrations)
+	}
+	m, err := d.Migrator(cfg.Migrations)
+	if err != nil {
+		return err
+	}
+	status, err := m.Status()
+	if err != nil {
+		erpc.Warnf("mysql: check the migrations of %s failed: %s", cfg.Migrations, err.Error())
+		return nil
+	}
+	for _, s := range status {
+		if !s.Applied {
+			erpc.Warnf("mysql: migration %s is pending, apply it by 'micro migrate up'", s.FileName("up"))
+		}
+	}
+	return nil
+}
+
+// pendingMigrations returns the hint of the pending migrations of the config, used in the errors of the missing tables.
+func (d *DB) pendingMigrations() string {
+	if len(d.dbConfig.Migrations) == 0 {
+		return ", it should be created by the migrations, see 'micro migrate'"
+	}
+	m, err := d.Migrator(d.dbConfig.Migrations)
+	if err != nil {
+		return ""
+	}
+	status, err := m.Status()
+	if err != nil {
+		return ""
+	}
+	var pending []string
+	for _, s := range status {
+		if !s.Applied {
+			pending = append(pending, s.FileName("up"))
+		}
+	}
+	if len(pending) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", the migrations are pending: %s, apply them by 'micro migrate up' or auto_migrate", strings.Join(pending, ", "))
+}
@@ -0,0 +1,64 @@
+package mysql_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xiaoenai/tp-micro/v6/model/migrate"
+	"github.com/xiaoenai/tp-micro/v6/model/mysql"
+)
+
+type migrateUser struct {
+	Id int64 `db:"id"`
+}
+
+func (*migrateUser) TableName() string {
+	return "user"
+}
+
+func TestMigrateAtConnecting(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err = migrate.Create(dir, "create user", `CREATE TABLE "user" ("id" INTEGER PRIMARY KEY);`, `DROP TABLE "user";`); err != nil {
+		t.Fatal(err)
+	}
+	dbConf := mysql.NewConfig()
+	dbConf.Dialect = "sqlite"
+	dbConf.Database = ":memory:"
+	dbConf.MaxOpenConns = 1
+	dbConf.MaxIdleConns = 1
+	dbConf.NoCache = true
+	dbConf.Migrations = dir
+
+	// only warn the pending migrations by default
+	db, err := mysql.Connect(dbConf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.Exec(`SELECT 1 FROM "user";`); err == nil {
+		t.Fatal("the pending migration is applied without auto_migrate")
+	}
+	if _, err = db.Exec(`SELECT 1 FROM "` + migrate.Table + `";`); err == nil {
+		t.Fatal("the migration table is created without auto_migrate")
+	}
+	// the error of the missing table mentions the pending migrations
+	if _, err = db.RegCacheableDB(new(migrateUser), time.Minute); err == nil || !strings.Contains(err.Error(), "create_user.up.sql") {
+		t.Fatalf("expect the pending migration in the error, got %v", err)
+	}
+	db.Close()
+
+	dbConf.AutoMigrate = true
+	if db, err = mysql.Connect(dbConf, nil); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err = db.Exec(`SELECT 1 FROM "user";`); err != nil {
+		t.Fatalf("the pending migration is not applied with auto_migrate: %v", err)
+	}
+}
@@ -2,9 +2,11 @@ package mysql
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/henrylee2cn/goutil"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
 	"github.com/xiaoenai/tp-micro/v6/model/redis"
 	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
 	"github.com/xiaoenai/tp-micro/v6/model/sqlx/reflectx"
@@ -13,6 +15,7 @@ import (
 // PreDB preset *DB
 type PreDB struct {
 	*DB
+	shards   []*DB
 	preFuncs map[string]func() error
 	inited   bool
 }
@@ -41,20 +44,36 @@ func (p *PreDB) Init(dbConfig *Config, redisConfig *redis.Config) (err error) {
 
 // Init2 initialize *DB.
 func (p *PreDB) Init2(dbConfig *Config, redisClient *redis.Client) (err error) {
-	p.DB.DB, err = sqlx.Connect("mysql", dbConfig.Source())
+	p.DB.dialect, err = dialect.Get(dbConfig.Dialect)
 	if err != nil {
 		return err
 	}
-	p.DB.SetMaxOpenConns(dbConfig.MaxOpenConns)
-	p.DB.SetMaxIdleConns(dbConfig.MaxIdleConns)
-	p.DB.SetConnMaxLifetime(time.Duration(dbConfig.ConnMaxLifetime) * time.Second)
+	p.DB.DB, err = sqlx.Connect(p.DB.dialect.DriverName(), dbConfig.Source())
+	if err != nil {
+		return err
+	}
+	dbConfig.setPool(p.DB.DB)
 	// p.DB.MapperFunc(goutil.SnakeString)
 	p.DB.Mapper = reflectx.NewMapperFunc("json", goutil.SnakeString)
+	p.DB.replicas, err = newReplicaSet(dbConfig)
+	if err != nil {
+		return err
+	}
 	p.DB.dbConfig = dbConfig
 	if !dbConfig.NoCache && redisClient != nil {
 		p.DB.Cache = redisClient
 		p.DB.redisConfig = redisClient.Config()
 	}
+	if err = p.DB.migrateAtConnecting(dbConfig); err != nil {
+		return err
+	}
+	for _, addr := range dbConfig.ShardAddrs {
+		shard, err := p.DB.connectShard(addr)
+		if err != nil {
+			return err
+		}
+		p.shards = append(p.shards, shard)
+	}
 
 	for _, preFunc := range p.preFuncs {
 		if err = preFunc(); err != nil {
@@ -66,6 +85,8 @@ func (p *PreDB) Init2(dbConfig *Config, redisClient *redis.Client) (err error) {
 }
 
 // RegCacheableDB registers a cacheable table.
+// NOTE:
+//  initQuery is executed before registering, prefer the migrations of Config.Migrations to evolve the schema.
 func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Duration, initQuery string, args ...interface{}) (*CacheableDB, error) {
 	if p.inited {
 		if len(initQuery) > 0 {
@@ -90,7 +111,14 @@ func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Dura
 			}
 		}
 		_cacheableDB, err := p.DB.RegCacheableDB(ormStructPtr, cacheExpiration)
+		if err == nil && cacheableDB.localConfig != nil {
+			err = _cacheableDB.EnableLocalCache(*cacheableDB.localConfig)
+		}
+		if err == nil && cacheableDB.codecConfig != nil {
+			err = _cacheableDB.SetCacheCodec(cacheableDB.codecConfig.name, cacheableDB.codecConfig.version)
+		}
 		if err == nil {
+			_cacheableDB.cacheOptions = cacheableDB.cacheOptions
 			*cacheableDB = *_cacheableDB
 			p.DB.cacheableDBs[tableName] = cacheableDB
 		}
@@ -99,3 +127,54 @@ func (p *PreDB) RegCacheableDB(ormStructPtr Cacheable, cacheExpiration time.Dura
 	p.preFuncs[tableName] = preFunc
 	return cacheableDB, nil
 }
+
+// ShardDBs returns the DBs over which the sharded tables are spread,
+// i.e. this DB followed by the DBs of Config.ShardAddrs.
+func (p *PreDB) ShardDBs() []*DB {
+	return append([]*DB{p.DB}, p.shards...)
+}
+
+// Close closes the DBs of Config.ShardAddrs, and this DB.
+func (p *PreDB) Close() error {
+	for _, shard := range p.shards {
+		shard.Close()
+	}
+	return p.DB.Close()
+}
+
+// RegShardedDB registers a sharded table, whose physical tables are spread evenly over ShardDBs in order.
+// NOTE:
+//  initQuery is executed for every physical table in its DB, with the ShardTable placeholder replaced by the table name.
+func (p *PreDB) RegShardedDB(ormStructPtr Cacheable, cacheExpiration time.Duration, cfg ShardConfig, initQuery string, args ...interface{}) (*ShardedDB, error) {
+	tableName := ormStructPtr.TableName()
+	var regFunc = func() (*ShardedDB, error) {
+		dbs := p.ShardDBs()
+		if len(initQuery) > 0 {
+			for i := 0; i < cfg.Tables; i++ {
+				d := dbs[cfg.dbIndex(i, len(dbs))]
+				query := strings.Replace(initQuery, ShardTable, d.Dialect().Quote(cfg.ShardTableName(tableName, i)), -1)
+				if _, err := d.Exec(query, args...); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return RegShardedDB(dbs, ormStructPtr, cacheExpiration, cfg)
+	}
+	if p.inited {
+		return regFunc()
+	}
+
+	if _, ok := p.preFuncs[tableName]; ok {
+		return nil, fmt.Errorf("re-register sharded table: %s", tableName)
+	}
+	var shardedDB = new(ShardedDB)
+	var preFunc = func() error {
+		_shardedDB, err := regFunc()
+		if err == nil {
+			*shardedDB = *_shardedDB
+		}
+		return err
+	}
+	p.preFuncs[tableName] = preFunc
+	return shardedDB, nil
+}
@@ -0,0 +1,219 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/goutil/errors"
+	"github.com/xiaoenai/tp-micro/v6/model/dialect"
+	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
+)
+
+// replicaCheckInterval the interval of checking the health and the lag of the replicas
+const replicaCheckInterval = 5 * time.Second
+
+type readPrimaryKey struct{}
+
+// WithReadPrimary returns a context that pins the reads to the primary, so the writes before are visible.
+func WithReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+// cacheFillContext the context of the reads that fill the cache, which are pinned to the primary,
+// otherwise a lagging replica would cache the stale row until it expires.
+var cacheFillContext = WithReadPrimary(context.Background())
+
+// IsReadPrimary returns whether the reads of the context are pinned to the primary.
+func IsReadPrimary(ctx context.Context) bool {
+	pinned, _ := ctx.Value(readPrimaryKey{}).(bool)
+	return pinned
+}
+
+// Get reads one row, from a healthy replica if configured.
+// Note:
+//  Falls back to the primary if no replica is healthy or the replica is broken.
+func (d *DB) Get(dest interface{}, query string, args ...interface{}) error {
+	return d.GetContext(context.Background(), dest, query, args...)
+}
+
+// GetContext reads one row, from a healthy replica if configured, unless the context is pinned to the primary.
+// NOTE:
+//  The '?' bind variables of the query are rebound for the dialect.
+func (d *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	query = d.DB.Rebind(query)
+	return d.read(ctx, func(db *sqlx.DB) error {
+		return db.GetContext(ctx, dest, query, args...)
+	})
+}
+
+// Select reads the rows, from a healthy replica if configured.
+// Note:
+//  Falls back to the primary if no replica is healthy or the replica is broken.
+func (d *DB) Select(dest interface{}, query string, args ...interface{}) error {
+	return d.SelectContext(context.Background(), dest, query, args...)
+}
+
+// SelectContext reads the rows, from a healthy replica if configured, unless the context is pinned to the primary.
+// NOTE:
+//  The '?' bind variables of the query are rebound for the dialect.
+func (d *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	query = d.DB.Rebind(query)
+	return d.read(ctx, func(db *sqlx.DB) error {
+		return db.SelectContext(ctx, dest, query, args...)
+	})
+}
+
+// Reader returns a healthy replica, or the primary if none or the context is pinned to the primary.
+func (d *DB) Reader(ctx context.Context) *sqlx.DB {
+	if d.replicas == nil || IsReadPrimary(ctx) {
+		return d.DB
+	}
+	if db := d.replicas.pick(); db != nil {
+		return db
+	}
+	return d.DB
+}
+
+// Close closes the primary and the replicas.
+func (d *DB) Close() error {
+	if d.replicas != nil {
+		d.replicas.close()
+	}
+	return d.DB.Close()
+}
+
+func (d *DB) read(ctx context.Context, fn func(*sqlx.DB) error) error {
+	db := d.Reader(ctx)
+	err := fn(db)
+	if err != nil && db != d.DB && isBrokenConn(err) {
+		erpc.Warnf("mysql: read from replica failed, fall back to primary: %s", err.Error())
+		err = fn(d.DB)
+	}
+	return err
+}
+
+func isBrokenConn(err error) bool {
+	if err == driver.ErrBadConn || err == sql.ErrConnDone {
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// replicaSet the read replicas, which are checked periodically.
+type replicaSet struct {
+	nodes   []*replicaNode
+	healthy atomic.Value // []*sqlx.DB
+	next    uint32
+	maxLag  time.Duration
+	lagger  dialect.ReplicaLagger
+	closed  chan struct{}
+	once    sync.Once
+}
+
+type replicaNode struct {
+	addr string
+	db   *sqlx.DB
+}
+
+// newReplicaSet opens the replicas of the config, returns nil if none.
+// Note:
+//  The replicas are not required to be available at startup.
+func newReplicaSet(cfg *Config) (*replicaSet, error) {
+	if len(cfg.ReplicaAddrs) == 0 {
+		return nil, nil
+	}
+	d := cfg.getDialect()
+	r := &replicaSet{
+		nodes:  make([]*replicaNode, 0, len(cfg.ReplicaAddrs)),
+		maxLag: time.Duration(cfg.MaxReplicaLag) * time.Second,
+		closed: make(chan struct{}),
+	}
+	if r.maxLag > 0 {
+		var ok bool
+		if r.lagger, ok = d.(dialect.ReplicaLagger); !ok {
+			erpc.Warnf("mysql: the %s dialect can not check the replica lag, max_replica_lag is ignored", d.Name())
+		}
+	}
+	for _, addr := range cfg.ReplicaAddrs {
+		db, err := sqlx.Open(d.DriverName(), cfg.source(addr))
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		cfg.setPool(db)
+		r.nodes = append(r.nodes, &replicaNode{addr: addr, db: db})
+	}
+	r.check()
+	go r.loop()
+	return r, nil
+}
+
+// pick returns a healthy replica by round-robin, or nil if none.
+func (r *replicaSet) pick() *sqlx.DB {
+	healthy, _ := r.healthy.Load().([]*sqlx.DB)
+	if len(healthy) == 0 {
+		return nil
+	}
+	return healthy[int(atomic.AddUint32(&r.next, 1))%len(healthy)]
+}
+
+func (r *replicaSet) loop() {
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.closed:
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// check keeps the replicas that are reachable and not lagging too far behind.
+func (r *replicaSet) check() {
+	healthy := make([]*sqlx.DB, 0, len(r.nodes))
+	for _, node := range r.nodes {
+		if err := r.checkNode(node); err != nil {
+			erpc.Warnf("mysql: replica %s is unavailable: %s", node.addr, err.Error())
+			continue
+		}
+		healthy = append(healthy, node.db)
+	}
+	r.healthy.Store(healthy)
+}
+
+func (r *replicaSet) checkNode(node *replicaNode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaCheckInterval)
+	defer cancel()
+	if err := node.db.PingContext(ctx); err != nil {
+		return err
+	}
+	if r.lagger == nil {
+		return nil
+	}
+	lag, err := r.lagger.ReplicaLag(ctx, node.db)
+	if err != nil {
+		return err
+	}
+	if lag > r.maxLag {
+		return errors.Errorf("replication lag %s exceeds %s", lag, r.maxLag)
+	}
+	return nil
+}
+
+func (r *replicaSet) close() {
+	r.once.Do(func() {
+		close(r.closed)
+		for _, node := range r.nodes {
+			node.db.Close()
+		}
+	})
+}
@@ -0,0 +1,46 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
+)
+
+func TestReader(t *testing.T) {
+	cfg := NewConfig()
+	cfg.Port = 1
+	// the unreachable replica is not read
+	cfg.ReplicaAddrs = []string{"127.0.0.1:1"}
+	primary, err := sqlx.Open("mysql", cfg.Source())
+	if err != nil {
+		t.Fatal(err)
+	}
+	replicas, err := newReplicaSet(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &DB{DB: primary, dbConfig: cfg, replicas: replicas}
+	defer d.Close()
+	if d.Reader(context.Background()) != primary {
+		t.Fatal("Reader: expect primary when no replica is healthy")
+	}
+
+	// round-robin over the healthy replicas
+	a, _ := sqlx.Open("mysql", cfg.source("127.0.0.1:2"))
+	b, _ := sqlx.Open("mysql", cfg.source("127.0.0.1:3"))
+	defer a.Close()
+	defer b.Close()
+	replicas.healthy.Store([]*sqlx.DB{a, b})
+	first := d.Reader(context.Background())
+	second := d.Reader(context.Background())
+	if first == primary || second == primary || first == second {
+		t.Fatal("Reader: expect round-robin over replicas")
+	}
+	if d.Reader(WithReadPrimary(context.Background())) != primary {
+		t.Fatal("Reader: expect primary when pinned")
+	}
+	if d.Reader(cacheFillContext) != primary {
+		t.Fatal("Reader: expect primary when filling the cache")
+	}
+}
@@ -0,0 +1,419 @@
+package mysql
+
+import (
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/goutil"
+	"github.com/henrylee2cn/goutil/errors"
+	"github.com/xiaoenai/tp-micro/v6/model/sqlx"
+)
+
+// ShardTable the placeholder of the quoted physical table name in the statements of ShardedDB,
+// e.g. 'SELECT * FROM {table} WHERE age>?'.
+const ShardTable = "{table}"
+
+// ErrNoShardKey error: the sharding column is not in the key fields
+var ErrNoShardKey = errors.New("the sharding column is not in the key fields")
+
+// ShardFunc returns the index of the table in [0, n) for the value of the sharding column.
+type ShardFunc func(value interface{}, n int) int
+
+// DefaultShardFunc shards the integers by modulo, and the others by the CRC32 of their string forms.
+func DefaultShardFunc(value interface{}, n int) int {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int() % int64(n)
+		if i < 0 {
+			i += int64(n)
+		}
+		return int(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int(v.Uint() % uint64(n))
+	case reflect.Invalid:
+		return 0
+	}
+	return int(crc32.ChecksumIEEE([]byte(fmt.Sprint(v.Interface()))) % uint32(n))
+}
+
+// ShardConfig the config of a sharded table
+type ShardConfig struct {
+	// Column the sharding column, e.g. user_id
+	Column string
+	// Tables the number of the physical tables, which are named '<table>_00', '<table>_01', ...,
+	// and spread evenly over the DBs in order.
+	Tables int
+	// Func maps the value of the sharding column to the table, default is DefaultShardFunc.
+	Func ShardFunc
+}
+
+// ShardTableName returns the name of the i-th physical table.
+func (cfg *ShardConfig) ShardTableName(tableName string, i int) string {
+	width := len(strconv.Itoa(cfg.Tables - 1))
+	if width < 2 {
+		width = 2
+	}
+	return fmt.Sprintf("%s_%0*d", tableName, width, i)
+}
+
+// dbIndex returns the index of the DB of the i-th physical table.
+func (cfg *ShardConfig) dbIndex(i, dbs int) int {
+	return i * dbs / cfg.Tables
+}
+
+func (cfg *ShardConfig) check(dbs int) error {
+	if cfg.Column == "" {
+		return errors.New("ShardConfig.Column is empty")
+	}
+	if cfg.Tables < dbs || dbs == 0 {
+		return fmt.Errorf("ShardConfig.Tables must be not less than the number of DBs: %d < %d", cfg.Tables, dbs)
+	}
+	if cfg.Func == nil {
+		cfg.Func = DefaultShardFunc
+	}
+	cfg.Column = goutil.SnakeString(cfg.Column)
+	return nil
+}
+
+// ShardedDB routes the rows of a sharded table to the physical tables across the DBs by the sharding column.
+// NOTE:
+//  The cache keys of each physical table are prefixed with its own database and table names;
+//  A transaction can only write the tables of one DB.
+type ShardedDB struct {
+	tableName  string
+	column     string
+	fieldIndex int
+	fn         ShardFunc
+	shards     []*CacheableDB
+}
+
+// RegShardedDB registers a sharded table, whose physical tables are spread evenly over dbs in order.
+// NOTE:
+//  e.g. with 2 DBs and 64 tables, user_00~user_31 are in dbs[0], and user_32~user_63 are in dbs[1].
+func RegShardedDB(dbs []*DB, ormStructPtr Cacheable, cacheExpiration time.Duration, cfg ShardConfig) (*ShardedDB, error) {
+	if err := cfg.check(len(dbs)); err != nil {
+		return nil, fmt.Errorf("RegShardedDB(): %s", err.Error())
+	}
+	tableName := ormStructPtr.TableName()
+	s := &ShardedDB{
+		tableName: tableName,
+		column:    cfg.Column,
+		fn:        cfg.Func,
+		shards:    make([]*CacheableDB, cfg.Tables),
+	}
+	for i := range s.shards {
+		d := dbs[cfg.dbIndex(i, len(dbs))]
+		c, err := d.regCacheableDB(ormStructPtr, cfg.ShardTableName(tableName, i), cacheExpiration)
+		if err != nil {
+			return nil, err
+		}
+		s.shards[i] = c
+	}
+	idx, ok := s.shards[0].fieldsIndexMap[s.column]
+	if !ok {
+		return nil, fmt.Errorf("RegShardedDB(): table '%s' has no sharding column '%s'", tableName, s.column)
+	}
+	s.fieldIndex = idx
+	return s, nil
+}
+
+// connectShard connects to the DB of the sharded tables at addr, which shares the config and the cache of d.
+// NOTE:
+//  The migrations of the config are checked or applied to it too,
+//  so it has all the physical tables, since which ones it owns depends on the number of shard_addrs.
+func (d *DB) connectShard(addr string) (*DB, error) {
+	db, err := sqlx.Connect(d.Dialect().DriverName(), d.dbConfig.source(addr))
+	if err != nil {
+		return nil, err
+	}
+	d.dbConfig.setPool(db)
+	db.Mapper = d.DB.Mapper
+	shard := &DB{
+		DB:           db,
+		Cache:        d.Cache,
+		dbConfig:     d.dbConfig,
+		redisConfig:  d.redisConfig,
+		cacheableDBs: make(map[string]*CacheableDB),
+		dialect:      d.dialect,
+	}
+	if err = shard.migrateAtConnecting(d.dbConfig); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return shard, nil
+}
+
+// TableName returns the logical table name.
+func (s *ShardedDB) TableName() string {
+	return s.tableName
+}
+
+// Column returns the sharding column.
+func (s *ShardedDB) Column() string {
+	return s.column
+}
+
+// Shards returns the physical tables in order.
+func (s *ShardedDB) Shards() []*CacheableDB {
+	return s.shards
+}
+
+// Shard returns the physical table of the sharding column's value.
+func (s *ShardedDB) Shard(value interface{}) *CacheableDB {
+	return s.shards[s.fn(value, len(s.shards))]
+}
+
+// ShardOf returns the physical table of the row by its sharding column.
+func (s *ShardedDB) ShardOf(structPtr Cacheable) (*CacheableDB, error) {
+	v := reflect.ValueOf(structPtr)
+	if typeName := v.Type().String(); typeName != s.shards[0].typeName {
+		return nil, fmt.Errorf("ShardOf(): unmatch Cacheable: want %s, have %s", s.shards[0].typeName, typeName)
+	}
+	return s.Shard(v.Elem().Field(s.fieldIndex).Interface()), nil
+}
+
+// ShardQuery replaces the ShardTable placeholder of the query with the quoted name of the physical table.
+func ShardQuery(c *CacheableDB, query string) string {
+	return strings.Replace(query, ShardTable, c.DB.Dialect().Quote(c.tableName), -1)
+}
+
+// routable returns whether the key fields contain the sharding column.
+func (s *ShardedDB) routable(fields []string) bool {
+	if len(fields) == 0 {
+		fields = s.shards[0].priCols
+	}
+	for _, field := range fields {
+		if goutil.SnakeString(field) == s.column {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheGet selects one row by primary key or the fields with the cache layer.
+// NOTE:
+//  The fields must contain the sharding column, otherwise use Get to query all the tables without the cache layer.
+func (s *ShardedDB) CacheGet(destStructPtr Cacheable, fields ...string) error {
+	if !s.routable(fields) {
+		return ErrNoShardKey
+	}
+	c, err := s.ShardOf(destStructPtr)
+	if err != nil {
+		return err
+	}
+	return c.CacheGet(destStructPtr, fields...)
+}
+
+// CacheMultiGet selects the rows by primary key or the fields in batch with the cache layer.
+// NOTE:
+//  The fields must contain the sharding column, and the rows are selected by one query per table.
+func (s *ShardedDB) CacheMultiGet(destStructPtrs interface{}, fields ...string) ([]bool, error) {
+	if !s.routable(fields) {
+		return nil, ErrNoShardKey
+	}
+	dests := reflect.ValueOf(destStructPtrs)
+	if dests.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("CacheMultiGet(): destStructPtrs must be a slice, have %T", destStructPtrs)
+	}
+	groups := make(map[*CacheableDB][]int)
+	for i := 0; i < dests.Len(); i++ {
+		c, err := s.ShardOf(dests.Index(i).Interface().(Cacheable))
+		if err != nil {
+			return nil, err
+		}
+		groups[c] = append(groups[c], i)
+	}
+	exists := make([]bool, dests.Len())
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for c, indexes := range groups {
+		wg.Add(1)
+		go func(c *CacheableDB, indexes []int) {
+			defer wg.Done()
+			group := reflect.MakeSlice(dests.Type(), len(indexes), len(indexes))
+			for j, i := range indexes {
+				group.Index(j).Set(dests.Index(i))
+			}
+			groupExists, err := c.CacheMultiGet(group.Interface(), append([]string(nil), fields...)...)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			for j, i := range indexes {
+				exists[i] = groupExists[j]
+			}
+		}(c, indexes)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return exists, nil
+}
+
+// PutCache caches one row of its physical table.
+func (s *ShardedDB) PutCache(srcStructPtr Cacheable, fields ...string) error {
+	c, err := s.ShardOf(srcStructPtr)
+	if err != nil {
+		return err
+	}
+	return c.PutCache(srcStructPtr, fields...)
+}
+
+// DeleteCache deletes one row from the cache.
+// NOTE:
+//  If the fields do not contain the sharding column, it is deleted from the cache of all the tables.
+func (s *ShardedDB) DeleteCache(srcStructPtr Cacheable, fields ...string) error {
+	if s.routable(fields) {
+		c, err := s.ShardOf(srcStructPtr)
+		if err != nil {
+			return err
+		}
+		return c.DeleteCache(srcStructPtr, fields...)
+	}
+	return s.scatter(func(_ int, c *CacheableDB) error {
+		return c.DeleteCache(srcStructPtr, append([]string(nil), fields...)...)
+	})
+}
+
+// MergeOptions the options of merging the rows selected from the tables
+type MergeOptions struct {
+	// Less sorts the merged rows if not nil, whose arguments are the elements of dest.
+	Less func(a, b interface{}) bool
+	// Offset skips the first merged rows.
+	Offset int
+	// Limit limits the number of merged rows if greater than 0.
+	Limit int
+}
+
+// Select selects the rows from all the tables, and concatenates them in the order of the tables.
+// NOTE:
+//  The query uses the ShardTable placeholder as the table name.
+func (s *ShardedDB) Select(dest interface{}, query string, args ...interface{}) error {
+	return s.SelectMerge(dest, nil, query, args...)
+}
+
+// SelectMerge selects the rows from all the tables, and merges them by opts.
+// NOTE:
+//  The query uses the ShardTable placeholder as the table name;
+//  For paging, each table should be limited to 'Offset+Limit' rows by the query.
+func (s *ShardedDB) SelectMerge(dest interface{}, opts *MergeOptions, query string, args ...interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("SelectMerge(): dest must be a pointer of slice, have %T", dest)
+	}
+	results := make([]reflect.Value, len(s.shards))
+	err := s.scatter(func(i int, c *CacheableDB) error {
+		result := reflect.New(v.Elem().Type())
+		err := c.Select(result.Interface(), ShardQuery(c, query), args...)
+		results[i] = result.Elem()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	rows := reflect.MakeSlice(v.Elem().Type(), 0, 0)
+	for _, result := range results {
+		rows = reflect.AppendSlice(rows, result)
+	}
+	if opts != nil {
+		if opts.Less != nil {
+			sort.SliceStable(rows.Interface(), func(i, j int) bool {
+				return opts.Less(rows.Index(i).Interface(), rows.Index(j).Interface())
+			})
+		}
+		if offset := opts.Offset; offset > 0 {
+			if offset > rows.Len() {
+				offset = rows.Len()
+			}
+			rows = rows.Slice(offset, rows.Len())
+		}
+		if opts.Limit > 0 && opts.Limit < rows.Len() {
+			rows = rows.Slice(0, opts.Limit)
+		}
+	}
+	v.Elem().Set(rows)
+	return nil
+}
+
+// Get selects one row from the tables, and returns the first found in the order of the tables.
+// NOTE:
+//  The query uses the ShardTable placeholder as the table name.
+func (s *ShardedDB) Get(dest interface{}, query string, args ...interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr {
+		return fmt.Errorf("Get(): dest must be a pointer, have %T", dest)
+	}
+	results := make([]reflect.Value, len(s.shards))
+	err := s.scatter(func(i int, c *CacheableDB) error {
+		result := reflect.New(v.Elem().Type())
+		err := c.Get(result.Interface(), ShardQuery(c, query), args...)
+		if err == nil {
+			results[i] = result.Elem()
+		} else if IsNoRows(err) {
+			err = nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.IsValid() {
+			v.Elem().Set(result)
+			return nil
+		}
+	}
+	return ErrNoRows
+}
+
+// Count sums the counts of all the tables.
+// NOTE:
+//  The query selects one integer, and uses the ShardTable placeholder as the table name.
+func (s *ShardedDB) Count(query string, args ...interface{}) (int64, error) {
+	counts := make([]int64, len(s.shards))
+	err := s.scatter(func(i int, c *CacheableDB) error {
+		return c.Get(&counts[i], ShardQuery(c, query), args...)
+	})
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, err
+}
+
+// scatter calls fn for all the tables concurrently, and returns the first error.
+func (s *ShardedDB) scatter(fn func(i int, c *CacheableDB) error) error {
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(s.shards))
+	)
+	for i, c := range s.shards {
+		wg.Add(1)
+		go func(i int, c *CacheableDB) {
+			defer wg.Done()
+			errs[i] = fn(i, c)
+		}(i, c)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package mysql
+
+import (
+	"testing"
+)
+
+type shardRow struct {
+	Id     int64
+	UserId int64
+	Name   string
+}
+
+func (*shardRow) TableName() string {
+	return "log"
+}
+
+func TestShardedDB(t *testing.T) {
+	cfg := ShardConfig{Column: "UserId", Tables: 64}
+	if err := cfg.check(2); err != nil {
+		t.Fatal(err)
+	}
+	if name := cfg.ShardTableName("log", 7); name != "log_07" {
+		t.Fatalf("ShardTableName: expect log_07, got %s", name)
+	}
+	if name := (&ShardConfig{Tables: 128}).ShardTableName("log", 7); name != "log_007" {
+		t.Fatalf("ShardTableName: expect log_007, got %s", name)
+	}
+	for value, want := range map[interface{}]int{int64(65): 1, int32(-1): 63, uint8(3): 3, nil: 0} {
+		if got := DefaultShardFunc(value, 64); got != want {
+			t.Fatalf("DefaultShardFunc(%v): expect %d, got %d", value, want, got)
+		}
+	}
+	if got := DefaultShardFunc("abc", 64); got != DefaultShardFunc("abc", 64) || got < 0 || got >= 64 {
+		t.Fatalf("DefaultShardFunc(abc): got %d", got)
+	}
+
+	s := &ShardedDB{tableName: "log", column: cfg.Column, fieldIndex: 1, fn: cfg.Func}
+	for i := 0; i < cfg.Tables; i++ {
+		s.shards = append(s.shards, &CacheableDB{
+			DB:        &DB{},
+			tableName: cfg.ShardTableName("log", i),
+			typeName:  "*mysql.shardRow",
+			priCols:   []string{"id"},
+		})
+	}
+	c, err := s.ShardOf(&shardRow{Id: 1, UserId: 130})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TableName() != "log_02" {
+		t.Fatalf("ShardOf: expect log_02, got %s", c.TableName())
+	}
+	if q := ShardQuery(c, "SELECT * FROM {table} WHERE id=?"); q != "SELECT * FROM `log_02` WHERE id=?" {
+		t.Fatalf("ShardQuery: got %s", q)
+	}
+	if s.routable(nil) || !s.routable([]string{"UserId", "name"}) {
+		t.Fatal("routable: expect routing by the fields containing user_id only")
+	}
+	if _, err = s.CacheMultiGet([]*shardRow{{Id: 1}}); err != ErrNoShardKey {
+		t.Fatalf("CacheMultiGet: expect ErrNoShardKey, got %v", err)
+	}
+	if err = s.CacheGet(&shardRow{Name: "a"}, "name"); err != ErrNoShardKey {
+		t.Fatalf("CacheGet: expect ErrNoShardKey, got %v", err)
+	}
+	// log_00~log_31 are in the first DB, and log_32~log_63 are in the second
+	if cfg.dbIndex(31, 2) != 0 || cfg.dbIndex(32, 2) != 1 || cfg.dbIndex(63, 2) != 1 {
+		t.Fatal("dbIndex: expect the tables spread evenly over the DBs in order")
+	}
+}
@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sync"
+
+	"github.com/henrylee2cn/erpc/v6/codec"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// CacheCodec the codec of the cached rows
+type CacheCodec interface {
+	// Name returns codec name.
+	Name() string
+	// Marshal returns the encoding of v.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal parses the encoded data and stores the result
+	// in the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// built-in cache codec names
+// Note:
+//  CodecProtobuf only supports the proto.Message models, such as the hand-written or protoc generated ones;
+//  Use CodecMsgpack for the compact encoding of the plain structs, such as the micro generated models.
+const (
+	CodecJSON     = "json"
+	CodecGob      = "gob"
+	CodecMsgpack  = "msgpack"
+	CodecProtobuf = codec.NAME_PROTOBUF
+)
+
+var cacheCodecs = struct {
+	m  map[string]CacheCodec
+	mu sync.RWMutex
+}{
+	m: map[string]CacheCodec{
+		CodecJSON:     jsonCodec{},
+		CodecGob:      gobCodec{},
+		CodecMsgpack:  msgpackCodec{},
+		CodecProtobuf: codec.ProtoCodec{},
+	},
+}
+
+// RegCacheCodec registers a cache codec.
+func RegCacheCodec(c CacheCodec) {
+	cacheCodecs.mu.Lock()
+	defer cacheCodecs.mu.Unlock()
+	if _, ok := cacheCodecs.m[c.Name()]; ok {
+		panic("redis: multi-register cache codec name: " + c.Name())
+	}
+	cacheCodecs.m[c.Name()] = c
+}
+
+// GetCacheCodec returns the cache codec by name.
+func GetCacheCodec(name string) (CacheCodec, error) {
+	cacheCodecs.mu.RLock()
+	defer cacheCodecs.mu.RUnlock()
+	c, ok := cacheCodecs.m[name]
+	if !ok {
+		return nil, fmt.Errorf("redis: unsupported cache codec name: %s", name)
+	}
+	return c, nil
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return CodecJSON }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string { return CodecGob }
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string                               { return CodecMsgpack }
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error)      { return msgpack.Marshal(v) }
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// ErrCacheVersion the cached row is encoded by another codec, version or struct
+var ErrCacheVersion = errors.New("redis: cache version mismatch")
+
+// CacheFormat encodes the cached rows with a codec, and prefixes them with the version.
+// Note:
+//  The prefix is '@<codec>:<version>:<fingerprint>:', where the fingerprint is of the struct fields,
+//  so the entries written before a codec, version or schema change are treated as misses instead of being decoded;
+//  The negative cache value is not prefixed.
+type CacheFormat struct {
+	codec  CacheCodec
+	prefix []byte
+}
+
+// NewCacheFormat creates the format of the cached rows of structPtr's type.
+// Note:
+//  If codecName is empty, use json.
+func NewCacheFormat(codecName, version string, structPtr interface{}) (*CacheFormat, error) {
+	if codecName == "" {
+		codecName = CodecJSON
+	}
+	c, err := GetCacheCodec(codecName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.Marshal(structPtr); err != nil {
+		return nil, fmt.Errorf("redis: %s cache codec does not support %T: %s", codecName, structPtr, err.Error())
+	}
+	return &CacheFormat{
+		codec:  c,
+		prefix: []byte(fmt.Sprintf("@%s:%s:%08x:", codecName, version, fingerprint(reflect.TypeOf(structPtr)))),
+	}, nil
+}
+
+// Codec returns the codec.
+func (f *CacheFormat) Codec() CacheCodec {
+	return f.codec
+}
+
+// Marshal returns the prefixed encoding of v.
+func (f *CacheFormat) Marshal(v interface{}) ([]byte, error) {
+	b, err := f.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(make([]byte, 0, len(f.prefix)+len(b)), f.prefix...), b...), nil
+}
+
+// Unmarshal parses the prefixed data into v.
+// Note:
+//  Returns ErrCacheVersion if the prefix mismatches.
+func (f *CacheFormat) Unmarshal(data []byte, v interface{}) error {
+	if !bytes.HasPrefix(data, f.prefix) {
+		return ErrCacheVersion
+	}
+	return f.codec.Unmarshal(data[len(f.prefix):], v)
+}
+
+// fingerprint returns the checksum of the struct fields' names, types and tags.
+func fingerprint(t reflect.Type) uint32 {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	h := crc32.NewIEEE()
+	fmt.Fprint(h, t.String())
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			fmt.Fprintf(h, ";%s %s %q", field.Name, field.Type.String(), field.Tag)
+		}
+	}
+	return h.Sum32()
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"testing"
+)
+
+type codecRow struct {
+	Id      int64
+	Content string
+}
+
+type codecRow2 struct {
+	Id      int64
+	Content string
+	Deleted bool
+}
+
+func TestCacheFormat(t *testing.T) {
+	for _, name := range []string{"", CodecJSON, CodecGob, CodecMsgpack} {
+		f, err := NewCacheFormat(name, "1", new(codecRow))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := f.Marshal(&codecRow{Id: 1, Content: "abc"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var row codecRow
+		if err = f.Unmarshal(data, &row); err != nil {
+			t.Fatalf("%s: Unmarshal: %v", name, err)
+		}
+		if row.Id != 1 || row.Content != "abc" {
+			t.Fatalf("%s: Unmarshal: got %+v", name, row)
+		}
+		if IsNegativeCache(data) {
+			t.Fatalf("%s: expect not negative cache", name)
+		}
+	}
+
+	f, _ := NewCacheFormat(CodecJSON, "1", new(codecRow))
+	data, _ := f.Marshal(&codecRow{Id: 1})
+	// the unprefixed entries, and the entries of another codec, version or struct are misses
+	mismatches := []*CacheFormat{}
+	for _, args := range [][2]string{{CodecGob, "1"}, {CodecMsgpack, "1"}, {CodecJSON, "2"}} {
+		f2, _ := NewCacheFormat(args[0], args[1], new(codecRow))
+		mismatches = append(mismatches, f2)
+	}
+	f2, _ := NewCacheFormat(CodecJSON, "1", new(codecRow2))
+	mismatches = append(mismatches, f2)
+	for _, f2 := range mismatches {
+		if err := f2.Unmarshal(data, new(codecRow)); err != ErrCacheVersion {
+			t.Fatalf("%s: expect ErrCacheVersion, got %v", f2.prefix, err)
+		}
+	}
+	if err := f.Unmarshal([]byte(`{"Id":1}`), new(codecRow)); err != ErrCacheVersion {
+		t.Fatalf("unprefixed: expect ErrCacheVersion, got %v", err)
+	}
+
+	// protobuf requires proto.Message
+	if _, err := NewCacheFormat(CodecProtobuf, "", new(codecRow)); err == nil {
+		t.Fatal("protobuf: expect error for non proto.Message")
+	}
+	if _, err := NewCacheFormat("unknown", "", new(codecRow)); err == nil {
+		t.Fatal("expect error for unknown codec")
+	}
+}
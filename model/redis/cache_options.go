@@ -0,0 +1,109 @@
+package redis
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// NegativeCacheValue the cache value of a non-existent row
+const NegativeCacheValue = "null"
+
+// IsNegativeCache returns whether the cache value is of a non-existent row.
+func IsNegativeCache(value []byte) bool {
+	return string(value) == NegativeCacheValue
+}
+
+// CacheOptions the options of reading through the cache, which protect the database from the cache-miss storms
+type CacheOptions struct {
+	// NegativeExpiration caches the non-existent rows for the duration, so the misses do not hit the database again;
+	// 0 disables it.
+	NegativeExpiration time.Duration `yaml:"negative_expiration"`
+	// Singleflight loads the same key only once at a time in the process, and shares the result with the concurrent callers.
+	Singleflight bool `yaml:"singleflight"`
+	// EarlyRefreshBeta refreshes the cache probabilistically before it expires (XFetch),
+	// the greater the earlier, 1 is recommended; 0 disables it.
+	EarlyRefreshBeta float64 `yaml:"early_refresh_beta"`
+}
+
+// ShouldRefresh returns whether to refresh the cache that expires after ttl,
+// delta is the duration of loading it from the database.
+func (o *CacheOptions) ShouldRefresh(ttl, delta time.Duration) bool {
+	if o.EarlyRefreshBeta <= 0 || ttl <= 0 {
+		return false
+	}
+	return float64(ttl) <= -float64(delta)*o.EarlyRefreshBeta*math.Log(1-rand.Float64())
+}
+
+var errFlightPanic = errors.New("redis: the shared call panicked")
+
+// FlightGroup deduplicates the concurrent calls of the same key.
+type FlightGroup struct {
+	calls map[string]*flightCall
+	mu    sync.Mutex
+}
+
+type flightCall struct {
+	wg    sync.WaitGroup
+	value []byte
+	err   error
+}
+
+// Do calls fn once for the concurrent calls of the key, and returns the same result to them.
+func (g *FlightGroup) Do(key string, fn func() ([]byte, error)) ([]byte, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+	call := new(flightCall)
+	call.wg.Add(1)
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	var returned bool
+	defer func() {
+		if !returned {
+			call.err = errFlightPanic
+		}
+		call.wg.Done()
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+	}()
+	call.value, call.err = fn()
+	returned = true
+	return call.value, call.err
+}
+
+// CacheLoader loads the cache through the FlightGroup, and tracks the duration of loading.
+type CacheLoader struct {
+	FlightGroup
+	delta int64
+}
+
+// Observe records the duration of a load, which is smoothed by an exponential moving average.
+func (l *CacheLoader) Observe(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&l.delta)
+		delta := int64(d)
+		if old > 0 {
+			delta = old + (delta-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&l.delta, old, delta) {
+			return
+		}
+	}
+}
+
+// Delta returns the average duration of loading.
+func (l *CacheLoader) Delta() time.Duration {
+	return time.Duration(atomic.LoadInt64(&l.delta))
+}
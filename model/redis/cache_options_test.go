@@ -0,0 +1,59 @@
+package redis
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroup(t *testing.T) {
+	var (
+		g     FlightGroup
+		calls int32
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Do("key", func() ([]byte, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(50 * time.Millisecond)
+				return []byte("value"), nil
+			})
+			if err != nil || string(v) != "value" {
+				t.Errorf("Do: %q, %v", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("expect 1 call, got %d", calls)
+	}
+}
+
+func TestShouldRefresh(t *testing.T) {
+	o := &CacheOptions{}
+	if o.ShouldRefresh(time.Millisecond, time.Second) {
+		t.Fatal("expect no refresh when disabled")
+	}
+	o.EarlyRefreshBeta = 1
+	var n int
+	for i := 0; i < 1000; i++ {
+		if o.ShouldRefresh(time.Hour, 10*time.Millisecond) {
+			n++
+		}
+	}
+	if n > 0 {
+		t.Fatalf("expect no refresh long before expiring, got %d", n)
+	}
+	for i := 0; i < 1000; i++ {
+		if o.ShouldRefresh(time.Millisecond, time.Second) {
+			n++
+		}
+	}
+	if n < 900 {
+		t.Fatalf("expect refresh soon before expiring, got %d", n)
+	}
+}
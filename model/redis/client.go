@@ -2,6 +2,7 @@
 package redis
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -12,10 +13,12 @@ import (
 type (
 	// Config redis (cluster) client config
 	Config struct {
-		// redis deploy type, [single, cluster]
+		// redis deploy type, [single, sentinel, cluster]
 		DeployType string `yaml:"deploy_type"`
 		// only for single node config, valid when DeployType=single.
 		ForSingle SingleConfig `yaml:"for_single"`
+		// only for sentinel config, valid when DeployType=sentinel.
+		ForSentinel SentinelConfig `yaml:"for_sentinel"`
 		// only for cluster config, valid when DeployType=cluster.
 		ForCluster ClusterConfig `yaml:"for_cluster"`
 
@@ -57,7 +60,8 @@ type (
 		IdleCheckFrequency int64 `yaml:"idle_check_frequency,omitempty"`
 
 		// Enables read only queries on slave nodes.
-		// Only for cluster.
+		// For single, it requires ForSingle.ReplicaAddrs;
+		// For sentinel, the replicas are discovered from the sentinels.
 		ReadOnly bool `yaml:"read_only,omitempty"`
 
 		init bool
@@ -71,6 +75,19 @@ type (
 		// Maximum backoff between each retry.
 		// Default is 512 seconds; -1 disables backoff.
 		MaxRetryBackoff int64 `yaml:"max_retry_backoff,omitempty"`
+
+		// host:port addresses of the replicas, valid when ReadOnly=true.
+		ReplicaAddrs []string `yaml:"replica_addrs,omitempty"`
+	}
+
+	// SentinelConfig redis sentinel client config, which fails over to the new master automatically.
+	SentinelConfig struct {
+		// The master name.
+		MasterName string `yaml:"master_name"`
+		// A seed list of host:port addresses of sentinel nodes.
+		SentinelAddrs []string `yaml:"sentinel_addrs"`
+		// An optional password of the sentinel nodes.
+		SentinelPassword string `yaml:"sentinel_password,omitempty"`
 	}
 
 	// ClusterConfig redis cluster client config.
@@ -90,8 +107,9 @@ type (
 
 // deploy types
 const (
-	TypeSingle  = "single"
-	TypeCluster = "cluster"
+	TypeSingle   = "single"
+	TypeSentinel = "sentinel"
+	TypeCluster  = "cluster"
 )
 
 // Reload reloads config.
@@ -104,8 +122,8 @@ func (cfg *Config) Reload(bind cfgo.BindFunc) error {
 		return err
 	}
 	cfg.init = true
-	if cfg.DeployType != TypeSingle && cfg.DeployType != TypeCluster {
-		return fmt.Errorf("redis config: deploy_type optional enumeration list: %s, %s", TypeSingle, TypeCluster)
+	if cfg.DeployType != TypeSingle && cfg.DeployType != TypeSentinel && cfg.DeployType != TypeCluster {
+		return fmt.Errorf("redis config: deploy_type optional enumeration list: %s, %s, %s", TypeSingle, TypeSentinel, TypeCluster)
 	}
 	return nil
 }
@@ -174,11 +192,22 @@ func NewClient(cfg *Config) (*Client, error) {
 	}
 	switch cfg.DeployType {
 	case TypeSingle:
-		c.Cmdable = redis.NewClient(&redis.Options{
-			Addr:               cfg.ForSingle.Addr,
+		master := redis.NewClient(cfg.nodeOptions(cfg.ForSingle.Addr))
+		if cfg.ReadOnly && len(cfg.ForSingle.ReplicaAddrs) > 0 {
+			c.Cmdable = newReplicaClient(master, func() ([]string, error) {
+				return cfg.ForSingle.ReplicaAddrs, nil
+			}, cfg.newNode)
+		} else {
+			c.Cmdable = master
+		}
+
+	case TypeSentinel:
+		master := redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:         cfg.ForSentinel.MasterName,
+			SentinelAddrs:      cfg.ForSentinel.SentinelAddrs,
+			SentinelPassword:   cfg.ForSentinel.SentinelPassword,
 			Password:           cfg.Password,
 			MaxRetries:         cfg.MaxRetries,
-			MaxRetryBackoff:    time.Duration(cfg.ForSingle.MaxRetryBackoff) * time.Second,
 			DialTimeout:        time.Duration(cfg.DialTimeout) * time.Second,
 			ReadTimeout:        time.Duration(cfg.ReadTimeout) * time.Second,
 			WriteTimeout:       time.Duration(cfg.WriteTimeout) * time.Second,
@@ -187,6 +216,11 @@ func NewClient(cfg *Config) (*Client, error) {
 			IdleTimeout:        time.Duration(cfg.IdleTimeout) * time.Second,
 			IdleCheckFrequency: time.Duration(cfg.IdleCheckFrequency) * time.Second,
 		})
+		if cfg.ReadOnly {
+			c.Cmdable = newReplicaClient(master, cfg.discoverSentinelReplicas, cfg.newNode)
+		} else {
+			c.Cmdable = master
+		}
 
 	case TypeCluster:
 		c.Cmdable = redis.NewClusterClient(&redis.ClusterOptions{
@@ -206,7 +240,7 @@ func NewClient(cfg *Config) (*Client, error) {
 		})
 
 	default:
-		return nil, fmt.Errorf("redis.Config.DeployType: optional enumeration list: %s, %s", TypeSingle, TypeCluster)
+		return nil, fmt.Errorf("redis.Config.DeployType: optional enumeration list: %s, %s, %s", TypeSingle, TypeSentinel, TypeCluster)
 	}
 
 	if _, err := c.Ping().Result(); err != nil {
@@ -215,6 +249,49 @@ func NewClient(cfg *Config) (*Client, error) {
 	return c, nil
 }
 
+func (cfg *Config) nodeOptions(addr string) *redis.Options {
+	return &redis.Options{
+		Addr:               addr,
+		Password:           cfg.Password,
+		MaxRetries:         cfg.MaxRetries,
+		MaxRetryBackoff:    time.Duration(cfg.ForSingle.MaxRetryBackoff) * time.Second,
+		DialTimeout:        time.Duration(cfg.DialTimeout) * time.Second,
+		ReadTimeout:        time.Duration(cfg.ReadTimeout) * time.Second,
+		WriteTimeout:       time.Duration(cfg.WriteTimeout) * time.Second,
+		PoolSize:           cfg.PoolSizePerNode,
+		PoolTimeout:        time.Duration(cfg.PoolTimeout) * time.Second,
+		IdleTimeout:        time.Duration(cfg.IdleTimeout) * time.Second,
+		IdleCheckFrequency: time.Duration(cfg.IdleCheckFrequency) * time.Second,
+	}
+}
+
+func (cfg *Config) newNode(addr string) *redis.Client {
+	return redis.NewClient(cfg.nodeOptions(addr))
+}
+
+// discoverSentinelReplicas asks the sentinels in turn for the replicas of the master.
+func (cfg *Config) discoverSentinelReplicas() ([]string, error) {
+	var err error
+	for _, addr := range cfg.ForSentinel.SentinelAddrs {
+		sentinel := redis.NewSentinelClient(&redis.Options{
+			Addr:        addr,
+			Password:    cfg.ForSentinel.SentinelPassword,
+			DialTimeout: time.Duration(cfg.DialTimeout) * time.Second,
+			ReadTimeout: time.Duration(cfg.ReadTimeout) * time.Second,
+		})
+		var addrs []string
+		addrs, err = sentinelReplicas(sentinel, cfg.ForSentinel.MasterName)
+		sentinel.Close()
+		if err == nil {
+			return addrs, nil
+		}
+	}
+	if err == nil {
+		err = fmt.Errorf("redis config: for_sentinel.sentinel_addrs is empty")
+	}
+	return nil, err
+}
+
 // Config returns config.
 func (c *Client) Config() *Config {
 	return c.cfg
@@ -226,7 +303,13 @@ func (c *Client) IsCluster() bool {
 }
 
 // ToSingle tries to convert it to *redis.Client.
+// Note:
+//  For sentinel, returns the failover client of the master;
+//  If ReadOnly=true, returns the master client.
 func (c *Client) ToSingle() (*redis.Client, bool) {
+	if r, ok := c.Cmdable.(*replicaClient); ok {
+		return r.Client, true
+	}
 	cli, ok := c.Cmdable.(*redis.Client)
 	return cli, ok
 }
@@ -238,21 +321,33 @@ func (c *Client) ToCluster() (*redis.ClusterClient, bool) {
 }
 
 // LockCallback 使用分布式锁执行回调函数
-// 注意：每10毫秒尝试1次上锁，且上锁后默认锁定1分钟
+// 注意：每10毫秒尝试1次上锁，且上锁后默认锁定1分钟；
+//  最多等待锁定时长，超时返回 ErrLockNotObtained；
+//  解锁时仅删除自己持有的锁，回调超时后不会误删他人的锁
 func (c *Client) LockCallback(lockKey string, callback func(), maxLock ...time.Duration) error {
+	var d = time.Minute
+	if len(maxLock) > 0 {
+		d = maxLock[0]
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return c.LockCallbackContext(ctx, lockKey, callback, d)
+}
+
+// LockCallbackContext 使用分布式锁执行回调函数，等待上锁直到 ctx 结束
+// 注意：上锁后默认锁定1分钟
+func (c *Client) LockCallbackContext(ctx context.Context, lockKey string, callback func(), maxLock ...time.Duration) error {
 	var d = time.Minute
 	if len(maxLock) > 0 {
 		d = maxLock[0]
 	}
 	// lock
-	for lockOk, err := c.SetNX(lockKey, "", d).Result(); !lockOk; lockOk, err = c.SetNX(lockKey, "", d).Result() {
-		if err != nil && !IsRedisNil(err) {
-			return err
-		}
-		time.Sleep(time.Millisecond * 10)
+	lock, err := c.Obtain(ctx, lockKey, &LockOptions{TTL: d})
+	if err != nil {
+		return err
 	}
 	// unlock
-	defer c.Del(lockKey)
+	defer lock.Release()
 	// do
 	callback()
 	return nil
@@ -0,0 +1,366 @@
+package redis
+
+import (
+	"container/heap"
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/henrylee2cn/erpc/v6"
+)
+
+// local cache eviction policies
+const (
+	PolicyLRU = "lru"
+	PolicyLFU = "lfu"
+)
+
+// LocalCacheConfig the config of the in-process cache
+type LocalCacheConfig struct {
+	// Size the maximum number of entries
+	Size int `yaml:"size"`
+	// TTL the lifetime of the entries, which bounds the staleness when an invalidation is missed.
+	// Default is 1 minute.
+	TTL time.Duration `yaml:"ttl"`
+	// Policy the eviction policy, [lru, lfu], default is lru.
+	Policy string `yaml:"policy"`
+}
+
+// LocalCache a bounded in-process cache in front of redis,
+// which is invalidated across the instances by redis pub/sub.
+// Note:
+//  The entries are evicted by the policy when full, and expire after TTL;
+//  If the subscription is broken, all entries are purged when it is resumed,
+//  since the invalidations may be missed.
+type LocalCache struct {
+	client  *Client
+	channel string
+	id      string
+	ttl     time.Duration
+	size    int
+	entries map[string]*localEntry
+	policy  evictPolicy
+	version uint64
+	// tombs the versions of the deleted keys, which are bounded by size
+	tombs map[string]uint64
+	// floor the values read before it are not cached, raised by Purge and the overflow of tombs
+	floor  uint64
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+	closed chan struct{}
+	once   sync.Once
+}
+
+type localEntry struct {
+	key    string
+	value  []byte
+	expire time.Time
+	// for lru
+	elem *list.Element
+	// for lfu
+	freq  int
+	index int
+}
+
+type invalidation struct {
+	From string   `json:"from"`
+	Keys []string `json:"keys"`
+}
+
+// NewLocalCache creates an in-process cache, and subscribes the invalidations of the channel.
+// Note:
+//  If client is nil, the cache is not invalidated across the instances.
+func NewLocalCache(client *Client, channel string, cfg LocalCacheConfig) (*LocalCache, error) {
+	if cfg.Size <= 0 {
+		return nil, fmt.Errorf("redis: local cache size must be greater than 0, got %d", cfg.Size)
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = time.Minute
+	}
+	var policy evictPolicy
+	switch cfg.Policy {
+	case "", PolicyLRU:
+		policy = &lruPolicy{list: list.New()}
+	case PolicyLFU:
+		policy = new(lfuPolicy)
+	default:
+		return nil, fmt.Errorf("redis: local cache policy optional enumeration list: %s, %s", PolicyLRU, PolicyLFU)
+	}
+	id, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	l := &LocalCache{
+		client:  client,
+		channel: channel,
+		id:      id,
+		ttl:     cfg.TTL,
+		size:    cfg.Size,
+		entries: make(map[string]*localEntry, cfg.Size),
+		tombs:   make(map[string]uint64),
+		policy:  policy,
+		closed:  make(chan struct{}),
+	}
+	if client != nil {
+		l.pubsub = client.Subscribe(channel)
+		go l.receive()
+	}
+	return l, nil
+}
+
+// Version returns the current version, which is increased by every deletion.
+// Note:
+//  Take the version before reading redis, and pass it to Set,
+//  so the value is not cached if the key is deleted after reading.
+func (l *LocalCache) Version() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.version
+}
+
+// Get returns the value of the key.
+func (l *LocalCache) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(e.expire) {
+		l.remove(e)
+		return nil, false
+	}
+	l.policy.touch(e)
+	return e.value, true
+}
+
+// Set caches the value of the key, if the key is not deleted since the version was taken.
+func (l *LocalCache) Set(key string, value []byte, version uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if version < l.floor || l.tombs[key] > version {
+		return
+	}
+	if e, ok := l.entries[key]; ok {
+		e.value = value
+		e.expire = time.Now().Add(l.ttl)
+		l.policy.touch(e)
+		return
+	}
+	for len(l.entries) >= l.size {
+		l.remove(l.policy.evict())
+	}
+	e := &localEntry{key: key, value: value, expire: time.Now().Add(l.ttl)}
+	l.entries[key] = e
+	l.policy.add(e)
+}
+
+// Delete deletes the keys from this instance.
+// Note:
+//  If l is nil, does nothing.
+func (l *LocalCache) Delete(keys ...string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.version++
+	if len(l.tombs)+len(keys) > l.size {
+		// NOTE: forget the tombstones, and reject all the values read before
+		l.floor = l.version
+		l.tombs = make(map[string]uint64)
+	}
+	for _, key := range keys {
+		l.tombs[key] = l.version
+		if e, ok := l.entries[key]; ok {
+			l.remove(e)
+		}
+	}
+}
+
+// Purge deletes all the keys from this instance.
+func (l *LocalCache) Purge() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.version++
+	l.floor = l.version
+	l.tombs = make(map[string]uint64)
+	for _, e := range l.entries {
+		l.remove(e)
+	}
+}
+
+// Invalidate deletes the keys from all the instances.
+// Note:
+//  If l is nil, does nothing.
+func (l *LocalCache) Invalidate(keys ...string) error {
+	if l == nil {
+		return nil
+	}
+	l.Delete(keys...)
+	if l.client == nil || len(keys) == 0 {
+		return nil
+	}
+	b, _ := json.Marshal(&invalidation{From: l.id, Keys: keys})
+	return l.client.Publish(l.channel, b).Err()
+}
+
+// Fetch returns the value of the key from the local cache, or reads and caches it.
+// Note:
+//  If l is nil, just reads it.
+func (l *LocalCache) Fetch(key string, read func() ([]byte, error)) ([]byte, error) {
+	if l == nil {
+		return read()
+	}
+	if value, ok := l.Get(key); ok {
+		return value, nil
+	}
+	version := l.Version()
+	value, err := read()
+	if err == nil {
+		l.Set(key, value, version)
+	}
+	return value, err
+}
+
+// Len returns the number of entries.
+func (l *LocalCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// Close stops subscribing the invalidations.
+func (l *LocalCache) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.closed)
+		if l.pubsub != nil {
+			err = l.pubsub.Close()
+		}
+	})
+	return err
+}
+
+func (l *LocalCache) remove(e *localEntry) {
+	delete(l.entries, e.key)
+	l.policy.remove(e)
+}
+
+func (l *LocalCache) receive() {
+	for {
+		msg, err := l.pubsub.Receive()
+		select {
+		case <-l.closed:
+			return
+		default:
+		}
+		if err != nil {
+			// NOTE: the invalidations may be missed until the subscription is resumed
+			l.Purge()
+			erpc.Warnf("redis: receive local cache invalidations failed: %s: %s", l.channel, err.Error())
+			time.Sleep(time.Second)
+			continue
+		}
+		switch m := msg.(type) {
+		case *redis.Subscription:
+			// NOTE: the invalidations may be missed before (re)subscribed
+			l.Purge()
+		case *redis.Message:
+			var inv invalidation
+			if err = json.Unmarshal([]byte(m.Payload), &inv); err != nil {
+				erpc.Warnf("redis: decode local cache invalidation failed: %s: %s", l.channel, err.Error())
+				continue
+			}
+			if inv.From != l.id {
+				l.Delete(inv.Keys...)
+			}
+		}
+	}
+}
+
+type evictPolicy interface {
+	add(e *localEntry)
+	touch(e *localEntry)
+	remove(e *localEntry)
+	// evict returns the entry to be evicted
+	evict() *localEntry
+}
+
+// lruPolicy evicts the least recently used entry.
+type lruPolicy struct {
+	list *list.List
+}
+
+func (p *lruPolicy) add(e *localEntry) {
+	e.elem = p.list.PushFront(e)
+}
+
+func (p *lruPolicy) touch(e *localEntry) {
+	p.list.MoveToFront(e.elem)
+}
+
+func (p *lruPolicy) remove(e *localEntry) {
+	p.list.Remove(e.elem)
+}
+
+func (p *lruPolicy) evict() *localEntry {
+	return p.list.Back().Value.(*localEntry)
+}
+
+// lfuPolicy evicts the least frequently used entry with dynamic aging(LFU-DA).
+// Note:
+//  The age is raised to the frequency of the evicted entry, and the new entry starts from it,
+//  so the entries that were hot long ago are evicted eventually.
+type lfuPolicy struct {
+	heap lfuHeap
+	age  int
+}
+
+func (p *lfuPolicy) add(e *localEntry) {
+	e.freq = p.age + 1
+	heap.Push(&p.heap, e)
+}
+
+func (p *lfuPolicy) touch(e *localEntry) {
+	e.freq++
+	heap.Fix(&p.heap, e.index)
+}
+
+func (p *lfuPolicy) remove(e *localEntry) {
+	heap.Remove(&p.heap, e.index)
+}
+
+func (p *lfuPolicy) evict() *localEntry {
+	e := p.heap[0]
+	p.age = e.freq
+	return e
+}
+
+// lfuHeap a min-heap of the frequency
+type lfuHeap []*localEntry
+
+func (h lfuHeap) Len() int           { return len(h) }
+func (h lfuHeap) Less(i, j int) bool { return h[i].freq < h[j].freq }
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*localEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
@@ -0,0 +1,107 @@
+package redis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLocalCacheLRU(t *testing.T) {
+	l, err := NewLocalCache(nil, "", LocalCacheConfig{Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Set("a", []byte("1"), l.Version())
+	l.Set("b", []byte("2"), l.Version())
+	l.Get("a")
+	l.Set("c", []byte("3"), l.Version())
+	if _, ok := l.Get("b"); ok {
+		t.Fatal("expect the least recently used 'b' evicted")
+	}
+	if v, ok := l.Get("a"); !ok || string(v) != "1" {
+		t.Fatalf("expect 'a'=1, got %q", v)
+	}
+
+	// the value read before a deletion is not cached
+	version := l.Version()
+	l.Delete("c")
+	l.Set("c", []byte("stale"), version)
+	if _, ok := l.Get("c"); ok {
+		t.Fatal("expect the stale value not cached")
+	}
+	// the deletion of other keys does not stop caching
+	version = l.Version()
+	l.Delete("x")
+	l.Set("c", []byte("3"), version)
+	if v, ok := l.Get("c"); !ok || string(v) != "3" {
+		t.Fatalf("expect 'c'=3, got %q", v)
+	}
+	// the values read before purging are not cached
+	version = l.Version()
+	l.Purge()
+	l.Set("c", []byte("stale"), version)
+	if _, ok := l.Get("c"); ok {
+		t.Fatal("expect the value read before purging not cached")
+	}
+	// the tombstones are bounded
+	version = l.Version()
+	for _, key := range []string{"x", "y", "z"} {
+		l.Delete(key)
+	}
+	if len(l.tombs) > 2 {
+		t.Fatalf("expect at most 2 tombstones, got %d", len(l.tombs))
+	}
+	l.Set("c", []byte("stale"), version)
+	if _, ok := l.Get("c"); ok {
+		t.Fatal("expect the value read before forgetting the tombstones not cached")
+	}
+}
+
+func TestLocalCacheLFU(t *testing.T) {
+	l, err := NewLocalCache(nil, "", LocalCacheConfig{Size: 2, Policy: PolicyLFU, TTL: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Set("a", []byte("1"), l.Version())
+	l.Set("b", []byte("2"), l.Version())
+	l.Get("a")
+	l.Get("a")
+	l.Get("b")
+	l.Set("c", []byte("3"), l.Version())
+	if _, ok := l.Get("b"); ok {
+		t.Fatal("expect the least frequently used 'b' evicted")
+	}
+	if _, ok := l.Get("a"); !ok {
+		t.Fatal("expect 'a' cached")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := l.Get("a"); ok {
+		t.Fatal("expect 'a' expired")
+	}
+	if l.Len() != 1 {
+		t.Fatalf("expect 1 entry, got %d", l.Len())
+	}
+}
+
+func TestLocalCacheLFUAging(t *testing.T) {
+	l, err := NewLocalCache(nil, "", LocalCacheConfig{Size: 2, Policy: PolicyLFU})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Set("hot", []byte("1"), l.Version())
+	for i := 0; i < 10; i++ {
+		l.Get("hot")
+	}
+	// the new entries are admitted, and the entry that was hot long ago is evicted eventually
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("k%d", i)
+		l.Set(key, []byte("1"), l.Version())
+		if _, ok := l.Get(key); !ok {
+			t.Fatalf("expect %q cached", key)
+		}
+		l.Get(key)
+	}
+	if _, ok := l.Get("hot"); ok {
+		t.Fatal("expect 'hot' evicted by aging")
+	}
+}
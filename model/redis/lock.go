@@ -0,0 +1,368 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	mrand "math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+)
+
+var (
+	// ErrLockNotObtained the lock is held by others until the context is done
+	ErrLockNotObtained = errors.New("redis: lock not obtained")
+	// ErrLockNotHeld the lock is expired or held by others
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+// acquireScript sets the token if the key does not exist, and returns 1,
+// or the new fencing token if the counter lifetime ARGV[3] is not 0.
+var acquireScript = redis.NewScript(`
+if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	if ARGV[3] == "0" then
+		return 1
+	end
+	local fence = redis.call("incr", KEYS[2])
+	redis.call("pexpire", KEYS[2], ARGV[3])
+	return fence
+end
+return 0
+`)
+
+// refreshScript extends the lease if the token matches.
+var refreshScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the key if the token matches.
+var releaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// LockOptions the options of obtaining a lock
+type LockOptions struct {
+	// TTL the lease of the lock, default is 1 minute
+	TTL time.Duration
+	// AutoRenew extends the lease every TTL/3 until the lock is released
+	AutoRenew bool
+	// RetryInterval the interval of retrying to obtain the lock, default is 10ms with a random jitter
+	RetryInterval time.Duration
+	// Fencing increments the fencing token of the key when the lock is obtained, see Lock.Fence
+	Fencing bool
+	// FenceTTL the lifetime of the fencing counter after the last obtaining, default is 7 days;
+	// it must be longer than a stale holder may still write
+	FenceTTL time.Duration
+}
+
+func (o *LockOptions) check() *LockOptions {
+	var opts LockOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = 10 * time.Millisecond
+	}
+	if !opts.Fencing {
+		opts.FenceTTL = 0
+	} else if opts.FenceTTL <= 0 {
+		opts.FenceTTL = 7 * 24 * time.Hour
+	}
+	if opts.FenceTTL > 0 && opts.FenceTTL < opts.TTL {
+		opts.FenceTTL = opts.TTL
+	}
+	return &opts
+}
+
+// Locker obtains the distributed locks from one or more independent redis deployments.
+// Note:
+//  With one client, the lock is held by the SET NX of the key;
+//  With multiple clients, the Redlock algorithm is used, and the lock is held when the majority of them are locked.
+type Locker struct {
+	clients []*Client
+	quorum  int
+}
+
+// NewLocker creates a locker from one or more independent redis deployments.
+func NewLocker(clients ...*Client) *Locker {
+	if len(clients) == 0 {
+		panic("redis: NewLocker requires at least one client")
+	}
+	return &Locker{
+		clients: clients,
+		quorum:  len(clients)/2 + 1,
+	}
+}
+
+// Obtain obtains the lock of the key from the client, and retries until the context is done.
+func (c *Client) Obtain(ctx context.Context, key string, opts *LockOptions) (*Lock, error) {
+	return NewLocker(c).Obtain(ctx, key, opts)
+}
+
+// TryObtain obtains the lock of the key from the client without waiting.
+func (c *Client) TryObtain(key string, opts *LockOptions) (*Lock, error) {
+	return NewLocker(c).TryObtain(key, opts)
+}
+
+// Lock a distributed lock held with a unique token
+type Lock struct {
+	locker  *Locker
+	key     string
+	token   string
+	fence   int64
+	ttl     time.Duration
+	lost    chan struct{}
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Obtain obtains the lock of the key, and retries until the context is done.
+// Note:
+//  Returns ErrLockNotObtained if the lock is still held by others when the context is done.
+func (l *Locker) Obtain(ctx context.Context, key string, opts *LockOptions) (*Lock, error) {
+	opts = opts.check()
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		lock, err := l.tryObtain(key, token, opts)
+		if lock != nil || err != nil {
+			return lock, err
+		}
+		// NOTE: the jitter keeps the waiters from retrying at the same time
+		interval := opts.RetryInterval + time.Duration(mrand.Int63n(int64(opts.RetryInterval)))
+		select {
+		case <-ctx.Done():
+			return nil, ErrLockNotObtained
+		case <-time.After(interval):
+		}
+	}
+}
+
+// TryObtain obtains the lock of the key without waiting.
+// Note:
+//  Returns ErrLockNotObtained if the lock is held by others.
+func (l *Locker) TryObtain(key string, opts *LockOptions) (*Lock, error) {
+	opts = opts.check()
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	lock, err := l.tryObtain(key, token, opts)
+	if lock == nil && err == nil {
+		err = ErrLockNotObtained
+	}
+	return lock, err
+}
+
+// tryObtain returns nil lock and nil error if the lock is held by others.
+func (l *Locker) tryObtain(key, token string, opts *LockOptions) (*Lock, error) {
+	start := time.Now()
+	var (
+		n        int
+		fence    int64
+		firstErr error
+	)
+	keys := []string{key}
+	if opts.Fencing {
+		keys = append(keys, fenceKey(key))
+	}
+	for _, c := range l.clients {
+		f, err := acquireScript.Run(c, keys, token, int64(opts.TTL/time.Millisecond), int64(opts.FenceTTL/time.Millisecond)).Int64()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if f > 0 {
+			n++
+			if f > fence {
+				fence = f
+			}
+		}
+	}
+	// NOTE: the lease is shortened by the elapsed time and the clock drift of the nodes
+	validity := opts.TTL - time.Since(start) - opts.TTL/100 - 2*time.Millisecond
+	if n < l.quorum || validity <= 0 {
+		if n > 0 {
+			l.release(key, token)
+		}
+		if n == 0 && firstErr != nil && !IsRedisNil(firstErr) {
+			return nil, firstErr
+		}
+		return nil, nil
+	}
+	lock := &Lock{
+		locker: l,
+		key:    key,
+		token:  token,
+		fence:  fence,
+		ttl:    opts.TTL,
+		lost:   make(chan struct{}),
+	}
+	if opts.AutoRenew {
+		lock.stop = make(chan struct{})
+		lock.stopped = make(chan struct{})
+		go lock.renew()
+	}
+	return lock, nil
+}
+
+// release deletes the key of the token from all the clients, and returns the number of deleted keys.
+func (l *Locker) release(key, token string) (int, error) {
+	var (
+		n        int
+		firstErr error
+	)
+	for _, c := range l.clients {
+		i, err := releaseScript.Run(c, []string{key}, token).Int64()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		n += int(i)
+	}
+	return n, firstErr
+}
+
+// Key returns the locked key.
+func (lock *Lock) Key() string {
+	return lock.key
+}
+
+// Token returns the unique token of the holder.
+func (lock *Lock) Token() string {
+	return lock.token
+}
+
+// Fence returns the fencing token, which increases every time the key is locked with LockOptions.Fencing,
+// so the storage can reject the writes of a stale holder whose lease has expired.
+// Note:
+//  Without LockOptions.Fencing, it is always 1;
+//  The counter expires after LockOptions.FenceTTL without obtaining, and then restarts from 1;
+//  With multiple clients, it is the maximum of the counters of the locked nodes,
+//  which is increasing only if the majority of the nodes keep their counters.
+func (lock *Lock) Fence() int64 {
+	return lock.fence
+}
+
+// Lost returns a channel that is closed when the auto-renewal finds the lock expired or held by others.
+func (lock *Lock) Lost() <-chan struct{} {
+	return lock.lost
+}
+
+// Refresh extends the lease of the lock to ttl.
+// Note:
+//  Returns ErrLockNotHeld if the lock is expired or held by others.
+func (lock *Lock) Refresh(ttl time.Duration) error {
+	var (
+		n        int
+		firstErr error
+	)
+	for _, c := range lock.locker.clients {
+		i, err := refreshScript.Run(c, []string{lock.key}, lock.token, int64(ttl/time.Millisecond)).Int64()
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		n += int(i)
+	}
+	if n >= lock.locker.quorum {
+		return nil
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	return ErrLockNotHeld
+}
+
+// Release stops the auto-renewal and deletes the lock if it is still held.
+// Note:
+//  Returns ErrLockNotHeld if the lock is expired or held by others.
+func (lock *Lock) Release() error {
+	lock.once.Do(func() {
+		if lock.stop != nil {
+			close(lock.stop)
+			<-lock.stopped
+		}
+	})
+	n, err := lock.locker.release(lock.key, lock.token)
+	if n >= lock.locker.quorum {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return ErrLockNotHeld
+}
+
+func (lock *Lock) renew() {
+	defer close(lock.stopped)
+	interval := lock.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(lock.ttl)
+	for {
+		select {
+		case <-lock.stop:
+			return
+		case <-ticker.C:
+		}
+		err := lock.Refresh(lock.ttl)
+		if err == nil {
+			deadline = time.Now().Add(lock.ttl)
+			continue
+		}
+		// NOTE: retry the temporary errors until the lease expires
+		if err == ErrLockNotHeld || time.Now().After(deadline) {
+			lock.setLost()
+			return
+		}
+	}
+}
+
+func (lock *Lock) setLost() {
+	select {
+	case <-lock.lost:
+	default:
+		close(lock.lost)
+	}
+}
+
+// fenceKey returns the key of the fencing counter, which is in the same cluster slot as the lock key.
+func fenceKey(key string) string {
+	if i := strings.IndexByte(key, '{'); i >= 0 {
+		if j := strings.IndexByte(key[i+1:], '}'); j > 0 {
+			return key + ":fence"
+		}
+	}
+	return "{" + key + "}:fence"
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,81 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFenceKey(t *testing.T) {
+	cases := map[string]string{
+		"lock":         "{lock}:fence",
+		"{user}:lock":  "{user}:lock:fence",
+		"{}lock":       "{{}lock}:fence",
+		"a{b":          "{a{b}:fence",
+		"x:{user}:123": "x:{user}:123:fence",
+	}
+	for key, want := range cases {
+		if got := fenceKey(key); got != want {
+			t.Fatalf("fenceKey(%q): expect %q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	cfg, err := ReadConfig("test_redis")
+	if err != nil {
+		t.Fatal("ReadConfig(\"test_redis\")", err)
+	}
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal("NewClient(\"test_redis\")", err)
+	}
+	key := NewModule("test").Key("a_lock")
+
+	lock, err := c.TryObtain(key, &LockOptions{TTL: 300 * time.Millisecond, AutoRenew: true, Fencing: true})
+	if err != nil {
+		t.Fatal("c.TryObtain() error:", err)
+	}
+	if _, err = c.TryObtain(key, nil); err != ErrLockNotObtained {
+		t.Fatalf("c.TryObtain() when locked: expect ErrLockNotObtained, got %v", err)
+	}
+	// the lease is renewed after the TTL
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	_, err = c.Obtain(ctx, key, nil)
+	cancel()
+	if err != ErrLockNotObtained {
+		t.Fatalf("c.Obtain() when renewed: expect ErrLockNotObtained, got %v", err)
+	}
+	if err = lock.Release(); err != nil {
+		t.Fatal("lock.Release() error:", err)
+	}
+	if err = lock.Release(); err != ErrLockNotHeld {
+		t.Fatalf("lock.Release() again: expect ErrLockNotHeld, got %v", err)
+	}
+
+	lock2, err := c.Obtain(context.Background(), key, &LockOptions{TTL: 100 * time.Millisecond, Fencing: true})
+	if err != nil {
+		t.Fatal("c.Obtain() error:", err)
+	}
+	if lock2.Fence() <= lock.Fence() {
+		t.Fatalf("expect increasing fence, got %d after %d", lock2.Fence(), lock.Fence())
+	}
+	// the expired lock does not delete the lock of others
+	time.Sleep(200 * time.Millisecond)
+	lock3, err := c.TryObtain(key, nil)
+	if err != nil {
+		t.Fatal("c.TryObtain() after expired error:", err)
+	}
+	if lock3.Fence() != 1 {
+		t.Fatalf("expect fence 1 without fencing, got %d", lock3.Fence())
+	}
+	if ttl := c.PTTL(fenceKey(key)).Val(); ttl <= 0 {
+		t.Fatalf("expect the fencing counter expires, got ttl %s", ttl)
+	}
+	if err = lock2.Release(); err != ErrLockNotHeld {
+		t.Fatalf("expired lock.Release(): expect ErrLockNotHeld, got %v", err)
+	}
+	if err = lock3.Release(); err != nil {
+		t.Fatal("lock.Release() error:", err)
+	}
+}
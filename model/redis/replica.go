@@ -0,0 +1,360 @@
+package redis
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/henrylee2cn/erpc/v6"
+)
+
+// replicaRefreshInterval the interval of refreshing the healthy replicas
+var replicaRefreshInterval = 10 * time.Second
+
+// replicaClient a single node or sentinel client that routes the read-only commands to the replicas.
+// Note:
+//  The writes, scans, scripts, transactions and pipelines are still sent to the master;
+//  The replicas are asynchronously replicated, so the reads may be stale;
+//  If no replica is healthy, or the replica has a network error, reads from the master.
+type replicaClient struct {
+	*redis.Client
+	discover func() ([]string, error)
+	newNode  func(addr string) *redis.Client
+	nodes    atomic.Value // []*redis.Client
+	all      map[string]*redis.Client
+	next     uint32
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newReplicaClient(master *redis.Client, discover func() ([]string, error), newNode func(addr string) *redis.Client) *replicaClient {
+	c := &replicaClient{
+		Client:   master,
+		discover: discover,
+		newNode:  newNode,
+		all:      make(map[string]*redis.Client),
+		closed:   make(chan struct{}),
+	}
+	c.nodes.Store([]*redis.Client{})
+	c.refresh()
+	go c.loop()
+	return c
+}
+
+func (c *replicaClient) loop() {
+	ticker := time.NewTicker(replicaRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closed:
+			for _, node := range c.all {
+				node.Close()
+			}
+			return
+		case <-ticker.C:
+			c.refresh()
+		}
+	}
+}
+
+// refresh pings the replicas, and keeps the healthy ones.
+func (c *replicaClient) refresh() {
+	addrs, err := c.discover()
+	if err != nil {
+		erpc.Warnf("redis: discover replicas failed: %s", err.Error())
+		return
+	}
+	healthy := make([]*redis.Client, 0, len(addrs))
+	found := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		found[addr] = true
+		node, ok := c.all[addr]
+		if !ok {
+			node = c.newNode(addr)
+			c.all[addr] = node
+		}
+		if err := node.Ping().Err(); err != nil {
+			erpc.Warnf("redis: ping replica %s failed: %s", addr, err.Error())
+			continue
+		}
+		healthy = append(healthy, node)
+	}
+	c.nodes.Store(healthy)
+	for addr, node := range c.all {
+		if !found[addr] {
+			delete(c.all, addr)
+			node.Close()
+		}
+	}
+}
+
+// replica returns the next healthy replica, or nil if there is none.
+func (c *replicaClient) replica() *redis.Client {
+	nodes := c.nodes.Load().([]*redis.Client)
+	if len(nodes) == 0 {
+		return nil
+	}
+	return nodes[atomic.AddUint32(&c.next, 1)%uint32(len(nodes))]
+}
+
+// read runs the command on a replica, and falls back to the master on the network errors.
+func (c *replicaClient) read(fn func(redis.Cmdable) redis.Cmder) redis.Cmder {
+	if r := c.replica(); r != nil {
+		cmd := fn(r)
+		if !isNetworkError(cmd.Err()) {
+			return cmd
+		}
+	}
+	return fn(c.Client)
+}
+
+// Close stops refreshing the replicas, and closes the master and the replicas.
+func (c *replicaClient) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Client.Close()
+}
+
+func isNetworkError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	// NOTE: the replica is loading the dataset from the master
+	return strings.HasPrefix(err.Error(), "LOADING ")
+}
+
+// sentinelReplicas returns the addresses of the replicas that are online and synchronized with the master.
+func sentinelReplicas(sentinel *redis.SentinelClient, masterName string) ([]string, error) {
+	slaves, err := sentinel.Slaves(masterName).Result()
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, slave := range slaves {
+		vals, ok := slave.([]interface{})
+		if !ok {
+			continue
+		}
+		info := make(map[string]string, len(vals)/2)
+		for i := 0; i+1 < len(vals); i += 2 {
+			k, _ := vals[i].(string)
+			v, _ := vals[i+1].(string)
+			info[k] = v
+		}
+		if strings.Contains(info["flags"], "s_down") ||
+			strings.Contains(info["flags"], "o_down") ||
+			strings.Contains(info["flags"], "disconnected") ||
+			info["master-link-status"] != "ok" {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(info["ip"], info["port"]))
+	}
+	return addrs, nil
+}
+
+// The read-only commands routed to the replicas.
+
+func (c *replicaClient) Exists(keys ...string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.Exists(keys...) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) PTTL(key string) *redis.DurationCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.PTTL(key) }).(*redis.DurationCmd)
+}
+
+func (c *replicaClient) TTL(key string) *redis.DurationCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.TTL(key) }).(*redis.DurationCmd)
+}
+
+func (c *replicaClient) Type(key string) *redis.StatusCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.Type(key) }).(*redis.StatusCmd)
+}
+
+func (c *replicaClient) BitCount(key string, bitCount *redis.BitCount) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.BitCount(key, bitCount) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) Get(key string) *redis.StringCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.Get(key) }).(*redis.StringCmd)
+}
+
+func (c *replicaClient) GetBit(key string, offset int64) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.GetBit(key, offset) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) GetRange(key string, start, end int64) *redis.StringCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.GetRange(key, start, end) }).(*redis.StringCmd)
+}
+
+func (c *replicaClient) MGet(keys ...string) *redis.SliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.MGet(keys...) }).(*redis.SliceCmd)
+}
+
+func (c *replicaClient) StrLen(key string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.StrLen(key) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) HExists(key, field string) *redis.BoolCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.HExists(key, field) }).(*redis.BoolCmd)
+}
+
+func (c *replicaClient) HGet(key, field string) *redis.StringCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.HGet(key, field) }).(*redis.StringCmd)
+}
+
+func (c *replicaClient) HGetAll(key string) *redis.StringStringMapCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.HGetAll(key) }).(*redis.StringStringMapCmd)
+}
+
+func (c *replicaClient) HKeys(key string) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.HKeys(key) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) HLen(key string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.HLen(key) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) HMGet(key string, fields ...string) *redis.SliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.HMGet(key, fields...) }).(*redis.SliceCmd)
+}
+
+func (c *replicaClient) HVals(key string) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.HVals(key) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) LIndex(key string, index int64) *redis.StringCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.LIndex(key, index) }).(*redis.StringCmd)
+}
+
+func (c *replicaClient) LLen(key string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.LLen(key) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) LRange(key string, start, stop int64) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.LRange(key, start, stop) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) SCard(key string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SCard(key) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) SDiff(keys ...string) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SDiff(keys...) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) SInter(keys ...string) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SInter(keys...) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) SIsMember(key string, member interface{}) *redis.BoolCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SIsMember(key, member) }).(*redis.BoolCmd)
+}
+
+func (c *replicaClient) SMembers(key string) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SMembers(key) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) SMembersMap(key string) *redis.StringStructMapCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SMembersMap(key) }).(*redis.StringStructMapCmd)
+}
+
+func (c *replicaClient) SRandMember(key string) *redis.StringCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SRandMember(key) }).(*redis.StringCmd)
+}
+
+func (c *replicaClient) SRandMemberN(key string, count int64) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SRandMemberN(key, count) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) SUnion(keys ...string) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.SUnion(keys...) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) ZCard(key string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZCard(key) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) ZCount(key, min, max string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZCount(key, min, max) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) ZLexCount(key, min, max string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZLexCount(key, min, max) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) ZRange(key string, start, stop int64) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRange(key, start, stop) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) ZRangeWithScores(key string, start, stop int64) *redis.ZSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRangeWithScores(key, start, stop) }).(*redis.ZSliceCmd)
+}
+
+func (c *replicaClient) ZRangeByScore(key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRangeByScore(key, opt) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) ZRangeByLex(key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRangeByLex(key, opt) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) ZRangeByScoreWithScores(key string, opt *redis.ZRangeBy) *redis.ZSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRangeByScoreWithScores(key, opt) }).(*redis.ZSliceCmd)
+}
+
+func (c *replicaClient) ZRank(key, member string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRank(key, member) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) ZRevRange(key string, start, stop int64) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRevRange(key, start, stop) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) ZRevRangeWithScores(key string, start, stop int64) *redis.ZSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRevRangeWithScores(key, start, stop) }).(*redis.ZSliceCmd)
+}
+
+func (c *replicaClient) ZRevRangeByScore(key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRevRangeByScore(key, opt) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) ZRevRangeByLex(key string, opt *redis.ZRangeBy) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRevRangeByLex(key, opt) }).(*redis.StringSliceCmd)
+}
+
+func (c *replicaClient) ZRevRangeByScoreWithScores(key string, opt *redis.ZRangeBy) *redis.ZSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRevRangeByScoreWithScores(key, opt) }).(*redis.ZSliceCmd)
+}
+
+func (c *replicaClient) ZRevRank(key, member string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZRevRank(key, member) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) ZScore(key, member string) *redis.FloatCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.ZScore(key, member) }).(*redis.FloatCmd)
+}
+
+func (c *replicaClient) PFCount(keys ...string) *redis.IntCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.PFCount(keys...) }).(*redis.IntCmd)
+}
+
+func (c *replicaClient) GeoPos(key string, members ...string) *redis.GeoPosCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.GeoPos(key, members...) }).(*redis.GeoPosCmd)
+}
+
+func (c *replicaClient) GeoDist(key string, member1, member2, unit string) *redis.FloatCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.GeoDist(key, member1, member2, unit) }).(*redis.FloatCmd)
+}
+
+func (c *replicaClient) GeoHash(key string, members ...string) *redis.StringSliceCmd {
+	return c.read(func(r redis.Cmdable) redis.Cmder { return r.GeoHash(key, members...) }).(*redis.StringSliceCmd)
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-redis/redis/v7"
+)
+
+// fakeNode a minimal RESP server that answers PING, GET and SET, and records the commands.
+type fakeNode struct {
+	ln    net.Listener
+	value string
+	cmds  []string
+	mu    sync.Mutex
+}
+
+func newFakeNode(t *testing.T, value string) *fakeNode {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &fakeNode{ln: ln, value: value}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(conn)
+		}
+	}()
+	return n
+}
+
+func (n *fakeNode) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		argc, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, argc)
+		for i := range args {
+			r.ReadString('\n')
+			arg, _ := r.ReadString('\n')
+			args[i] = strings.TrimSpace(arg)
+		}
+		cmd := strings.ToLower(args[0])
+		n.mu.Lock()
+		n.cmds = append(n.cmds, cmd)
+		n.mu.Unlock()
+		switch cmd {
+		case "ping":
+			conn.Write([]byte("+PONG\r\n"))
+		case "get":
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(n.value), n.value)
+		default:
+			conn.Write([]byte("+OK\r\n"))
+		}
+	}
+}
+
+func (n *fakeNode) count(cmd string) int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var i int
+	for _, c := range n.cmds {
+		if c == cmd {
+			i++
+		}
+	}
+	return i
+}
+
+func TestReplicaClient(t *testing.T) {
+	master := newFakeNode(t, "master")
+	defer master.ln.Close()
+	replica := newFakeNode(t, "replica")
+	addrs := []string{replica.ln.Addr().String()}
+
+	cfg := NewConfig()
+	cfg.ReadOnly = true
+	c := newReplicaClient(redis.NewClient(cfg.nodeOptions(master.ln.Addr().String())), func() ([]string, error) {
+		return addrs, nil
+	}, cfg.newNode)
+	defer c.Close()
+
+	if v := c.Get("a").Val(); v != "replica" {
+		t.Fatalf("Get: expect reading from replica, got %q", v)
+	}
+	if err := c.Set("a", "b", 0).Err(); err != nil {
+		t.Fatal(err)
+	}
+	if master.count("set") != 1 || replica.count("set") != 0 {
+		t.Fatal("Set: expect writing to master")
+	}
+
+	// falls back to the master when the replica is down
+	replica.ln.Close()
+	c.nodes.Load().([]*redis.Client)[0].Close()
+	c.nodes.Store([]*redis.Client{c.newNode(replica.ln.Addr().String())})
+	if v := c.Get("a").Val(); v != "master" {
+		t.Fatalf("Get: expect falling back to master, got %q", v)
+	}
+
+	// the unhealthy replica is removed
+	c.refresh()
+	if len(c.nodes.Load().([]*redis.Client)) != 0 {
+		t.Fatal("refresh: expect no healthy replica")
+	}
+}
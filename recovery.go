@@ -0,0 +1,330 @@
+// Copyright 2018 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/goutil"
+)
+
+type (
+	// CrashReport the information of a recovered handler panic
+	CrashReport struct {
+		ID            string    `json:"id"`
+		Time          time.Time `json:"time"`
+		ServiceMethod string    `json:"service_method"`
+		SessionID     string    `json:"session_id,omitempty"`
+		RealIP        string    `json:"real_ip,omitempty"`
+		Panic         string    `json:"panic"`
+		Stack         string    `json:"stack"`
+	}
+	// CrashReporter reports the recovered handler panic.
+	CrashReporter interface {
+		Report(*CrashReport) error
+	}
+	// RecoveryPlugin a plugin that catches handler panics,
+	// replies RerrInternalServerError with a correlation ID in the cause,
+	// and sends the crash report to the reporters in the background.
+	RecoveryPlugin struct {
+		reporters []CrashReporter
+		queue     chan *CrashReport
+		pending   sync.WaitGroup
+		startOnce sync.Once
+		closeMu   sync.RWMutex
+		closed    bool
+	}
+	// RecoveryConfig the crash reporters config
+	RecoveryConfig struct {
+		File           string        `yaml:"file"            ini:"file"            comment:"The file that the crash reports are appended to, one JSON object per line; if empty, disable it"`
+		Webhook        string        `yaml:"webhook"         ini:"webhook"         comment:"The URL that the crash reports are posted to as JSON; if empty, disable it"`
+		WebhookTimeout time.Duration `yaml:"webhook_timeout" ini:"webhook_timeout" comment:"The timeout of posting to the webhook, default 5s; ns,µs,ms,s,m,h"`
+	}
+)
+
+// crashQueueSize the max number of the crash reports waiting to be reported
+const crashQueueSize = 256
+
+var (
+	_ PreClosePlugin = new(RecoveryPlugin)
+	// crashFlushTimeout the max time to wait for the queued crash reports before closing
+	crashFlushTimeout = 5 * time.Second
+)
+
+// Reporters returns the configured crash reporters.
+func (r *RecoveryConfig) Reporters() []CrashReporter {
+	var reporters []CrashReporter
+	if len(r.File) > 0 {
+		reporters = append(reporters, NewFileReporter(r.File))
+	}
+	if len(r.Webhook) > 0 {
+		reporters = append(reporters, NewWebhookReporter(r.Webhook, r.WebhookTimeout))
+	}
+	return reporters
+}
+
+// NewRecoveryPlugin creates a handler panic recovery plugin.
+// Note:
+//  If no reporter is specified, the crash is only logged;
+//  NewServer registers one by SrvConfig.Recovery if no RecoveryPlugin is specified;
+//  erpc has no hook around the handler, so the handlers defer GuardCall or GuardPush to be recovered,
+//  as the handlers generated by micro gen do:
+//
+//   func (m *Math) Divide(arg *Arg) (reply *Result, stat *erpc.Status) {
+//   	defer micro.GuardCall(m.CallCtx, &stat)
+//   	...
+//   }
+//
+func NewRecoveryPlugin(reporter ...CrashReporter) *RecoveryPlugin {
+	return &RecoveryPlugin{
+		reporters: reporter,
+		queue:     make(chan *CrashReport, crashQueueSize),
+	}
+}
+
+// Name returns name.
+func (r *RecoveryPlugin) Name() string {
+	return "recovery"
+}
+
+// PreClose stops queuing the crash reports,
+// and waits for the queued ones to be reported, at most 5s.
+// Note:
+//  The crashes recovered after closing are only logged.
+func (r *RecoveryPlugin) PreClose() error {
+	r.closeMu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.closeMu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(crashFlushTimeout):
+		return fmt.Errorf("timeout waiting for %d crash reports", len(r.queue))
+	}
+}
+
+// GuardCall recovers the panic of the CALL handler by the RecoveryPlugin of the peer, and sets the reply status.
+// Note:
+//  It must be deferred directly by the handler, and stat must point to the named status result;
+//  If the peer has no RecoveryPlugin, the crash is only logged.
+func GuardCall(ctx erpc.CallCtx, stat **erpc.Status) {
+	if p := recover(); p != nil {
+		*stat = recoveryOf(ctx.Peer()).recoverCtx(ctx, p)
+	}
+}
+
+// GuardPush recovers the panic of the PUSH handler by the RecoveryPlugin of the peer, and sets the status.
+// Note:
+//  It must be deferred directly by the handler, and stat must point to the named status result;
+//  If the peer has no RecoveryPlugin, the crash is only logged.
+func GuardPush(ctx erpc.PushCtx, stat **erpc.Status) {
+	if p := recover(); p != nil {
+		*stat = recoveryOf(ctx.Peer()).recoverCtx(ctx, p)
+	}
+}
+
+// logRecovery the recovery of the peers without RecoveryPlugin, which only logs the crashes
+var logRecovery = NewRecoveryPlugin()
+
+// recoveryOf returns the RecoveryPlugin of the peer.
+func recoveryOf(peer erpc.Peer) *RecoveryPlugin {
+	if r, ok := peer.PluginContainer().GetByName("recovery").(*RecoveryPlugin); ok {
+		return r
+	}
+	return logRecovery
+}
+
+// GuardCall recovers the panic of the CALL handler, and sets the reply status.
+// Note:
+//  It must be deferred directly by the handler, and stat must point to the named status result.
+func (r *RecoveryPlugin) GuardCall(ctx erpc.CallCtx, stat **erpc.Status) {
+	if p := recover(); p != nil {
+		*stat = r.recoverCtx(ctx, p)
+	}
+}
+
+// GuardPush recovers the panic of the PUSH handler, and sets the status.
+// Note:
+//  It must be deferred directly by the handler, and stat must point to the named status result.
+func (r *RecoveryPlugin) GuardPush(ctx erpc.PushCtx, stat **erpc.Status) {
+	if p := recover(); p != nil {
+		*stat = r.recoverCtx(ctx, p)
+	}
+}
+
+// WrapUnknownCall wraps the unknown CALL handler so that its panic can be recovered and reported.
+func (r *RecoveryPlugin) WrapUnknownCall(fn func(erpc.UnknownCallCtx) (interface{}, *erpc.Status)) func(erpc.UnknownCallCtx) (interface{}, *erpc.Status) {
+	return func(ctx erpc.UnknownCallCtx) (reply interface{}, stat *erpc.Status) {
+		defer func() {
+			if p := recover(); p != nil {
+				reply, stat = nil, r.recoverCtx(ctx, p)
+			}
+		}()
+		return fn(ctx)
+	}
+}
+
+// WrapUnknownPush wraps the unknown PUSH handler so that its panic can be recovered and reported.
+func (r *RecoveryPlugin) WrapUnknownPush(fn func(erpc.UnknownPushCtx) *erpc.Status) func(erpc.UnknownPushCtx) *erpc.Status {
+	return func(ctx erpc.UnknownPushCtx) (stat *erpc.Status) {
+		defer func() {
+			if p := recover(); p != nil {
+				stat = r.recoverCtx(ctx, p)
+			}
+		}()
+		return fn(ctx)
+	}
+}
+
+type recoverCtx interface {
+	ServiceMethod() string
+	RealIP() string
+	Session() erpc.CtxSession
+}
+
+func (r *RecoveryPlugin) recoverCtx(ctx recoverCtx, p interface{}) *erpc.Status {
+	return r.Recover(p, ctx.ServiceMethod(), ctx.Session().ID(), ctx.RealIP())
+}
+
+// Recover reports the recovered panic value p, and returns the reply status.
+// Note:
+//  It must be called in the deferred function that recovers p, so that the stack can be captured;
+//  The report is dropped if the queue of the reporters is full.
+func (r *RecoveryPlugin) Recover(p interface{}, serviceMethod, sessionID, realIP string) *erpc.Status {
+	report := &CrashReport{
+		ID:            goutil.URLRandomString(16),
+		Time:          time.Now(),
+		ServiceMethod: serviceMethod,
+		SessionID:     sessionID,
+		RealIP:        realIP,
+		Panic:         fmt.Sprint(p),
+		Stack:         string(goutil.PanicTrace(4)),
+	}
+	erpc.Errorf("[%s] crash(id:%s): %s %s\n%s", r.Name(), report.ID, report.ServiceMethod, report.Panic, report.Stack)
+	r.closeMu.RLock()
+	defer r.closeMu.RUnlock()
+	if len(r.reporters) > 0 && !r.closed {
+		r.startOnce.Do(func() { go r.report() })
+		r.pending.Add(1)
+		select {
+		case r.queue <- report:
+		default:
+			r.pending.Done()
+			erpc.Errorf("[%s] drop crash(id:%s) report: the queue is full", r.Name(), report.ID)
+		}
+	}
+	return RerrInternalServerError.Copy(fmt.Sprintf(`{"correlation_id": %q}`, report.ID))
+}
+
+func (r *RecoveryPlugin) report() {
+	for report := range r.queue {
+		for _, reporter := range r.reporters {
+			if err := reporter.Report(report); err != nil {
+				erpc.Errorf("[%s] report crash(id:%s) error: %v", r.Name(), report.ID, err)
+			}
+		}
+		r.pending.Done()
+	}
+}
+
+// FileReporter appends crash reports to a file, one JSON object per line.
+type FileReporter struct {
+	filename string
+	mu       sync.Mutex
+}
+
+var _ CrashReporter = new(FileReporter)
+
+// NewFileReporter creates a crash reporter that appends JSON lines to the file.
+func NewFileReporter(filename string) *FileReporter {
+	return &FileReporter{filename: filename}
+}
+
+// Report appends the crash report to the file.
+func (f *FileReporter) Report(report *CrashReport) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err = os.MkdirAll(filepath.Dir(f.filename), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(b)
+	if err1 := file.Close(); err == nil {
+		err = err1
+	}
+	return err
+}
+
+// WebhookReporter posts crash reports to a webhook URL as JSON.
+type WebhookReporter struct {
+	url    string
+	client *http.Client
+}
+
+var _ CrashReporter = new(WebhookReporter)
+
+// NewWebhookReporter creates a crash reporter that posts JSON to the URL.
+// Note:
+//  If timeout<=0, the default value(5s) is used.
+func NewWebhookReporter(url string, timeout time.Duration) *WebhookReporter {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &WebhookReporter{
+		url:    url,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Report posts the crash report to the webhook.
+func (w *WebhookReporter) Report(report *CrashReport) error {
+	b, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook response status: %s", resp.Status)
+	}
+	return nil
+}
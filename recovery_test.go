@@ -0,0 +1,145 @@
+package micro
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+)
+
+var recovery *RecoveryPlugin
+
+func panicHandler(ctx erpc.CallCtx, arg *int) (reply int, stat *erpc.Status) {
+	defer GuardCall(ctx, &stat)
+	panic("boom")
+}
+
+func TestRecoveryPlugin(t *testing.T) {
+	reports := make(chan *CrashReport, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report CrashReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("webhook decode error: %v", err)
+		}
+		reports <- &report
+	}))
+	defer webhook.Close()
+	dir, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "crash.log")
+
+	recovery = NewRecoveryPlugin(
+		NewFileReporter(filename),
+		NewWebhookReporter(webhook.URL, time.Second),
+	)
+	srv := NewServer(SrvConfig{
+		ListenAddress: "127.0.0.1:9096",
+	}, recovery)
+	srv.RouteCallFunc(panicHandler)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewClient(CliConfig{}, NewStaticLinker("127.0.0.1:9096"))
+	defer cli.Close()
+	var reply int
+	stat := cli.Call("/panic_handler", 1, &reply).Status()
+	if stat.Code() != RerrInternalServerError.Code() || stat.Msg() != RerrInternalServerError.Msg() {
+		t.Fatalf("unexpected status: %v", stat)
+	}
+
+	var report *CrashReport
+	select {
+	case report = <-reports:
+	case <-time.After(3 * time.Second):
+		t.Fatal("webhook reporter timeout")
+	}
+	if report.Panic != "boom" || report.ServiceMethod != "/panic_handler" || report.Stack == "" {
+		t.Fatalf("unexpected crash report: %+v", report)
+	}
+	if !strings.Contains(stat.Cause().Error(), report.ID) {
+		t.Fatalf("correlation ID %q is not in the cause: %v", report.ID, stat.Cause())
+	}
+	if err = recovery.PreClose(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), report.ID) {
+		t.Fatalf("file reporter content: %s", b)
+	}
+}
+
+type blockReporter chan struct{}
+
+func (b blockReporter) Report(*CrashReport) error {
+	<-b
+	return nil
+}
+
+func TestRecoveryQueue(t *testing.T) {
+	block := make(blockReporter)
+	r := NewRecoveryPlugin(block)
+	start := time.Now()
+	for i := 0; i < crashQueueSize+10; i++ {
+		r.Recover("boom", "/test", "", "")
+	}
+	if cost := time.Since(start); cost > time.Second {
+		t.Fatalf("the slow reporter blocks the handler: %s", cost)
+	}
+	close(block)
+	if err := r.PreClose(); err != nil {
+		t.Fatal(err)
+	}
+	if stat := r.Recover("boom", "/test", "", ""); stat.Code() != RerrInternalServerError.Code() {
+		t.Fatalf("unexpected status after closing: %v", stat)
+	}
+	if err := r.PreClose(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoveryConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "crash.log")
+
+	srv := NewServer(SrvConfig{
+		ListenAddress: "127.0.0.1:9097",
+		Recovery:      RecoveryConfig{File: filename},
+	})
+	srv.RouteCallFunc(panicHandler)
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+
+	cli := NewClient(CliConfig{}, NewStaticLinker("127.0.0.1:9097"))
+	defer cli.Close()
+	var reply int
+	stat := cli.Call("/panic_handler", 1, &reply).Status()
+	if stat.Code() != RerrInternalServerError.Code() {
+		t.Fatalf("unexpected status: %v", stat)
+	}
+	srv.Close()
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"panic":"boom"`) {
+		t.Fatalf("file reporter content: %s", b)
+	}
+}
@@ -15,15 +15,22 @@
 package micro
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
+	"os"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/henrylee2cn/cfgo"
 	"github.com/henrylee2cn/erpc/v6"
 	"github.com/henrylee2cn/erpc/v6/plugin/binder"
 	"github.com/henrylee2cn/erpc/v6/plugin/heartbeat"
+	"github.com/henrylee2cn/erpc/v6/proto/httproto"
+	"github.com/henrylee2cn/erpc/v6/proto/jsonproto"
+	"github.com/henrylee2cn/erpc/v6/proto/pbproto"
+	"github.com/henrylee2cn/erpc/v6/proto/rawproto"
 )
 
 // SrvConfig server config
@@ -31,17 +38,76 @@ import (
 //  yaml tag is used for github.com/henrylee2cn/cfgo
 //  ini tag is used for github.com/henrylee2cn/ini
 type SrvConfig struct {
-	Network           string        `yaml:"network"              ini:"network"              comment:"Network; tcp, tcp4, tcp6, unix or unixpacket"`
-	ListenAddress     string        `yaml:"listen_address"       ini:"listen_address"       comment:"Listen address; for server role"`
-	TlsCertFile       string        `yaml:"tls_cert_file"        ini:"tls_cert_file"        comment:"TLS certificate file path"`
-	TlsKeyFile        string        `yaml:"tls_key_file"         ini:"tls_key_file"         comment:"TLS key file path"`
-	DefaultSessionAge time.Duration `yaml:"default_session_age"  ini:"default_session_age"  comment:"Default session max age, if less than or equal to 0, no time limit; ns,µs,ms,s,m,h"`
-	DefaultContextAge time.Duration `yaml:"default_context_age"  ini:"default_context_age"  comment:"Default CALL or PUSH context max age, if less than or equal to 0, no time limit; ns,µs,ms,s,m,h"`
-	SlowCometDuration time.Duration `yaml:"slow_comet_duration"  ini:"slow_comet_duration"  comment:"Slow operation alarm threshold; ns,µs,ms,s ..."`
-	DefaultBodyCodec  string        `yaml:"default_body_codec"   ini:"default_body_codec"   comment:"Default body codec type id"`
-	PrintDetail       bool          `yaml:"print_detail"         ini:"print_detail"         comment:"Is print body and metadata or not"`
-	CountTime         bool          `yaml:"count_time"           ini:"count_time"           comment:"Is count cost time or not"`
-	EnableHeartbeat   bool          `yaml:"enable_heartbeat"     ini:"enable_heartbeat"     comment:"enable heartbeat"`
+	Network           string           `yaml:"network"              ini:"network"              comment:"Network; tcp, tcp4, tcp6, unix or unixpacket"`
+	ListenAddress     string           `yaml:"listen_address"       ini:"listen_address"       comment:"Listen address; for server role"`
+	TlsCertFile       string           `yaml:"tls_cert_file"        ini:"tls_cert_file"        comment:"TLS certificate file path"`
+	TlsKeyFile        string           `yaml:"tls_key_file"         ini:"tls_key_file"         comment:"TLS key file path"`
+	TlsCaFile         string           `yaml:"tls_ca_file"          ini:"tls_ca_file"          comment:"TLS CA bundle file path, used to verify client certificate"`
+	TlsClientAuth     string           `yaml:"tls_client_auth"      ini:"tls_client_auth"      comment:"TLS client certificate verification mode; none, request or require"`
+	TlsAllowedPeers   []string         `yaml:"tls_allowed_peers"    ini:"-"                    comment:"Allowed client identities (URI SAN, DNS SAN or CN), a trailing '*' matches by prefix; if empty, allow all verified clients"`
+	DefaultSessionAge time.Duration    `yaml:"default_session_age"  ini:"default_session_age"  comment:"Default session max age, if less than or equal to 0, no time limit; ns,µs,ms,s,m,h"`
+	DefaultContextAge time.Duration    `yaml:"default_context_age"  ini:"default_context_age"  comment:"Default CALL or PUSH context max age, if less than or equal to 0, no time limit; ns,µs,ms,s,m,h"`
+	SlowCometDuration time.Duration    `yaml:"slow_comet_duration"  ini:"slow_comet_duration"  comment:"Slow operation alarm threshold; ns,µs,ms,s ..."`
+	DefaultBodyCodec  string           `yaml:"default_body_codec"   ini:"default_body_codec"   comment:"Default body codec type id"`
+	PrintDetail       bool             `yaml:"print_detail"         ini:"print_detail"         comment:"Is print body and metadata or not"`
+	CountTime         bool             `yaml:"count_time"           ini:"count_time"           comment:"Is count cost time or not"`
+	EnableHeartbeat   bool             `yaml:"enable_heartbeat"     ini:"enable_heartbeat"     comment:"enable heartbeat"`
+	ExtraListeners    []ListenerConfig `yaml:"extra_listeners"      ini:"-"                    comment:"Extra listeners sharing the same router and plugins"`
+	HttpListenAddress string           `yaml:"http_listen_address"  ini:"http_listen_address"  comment:"HTTP/JSON transcoding endpoint listen address, which maps 'POST /uri/path' onto the local router and shares the TLS config of the server; if empty, disable it"`
+	Recovery          RecoveryConfig   `yaml:"recovery"             ini:"recovery"             comment:"Crash reporters of the recovered handler panics; if empty, the crashes are only logged"`
+}
+
+// ListenerConfig extra listener config
+type ListenerConfig struct {
+	Network       string `yaml:"network"         ini:"network"         comment:"Network; tcp, tcp4, tcp6, unix or unixpacket"`
+	ListenAddress string `yaml:"listen_address"  ini:"listen_address"  comment:"Listen address; the socket file path for unix or unixpacket"`
+	Proto         string `yaml:"proto"           ini:"proto"           comment:"Socket protocol; raw, json, pb or http; if empty, use the protocol of the main listener"`
+}
+
+// IsUnix returns whether the network is unix or unixpacket.
+func (l *ListenerConfig) IsUnix() bool {
+	return l.Network == "unix" || l.Network == "unixpacket"
+}
+
+func (l *ListenerConfig) protoFunc(defProtoFunc []erpc.ProtoFunc) ([]erpc.ProtoFunc, error) {
+	switch l.Proto {
+	case "":
+		return defProtoFunc, nil
+	case "raw":
+		return []erpc.ProtoFunc{rawproto.NewRawProtoFunc()}, nil
+	case "json":
+		return []erpc.ProtoFunc{jsonproto.NewJSONProtoFunc()}, nil
+	case "pb":
+		return []erpc.ProtoFunc{pbproto.NewPbProtoFunc()}, nil
+	case "http":
+		return []erpc.ProtoFunc{httproto.NewHTTProtoFunc()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported proto: %q", l.Proto)
+	}
+}
+
+func (l *ListenerConfig) listen(tlsConfig *tls.Config) (net.Listener, error) {
+	if l.IsUnix() {
+		os.Remove(l.ListenAddress)
+		return net.Listen(l.Network, l.ListenAddress)
+	}
+	addr, err := erpc.NewFakeAddr2(l.Network, l.ListenAddress)
+	if err != nil {
+		return nil, err
+	}
+	return erpc.NewInheritedListener(addr, tlsConfig)
+}
+
+// PostListenExtraPlugin is executed between listening and accepting of the extra listener.
+type PostListenExtraPlugin interface {
+	erpc.Plugin
+	PostListenExtra(addr net.Addr, proto string) error
+}
+
+// PreClosePlugin is executed before the server is closed by Close.
+type PreClosePlugin interface {
+	erpc.Plugin
+	PreClose() error
 }
 
 // Reload Bi-directionally synchronizes config between YAML file and memory.
@@ -53,6 +119,11 @@ func (s *SrvConfig) Reload(bind cfgo.BindFunc) error {
 	if len(s.ListenAddress) == 0 {
 		s.ListenAddress = "0.0.0.0:9090"
 	}
+	for i := range s.ExtraListeners {
+		if len(s.ExtraListeners[i].Network) == 0 {
+			s.ExtraListeners[i].Network = "tcp"
+		}
+	}
 	return err
 }
 
@@ -83,6 +154,18 @@ func (s *SrvConfig) OuterIpPort() string {
 	return hostPort
 }
 
+func (s *SrvConfig) tlsOptions() tlsOptions {
+	return tlsOptions{
+		certFile:     s.TlsCertFile,
+		keyFile:      s.TlsKeyFile,
+		caFile:       s.TlsCaFile,
+		clientAuth:   s.TlsClientAuth,
+		allowedPeers: s.TlsAllowedPeers,
+		isServer:     true,
+	}
+}
+
+// PeerConfig returns the erpc peer config.
 func (s *SrvConfig) PeerConfig() erpc.PeerConfig {
 	host, port, err := net.SplitHostPort(s.ListenAddress)
 	if err != nil {
@@ -104,33 +187,62 @@ func (s *SrvConfig) PeerConfig() erpc.PeerConfig {
 
 // Server server peer
 type Server struct {
-	peer   erpc.Peer
-	binder *binder.StructArgsBinder
+	peer           erpc.Peer
+	binder         *binder.StructArgsBinder
+	extraListeners []ListenerConfig
+	httpListenAddr string
+	httpFront      *httpFront
+	listeners      []net.Listener
+	closeCh        chan struct{}
+	lisMu          sync.Mutex
 }
 
 // NewServer creates a server peer.
+// Note:
+//  If no RecoveryPlugin is specified, one is registered by cfg.Recovery.
 func NewServer(cfg SrvConfig, globalLeftPlugin ...erpc.Plugin) *Server {
 	doInit()
 	if cfg.EnableHeartbeat {
 		globalLeftPlugin = append(globalLeftPlugin, heartbeat.NewPong())
 	}
+	if !hasRecoveryPlugin(globalLeftPlugin) {
+		globalLeftPlugin = append(globalLeftPlugin, NewRecoveryPlugin(cfg.Recovery.Reporters()...))
+	}
 	peer := erpc.NewPeer(cfg.PeerConfig(), globalLeftPlugin...)
 	binder := binder.NewStructArgsBinder(nil)
 	peer.PluginContainer().AppendRight(binder)
-	if len(cfg.TlsCertFile) > 0 && len(cfg.TlsKeyFile) > 0 {
-		err := peer.SetTLSConfigFromFile(cfg.TlsCertFile, cfg.TlsKeyFile)
+	if tlsOpts := cfg.tlsOptions(); tlsOpts.enabled() {
+		tlsConfig, err := newTLSConfig(tlsOpts)
 		if err != nil {
 			erpc.Fatalf("%v", err)
 		}
+		peer.SetTLSConfig(tlsConfig)
+		peer.PluginContainer().AppendRight(tlsIdentityPlugin{})
 	}
 	s := &Server{
-		peer:   peer,
-		binder: binder,
+		peer:           peer,
+		binder:         binder,
+		extraListeners: cfg.ExtraListeners,
+		httpListenAddr: cfg.HttpListenAddress,
+		closeCh:        make(chan struct{}),
+	}
+	if len(s.httpListenAddr) > 0 {
+		s.httpFront = newHttpFront(s)
 	}
 	s.SetBindErrorFunc(nil)
 	return s
 }
 
+// hasRecoveryPlugin returns whether a RecoveryPlugin is in the plugins.
+func hasRecoveryPlugin(plugins []erpc.Plugin) bool {
+	for _, plugin := range plugins {
+		if _, ok := plugin.(*RecoveryPlugin); ok {
+			return true
+		}
+	}
+	return false
+}
+
 // Peer returns the peer
 func (s *Server) Peer() erpc.Peer {
 	return s.peer
@@ -196,7 +308,29 @@ func (s *Server) SetUnknownPush(fn func(erpc.UnknownPushCtx) *erpc.Status, plugi
 }
 
 // Close closes server.
+// Note:
+//  The PreClosePlugins are executed only once, before closing the listeners.
 func (s *Server) Close() error {
+	s.lisMu.Lock()
+	select {
+	case <-s.closeCh:
+	default:
+		close(s.closeCh)
+		for _, plugin := range s.peer.PluginContainer().GetAll() {
+			if p, ok := plugin.(PreClosePlugin); ok {
+				if err := p.PreClose(); err != nil {
+					erpc.Errorf("[PreClosePlugin:%s] %s", p.Name(), err.Error())
+				}
+			}
+		}
+		for _, lis := range s.listeners {
+			lis.Close()
+		}
+		if s.httpFront != nil {
+			s.httpFront.close()
+		}
+	}
+	s.lisMu.Unlock()
 	return s.peer.Close()
 }
 
@@ -211,10 +345,104 @@ func (s *Server) GetSession(sessionId string) (erpc.Session, bool) {
 }
 
 // ListenAndServe turns on the listening service.
-func (s *Server) ListenAndServe(protoFunc ...erpc.ProtoFunc) error {
+// Note:
+//  The extra listeners are served in the background with the same router and plugins;
+//  If the proto of an extra listener is empty, protoFunc is used;
+//  If HttpListenAddress is not empty, the HTTP/JSON transcoding endpoint is served in the background;
+//  If any listener or PostListenExtraPlugin fails, the opened listeners are closed, and the error is returned.
+func (s *Server) ListenAndServe(protoFunc ...erpc.ProtoFunc) (err error) {
+	defer func() {
+		if err != nil {
+			s.closeListeners()
+		}
+	}()
+	if s.httpFront != nil {
+		lis, err := (&ListenerConfig{Network: "tcp", ListenAddress: s.httpListenAddr}).listen(s.peer.TLSConfig())
+		if err != nil {
+			return err
+		}
+		s.lisMu.Lock()
+		s.listeners = append(s.listeners, lis)
+		s.lisMu.Unlock()
+		go func() {
+			if err := s.httpFront.serve(lis); err != nil {
+				select {
+				case <-s.closeCh:
+				default:
+					erpc.Errorf("HTTP transcoding endpoint (addr:%s): %s", lis.Addr(), err.Error())
+				}
+			}
+		}()
+	}
+	for _, cfg := range s.extraListeners {
+		extraProtoFunc, err := cfg.protoFunc(protoFunc)
+		if err != nil {
+			return err
+		}
+		lis, err := cfg.listen(s.peer.TLSConfig())
+		if err != nil {
+			return err
+		}
+		s.lisMu.Lock()
+		s.listeners = append(s.listeners, lis)
+		s.lisMu.Unlock()
+		erpc.Printf("listen and serve (network:%s, addr:%s, proto:%s)", cfg.Network, lis.Addr(), cfg.Proto)
+		for _, plugin := range s.peer.PluginContainer().GetAll() {
+			if p, ok := plugin.(PostListenExtraPlugin); ok {
+				if err = p.PostListenExtra(lis.Addr(), cfg.Proto); err != nil {
+					return fmt.Errorf("[PostListenExtraPlugin:%s] network:%s, addr:%s, error:%s", p.Name(), cfg.Network, lis.Addr(), err.Error())
+				}
+			}
+		}
+		go s.serveListener(lis, extraProtoFunc)
+	}
 	return s.peer.ListenAndServe(protoFunc...)
 }
 
+// closeListeners closes the extra and HTTP listeners.
+func (s *Server) closeListeners() {
+	s.lisMu.Lock()
+	defer s.lisMu.Unlock()
+	for _, lis := range s.listeners {
+		lis.Close()
+	}
+	s.listeners = nil
+}
+
+func (s *Server) serveListener(lis net.Listener, protoFunc []erpc.ProtoFunc) {
+	var tempDelay time.Duration // how long to sleep on accept failure
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			select {
+			case <-s.closeCh:
+				return
+			default:
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				if tempDelay == 0 {
+					tempDelay = 5 * time.Millisecond
+				} else {
+					tempDelay *= 2
+				}
+				if max := 1 * time.Second; tempDelay > max {
+					tempDelay = max
+				}
+				time.Sleep(tempDelay)
+				continue
+			}
+			erpc.Errorf("accept error (network:%s, addr:%s): %s", lis.Addr().Network(), lis.Addr(), err.Error())
+			return
+		}
+		tempDelay = 0
+		go func() {
+			if _, stat := s.peer.ServeConn(conn, protoFunc...); !stat.OK() {
+				erpc.Debugf("serve conn error (network:%s, addr:%s): %s", lis.Addr().Network(), conn.RemoteAddr(), stat.String())
+			}
+		}()
+	}
+}
+
 // RangeSession ranges all sessions. If fn returns false, stop traversing.
 func (s *Server) RangeSession(fn func(sess erpc.Session) bool) {
 	s.peer.RangeSession(fn)
@@ -0,0 +1,191 @@
+package micro
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/erpc/v6/proto/jsonproto"
+)
+
+func echoHandler(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+	return *arg, nil
+}
+
+func metaHandler(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+	return string(ctx.PeekMeta(MetaCallerService)) + "|" + string(ctx.PeekMeta("X-Request-Id")) + "|" + string(ctx.PeekMeta("a")), nil
+}
+
+func TestExtraListeners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sockFile := filepath.Join(dir, "srv.sock")
+
+	srv := NewServer(SrvConfig{
+		ListenAddress: "127.0.0.1:9097",
+		ExtraListeners: []ListenerConfig{
+			{Network: "unix", ListenAddress: sockFile},
+			{Network: "tcp", ListenAddress: "127.0.0.1:9098", Proto: "json"},
+		},
+	})
+	srv.RouteCallFunc(echoHandler)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	for _, c := range []struct {
+		network   string
+		localIP   string
+		addr      string
+		protoFunc erpc.ProtoFunc
+	}{
+		{"tcp", "", "127.0.0.1:9097", nil},
+		{"unix", filepath.Join(dir, "cli.sock"), sockFile, nil},
+		{"tcp", "", "127.0.0.1:9098", jsonproto.NewJSONProtoFunc()},
+	} {
+		cli := NewClient(CliConfig{Network: c.network, LocalIP: c.localIP}, NewStaticLinker(c.addr))
+		cli.SetProtoFunc(c.protoFunc)
+		var reply string
+		stat := cli.Call("/echo_handler", "hello", &reply).Status()
+		cli.Close()
+		if !stat.OK() || reply != "hello" {
+			t.Fatalf("%s(%s): stat=%v, reply=%q", c.network, c.addr, stat, reply)
+		}
+	}
+}
+
+func TestListenFailure(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:9111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	srv := NewServer(SrvConfig{
+		ListenAddress: "127.0.0.1:9112",
+		ExtraListeners: []ListenerConfig{
+			{Network: "tcp", ListenAddress: "127.0.0.1:9113"},
+			{Network: "tcp", ListenAddress: "127.0.0.1:9111"},
+		},
+	})
+	defer srv.Close()
+	if err = srv.ListenAndServe(); err == nil {
+		t.Fatal("expect the listening error")
+	}
+	// the listener opened before the failure is closed
+	lis, err := net.Listen("tcp", "127.0.0.1:9113")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+}
+
+type failedPostListenExtra struct{}
+
+func (failedPostListenExtra) Name() string { return "failed_post_listen_extra" }
+
+func (failedPostListenExtra) PostListenExtra(net.Addr, string) error {
+	return errors.New("register failed")
+}
+
+func TestPostListenExtraFailure(t *testing.T) {
+	srv := NewServer(SrvConfig{
+		ListenAddress:  "127.0.0.1:9114",
+		ExtraListeners: []ListenerConfig{{Network: "tcp", ListenAddress: "127.0.0.1:9115"}},
+	}, failedPostListenExtra{})
+	defer srv.Close()
+	if err := srv.ListenAndServe(); err == nil || !strings.Contains(err.Error(), "register failed") {
+		t.Fatalf("expect the plugin error, got %v", err)
+	}
+	// the extra listener is closed
+	lis, err := net.Listen("tcp", "127.0.0.1:9115")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis.Close()
+}
+
+func TestHttpListenAddress(t *testing.T) {
+	srv := NewServer(SrvConfig{
+		ListenAddress:     "127.0.0.1:9099",
+		HttpListenAddress: "127.0.0.1:9100",
+	})
+	srv.RouteCallFunc(echoHandler)
+	srv.RouteCallFunc(metaHandler)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	resp, err := http.Post("http://127.0.0.1:9100/echo_handler", "application/json", strings.NewReader(`"hello"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(b) != `"hello"` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("status=%d, content-type=%q, body=%s", resp.StatusCode, resp.Header.Get("Content-Type"), b)
+	}
+
+	resp, err = http.Post("http://127.0.0.1:9100/not_found", "application/json", strings.NewReader(`"hello"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Fatalf("status=%d, body=%s", resp.StatusCode, b)
+	}
+
+	resp, err = http.Get("http://127.0.0.1:9100/echo_handler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 405 || resp.Header.Get("Allow") != "POST" {
+		t.Fatalf("status=%d, allow=%q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+
+	req, _ := http.NewRequest("POST", "http://127.0.0.1:9100/meta_handler?a=1&X-Caller-Service=admin", strings.NewReader(`""`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-Id", "r1")
+	req.Header.Set(MetaCallerService, "admin")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || string(b) != `"|r1|1"` {
+		t.Fatalf("status=%d, body=%s", resp.StatusCode, b)
+	}
+}
+
+type preCloseCounter struct{ count *int }
+
+func (p preCloseCounter) Name() string { return "pre_close_counter" }
+
+func (p preCloseCounter) PreClose() error {
+	*p.count++
+	return nil
+}
+
+func TestPreClosePlugin(t *testing.T) {
+	var count int
+	srv := NewServer(SrvConfig{ListenAddress: "127.0.0.1:9103"}, preCloseCounter{&count})
+	go srv.ListenAndServe()
+	time.Sleep(200 * time.Millisecond)
+	srv.Close()
+	srv.Close()
+	if count != 1 {
+		t.Fatalf("expect PreClose once, got %d", count)
+	}
+}
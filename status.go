@@ -14,6 +14,12 @@ var (
 	RerrNotFound = erpc.NewStatus(erpc.CodeNotFound, "Not Found", "")
 	// RerrNotOnline: User is not online
 	RerrNotOnline = erpc.NewStatus(erpc.CodeNotFound, "Not Found", "User is not online")
+	// RerrUnauthorized: Unauthorized
+	RerrUnauthorized = erpc.NewStatus(erpc.CodeUnauthorized, "Unauthorized", "")
+	// RerrForbidden: Forbidden
+	RerrForbidden = erpc.NewStatus(403, "Forbidden", "")
+	// RerrMethodNotAllowed: Method Not Allowed
+	RerrMethodNotAllowed = erpc.NewStatus(405, "Method Not Allowed", "")
 	// RerrRenderFailed: Template Rendering Failed
 	RerrRenderFailed = erpc.NewStatus(erpc.CodeInternalServerError, "Template Rendering Failed", "")
 )
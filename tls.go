@@ -0,0 +1,350 @@
+// Copyright 2018 HenryLee. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package micro
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+	"github.com/henrylee2cn/goutil"
+)
+
+// TLS client certificate verification modes of server
+const (
+	// TlsClientAuthNone does not request client certificate.
+	TlsClientAuthNone = "none"
+	// TlsClientAuthRequest requests client certificate, and verifies it if given.
+	TlsClientAuthRequest = "request"
+	// TlsClientAuthRequire requires and verifies client certificate.
+	TlsClientAuthRequire = "require"
+)
+
+// tlsReloadCheckInterval the minimum interval of checking whether TLS files are changed
+var tlsReloadCheckInterval = 5 * time.Second
+
+// tlsOptions TLS options of server or client
+type tlsOptions struct {
+	certFile     string
+	keyFile      string
+	caFile       string
+	clientAuth   string
+	allowedPeers []string
+	serverName   string
+	isServer     bool
+}
+
+func (o *tlsOptions) enabled() bool {
+	return len(o.certFile) > 0 && len(o.keyFile) > 0 || len(o.caFile) > 0
+}
+
+// newTLSConfig creates a TLS config whose certificate and CA bundle are
+// automatically reloaded when the files change on disk.
+func newTLSConfig(o tlsOptions) (*tls.Config, error) {
+	if len(o.caFile) == 0 {
+		if o.isServer && o.clientAuth != "" && o.clientAuth != TlsClientAuthNone {
+			return nil, errors.New("tls: CA file is required to verify client certificate")
+		}
+		if len(o.allowedPeers) > 0 {
+			return nil, errors.New("tls: CA file is required to verify allowed peers")
+		}
+	}
+	if o.isServer && len(o.allowedPeers) > 0 && (o.clientAuth == "" || o.clientAuth == TlsClientAuthNone) {
+		return nil, errors.New("tls: client auth mode must be request or require to verify allowed peers")
+	}
+	r, err := newTLSReloader(o.certFile, o.keyFile, o.caFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		NextProtos: []string{"http/1.1", "h2"},
+		MinVersion: tls.VersionTLS12,
+		// NOTE: If the CA bundle is specified, the certificate chain and host name are verified in VerifyConnection,
+		// so that the latest CA bundle is used.
+		InsecureSkipVerify: len(o.caFile) > 0,
+		ServerName:         o.serverName,
+	}
+	var usage x509.ExtKeyUsage
+	if o.isServer {
+		if r.cert == nil {
+			return nil, errors.New("tls: server certificate and key files are required")
+		}
+		tlsConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate(), nil
+		}
+		switch o.clientAuth {
+		case "", TlsClientAuthNone:
+			tlsConfig.ClientAuth = tls.NoClientCert
+		case TlsClientAuthRequest:
+			tlsConfig.ClientAuth = tls.RequestClientCert
+		case TlsClientAuthRequire:
+			tlsConfig.ClientAuth = tls.RequireAnyClientCert
+		default:
+			return nil, fmt.Errorf("tls: invalid client auth mode: %q", o.clientAuth)
+		}
+		usage = x509.ExtKeyUsageClientAuth
+	} else {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.certificate(); cert != nil {
+				return cert, nil
+			}
+			return new(tls.Certificate), nil
+		}
+		usage = x509.ExtKeyUsageServerAuth
+	}
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		certs := cs.PeerCertificates
+		if len(certs) == 0 {
+			// NOTE: The server requires client certificate by tls.RequireAnyClientCert,
+			// and the request mode only accepts no certificate without allow-list.
+			if len(o.allowedPeers) > 0 {
+				return errors.New("tls: peer certificate is required to verify allowed peers")
+			}
+			return nil
+		}
+		if roots := r.caPool(); roots != nil {
+			intermediates := x509.NewCertPool()
+			for _, cert := range certs[1:] {
+				intermediates.AddCert(cert)
+			}
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				Intermediates: intermediates,
+				KeyUsages:     []x509.ExtKeyUsage{usage},
+			}
+			if !o.isServer {
+				// The host name of the dial address, or the configured server name.
+				opts.DNSName = cs.ServerName
+			}
+			if _, err := certs[0].Verify(opts); err != nil {
+				return err
+			}
+		}
+		if len(o.allowedPeers) > 0 && !peerAllowed(certs[0], o.allowedPeers) {
+			return fmt.Errorf("tls: peer is not allowed: %s", certIdentity(certs[0]))
+		}
+		return nil
+	}
+	return tlsConfig, nil
+}
+
+// peerAllowed returns whether one of the URI SANs, DNS SANs or CN matches the allow-list.
+// Note:
+//  A pattern ending with '*' matches by prefix, such as 'spiffe://example.org/ns/prod/*'.
+func peerAllowed(cert *x509.Certificate, allowedPeers []string) bool {
+	names := make([]string, 0, len(cert.URIs)+len(cert.DNSNames)+1)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	names = append(names, cert.DNSNames...)
+	if cert.Subject.CommonName != "" {
+		names = append(names, cert.Subject.CommonName)
+	}
+	for _, name := range names {
+		if matchAnyPattern(allowedPeers, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// certIdentity returns the SPIFFE ID of the certificate, or the CN if there is no SPIFFE ID.
+func certIdentity(cert *x509.Certificate) string {
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			return u.String()
+		}
+	}
+	return cert.Subject.CommonName
+}
+
+type tlsReloader struct {
+	certFile, keyFile, caFile string
+	cert                      *tls.Certificate
+	roots                     *x509.CertPool
+	modTime                   time.Time
+	checkedAt                 time.Time
+	mu                        sync.RWMutex
+}
+
+func newTLSReloader(certFile, keyFile, caFile string) (*tlsReloader, error) {
+	r := &tlsReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	modTime, err := r.lastModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *tlsReloader) files() []string {
+	var files []string
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if len(f) > 0 {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (r *tlsReloader) lastModTime() (time.Time, error) {
+	var modTime time.Time
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return modTime, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func (r *tlsReloader) load(modTime time.Time) error {
+	var (
+		cert  *tls.Certificate
+		roots *x509.CertPool
+	)
+	if len(r.certFile) > 0 && len(r.keyFile) > 0 {
+		c, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+	if len(r.caFile) > 0 {
+		b, err := ioutil.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(b) {
+			return fmt.Errorf("tls: no certificate is found in CA file: %s", r.caFile)
+		}
+	}
+	r.mu.Lock()
+	r.cert = cert
+	r.roots = roots
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// reload reloads the files if they are changed on disk.
+// Note:
+//  If failed, the old certificate and CA bundle are kept.
+func (r *tlsReloader) reload() {
+	r.mu.Lock()
+	if time.Since(r.checkedAt) < tlsReloadCheckInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.checkedAt = time.Now()
+	lastModTime := r.modTime
+	r.mu.Unlock()
+	modTime, err := r.lastModTime()
+	if err != nil {
+		erpc.Errorf("tls: check files error: %s", err.Error())
+		return
+	}
+	if !modTime.After(lastModTime) {
+		return
+	}
+	if err = r.load(modTime); err != nil {
+		erpc.Errorf("tls: reload files error: %s", err.Error())
+		return
+	}
+	erpc.Infof("tls: reloaded files: %v", r.files())
+}
+
+func (r *tlsReloader) certificate() *tls.Certificate {
+	r.reload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+func (r *tlsReloader) caPool() *x509.CertPool {
+	r.reload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.roots
+}
+
+// peerIdentityKey the session swap key of the verified peer identity
+const peerIdentityKey = "micro.peer_identity"
+
+// PeerIdentity returns the verified identity of the peer, which is the SPIFFE ID or CN of the certificate.
+// For example:
+//  identity, ok := micro.PeerIdentity(ctx.Session())
+func PeerIdentity(sess interface{ Swap() goutil.Map }) (string, bool) {
+	v, ok := sess.Swap().Load(peerIdentityKey)
+	if !ok {
+		return "", false
+	}
+	return v.(string), true
+}
+
+// tlsIdentityPlugin stores the verified peer identity to the session swap.
+type tlsIdentityPlugin struct{}
+
+var (
+	_ erpc.PostAcceptPlugin = tlsIdentityPlugin{}
+	_ erpc.PostDialPlugin   = tlsIdentityPlugin{}
+)
+
+func (tlsIdentityPlugin) Name() string {
+	return "tls-identity"
+}
+
+func (tlsIdentityPlugin) PostAccept(sess erpc.PreSession) *erpc.Status {
+	return setPeerIdentity(sess)
+}
+
+func (tlsIdentityPlugin) PostDial(sess erpc.PreSession, _ bool) *erpc.Status {
+	return setPeerIdentity(sess)
+}
+
+func setPeerIdentity(sess erpc.PreSession) (stat *erpc.Status) {
+	sess.ModifySocket(func(conn net.Conn) (net.Conn, erpc.ProtoFunc) {
+		tlsConn, ok := conn.(*tls.Conn)
+		if !ok {
+			return nil, nil
+		}
+		if err := tlsConn.Handshake(); err != nil {
+			stat = RerrUnauthorized.Copy(err)
+			return nil, nil
+		}
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			sess.Swap().Store(peerIdentityKey, certIdentity(certs[0]))
+		}
+		return nil, nil
+	})
+	return stat
+}
@@ -0,0 +1,264 @@
+package micro
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrylee2cn/erpc/v6"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T, dir string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	ca := &testCA{cert: cert, key: key, dir: dir}
+	writePEM(t, filepath.Join(dir, "ca.pem"), "CERTIFICATE", der)
+	return ca
+}
+
+// issue issues a certificate, and returns the cert file and key file.
+func (ca *testCA) issue(t *testing.T, name, spiffeID string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(spiffeID)
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		URIs:         []*url.URL{u},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := filepath.Join(ca.dir, name+".pem")
+	keyFile := filepath.Join(ca.dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, filename, typ string, der []byte) {
+	b := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := ioutil.WriteFile(filename, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func identityHandler(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+	identity, _ := PeerIdentity(ctx.Session())
+	return identity, nil
+}
+
+func callerIdentityHandler(ctx erpc.CallCtx, arg *string) (string, *erpc.Status) {
+	identity, _ := callerIdentity(ctx)
+	return identity, nil
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t, dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	srvCert, srvKey := ca.issue(t, "server", "spiffe://example.org/server", 2)
+	aCert, aKey := ca.issue(t, "client-a", "spiffe://example.org/client/a", 3)
+	bCert, bKey := ca.issue(t, "client-b", "spiffe://example.org/other/b", 4)
+
+	srv := NewServer(SrvConfig{
+		ListenAddress:     "127.0.0.1:9101",
+		HttpListenAddress: "127.0.0.1:9105",
+		TlsCertFile:       srvCert,
+		TlsKeyFile:        srvKey,
+		TlsCaFile:         caFile,
+		TlsClientAuth:     TlsClientAuthRequire,
+		TlsAllowedPeers:   []string{"spiffe://example.org/client/*"},
+	})
+	srv.RouteCallFunc(identityHandler)
+	srv.RouteCallFunc(callerIdentityHandler)
+	go srv.ListenAndServe()
+	defer srv.Close()
+	time.Sleep(200 * time.Millisecond)
+
+	cliA := NewClient(CliConfig{
+		TlsCertFile:     aCert,
+		TlsKeyFile:      aKey,
+		TlsCaFile:       caFile,
+		TlsAllowedPeers: []string{"spiffe://example.org/server"},
+	}, NewStaticLinker("127.0.0.1:9101"))
+	defer cliA.Close()
+	var identity string
+	if stat := cliA.Call("/identity_handler", "", &identity).Status(); !stat.OK() {
+		t.Fatalf("client-a: %v", stat)
+	}
+	if identity != "spiffe://example.org/client/a" {
+		t.Fatalf("client-a: identity=%q", identity)
+	}
+
+	// the HTTP transcoding endpoint shares the mutual TLS
+	certPEM, _ := ioutil.ReadFile(caFile)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+	pair, err := tls.LoadX509KeyPair(aCert, aKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpCli := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{pair},
+	}}}
+	resp, err := httpCli.Post("https://127.0.0.1:9105/caller_identity_handler?X-Peer-Identity=fake", "application/json", strings.NewReader(`""`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != `"spiffe://example.org/client/a"` {
+		t.Fatalf("http: status=%d, body=%s", resp.StatusCode, b)
+	}
+
+	cliB := NewClient(CliConfig{
+		TlsCertFile: bCert,
+		TlsKeyFile:  bKey,
+		TlsCaFile:   caFile,
+	}, NewStaticLinker("127.0.0.1:9101"))
+	defer cliB.Close()
+	if stat := cliB.Call("/identity_handler", "", &identity).Status(); stat.OK() {
+		t.Fatal("client-b: expect not allowed")
+	}
+
+	cliNoCert := NewClient(CliConfig{
+		TlsCaFile: caFile,
+	}, NewStaticLinker("127.0.0.1:9101"))
+	defer cliNoCert.Close()
+	if stat := cliNoCert.Call("/identity_handler", "", &identity).Status(); stat.OK() {
+		t.Fatal("client without certificate: expect not allowed")
+	}
+
+	cliWrongName := NewClient(CliConfig{
+		TlsCertFile:   aCert,
+		TlsKeyFile:    aKey,
+		TlsCaFile:     caFile,
+		TlsServerName: "other.example.org",
+	}, NewStaticLinker("127.0.0.1:9101"))
+	defer cliWrongName.Close()
+	if stat := cliWrongName.Call("/identity_handler", "", &identity).Status(); stat.OK() {
+		t.Fatal("client with wrong server name: expect not allowed")
+	}
+}
+
+func TestTLSOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t, dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	srvCert, srvKey := ca.issue(t, "server", "spiffe://example.org/server", 2)
+	o := tlsOptions{
+		certFile:     srvCert,
+		keyFile:      srvKey,
+		caFile:       caFile,
+		allowedPeers: []string{"spiffe://example.org/client/*"},
+		isServer:     true,
+	}
+	for _, mode := range []string{"", TlsClientAuthNone} {
+		o.clientAuth = mode
+		if _, err = newTLSConfig(o); err == nil {
+			t.Fatalf("client auth %q with allowed peers: expect error", mode)
+		}
+	}
+	o.clientAuth = TlsClientAuthRequest
+	tlsConfig, err := newTLSConfig(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tlsConfig.VerifyConnection(tls.ConnectionState{}); err == nil {
+		t.Fatal("request mode without certificate: expect not allowed")
+	}
+	o.allowedPeers = nil
+	tlsConfig, err = newTLSConfig(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tlsConfig.VerifyConnection(tls.ConnectionState{}); err != nil {
+		t.Fatalf("request mode without allow-list: %v", err)
+	}
+}
+
+func TestTLSReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := newTestCA(t, dir)
+	certFile, keyFile := ca.issue(t, "server", "spiffe://example.org/server", 2)
+	r, err := newTLSReloader(certFile, keyFile, filepath.Join(dir, "ca.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(d time.Duration) { tlsReloadCheckInterval = d }(tlsReloadCheckInterval)
+	tlsReloadCheckInterval = 0
+
+	old := r.certificate()
+	ca.issue(t, "server", "spiffe://example.org/server", 5)
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	cert, err := x509.ParseCertificate(r.certificate().Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.certificate() == old || cert.SerialNumber.Int64() != 5 {
+		t.Fatalf("certificate is not reloaded, serial number: %d", cert.SerialNumber.Int64())
+	}
+}